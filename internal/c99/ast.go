@@ -9,6 +9,7 @@ package c99
 import (
 	"fmt"
 	"github.com/cznic/xc"
+	"go/scanner"
 	"go/token"
 )
 
@@ -583,6 +584,11 @@ func (n *DeclarationSpecifiersOpt) Pos() token.Pos {
 //	Declarator:
 //	        PointerOpt DirectDeclarator  // Case 0
 type Declarator struct {
+	Image            *Image
+	Linkage          Linkage
+	Static           bool
+	Type             Type
+	Typedef          bool
 	DirectDeclarator *DirectDeclarator
 	PointerOpt       *PointerOpt
 }
@@ -991,6 +997,7 @@ func (n EnumSpecifierCase) String() string {
 //	        "enum" IDENTIFIER                                     // Case EnumSpecifierTag
 //	|       "enum" IdentifierOpt '{' EnumeratorList CommaOpt '}'  // Case EnumSpecifierDefine
 type EnumSpecifier struct {
+	Type           Type
 	Case           EnumSpecifierCase
 	CommaOpt       *CommaOpt
 	EnumeratorList *EnumeratorList
@@ -1021,6 +1028,7 @@ func (n *EnumSpecifier) Pos() token.Pos {
 //	EnumerationConstant:
 //	        IDENTIFIER  // Case 0
 type EnumerationConstant struct {
+	Value *Value
 	Token xc.Token
 }
 
@@ -3004,6 +3012,7 @@ func (n StructOrUnionSpecifierCase) String() string {
 //	        StructOrUnion IDENTIFIER                                   // Case StructOrUnionSpecifierTag
 //	|       StructOrUnion IdentifierOpt '{' StructDeclarationList '}'  // Case StructOrUnionSpecifierDefine
 type StructOrUnionSpecifier struct {
+	Type                  *StructType
 	Case                  StructOrUnionSpecifierCase
 	IdentifierOpt         *IdentifierOpt
 	StructDeclarationList *StructDeclarationList
@@ -3034,6 +3043,11 @@ func (n *StructOrUnionSpecifier) Pos() token.Pos {
 //	        ExternalDeclaration                  // Case 0
 //	|       TranslationUnit ExternalDeclaration  // Case 1
 type TranslationUnit struct {
+	Diagnostics         Diagnostics
+	FileSet             *token.FileSet
+	Macros              *Macros
+	Model               Model
+	Warnings            scanner.ErrorList
 	Case                int
 	ExternalDeclaration *ExternalDeclaration
 	TranslationUnit     *TranslationUnit
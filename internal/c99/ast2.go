@@ -9,10 +9,12 @@ package c99
 import (
 	"fmt"
 	"go/token"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/cznic/ir"
+	"github.com/cznic/xc"
 )
 
 // Node represents an AST node.
@@ -22,28 +24,142 @@ type Node interface {
 
 func (n *ConstExpr) eval(ctx *context) *Value {
 	if n.Value == nil {
-		n.Value = n.Expr.eval(ctx)
+		n.Value = n.Expr.rvalue(ctx)
 	}
 	return n.Value
 }
 
+// rvalue returns the value of n after the conversions of lvalues, arrays and
+// function designators.
+func (n *Expr) rvalue(ctx *context) *Value { return n.eval(ctx).rvalue() }
+
 func (n *Expr) eval(ctx *context) *Value {
 	if n.Value != nil {
 		return n.Value
 	}
 
 	switch n.Case {
-	case ExprPreInc: // "++" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprPreDec: // "--" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+	case ExprAssign: // Expr '=' Expr
+		n.Value = n.assign(ctx, n.Expr.eval(ctx), n.Expr2.rvalue(ctx))
+	case
+		ExprAddAssign, // Expr "+=" Expr
+		ExprAndAssign, // Expr "&=" Expr
+		ExprDivAssign, // Expr "/=" Expr
+		ExprLshAssign, // Expr "<<=" Expr
+		ExprModAssign, // Expr "%=" Expr
+		ExprMulAssign, // Expr "*=" Expr
+		ExprOrAssign,  // Expr "|=" Expr
+		ExprRshAssign, // Expr ">>=" Expr
+		ExprSubAssign, // Expr "-=" Expr
+		ExprXorAssign: // Expr "^=" Expr
+		// [0]6.5.16.2-3: A compound assignment of the form E1 op = E2
+		// differs from the simple assignment expression E1 = E1 op
+		// (E2) only in that the lvalue E1 is evaluated only once.
+		a := n.Expr.eval(ctx)
+		b := a.rvalue().binary(ctx, n, compoundOps[n.Case], n.Expr2.rvalue(ctx))
+		n.Value = n.assign(ctx, a, b)
+	case ExprCall: // Expr '(' ArgumentExprListOpt ')'
+		n.Value = n.call(ctx)
+	case ExprCompLit: // '(' TypeName ')' '{' InitializerList CommaOpt '}'
+		// [0]6.5.2.5-4: A postfix expression that consists of a
+		// parenthesized type name followed by a brace-enclosed list of
+		// initializers is a compound literal. It provides an unnamed
+		// object whose value is given by the initializer list.
+		t := n.TypeName.typ(ctx)
+		if t == nil || t == Void {
+			ctx.err(n.TypeName, "invalid combination of type specifiers")
+			n.Value = &Value{Type: Undefined}
+			break
+		}
+
+		_, t = ctx.initialize(n.initializer(), t, false)
+		n.Value = &Value{Type: t, lvalue: true}
+	case
+		ExprPostDec, // Expr "--"
+		ExprPostInt, // Expr "++"
+		ExprPreDec,  // "--" Expr
+		ExprPreInc:  // "++" Expr
+		// [0]6.5.2.4-1: The operand of the postfix increment or
+		// decrement operator shall have qualified or unqualified real
+		// or pointer type and shall be a modifiable lvalue.
+		switch a := n.Expr.eval(ctx); {
+		case a.Type == Undefined:
+			n.Value = a
+		case !a.lvalue:
+			ctx.err(n, "lvalue required as increment or decrement operand")
+			n.Value = &Value{Type: Undefined}
+		case !a.isArithmeticType() && !a.isPointerType():
+			ctx.err(n, "invalid operand (%v)", a.Type)
+			n.Value = &Value{Type: Undefined}
+		default:
+			n.Value = &Value{Type: a.Type}
+		}
+	case ExprAddrof: // '&' Expr
+		// [0]6.5.3.2-1: The operand of the unary & operator shall be
+		// either a function designator, the result of a [] or unary *
+		// operator, or an lvalue that designates an object that is not
+		// a bit-field and is not declared with the register
+		// storage-class specifier.
+		switch a := n.Expr.eval(ctx); {
+		case a.Type == Undefined:
+			n.Value = a
+		case !a.lvalue:
+			ctx.err(n, "lvalue required as unary '&' operand")
+			n.Value = &Value{Type: Undefined}
+		default:
+			n.Value = a.address()
+		}
+	case ExprDeref: // '*' Expr
+		switch a := n.Expr.rvalue(ctx); {
+		case a.Type == Undefined:
+			n.Value = a
+		case !a.isPointerType():
+			ctx.err(n, "invalid type argument of unary '*' (have %v)", a.Type)
+			n.Value = &Value{Type: Undefined}
+		default:
+			n.Value = a.deref(a.Type.(*PointerType).Item, 0)
+		}
+	case ExprIndex: // Expr '[' ExprList ']'
+		// [0]6.5.2.1-2: The definition of the subscript operator [] is
+		// that E1[E2] is identical to (*((E1)+(E2))).
+		a, b := n.Expr.rvalue(ctx), n.ExprList.eval(ctx).rvalue()
+		if b.isPointerType() {
+			a, b = b, a
+		}
+		switch {
+		case a.Type == Undefined || b.Type == Undefined:
+			n.Value = &Value{Type: Undefined}
+		case !a.isPointerType() || !b.isIntegerType():
+			ctx.err(n, "subscripted value is neither array nor pointer")
+			n.Value = &Value{Type: Undefined}
+		default:
+			p := a.ptrAdd(ctx, n, b, 1)
+			if p.Type == Undefined {
+				n.Value = p
+				break
+			}
+
+			n.Value = p.deref(a.Type.(*PointerType).Item, 0)
+		}
+	case ExprSelect: // Expr '.' IDENTIFIER
+		n.Value = n.Expr.eval(ctx).selectField(ctx, n, n.Token2)
+	case ExprPSelect: // Expr "->" IDENTIFIER
+		switch a := n.Expr.rvalue(ctx); {
+		case a.Type == Undefined:
+			n.Value = a
+		case !a.isPointerType():
+			ctx.err(n, "invalid type argument of '->' (have %v)", a.Type)
+			n.Value = &Value{Type: Undefined}
+		default:
+			n.Value = a.deref(a.Type.(*PointerType).Item, 0).selectField(ctx, n, n.Token2)
+		}
 	case ExprSizeOfType: // "sizeof" '(' TypeName ')'
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = ctx.sizeof(n, n.TypeName.typ(ctx))
 	case ExprSizeofExpr: // "sizeof" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = ctx.sizeof(n, n.Expr.eval(ctx).Type)
 	case ExprNot: // '!' Expr
 		n.Value = &Value{Type: Int}
-		a := n.Expr.eval(ctx)
+		a := n.Expr.rvalue(ctx)
 		if a.isZero() {
 			n.Value.Value = &ir.Int64Value{Value: 1}
 			break
@@ -52,37 +168,86 @@ func (n *Expr) eval(ctx *context) *Value {
 		if a.isNonzero() {
 			n.Value.Value = &ir.Int64Value{Value: 0}
 		}
-	case ExprAddrof: // '&' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
 	case ExprPExprList: // '(' ExprList ')'
 		n.Value = n.ExprList.eval(ctx)
-	case ExprCompLit: // '(' TypeName ')' '{' InitializerList CommaOpt '}'
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
 	case ExprCast: // '(' TypeName ')' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprDeref: // '*' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		t := n.TypeName.typ(ctx)
+		a := n.Expr.rvalue(ctx)
+		switch {
+		case a.Type == Undefined || t == Undefined:
+			n.Value = &Value{Type: Undefined}
+		case t == Void:
+			// [0]6.5.4-2: Unless the type name specifies a void
+			// type, the type name shall specify qualified or
+			// unqualified scalar type and the operand shall have
+			// scalar type.
+			n.Value = &Value{Type: Void}
+		case t != nil && isArithmeticType[t.Kind()] && a.isArithmeticType():
+			n.Value = a.convertTo(ctx, t)
+		case t != nil && (t.Kind() == Ptr || intConvRank[t.Kind()] != 0) && (a.isPointerType() || a.isIntegerType()):
+			// [0]6.3.2.3-5,6: An integer may be converted to any
+			// pointer type. Any pointer type may be converted to an
+			// integer type.
+			n.Value = a.convertPtr(ctx, t)
+		default:
+			ctx.err(n, "invalid conversion")
+			n.Value = &Value{Type: Undefined}
+		}
 	case ExprUnaryPlus: // '+' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).unary(ctx, n, '+')
 	case ExprUnaryMinus: // '-' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).unary(ctx, n, '-')
 	case ExprCpl: // '~' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).unary(ctx, n, '~')
 	case ExprChar: // CHARCONST
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		r, _, err := unquote(string(dict.S(n.Token.Val)))
+		if err != nil || len(r) == 0 {
+			if err == nil {
+				err = fmt.Errorf("empty character constant")
+			}
+			ctx.diagnose(SeverityError, "invalid-constant", n.Pos(), "%v", err)
+			n.Value = &Value{Type: Undefined}
+			break
+		}
+
+		// [0]6.4.4.4-10: An integer character constant has type int.
+		// The value of an integer character constant containing a
+		// single character that maps to a single-byte execution
+		// character is the numerical value of the representation of
+		// the mapped character interpreted as an integer.
+		v := int64(int8(r[0]))
+		if len(r) > 1 {
+			ctx.warnPos(n.Pos(), "multi-character character constant")
+			v = 0
+			for _, c := range r {
+				v = v<<8 | int64(c)
+			}
+		}
+		n.Value = (&Value{Type: Int, Value: &ir.Int64Value{Value: v}}).normalize(ctx)
+	case ExprLChar: // LONGCHARCONST
+		r, _, err := unquote(string(dict.S(n.Token.Val)))
+		if err != nil || len(r) == 0 {
+			if err == nil {
+				err = fmt.Errorf("empty character constant")
+			}
+			ctx.diagnose(SeverityError, "invalid-constant", n.Pos(), "%v", err)
+			n.Value = &Value{Type: Undefined}
+			break
+		}
+
+		// [0]6.4.4.4-11: A wide character constant has type wchar_t.
+		n.Value = (&Value{Type: Int, Value: &ir.Int64Value{Value: int64(r[len(r)-1])}}).normalize(ctx)
 	case ExprNe: // Expr "!=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprModAssign: // Expr "%=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).ne(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprLAnd: // Expr "&&" Expr
 		n.Value = &Value{Type: Int}
-		a := n.Expr.eval(ctx)
+		a := n.Expr.rvalue(ctx)
 		if a.isZero() {
 			n.Value.Value = &ir.Int64Value{Value: 0}
 			break
 		}
 
-		b := n.Expr2.eval(ctx)
+		b := n.Expr2.rvalue(ctx)
 		if b.isZero() {
 			n.Value.Value = &ir.Int64Value{Value: 0}
 			break
@@ -91,49 +256,25 @@ func (n *Expr) eval(ctx *context) *Value {
 		if a.isNonzero() && b.isNonzero() {
 			n.Value.Value = &ir.Int64Value{Value: 1}
 		}
-	case ExprAndAssign: // Expr "&=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprMulAssign: // Expr "*=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprPostInt: // Expr "++"
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprAddAssign: // Expr "+=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprPostDec: // Expr "--"
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprSubAssign: // Expr "-=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprPSelect: // Expr "->" IDENTIFIER
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprDivAssign: // Expr "/=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
 	case ExprLsh: // Expr "<<" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprLshAssign: // Expr "<<=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).shift(ctx, n, n.Expr2.rvalue(ctx), true)
 	case ExprLe: // Expr "<=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).le(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprEq: // Expr "==" Expr
-		n.Value = n.Expr.eval(ctx).eq(ctx, n.Expr2.eval(ctx))
+		n.Value = n.Expr.rvalue(ctx).eq(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprGe: // Expr ">=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).ge(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprRsh: // Expr ">>" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprRshAssign: // Expr ">>=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprXorAssign: // Expr "^=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprOrAssign: // Expr "|=" Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).shift(ctx, n, n.Expr2.rvalue(ctx), false)
 	case ExprLOr: // Expr "||" Expr
 		n.Value = &Value{Type: Int}
-		a := n.Expr.eval(ctx)
+		a := n.Expr.rvalue(ctx)
 		if a.isNonzero() {
 			n.Value.Value = &ir.Int64Value{Value: 1}
 			break
 		}
 
-		b := n.Expr2.eval(ctx)
+		b := n.Expr2.rvalue(ctx)
 		if b.isNonzero() {
 			n.Value.Value = &ir.Int64Value{Value: 1}
 			break
@@ -143,72 +284,134 @@ func (n *Expr) eval(ctx *context) *Value {
 			n.Value.Value = &ir.Int64Value{Value: 0}
 		}
 	case ExprMod: // Expr '%' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).mod(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprAnd: // Expr '&' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprCall: // Expr '(' ArgumentExprListOpt ')'
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).and(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprMul: // Expr '*' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).mul(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprAdd: // Expr '+' Expr
-		n.Value = n.Expr.eval(ctx).add(ctx, n.Expr2.eval(ctx))
+		n.Value = n.Expr.rvalue(ctx).binary(ctx, n, '+', n.Expr2.rvalue(ctx))
 	case ExprSub: // Expr '-' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprSelect: // Expr '.' IDENTIFIER
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).binary(ctx, n, '-', n.Expr2.rvalue(ctx))
 	case ExprDiv: // Expr '/' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).div(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprLt: // Expr '<' Expr
-		n.Value = n.Expr.eval(ctx).lt(ctx, n.Expr2.eval(ctx))
-	case ExprAssign: // Expr '=' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).lt(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprGt: // Expr '>' Expr
-		n.Value = n.Expr.eval(ctx).gt(ctx, n.Expr2.eval(ctx))
+		n.Value = n.Expr.rvalue(ctx).gt(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprCond: // Expr '?' ExprList ':' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprIndex: // Expr '[' ExprList ']'
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		c := n.Expr.rvalue(ctx)
+		a, b := n.ExprList.eval(ctx).rvalue(), n.Expr2.rvalue(ctx)
+		// [0]6.5.15-6: If both the second and third operands are
+		// pointers or one is a null pointer constant and the other is a
+		// pointer, the result type is a pointer to a type qualified with
+		// all the type qualifiers of the types pointed-to by both
+		// operands. ... if one operand is a null pointer constant, the
+		// result has the type of the other operand; otherwise, one
+		// operand is a pointer to void or a qualified version of void,
+		// in which case the result type is a pointer to an
+		// appropriately qualified version of void.
+		switch {
+		case a.isArithmeticType() && b.isArithmeticType():
+			a, b = usualArithmeticConversions(ctx, n, a, b)
+		case a.isPointerType() && b.isIntegerType():
+			b = &Value{Type: a.Type, Value: b.Value}
+		case a.isIntegerType() && b.isPointerType():
+			a = &Value{Type: b.Type, Value: a.Value}
+		case a.isPointerType() && b.isPointerType() && b.Type.(*PointerType).Item == Void:
+			a = &Value{Type: b.Type, Value: a.Value, Addr: a.Addr}
+		case a.isPointerType() && b.isPointerType():
+			b = &Value{Type: a.Type, Value: b.Value, Addr: b.Addr}
+		}
+		switch {
+		case c.Type == Undefined || a.Type == Undefined || b.Type == Undefined:
+			n.Value = &Value{Type: Undefined}
+		case c.isNonzero():
+			n.Value = a
+		case c.isZero():
+			n.Value = b
+		default:
+			n.Value = &Value{Type: a.Type}
+		}
 	case ExprXor: // Expr '^' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).xor(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprOr: // Expr '|' Expr
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = n.Expr.rvalue(ctx).or(ctx, n, n.Expr2.rvalue(ctx))
 	case ExprFloat: // FLOATCONST
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		// [0]6.4.4.2-4: An unsuffixed floating constant has type
+		// double. If suffixed by the letter f or F, it has type float.
+		// If suffixed by the letter l or L, it has type long double.
+		s := string(dict.S(n.Token.Val))
+		t := Double
+		switch s[len(s)-1] {
+		case 'f', 'F':
+			t = Float
+			s = s[:len(s)-1]
+		case 'l', 'L':
+			t = LongDouble
+			s = s[:len(s)-1]
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil && err.(*strconv.NumError).Err != strconv.ErrRange {
+			ctx.err(n, "invalid floating constant")
+			n.Value = &Value{Type: Undefined}
+			break
+		}
+
+		n.Value = (&Value{Type: Double, Value: &ir.Float64Value{Value: v}}).convertTo(ctx, t)
 	case ExprIdent: // IDENTIFIER
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprInt: // INTCONST
-		s0 := string(dict.S(n.Token.Val))
-		s := s0
-	loop:
-		for i := len(s) - 1; i > 0; i-- {
-			switch s0[i] {
-			case 'l', 'L', 'u', 'U':
-				s = s[:i]
-			default:
-				break loop
+		if t := ctx.constIdents[n.Token.Val]; t != nil {
+			n.Value = &Value{Type: t}
+			break
+		}
+
+		switch x := ctx.scope.lookup(n.Token.Val).(type) {
+		case *EnumerationConstant:
+			n.Value = x.Value
+		case *Declarator:
+			if x.Typedef {
+				ctx.err(n, "unexpected type name '%s'", dict.S(n.Token.Val))
+				n.Value = &Value{Type: Undefined}
+				break
 			}
+
+			// The value is the address of the object or function.
+			n.Value = &Value{Type: x.Type, Value: &ir.Int64Value{}, Addr: x, lvalue: true}
+		default:
+			ctx.err(n, "'%s' undeclared", dict.S(n.Token.Val))
+			n.Value = &Value{Type: Undefined}
 		}
-		decadic := s == "0" || !strings.HasPrefix(s, "0")
-		v, err := strconv.ParseUint(s, 0, 64)
+	case ExprInt: // INTCONST
+		n.Value = ctx.intConst(n, string(dict.S(n.Token.Val)))
+	case ExprLString, ExprString: // LONGSTRINGLITERAL, STRINGLITERAL
+		r, wide, err := unquote(string(dict.S(n.Token.Val)))
 		if err != nil {
-			panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+			ctx.diagnose(SeverityError, "invalid-constant", n.Pos(), "%v", err)
+			n.Value = &Value{Type: Undefined}
+			break
 		}
 
-		// [0]6.4.4.1
-		switch suff := strings.ToUpper(s0[len(s):]); {
-		case suff == "" && decadic:
-			n.Value = ctx.newIntConstValue(n, v, Int, Long, LongLong)
-		case suff == "L" && decadic:
-			n.Value = ctx.newIntConstValue(n, v, Long, LongLong)
+		// [0]6.4.5-5: The multibyte character sequence is then used to
+		// initialize an array of static storage duration and length
+		// just sufficient to contain the sequence. For character string
+		// literals, the array elements have type char, and are
+		// initialized with the individual bytes of the multibyte
+		// character sequence; for wide string literals, the array
+		// elements have type wchar_t.
+		var s string
+		t := &ArrayType{Item: Char, Size: int64(len(r)) + 1}
+		switch {
+		case wide:
+			t.Item = Int
+			s = string(r)
 		default:
-			panic(fmt.Errorf("%v: TODO %q %q decadic: %v\n%s", ctx.fset.Position(n.Pos()), s, suff, decadic, PrettyString(n)))
+			b := make([]byte, len(r))
+			for i, v := range r {
+				b[i] = byte(v)
+			}
+			s = string(b)
 		}
-	case ExprLChar: // LONGCHARCONST
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprLString: // LONGSTRINGLITERAL
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
-	case ExprString: // STRINGLITERAL
-		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
+		n.Value = &Value{Type: t, Value: &ir.StringValue{StringID: ir.StringID(dict.SID(s))}, Addr: n, lvalue: true}
 	default:
 		panic(fmt.Errorf("%v: TODO\n%s", ctx.fset.Position(n.Pos()), PrettyString(n)))
 	}
@@ -217,9 +420,954 @@ func (n *Expr) eval(ctx *context) *Value {
 
 func (n *ExprList) eval(ctx *context) *Value {
 	if n.Value == nil {
+		if n.ExprList == nil {
+			n.Value = n.Expr.eval(ctx)
+			return n.Value
+		}
+
+		// [0]6.5.17-2: The left operand of a comma operator is
+		// evaluated as a void expression; ... Then the right operand
+		// is evaluated; the result has its type and value.
+		//
+		// [0]6.6-3: Constant expressions shall not contain ... comma
+		// operators.
+		var v *Value
 		for l := n; l != nil; l = l.ExprList {
-			n.Value = l.Expr.eval(ctx)
+			v = l.Expr.eval(ctx)
 		}
+		n.Value = &Value{Type: v.rvalue().Type}
 	}
 	return n.Value
 }
+
+// compoundOps maps compound assignments to their binary operators.
+var compoundOps = map[ExprCase]rune{
+	ExprAddAssign: '+',
+	ExprAndAssign: '&',
+	ExprDivAssign: '/',
+	ExprLshAssign: '<',
+	ExprModAssign: '%',
+	ExprMulAssign: '*',
+	ExprOrAssign:  '|',
+	ExprRshAssign: '>',
+	ExprSubAssign: '-',
+	ExprXorAssign: '^',
+}
+
+// [0]6.5.16-2: An assignment operator shall have a modifiable lvalue as its
+// left operand.
+//
+// [0]6.5.16-3: ... The type of an assignment expression is the type of the
+// left operand ... An assignment expression has the value of the left
+// operand after the assignment, but is not an lvalue.
+//
+// assign returns the value of the assignment of b to the lvalue a.
+func (n *Expr) assign(ctx *context, a, b *Value) *Value {
+	switch {
+	case a.Type == Undefined || b.Type == Undefined:
+		return &Value{Type: Undefined}
+	case !a.lvalue:
+		ctx.err(n, "lvalue required as left operand of assignment")
+		return &Value{Type: Undefined}
+	case a.Type.Kind() == Array || a.Type.Kind() == Function:
+		ctx.err(n, "assignment to expression with %v type", a.Type)
+		return &Value{Type: Undefined}
+	case a.isArithmeticType() && b.isArithmeticType(),
+		a.isPointerType() && (b.isPointerType() || b.isIntegerType()),
+		a.Type.Kind() == Bool && b.isPointerType(),
+		(a.Type.Kind() == Struct || a.Type.Kind() == Union) && a.Type == b.Type:
+		// [0]6.5.16.1-1
+		return &Value{Type: a.Type}
+	default:
+		ctx.err(n, "incompatible types when assigning to type %v from type %v", a.Type, b.Type)
+		return &Value{Type: Undefined}
+	}
+}
+
+// [0]6.5.2.2-1: The expression that denotes the called function shall have
+// type pointer to function returning void or returning an object type other
+// than an array type.
+//
+// call returns the value of the function call n.
+func (n *Expr) call(ctx *context) *Value {
+	if n.Expr.Case == ExprIdent && ctx.scope.lookup(n.Expr.Token.Val) == nil {
+		// Like gcc, an undeclared identifier called as a function is
+		// implicitly declared as extern int identifier().
+		ctx.warnPos(n.Expr.Pos(), "implicit declaration of function '%s'", dict.S(n.Expr.Token.Val))
+		d := &Declarator{
+			DirectDeclarator: &DirectDeclarator{Case: DirectDeclaratorIdent, Token: n.Expr.Token},
+			Linkage:          LinkageExternal,
+			Type:             &FunctionType{Result: Int},
+		}
+		s := ctx.scope
+		for s.parent != nil {
+			s = s.parent
+		}
+		s.idents[n.Expr.Token.Val] = d
+	}
+	f := n.Expr.rvalue(ctx)
+	var args []*Value
+	if o := n.ArgumentExprListOpt; o != nil {
+		for l := o.ArgumentExprList; l != nil; l = l.ArgumentExprList {
+			args = append(args, l.Expr.rvalue(ctx))
+		}
+	}
+	if f.Type == Undefined {
+		return f
+	}
+
+	p, ok := f.Type.(*PointerType)
+	if !ok || p.Item.Kind() != Function {
+		ctx.err(n, "called object is not a function")
+		return &Value{Type: Undefined}
+	}
+
+	t := p.Item.(*FunctionType)
+	// [0]6.5.2.2-2: If the expression that denotes the called function
+	// has a type that includes a prototype, the number of arguments shall
+	// agree with the number of parameters.
+	switch {
+	case t.Params == nil:
+		// nop
+	case len(args) < len(t.Params):
+		ctx.err(n, "too few arguments to function")
+	case len(args) > len(t.Params) && !t.Variadic:
+		ctx.err(n, "too many arguments to function")
+	}
+	if t.Result.Kind() == Struct || t.Result.Kind() == Union {
+		if _, err := ctx.model.Layout(t.Result.(*StructType)); err != nil {
+			ctx.err(n, "invalid use of incomplete type %v", t.Result)
+			return &Value{Type: Undefined}
+		}
+	}
+	return &Value{Type: t.Result}
+}
+
+// initializer returns the initializer of the compound literal n.
+func (n *Expr) initializer() *Initializer {
+	return &Initializer{
+		Case:            InitializerCompLit,
+		CommaOpt:        n.CommaOpt,
+		InitializerList: n.InitializerList,
+		Token:           n.Token3,
+		Token2:          n.Token4,
+	}
+}
+
+// [0]6.7.2-2: Each list of type specifiers shall be one of the following
+// sets. The specifiers are listed here in the order of specifierRank.
+var typeSpecifiers = map[string]TypeKind{
+	"_Bool":                  Bool,
+	"char":                   Char,
+	"double":                 Double,
+	"double _Complex":        DoubleComplex,
+	"float":                  Float,
+	"float _Complex":         FloatComplex,
+	"int":                    Int,
+	"long":                   Long,
+	"long double":            LongDouble,
+	"long double _Complex":   LongDoubleComplex,
+	"long int":               Long,
+	"long long":              LongLong,
+	"long long int":          LongLong,
+	"short":                  Short,
+	"short int":              Short,
+	"signed":                 Int,
+	"signed char":            SChar,
+	"signed int":             Int,
+	"signed long":            Long,
+	"signed long int":        Long,
+	"signed long long":       LongLong,
+	"signed long long int":   LongLong,
+	"signed short":           Short,
+	"signed short int":       Short,
+	"unsigned":               UInt,
+	"unsigned char":          UChar,
+	"unsigned int":           UInt,
+	"unsigned long":          ULong,
+	"unsigned long int":      ULong,
+	"unsigned long long":     ULongLong,
+	"unsigned long long int": ULongLong,
+	"unsigned short":         UShort,
+	"unsigned short int":     UShort,
+}
+
+var specifierRank = map[string]int{
+	"signed":   0,
+	"unsigned": 0,
+
+	"long":  1,
+	"short": 1,
+
+	"_Bool":  2,
+	"char":   2,
+	"double": 2,
+	"float":  2,
+	"int":    2,
+
+	"_Complex": 3,
+}
+
+// typ returns the type n names or nil if its type specifiers are not a valid
+// combination. Type qualifiers are ignored.
+func (n *TypeName) typ(ctx *context) Type {
+	t := n.SpecifierQualifierList.typ(ctx)
+	if t == nil {
+		return nil
+	}
+
+	if o := n.AbstractDeclaratorOpt; o != nil {
+		t = o.AbstractDeclarator.typ(ctx, t, false)
+	}
+	return t
+}
+
+// typ returns the type specified by the type specifiers of n or nil if they
+// are not a valid combination. Type qualifiers are ignored.
+func (n *SpecifierQualifierList) typ(ctx *context) Type {
+	var a []*TypeSpecifier
+	for l := n; l != nil; {
+		if s := l.TypeSpecifier; s != nil {
+			a = append(a, s)
+		}
+		o := l.SpecifierQualifierListOpt
+		if o == nil {
+			break
+		}
+
+		l = o.SpecifierQualifierList
+	}
+	return specifiersType(ctx, a)
+}
+
+// typ returns the type specified by the type specifiers of n, or nil if they
+// are not a valid combination, and the storage class specifier of n, if any.
+// Type qualifiers and function specifiers are ignored.
+func (n *DeclarationSpecifiers) typ(ctx *context) (Type, *StorageClassSpecifier) {
+	var a []*TypeSpecifier
+	var sc *StorageClassSpecifier
+	for l := n; l != nil; {
+		switch {
+		case l.StorageClassSpecifier == nil:
+			if s := l.TypeSpecifier; s != nil {
+				a = append(a, s)
+			}
+		case sc != nil:
+			// [0]6.7.1-2: At most, one storage-class specifier may
+			// be given in the declaration specifiers in a
+			// declaration.
+			ctx.err(l.StorageClassSpecifier, "multiple storage classes in declaration specifiers")
+		default:
+			sc = l.StorageClassSpecifier
+		}
+		o := l.DeclarationSpecifiersOpt
+		if o == nil {
+			break
+		}
+
+		l = o.DeclarationSpecifiers
+	}
+	return specifiersType(ctx, a), sc
+}
+
+// specifiersType returns the type specified by the type specifiers a or nil if
+// they are not a valid combination.
+func specifiersType(ctx *context, a []*TypeSpecifier) Type {
+	var b []string
+	var t Type
+	for _, s := range a {
+		switch s.Case {
+		case TypeSpecifierEnum:
+			if t != nil {
+				return nil
+			}
+
+			t = s.EnumSpecifier.typ(ctx)
+		case TypeSpecifierStruct:
+			if t != nil {
+				return nil
+			}
+
+			t = s.StructOrUnionSpecifier.typ(ctx)
+		case TypeSpecifierVoid:
+			if t != nil {
+				return nil
+			}
+
+			t = Void
+		case TypeSpecifierName:
+			if t != nil {
+				return nil
+			}
+
+			d, ok := ctx.scope.lookup(s.Token.Val).(*Declarator)
+			if !ok || !d.Typedef {
+				return nil
+			}
+
+			t = d.Type
+		default:
+			b = append(b, TokSrc(s.Token))
+		}
+	}
+	if t != nil {
+		if len(b) != 0 {
+			return nil
+		}
+
+		return t
+	}
+
+	sort.SliceStable(b, func(i, j int) bool {
+		return specifierRank[b[i]] < specifierRank[b[j]]
+	})
+	if k, ok := typeSpecifiers[strings.Join(b, " ")]; ok {
+		return k
+	}
+
+	return nil
+}
+
+// typ declares the enumeration constants of n, once, and returns the type of
+// n.
+func (n *EnumSpecifier) typ(ctx *context) Type {
+	if n.Type != nil {
+		return n.Type
+	}
+
+	// [0]6.7.2.2-4: Each enumerated type shall be compatible with char, a
+	// signed integer type, or an unsigned integer type.
+	n.Type = Int
+	if n.Case == EnumSpecifierTag { // "enum" IDENTIFIER
+		return n.Type
+	}
+
+	// [0]6.7.2.2-3: An enumerator with = defines its enumeration constant
+	// as the value of the constant expression. If the first enumerator
+	// has no =, the value of its enumeration constant is 0. Each
+	// subsequent enumerator with no = defines its enumeration constant as
+	// the value of the constant expression obtained by adding 1 to the
+	// value of the previous enumeration constant.
+	v := &Value{Type: Int, Value: &ir.Int64Value{}}
+	for l := n.EnumeratorList; l != nil; l = l.EnumeratorList {
+		e := l.Enumerator
+		c := e.EnumerationConstant
+		if e.Case == EnumeratorInit { // EnumerationConstant '=' ConstExpr
+			switch x := e.ConstExpr.eval(ctx); {
+			case x.Type == Undefined:
+				v = x
+			case !x.isIntegerType() || x.Value == nil:
+				ctx.err(e.ConstExpr, "enumerator value for '%s' is not an integer constant", c.Token.S())
+				v = &Value{Type: Undefined}
+			default:
+				// [0]6.7.2.2-2: The expression that defines
+				// the value of an enumeration constant shall be
+				// an integer constant expression that has a
+				// value representable as an int. Like gcc,
+				// other values keep their type.
+				v = x
+				if w := x.convertTo(ctx, Int); w.Value.(*ir.Int64Value).Value == x.Value.(*ir.Int64Value).Value {
+					v = w
+				}
+			}
+		}
+		c.Value = v
+		ctx.scope.idents[c.Token.Val] = c
+		if v.Type != Undefined {
+			v = v.add(ctx, c, &Value{Type: Int, Value: &ir.Int64Value{Value: 1}})
+		}
+	}
+	return n.Type
+}
+
+// declare types the declarators of n and declares them in the current scope.
+// The initializers of objects with static storage duration are evaluated.
+func (n *Declaration) declare(ctx *context) {
+	t, sc := n.DeclarationSpecifiers.typ(ctx)
+	if t == nil {
+		ctx.err(n.DeclarationSpecifiers, "invalid combination of type specifiers")
+		t = Undefined
+	}
+	o := n.InitDeclaratorListOpt
+	if o == nil {
+		return
+	}
+
+	for l := o.InitDeclaratorList; l != nil; l = l.InitDeclaratorList {
+		d := l.InitDeclarator.Declarator
+		d.declare(ctx, t, sc)
+		if l.InitDeclarator.Case == InitDeclaratorInit { // Declarator '=' Initializer
+			d.initialize(ctx, sc, l.InitDeclarator.Initializer)
+		}
+	}
+}
+
+// declare declares the function n defines in the current scope.
+func (n *FunctionDefinition) declare(ctx *context) {
+	t, sc := n.DeclarationSpecifiers.typ(ctx)
+	if t == nil {
+		ctx.err(n.DeclarationSpecifiers, "invalid combination of type specifiers")
+		t = Undefined
+	}
+	d := n.Declarator
+	d.declare(ctx, t, sc)
+	switch {
+	case d.Type == Undefined:
+		// nop
+	case d.Type.Kind() != Function || d.DirectDeclarator.funcDeclarator() == nil:
+		// [0]6.9.1-2: The identifier declared in a function
+		// definition (which is the name of the function) shall have a
+		// function type, as specified by the declarator portion of the
+		// function definition.
+		ctx.err(d, "declarator of a function definition does not declare a function")
+	case sc != nil && sc.Case != StorageClassSpecifierExtern && sc.Case != StorageClassSpecifierStatic:
+		// [0]6.9.1-4: The storage-class specifier, if any, in the
+		// declaration specifiers shall be either extern or static.
+		ctx.err(sc, "invalid storage class for function '%s'", d.ident().S())
+	}
+}
+
+// declareParams declares the parameters of the function n defines in the
+// current scope.
+func (n *FunctionDefinition) declareParams(ctx *context) {
+	f := n.Declarator.DirectDeclarator.funcDeclarator()
+	if f == nil || f.Case != DirectDeclaratorParamList {
+		return
+	}
+
+	for l := f.ParameterTypeList.ParameterList; l != nil; l = l.ParameterList {
+		if d := l.ParameterDeclaration.Declarator; d != nil {
+			ctx.scope.idents[d.ident().Val] = d
+		}
+	}
+}
+
+// declare sets the type, linkage and storage duration of the identifier n
+// declares, given the type t and the storage class specifier sc, if any, of
+// the declaration specifiers, and declares it in the current scope.
+func (n *Declarator) declare(ctx *context, t Type, sc *StorageClassSpecifier) {
+	nm, t := n.typ(ctx, t, false)
+	n.Type = t
+	fileScope := ctx.scope.parent == nil
+	prev, _ := ctx.scope.lookup(nm.Val).(*Declarator)
+	if prev != nil && prev.Linkage == LinkageNone {
+		prev = nil
+	}
+	class := StorageClassSpecifierCase(-1)
+	if sc != nil {
+		class = sc.Case
+	}
+	switch {
+	case class == StorageClassSpecifierTypedef:
+		n.Typedef = true
+	case class == StorageClassSpecifierStatic && fileScope:
+		// [0]6.2.2-3: If the declaration of a file scope identifier
+		// for an object or a function contains the storage-class
+		// specifier static, the identifier has internal linkage.
+		n.Linkage = LinkageInternal
+	case class == StorageClassSpecifierStatic:
+		n.Static = t.Kind() != Function
+	case class == StorageClassSpecifierExtern, t.Kind() == Function && class < 0:
+		// [0]6.2.2-4: For an identifier declared with the
+		// storage-class specifier extern in a scope in which a prior
+		// declaration of that identifier is visible, if the prior
+		// declaration specifies internal or external linkage, the
+		// linkage of the identifier at the later declaration is the
+		// same as the linkage specified at the prior declaration. If
+		// no prior declaration is visible, or if the prior declaration
+		// specifies no linkage, then the identifier has external
+		// linkage.
+		//
+		// [0]6.2.2-5: If the declaration of an identifier for a
+		// function has no storage-class specifier, its linkage is
+		// determined exactly as if it were declared with the
+		// storage-class specifier extern.
+		n.Linkage = LinkageExternal
+		if prev != nil {
+			n.Linkage = prev.Linkage
+		}
+	case fileScope:
+		// [0]6.2.2-5: If the declaration of an identifier for an
+		// object has file scope and no storage-class specifier, its
+		// linkage is external.
+		n.Linkage = LinkageExternal
+	}
+	// [0]6.2.4-3: An object whose identifier is declared with external or
+	// internal linkage, or with the storage-class specifier static has
+	// static storage duration.
+	if n.Linkage != LinkageNone && t.Kind() != Function {
+		n.Static = true
+	}
+	if x, ok := t.(*ArrayType); ok && x.Size < 0 && prev != nil {
+		if y, ok := prev.Type.(*ArrayType); ok && y.Size >= 0 {
+			n.Type = prev.Type
+		}
+	}
+	ctx.scope.idents[nm.Val] = n
+}
+
+// initialize evaluates the initializer of the object n declares with the
+// storage class specifier sc, if any. The Image of an object with static
+// storage duration is set, an array of unknown size is completed.
+func (n *Declarator) initialize(ctx *context, sc *StorageClassSpecifier, init *Initializer) {
+	switch {
+	case n.Type == Undefined:
+		return
+	case n.Typedef:
+		ctx.err(n, "typedef '%s' is initialized", n.ident().S())
+		return
+	case n.Type.Kind() == Function:
+		ctx.err(n, "function '%s' is initialized like a variable", n.ident().S())
+		return
+	case sc != nil && sc.Case == StorageClassSpecifierExtern && ctx.scope.parent != nil:
+		// [0]6.7.8-5: If the declaration of an identifier has block
+		// scope, and the identifier has external or internal linkage,
+		// the declaration shall have no initializer.
+		ctx.err(n, "'%s' has both 'extern' and initializer", n.ident().S())
+		return
+	}
+
+	n.Image, n.Type = ctx.initialize(init, n.Type, n.Static)
+}
+
+// typ returns the identifier n declares and its type, given the type t of the
+// declaration specifiers. The declarator of a parameter has param set.
+func (n *Declarator) typ(ctx *context, t Type, param bool) (xc.Token, Type) {
+	if o := n.PointerOpt; o != nil {
+		t = o.Pointer.typ(t)
+	}
+	return n.DirectDeclarator.typ(ctx, t, param)
+}
+
+// ident returns the identifier n declares.
+func (n *Declarator) ident() xc.Token { return n.DirectDeclarator.ident() }
+
+// end returns the last token of n.
+func (n *Declarator) end() xc.Token { return n.DirectDeclarator.end() }
+
+// typ returns the pointer type derived from t by n.
+func (n *Pointer) typ(t Type) Type {
+	for p := n; p != nil; p = p.Pointer {
+		t = &PointerType{t}
+	}
+	return t
+}
+
+// typ returns the identifier n declares and its type, given the type t it
+// derives from. The type qualifiers and the keyword static in an array
+// declarator are accepted only in the declaration of a parameter, param, as
+// in arrayType.
+func (n *DirectDeclarator) typ(ctx *context, t Type, param bool) (xc.Token, Type) {
+	outer := param && n.DirectDeclarator != nil && n.DirectDeclarator.Case == DirectDeclaratorIdent
+	switch n.Case {
+	case DirectDeclaratorParen: // '(' Declarator ')'
+		return n.Declarator.typ(ctx, t, param)
+	case DirectDeclaratorIdentList: // DirectDeclarator '(' IdentifierListOpt ')'
+		return n.DirectDeclarator.typ(ctx, &FunctionType{Result: t}, param)
+	case DirectDeclaratorParamList: // DirectDeclarator '(' ParameterTypeList ')'
+		params, variadic := n.ParameterTypeList.params(ctx)
+		return n.DirectDeclarator.typ(ctx, &FunctionType{Params: params, Result: t, Variadic: variadic}, param)
+	case DirectDeclaratorArraySize, DirectDeclaratorArraySize2: // DirectDeclarator '[' ... "static" ... Expr ']'
+		return n.DirectDeclarator.typ(ctx, arrayType(ctx, n.Token, t, n.Expr, true, false, outer), param)
+	case DirectDeclaratorArrayVar: // DirectDeclarator '[' TypeQualifierListOpt '*' ']'
+		return n.DirectDeclarator.typ(ctx, arrayType(ctx, n.Token, t, nil, false, true, outer), param)
+	case DirectDeclaratorArray: // DirectDeclarator '[' TypeQualifierListOpt ExprOpt ']'
+		var e *Expr
+		if o := n.ExprOpt; o != nil {
+			e = o.Expr
+		}
+		return n.DirectDeclarator.typ(ctx, arrayType(ctx, n.Token, t, e, n.TypeQualifierListOpt != nil, false, outer), param)
+	case DirectDeclaratorIdent: // IDENTIFIER
+		return n.Token, t
+	default:
+		panic("internal error")
+	}
+}
+
+// arrayType returns the array of t declared by the array declarator starting
+// at tok with the size expression e, if any. The declarator has type
+// qualifiers or the keyword static, qualified, or it is a [*] declarator,
+// star. The outer array declarator of a parameter, param, is adjusted to a
+// pointer later, so its size is not evaluated.
+func arrayType(ctx *context, tok xc.Token, t Type, e *Expr, qualified, star, param bool) Type {
+	if !param {
+		switch {
+		case star:
+			// [0]6.7.5.2-4: ... such arrays are nonetheless
+			// complete types. Such types can only be used in
+			// declarations with function prototype scope.
+			ctx.errPos(tok.Pos(), "[*] not allowed in other than function prototype scope")
+			return &ArrayType{Item: t}
+		case qualified:
+			// [0]6.7.5.2-1: The optional type qualifiers and the
+			// keyword static shall appear only in a declaration of
+			// a function parameter with an array type, and then
+			// only in the outermost array type derivation.
+			ctx.errPos(tok.Pos(), "static or type qualifiers in non-parameter array declarator")
+		}
+	}
+	r := &ArrayType{Item: t, Size: -1}
+	if e != nil && !param {
+		r.Size = ctx.arraySize(e)
+	}
+	return r
+}
+
+// ident returns the identifier n declares.
+func (n *DirectDeclarator) ident() xc.Token {
+	for {
+		switch n.Case {
+		case DirectDeclaratorIdent:
+			return n.Token
+		case DirectDeclaratorParen:
+			n = n.Declarator.DirectDeclarator
+		default:
+			n = n.DirectDeclarator
+		}
+	}
+}
+
+// funcDeclarator returns the function declarator applied directly to the
+// identifier n declares or nil if there is none.
+func (n *DirectDeclarator) funcDeclarator() *DirectDeclarator {
+	switch n.Case {
+	case DirectDeclaratorIdent:
+		return nil
+	case DirectDeclaratorParen:
+		return n.Declarator.DirectDeclarator.funcDeclarator()
+	case DirectDeclaratorIdentList, DirectDeclaratorParamList:
+		d := n.DirectDeclarator
+		for d.Case == DirectDeclaratorParen && d.Declarator.PointerOpt == nil {
+			d = d.Declarator.DirectDeclarator
+		}
+		if d.Case == DirectDeclaratorIdent {
+			return n
+		}
+	}
+	return n.DirectDeclarator.funcDeclarator()
+}
+
+// end returns the last token of n.
+func (n *DirectDeclarator) end() xc.Token {
+	switch n.Case {
+	case DirectDeclaratorArraySize, DirectDeclaratorArraySize2, DirectDeclaratorArrayVar:
+		return n.Token3
+	case DirectDeclaratorIdent:
+		return n.Token
+	default:
+		return n.Token2
+	}
+}
+
+// typ returns the type derived from t by n. The abstract declarator of a
+// parameter has param set, as in DirectDeclarator.typ.
+func (n *AbstractDeclarator) typ(ctx *context, t Type, param bool) Type {
+	switch n.Case {
+	case AbstractDeclaratorPointer: // Pointer
+		return n.Pointer.typ(t)
+	case AbstractDeclaratorAbstract: // PointerOpt DirectAbstractDeclarator
+		if o := n.PointerOpt; o != nil {
+			t = o.Pointer.typ(t)
+		}
+		return n.DirectAbstractDeclarator.typ(ctx, t, param)
+	default:
+		panic("internal error")
+	}
+}
+
+// typ returns the type derived from t by n.
+func (n *DirectAbstractDeclarator) typ(ctx *context, t Type, param bool) Type {
+	var d *DirectAbstractDeclarator
+	if o := n.DirectAbstractDeclaratorOpt; o != nil {
+		d = o.DirectAbstractDeclarator
+	}
+	outer := param && d == nil
+	switch n.Case {
+	case DirectAbstractDeclaratorAbstract: // '(' AbstractDeclarator ')'
+		return n.AbstractDeclarator.typ(ctx, t, param)
+	case DirectAbstractDeclaratorParamList: // '(' ParameterTypeListOpt ')'
+		return functionType(ctx, t, n.ParameterTypeListOpt)
+	case DirectAbstractDeclaratorDFn: // DirectAbstractDeclarator '(' ParameterTypeListOpt ')'
+		return n.DirectAbstractDeclarator.typ(ctx, functionType(ctx, t, n.ParameterTypeListOpt), param)
+	case DirectAbstractDeclaratorDArrSize, DirectAbstractDeclaratorDArrSize2: // DirectAbstractDeclaratorOpt '[' ... "static" ... Expr ']'
+		t = arrayType(ctx, n.Token, t, n.Expr, true, false, outer)
+	case DirectAbstractDeclaratorDArrVL: // DirectAbstractDeclaratorOpt '[' '*' ']'
+		t = arrayType(ctx, n.Token, t, nil, false, true, outer)
+	case DirectAbstractDeclaratorDArr, DirectAbstractDeclaratorDArr2: // DirectAbstractDeclaratorOpt '[' TypeQualifierList? ExprOpt ']'
+		var e *Expr
+		if o := n.ExprOpt; o != nil {
+			e = o.Expr
+		}
+		t = arrayType(ctx, n.Token, t, e, n.TypeQualifierList != nil, false, outer)
+	default:
+		panic("internal error")
+	}
+	if d != nil {
+		return d.typ(ctx, t, param)
+	}
+
+	return t
+}
+
+// functionType returns the type of a function returning t with the
+// parameters o, if any.
+func functionType(ctx *context, t Type, o *ParameterTypeListOpt) Type {
+	if o == nil {
+		return &FunctionType{Result: t}
+	}
+
+	params, variadic := o.ParameterTypeList.params(ctx)
+	return &FunctionType{Params: params, Result: t, Variadic: variadic}
+}
+
+// params returns the types of the parameters n declares and whether the
+// function is variadic.
+func (n *ParameterTypeList) params(ctx *context) (r []Type, variadic bool) {
+	var void bool
+	for l := n.ParameterList; l != nil; l = l.ParameterList {
+		d := l.ParameterDeclaration
+		t := d.typ(ctx)
+		void = d.Case == ParameterDeclarationAbstract && d.AbstractDeclaratorOpt == nil && t == Void
+		r = append(r, t)
+	}
+	// [0]6.7.5.3-10: The special case of an unnamed parameter of type void
+	// as the only item in the list specifies that the function has no
+	// parameters.
+	if len(r) == 1 && void {
+		r = r[:0]
+	}
+	return r, n.Case == ParameterTypeListDots
+}
+
+// typ returns the adjusted type of the parameter n declares. The type of its
+// declarator, if any, is set.
+func (n *ParameterDeclaration) typ(ctx *context) Type {
+	t, sc := n.DeclarationSpecifiers.typ(ctx)
+	if sc != nil && sc.Case != StorageClassSpecifierRegister {
+		// [0]6.7.5.3-2: The only storage-class specifier that shall
+		// occur in a parameter declaration is register.
+		ctx.err(sc, "storage class specified for parameter")
+	}
+	if t == nil {
+		ctx.err(n.DeclarationSpecifiers, "invalid combination of type specifiers")
+		t = Undefined
+	}
+	switch n.Case {
+	case ParameterDeclarationAbstract: // DeclarationSpecifiers AbstractDeclaratorOpt
+		if o := n.AbstractDeclaratorOpt; o != nil {
+			t = o.AbstractDeclarator.typ(ctx, t, true)
+		}
+	case ParameterDeclarationDeclarator: // DeclarationSpecifiers Declarator
+		_, t = n.Declarator.typ(ctx, t, true)
+	}
+	// [0]6.7.5.3-7: A declaration of a parameter as "array of type" shall
+	// be adjusted to "qualified pointer to type".
+	//
+	// [0]6.7.5.3-8: A declaration of a parameter as "function returning
+	// type" shall be adjusted to "pointer to function returning type".
+	switch x := t.(type) {
+	case *ArrayType:
+		t = &PointerType{x.Item}
+	case *FunctionType:
+		t = &PointerType{x}
+	}
+	if d := n.Declarator; d != nil {
+		d.Type = t
+	}
+	return t
+}
+
+// typ returns the type n specifies. Struct and union types are computed once,
+// when first needed, so n.Type is set by typ.
+func (n *StructOrUnionSpecifier) typ(ctx *context) *StructType {
+	if n.Type != nil {
+		return n.Type
+	}
+
+	union := n.StructOrUnion.Case == StructOrUnionUnion
+	if n.Case == StructOrUnionSpecifierTag { // StructOrUnion IDENTIFIER
+		n.Type = ctx.scope.lookupTag(ctx, n.Token, union).typ
+		return n.Type
+	}
+
+	// StructOrUnion IdentifierOpt '{' StructDeclarationList '}'
+	t := &StructType{Incomplete: true, Union: union}
+	if o := n.IdentifierOpt; o != nil {
+		switch x := ctx.scope.declareTag(ctx, o.Token, union); {
+		case x.def != nil:
+			// [0]6.7.2.3-1: A specific type shall have its content
+			// defined at most once.
+			ctx.errPos(o.Token.Pos(), "redefinition of %v", x.typ)
+			t.Tag = x.typ.Tag
+		default:
+			x.def = n
+			t = x.typ
+		}
+	}
+	n.Type = t
+	for _, pos := range []token.Pos{n.StructOrUnion.Token.Pos(), n.Token2.Pos()} {
+		if a := ctx.attributes[pos]; a != nil {
+			t.Packed = t.Packed || a.packed
+			if a.aligned > t.Align {
+				t.Align = a.aligned
+			}
+			if a.pack != 0 {
+				t.Pack = a.pack
+			}
+		}
+	}
+	names := map[int]struct{}{}
+	flexible := -1
+	for l := n.StructDeclarationList; l != nil; l = l.StructDeclarationList {
+		d := l.StructDeclaration
+		ft := d.SpecifierQualifierList.typ(ctx)
+		if ft == nil {
+			ctx.err(d.SpecifierQualifierList, "invalid combination of type specifiers")
+			continue
+		}
+
+		for l := d.StructDeclaratorList; l != nil; l = l.StructDeclaratorList {
+			f, nm, ok := l.StructDeclarator.field(ctx, ft)
+			if !ok {
+				continue
+			}
+
+			if nm.Rune != 0 {
+				if _, ok := names[nm.Val]; ok {
+					ctx.errPos(nm.Pos(), "duplicate member %q", f.Name)
+				}
+				names[nm.Val] = struct{}{}
+			}
+			if x, ok := f.Type.(*ArrayType); ok && x.Size < 0 && flexible < 0 {
+				flexible = len(t.Fields)
+				switch _, err := ctx.model.Sizeof(x.Item); {
+				case err != nil:
+					ctx.errPos(nm.Pos(), "field %q has incomplete type", f.Name)
+				case t.Union:
+					ctx.errPos(nm.Pos(), "flexible array member in union")
+				}
+			}
+			t.Fields = append(t.Fields, f)
+		}
+	}
+	switch {
+	case flexible < 0:
+		// nop
+	case flexible != len(t.Fields)-1:
+		// [0]6.7.2.1-16: As a special case, the last element of a
+		// structure with more than one named member may have an
+		// incomplete array type; this is called a flexible array
+		// member.
+		ctx.err(n, "flexible array member not at end of struct")
+	case len(names) == 1 && !t.Union:
+		ctx.err(n, "flexible array member in a struct with no named members")
+	}
+	t.Incomplete = false
+	return t
+}
+
+// field returns the member n declares, its identifier, if any, and whether
+// the member is valid. The type of the declaration specifiers is t.
+func (n *StructDeclarator) field(ctx *context, t Type) (f Field, nm xc.Token, ok bool) {
+	var d *Declarator
+	switch n.Case {
+	case StructDeclaratorBase: // Declarator
+		d = n.Declarator
+	case StructDeclaratorBits: // DeclaratorOpt ':' ConstExpr
+		if o := n.DeclaratorOpt; o != nil {
+			d = o.Declarator
+		}
+		f.BitField = true
+	}
+	if d != nil {
+		nm, t = d.typ(ctx, t, false)
+		f.Name = string(nm.S())
+		if a := ctx.attributes[d.end().Pos()]; a != nil {
+			f.Align = a.aligned
+			f.Packed = a.packed
+		}
+	}
+	f.Type = t
+	s := f.Name
+	if s == "" {
+		s = "<anonymous>"
+	}
+	if t.Kind() == Function {
+		// [0]6.7.2.1-2: A structure or union shall not contain a
+		// member with incomplete or function type ...
+		ctx.err(n, "field %q declared as a function", s)
+		return f, nm, false
+	}
+
+	sz, err := ctx.model.Sizeof(t)
+	if !f.BitField {
+		if x, ok := t.(*ArrayType); ok && x.Size < 0 {
+			return f, nm, true // Checked by the caller.
+		}
+
+		if err != nil {
+			ctx.err(n, "field %q has incomplete type", s)
+			return f, nm, false
+		}
+
+		return f, nm, true
+	}
+
+	// [0]6.7.2.1-4: A bit-field shall have a type that is a qualified or
+	// unqualified version of _Bool, signed int, unsigned int, or some
+	// other implementation-defined type.
+	if intConvRank[t.Kind()] == 0 || err != nil {
+		ctx.err(n, "bit-field %q has invalid type", s)
+		return f, nm, false
+	}
+
+	v := n.ConstExpr.eval(ctx)
+	if v.Type == Undefined {
+		return f, nm, false
+	}
+
+	x, ok := v.Value.(*ir.Int64Value)
+	if !v.isIntegerType() || !ok {
+		ctx.err(n.ConstExpr, "integer constant expression required")
+		return f, nm, false
+	}
+
+	// [0]6.7.2.1-3: The expression that specifies the width of a
+	// bit-field shall be an integer constant expression with a
+	// nonnegative value that does not exceed the width of an object of
+	// the type that would be specified were the colon and expression
+	// omitted. If the value is zero, the declaration shall have no
+	// declarator.
+	switch w := x.Value; {
+	case v.isSigned() && w < 0:
+		ctx.err(n.ConstExpr, "negative width in bit-field %q", s)
+	case uint64(w) > uint64(8*sz):
+		ctx.err(n.ConstExpr, "width of %q exceeds its type", s)
+	case w == 0 && d != nil:
+		ctx.err(n.ConstExpr, "zero width for bit-field %q", s)
+	default:
+		f.Bits = int(w)
+		return f, nm, true
+	}
+	return f, nm, false
+}
+
+// check verifies the constant expression of a case label.
+func (n *LabeledStmt) check(ctx *context) {
+	if n.Case != LabeledStmtSwitchCase {
+		return
+	}
+
+	// [0]6.8.4.2-3: The expression of each case label shall be an integer
+	// constant expression and no two of the case constant expressions in
+	// the same switch statement shall have the same value after
+	// conversion.
+	v := n.ConstExpr.eval(ctx)
+	if v.Type == Undefined {
+		return
+	}
+
+	if _, ok := v.Value.(*ir.Int64Value); !ok || !v.isIntegerType() || v.Addr != nil {
+		ctx.err(n.ConstExpr, "case label does not reduce to an integer constant")
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package c99
+
+// builtin declares the compiler provided types and functions the system
+// headers refer to. Like gcc's <stdarg.h>, a va_list is a __builtin_va_list
+// and va_start, va_arg, va_copy and va_end expand to their __builtin_
+// counterparts.
+//
+// A va_list points to the variadic arguments of a call, stored in consecutive
+// 8 byte slots after the default argument promotions, each at the start of
+// its slot. __builtin_va_args, which can be called only in a variadic
+// function, returns the address of the first slot. The type of va_arg must
+// become a pointer type by appending a *, so a function pointer type must be
+// named by a typedef.
+const builtin = `
+typedef char *__builtin_va_list;
+char *__builtin_va_args(void);
+#define __builtin_va_start(ap, last) ((void)((ap) = __builtin_va_args()))
+#define __builtin_va_arg(ap, type) (*(type *)(((ap) += 8) - 8))
+#define __builtin_va_copy(dest, src) ((void)((dest) = (src)))
+#define __builtin_va_end(ap) ((void)0)
+`
+
+var idBuiltinVaArgs = dict.SID("__builtin_va_args")
+
+// NewBuiltinSource returns a Source with the builtin declarations. It should
+// be the first source passed to Translate.
+func NewBuiltinSource() Source { return newStringSource("<builtin>", builtin) }
@@ -4,11 +4,12 @@
 
 //go:generate golex -o trigraphs.go trigraphs.l
 //go:generate golex -o scanner.go scanner.l
-//go:generate yy -kind Case -o parser.y -astImport "\"github.com/cznic/xc\";\"go/token\";\"fmt\"" -prettyString PrettyString parser.yy
+//go:generate yy -kind Case -o parser.y -astImport "\"github.com/cznic/xc\";\"go/scanner\";\"go/token\";\"fmt\"" -prettyString PrettyString parser.yy
 //go:generate goyacc -o /dev/null -xegen xegen parser.y
 //go:generate goyacc -o parser.go -fs -xe xegen -dlvalf "%v" -dlval "PrettyString(lval.Token)" parser.y
 //go:generate rm -f xegen
-//go:generate stringer -output enum_string.go -type=TypeKind,condValue enum.go type.go
+//go:generate go run mkwalk.go
+//go:generate stringer -output enum_string.go -trimprefix=Severity -type=TypeKind,Severity,Linkage,condValue enum.go type.go
 //go:generate sh -c "go test -run ^Example |fe"
 //go:generate gofmt -l -s -w .
 
@@ -16,43 +17,153 @@
 //
 // This package is a modification of[1] supporting only SQLite.
 //
+// The values of identifiers, literals and other tokens are interned in the
+// process-global xc.Dict, through which xc.Token.S, the String methods of the
+// AST nodes and package ir resolve them. xc.Dict never shrinks, so a process
+// translating many different sources keeps every token value it has seen.
+// Only the preprocessing lines and the macro definitions belong to a
+// translation, or to its Tweaks.Cache, and are released together with it.
+//
+// Translations running concurrently share xc.Dict, which is safe for
+// concurrent use. Everything else a translation modifies is owned by it,
+// except for a Tweaks.Cache, which is locked on its own, see Translate.
+//
 //  [0]: http://www.open-std.org/jtc1/sc22/wg14/www/docs/n1256.pdf
 //  [1]: https://github.com/cznic/cc
 package c99
 
 import (
 	"bufio"
-	"fmt"
-	"go/scanner"
 	"go/token"
 	"io"
 	"math/bits"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/cznic/ir"
+	"github.com/cznic/xc"
 )
 
-type tweaks struct {
-	cppExpandTest   bool // Fake includes
-	enableTrigraphs bool
-	injectFinalNL   bool
+// Tweaks amend the behavior of the translator.
+type Tweaks struct {
+	// Replace trigraph sequences, [0]5.2.1.1.
+	EnableTrigraphs bool
+
+	// Do not report trigraph sequences found outside of comments. When
+	// trigraphs are enabled the warnings report the conversions,
+	// otherwise they report ignored trigraphs. Cf. gcc -Wtrigraphs.
+	DisableTrigraphWarnings bool
+
+	// Attach comments to macro definitions, see Macro.Doc and
+	// Macro.Comment.
+	MacroComments bool
+
+	// Record the macro expansions producing the preprocessed tokens.
+	// Syntax errors in tokens produced by macro expansion then list the
+	// expansions, cf. gcc's "in expansion of macro" notes.
+	TrackExpansions bool
+
+	// If not nil, TraceExpansions is called for every preprocessed token,
+	// in order, with the innermost macro expansion producing the token or
+	// nil. Setting TraceExpansions implies TrackExpansions.
+	TraceExpansions func(tok xc.Token, e *Expansion)
+
+	// If not nil, preprocessing is memoized in Cache and the translation
+	// uses Cache.FileSet. Cache is not used when TrackExpansions,
+	// TraceExpansions or MacroComments are set.
+	Cache *Cache
+
+	cppExpandTest bool // Fake includes
+	injectFinalNL bool
 }
 
+func (t *Tweaks) trackExpansions() bool { return t.TrackExpansions || t.TraceExpansions != nil }
+
 // Translation unit context.
 type context struct {
-	errors          scanner.ErrorList
+	attributes      map[token.Pos]*attributes // Keyed by the position of the preceding token.
+	comments        []comment                 // If tweaks.MacroComments.
+	constIdents     map[int]Type              // Identifiers of known type, like macro parameters.
+	diagnostics     Diagnostics
 	exampleAST      interface{}
 	exampleRule     int
 	fset            *token.FileSet
 	includePaths    []string
+	lines           *tokenStore // Tokens of preprocessing lines.
 	model           Model
 	sysIncludePaths []string
-	tweaks          *tweaks
+	scope           *scope
+	tweaks          *Tweaks
 }
 
-func newContext(fset *token.FileSet, t *tweaks) (*context, error) {
+// scope maps the ordinary identifiers and the struct and union tags declared
+// in the translation unit or in a block to their declarations. Function
+// definitions and compound statements open nested scopes.
+type scope struct {
+	idents map[int]Node // *Declarator or *EnumerationConstant.
+	parent *scope
+	tags   map[int]*tag
+}
+
+type tag struct {
+	def *StructOrUnionSpecifier // Nil if the type is not yet defined.
+	typ *StructType
+}
+
+func newScope(parent *scope) *scope { return &scope{map[int]Node{}, parent, map[int]*tag{}} }
+
+// declareTag returns the tag t of the innermost scope, declaring it if
+// necessary.
+func (s *scope) declareTag(ctx *context, t xc.Token, union bool) *tag {
+	x := s.tags[t.Val]
+	if x == nil {
+		x = &tag{typ: &StructType{Incomplete: true, Tag: string(t.S()), Union: union}}
+		s.tags[t.Val] = x
+	}
+	if x.typ.Union != union {
+		// [0]6.7.2.3-2: Where two declarations that use the same tag
+		// declare the same type, they shall both use the same choice of
+		// struct, union, or enum.
+		ctx.errPos(t.Pos(), "%s defined as wrong kind of tag", t.S())
+	}
+	return x
+}
+
+// lookupTag returns the tag t visible in s, declaring it in s if there is
+// none.
+func (s *scope) lookupTag(ctx *context, t xc.Token, union bool) *tag {
+	for p := s; p != nil; p = p.parent {
+		if _, ok := p.tags[t.Val]; ok {
+			return p.declareTag(ctx, t, union)
+		}
+	}
+	return s.declareTag(ctx, t, union)
+}
+
+// lookup returns the declaration of the ordinary identifier id visible in s
+// or nil if there is none.
+func (s *scope) lookup(id int) Node {
+	for p := s; p != nil; p = p.parent {
+		if n, ok := p.idents[id]; ok {
+			return n
+		}
+	}
+	return nil
+}
+
+type comment struct {
+	end  token.Pos
+	own  bool // Nothing but white space precedes the comment on its line.
+	pos  token.Pos
+	text string
+}
+
+func newContext(fset *token.FileSet, t *Tweaks) (*context, error) {
 	return &context{
 		fset:   fset,
+		lines:  newTokenStore(),
+		scope:  newScope(nil),
 		tweaks: t,
 	}, nil
 }
@@ -69,38 +180,362 @@ func (c *context) toC(ch rune, val int) rune {
 	return ch
 }
 
-func (c *context) err(n Node, msg string, args ...interface{}) { c.errPos(n.Pos(), msg, args...) }
+func (c *context) err(n Node, msg string, args ...interface{}) *Diagnostic {
+	return c.errPos(n.Pos(), msg, args...)
+}
+
+func (c *context) errPos(pos token.Pos, msg string, args ...interface{}) *Diagnostic {
+	return c.diagnose(SeverityError, "", pos, msg, args...)
+}
 
-func (c *context) errPos(pos token.Pos, msg string, args ...interface{}) {
-	c.errors.Add(c.fset.PositionFor(pos, true), fmt.Sprintf(msg, args...))
+func (c *context) warnPos(pos token.Pos, msg string, args ...interface{}) *Diagnostic {
+	return c.diagnose(SeverityWarning, "", pos, msg, args...)
 }
 
+// error returns the sorted diagnostics, if any of them is an error.
 func (c *context) error() error {
-	if len(c.errors) == 0 {
+	if c.diagnostics.Count(SeverityError) == 0 {
 		return nil
 	}
 
-	c.errors.Sort()
-	err := append(scanner.ErrorList(nil), c.errors...)
-	return err
+	c.diagnostics.Sort()
+	return append(Diagnostics(nil), c.diagnostics...)
+}
+
+// parse parses preprocessed tokens as a translation unit. The exps argument
+// is nil or it has the expansion producing each token.
+func (c *context) parse(toks []xc.Token, exps []*Expansion) (*TranslationUnit, error) {
+	lx, err := newLexer(c, "", 0, nullReader{})
+	if err != nil {
+		return nil, err
+	}
+
+	toks, exps = concatStrings(toks, exps)
+	if f := c.tweaks.TraceExpansions; f != nil {
+		for i, v := range toks {
+			f(v, exps[i])
+		}
+	}
+	lx.expansions = exps
+	lx.ungets(toks...)
+	if !lx.parseC() {
+		return nil, c.error()
+	}
+
+	if err := c.error(); err != nil {
+		return nil, err
+	}
+
+	return lx.ast.(*TranslationUnit).reverse(), nil
 }
 
-func (c context) newIntConstValue(n Node, v uint64, t ...TypeKind) (r *Value) {
-	r = &Value{Type: Undefined}
+// [0]5.1.1.2-1.6: Adjacent string literal tokens are concatenated.
+//
+// The concatenated token keeps the source form of its parts, separated by a
+// space, so it can be printed back unchanged. The exps argument, if not nil,
+// has the expansion producing each token and it is compacted to match the
+// result.
+func concatStrings(toks []xc.Token, exps []*Expansion) ([]xc.Token, []*Expansion) {
+	w := 0
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if exps != nil {
+			exps[w] = exps[i]
+		}
+		switch t.Rune {
+		case ' ', '\n':
+			continue
+		case STRINGLITERAL, LONGSTRINGLITERAL:
+			var a []string
+			j := i + 1
+		loop:
+			for ; j < len(toks); j++ {
+				switch u := toks[j]; u.Rune {
+				case ' ', '\n':
+					// nop
+				case STRINGLITERAL, LONGSTRINGLITERAL:
+					if a == nil {
+						a = append(a, TokSrc(t))
+					}
+					a = append(a, TokSrc(u))
+					if u.Rune == LONGSTRINGLITERAL {
+						t.Rune = LONGSTRINGLITERAL
+					}
+				default:
+					break loop
+				}
+			}
+			if a != nil {
+				t.Val = dict.SID(strings.Join(a, " "))
+				i = j - 1
+			}
+		}
+		toks[w] = t
+		w++
+	}
+	if exps != nil {
+		exps = exps[:w]
+	}
+	return toks[:w], exps
+}
+
+// [0]6.4.4.1-5: The type of an integer constant is the first of the
+// corresponding list in which its value can be represented.
+var intConstTypes = map[string][2][]TypeKind{ // suffix: {decimal, octal or hexadecimal}
+	"": {
+		{Int, Long, LongLong},
+		{Int, UInt, Long, ULong, LongLong, ULongLong},
+	},
+	"U": {
+		{UInt, ULong, ULongLong},
+		{UInt, ULong, ULongLong},
+	},
+	"L": {
+		{Long, LongLong},
+		{Long, ULong, LongLong, ULongLong},
+	},
+	"UL": {
+		{ULong, ULongLong},
+		{ULong, ULongLong},
+	},
+	"LL": {
+		{LongLong},
+		{LongLong, ULongLong},
+	},
+	"ULL": {
+		{ULongLong},
+		{ULongLong},
+	},
+}
+
+func (c *context) intConst(n Node, s0 string) *Value {
+	s := strings.TrimRight(s0, "lLuU")
+	suff := strings.ToUpper(s0[len(s):])
+	switch suff {
+	case "LU":
+		suff = "UL"
+	case "LLU":
+		suff = "ULL"
+	}
+	types, ok := intConstTypes[suff]
+	if !ok || strings.Contains(s0[len(s):], "lL") || strings.Contains(s0[len(s):], "Ll") {
+		c.err(n, "invalid suffix %q on integer constant", s0[len(s):])
+		return &Value{Type: Undefined}
+	}
+
+	base, decimal := 10, true
+	switch {
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		base, decimal = 16, false
+		s = s[2:]
+	case len(s) > 1 && s[0] == '0':
+		base, decimal = 8, false
+		s = s[1:]
+	}
+	v, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		if err.(*strconv.NumError).Err == strconv.ErrRange {
+			c.err(n, "integer constant is too large")
+			return &Value{Type: Undefined}
+		}
+
+		c.err(n, "invalid integer constant")
+		return &Value{Type: Undefined}
+	}
+
+	list := types[1]
+	if decimal {
+		list = types[0]
+	}
 	b := bits.Len64(v)
-	for _, t := range t {
-		if c.model[t].Size*8 >= b {
-			return &Value{t, &ir.Int64Value{Value: int64(v)}}
+	for _, t := range list {
+		sz := 8 * c.model[t].Size
+		if isSigned[t] {
+			sz--
+		}
+		if b <= sz {
+			return &Value{Type: t, Value: &ir.Int64Value{Value: int64(v)}}
 		}
 	}
 
-	c.err(n, "invalid integer constant")
+	c.err(n, "integer constant is too large")
 	return &Value{Type: Undefined}
 }
 
+// [0]6.5.3.4-4: The value of the result is implementation-defined, and its
+// type (an unsigned integer type) is size_t, defined in <stddef.h>.
+func (c *context) sizeof(n Node, t Type) *Value {
+	if t == Undefined {
+		return &Value{Type: Undefined}
+	}
+
+	if t == nil || t == Void {
+		c.err(n, "invalid application of sizeof")
+		return &Value{Type: Undefined}
+	}
+
+	sz, err := c.model.Sizeof(t)
+	if err != nil {
+		c.err(n, "invalid application of sizeof: %v", err)
+		return &Value{Type: Undefined}
+	}
+
+	return &Value{Type: ULong, Value: &ir.Int64Value{Value: sz}}
+}
+
+// arraySize returns the value of the array size expression n.
+func (c *context) arraySize(n *Expr) int64 {
+	v := n.rvalue(c)
+	if v.Type == Undefined {
+		return 0
+	}
+
+	x, ok := v.Value.(*ir.Int64Value)
+	if !v.isIntegerType() || !ok {
+		c.err(n, "integer constant expression required")
+		return 0
+	}
+
+	// [0]6.7.5.2-1: If the expression is a constant expression, it shall
+	// have a value greater than zero.
+	switch {
+	case v.isSigned() && x.Value < 0:
+		c.err(n, "size of array is negative")
+		return 0
+	case x.Value < 0:
+		c.err(n, "size of array is too large")
+		return 0
+	}
+
+	return x.Value
+}
+
 func (c context) position(n Node) token.Position { return c.fset.PositionFor(n.Pos(), true) }
 
+// Translate preprocesses and parses a translation unit using includePaths and
+// sysIncludePaths for looking for "foo.h" and <foo.h> files. A special path
+// "@" is interpreted as 'the same directory as where the file with the
+// #include is'. The input consists of sources which must include any
+// predefined/builtin stuff.
+//
+// On failure the error is Diagnostics holding all the errors, warnings and
+// notes of the translation. On success they are in
+// TranslationUnit.Diagnostics.
+//
+// Translate may be called concurrently by multiple goroutines. Concurrent
+// translations may share tweaks, including Tweaks.Cache, but not sources.
+func Translate(tweaks *Tweaks, includePaths, sysIncludePaths []string, sources ...Source) (*TranslationUnit, error) {
+	if tweaks == nil {
+		tweaks = &Tweaks{}
+	}
+
+	model, err := newModel()
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	if tweaks.Cache != nil {
+		fset = tweaks.Cache.fset
+	}
+	ctx, err := newContext(fset, tweaks)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.includePaths = includePaths
+	ctx.model = model
+	ctx.sysIncludePaths = sysIncludePaths
+	c := newCPP(ctx)
+	r, err := c.parse(sources...)
+	if err != nil {
+		return nil, err
+	}
+
+	var w tokenBuffer
+	if err := c.eval(r, &w); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.error(); err != nil {
+		return nil, err
+	}
+
+	tu, err := ctx.parse(w.toks, c.tokenExpansions)
+	if err != nil {
+		return nil, err
+	}
+
+	Walk(&typeVisitor{ctx: ctx}, tu)
+	if err := ctx.error(); err != nil {
+		return nil, err
+	}
+
+	tu.FileSet = ctx.fset
+	tu.Macros = newMacros(c)
+	tu.Model = model
+	ctx.diagnostics.Sort()
+	tu.Diagnostics = append(Diagnostics(nil), ctx.diagnostics...)
+	tu.Warnings = tu.Diagnostics.Warnings().ErrorList()
+	return tu, nil
+}
+
+// typeVisitor computes the types of the declarations of a translation unit in
+// source order, so their constraints are checked, their layouts can be queried
+// and the initializers of objects with static storage duration are evaluated.
+// Expressions are typed in the scope they appear in. Function definitions,
+// compound statements and for statements declaring variables open new
+// scopes.
+type typeVisitor struct {
+	ctx   *context
+	scope bool // Visit(nil) closes a scope.
+}
+
+func (v *typeVisitor) Visit(n Node) Visitor {
+	switch x := n.(type) {
+	case nil:
+		if v.scope {
+			v.ctx.scope = v.ctx.scope.parent
+		}
+	case *CompoundStmt:
+		v.ctx.scope = newScope(v.ctx.scope)
+		return &typeVisitor{v.ctx, true}
+	case *Declaration:
+		x.declare(v.ctx)
+	case *EnumSpecifier:
+		x.typ(v.ctx)
+	case *Expr:
+		x.eval(v.ctx)
+	case *ExprList:
+		x.eval(v.ctx)
+	case *FunctionDefinition:
+		x.declare(v.ctx)
+		v.ctx.scope = newScope(v.ctx.scope)
+		x.declareParams(v.ctx)
+		return &typeVisitor{v.ctx, true}
+	case *IterationStmt:
+		if x.Case == IterationStmtForDecl {
+			v.ctx.scope = newScope(v.ctx.scope)
+			return &typeVisitor{v.ctx, true}
+		}
+	case *LabeledStmt:
+		x.check(v.ctx)
+	case *StructOrUnionSpecifier:
+		x.typ(v.ctx)
+	}
+	if v.scope {
+		return &typeVisitor{ctx: v.ctx}
+	}
+
+	return v
+}
+
 // Source represents a preprocessing file.
+//
+// Cache receives the tokenized lines of the source and Cached returns them,
+// if any, instead of tokenizing the source again. The lines are IDs local to
+// the translation or to its Tweaks.Cache, if set, so they may be reused only
+// by the same translation or by translations sharing the Cache.
 type Source interface {
 	Cache([]uint32)
 	Cached() []uint32
@@ -115,6 +550,9 @@ type fileSource struct {
 	path string
 }
 
+// NewFileSource returns a Source reading the file at path.
+func NewFileSource(path string) Source { return newFileSource(path) }
+
 func newFileSource(nm string) *fileSource { return &fileSource{path: nm} }
 
 func (s *fileSource) Cache([]uint32)   {}
@@ -141,3 +579,25 @@ func (s *fileSource) Size() (int64, error) {
 
 	return fi.Size(), nil
 }
+
+type stringSource struct {
+	*strings.Reader
+	name string
+	src  string
+}
+
+// NewStringSource returns a Source named name with content src.
+func NewStringSource(name, src string) Source { return newStringSource(name, src) }
+
+func newStringSource(name, src string) *stringSource { return &stringSource{name: name, src: src} }
+
+func (s *stringSource) Cache([]uint32)       {}
+func (s *stringSource) Cached() []uint32     { return nil }
+func (s *stringSource) Close() error         { return nil }
+func (s *stringSource) Name() string         { return s.name }
+func (s *stringSource) Size() (int64, error) { return int64(len(s.src)), nil }
+
+func (s *stringSource) ReadCloser() (io.ReadCloser, error) {
+	s.Reader = strings.NewReader(s.src)
+	return s, nil
+}
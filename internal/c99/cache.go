@@ -0,0 +1,212 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package c99
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"go/token"
+	"sync"
+
+	"github.com/cznic/xc"
+)
+
+// Cache memoizes preprocessing shared by translations, for example by
+// translations of the same sources configured by different predefined
+// macros. Set Tweaks.Cache to use it.
+//
+// Sources are tokenized once per name and content. The lines of text between
+// two preprocessing directives are expanded once per definitions of the
+// macros the expansion looks up, so changing a macro affects only the text
+// using it. Translations using a Cache share its FileSet.
+//
+// A Cache is safe for concurrent use by multiple goroutines, so concurrent
+// translations of different files tokenize common headers only once.
+type Cache struct {
+	chunks map[string][]*chunk // Text lines: expansions.
+	files  map[string][]uint32 // Name, tweaks and content hash: lines.
+	fset   *token.FileSet
+	defs   *dictionary // Macro definitions.
+	lines  *tokenStore // Replaces the token store of translations.
+	mu     sync.Mutex
+
+	hits   int // Expansions reused.
+	misses int // Expansions computed.
+}
+
+// NewCache returns a newly created Cache.
+func NewCache() *Cache {
+	return &Cache{
+		chunks: map[string][]*chunk{},
+		files:  map[string][]uint32{},
+		fset:   token.NewFileSet(),
+		defs:   newDictionary(),
+		lines:  newTokenStore(),
+	}
+}
+
+// FileSet returns the FileSet of translations using c.
+func (c *Cache) FileSet() *token.FileSet { return c.fset }
+
+// chunk is the expansion of lines of text.
+type chunk struct {
+	deps []chunkDep // Macros looked up by the expansion.
+	toks []xc.Token
+}
+
+type chunkDep struct {
+	name int
+	def  int // Definition ID or 0 if not defined.
+}
+
+func (c *Cache) fileKey(nm string, t *Tweaks, b []byte) string {
+	return fmt.Sprintf("%s\x00%v%v%v\x00%x", nm, t.EnableTrigraphs, t.DisableTrigraphWarnings, t.injectFinalNL, sha256.Sum256(b))
+}
+
+func (c *Cache) file(key string) ([]uint32, bool) {
+	c.mu.Lock()
+	pf, ok := c.files[key]
+	c.mu.Unlock()
+	return pf, ok
+}
+
+func (c *Cache) putFile(key string, pf []uint32) {
+	c.mu.Lock()
+	c.files[key] = pf
+	c.mu.Unlock()
+}
+
+// chunk returns the expansion of lines, if any, valid for macros.
+func (c *Cache) chunk(lines string, macros map[int]*macro) ([]xc.Token, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+outer:
+	for _, v := range c.chunks[lines] {
+		for _, d := range v.deps {
+			if macros[d.name].id(c.defs) != d.def {
+				continue outer
+			}
+		}
+
+		c.hits++
+		return v.toks, true
+	}
+
+	c.misses++
+	return nil, false
+}
+
+func (c *Cache) putChunk(lines string, x *chunk) {
+	c.mu.Lock()
+	c.chunks[lines] = append(c.chunks[lines], x)
+	c.mu.Unlock()
+}
+
+// id returns a number identifying the definition of m in d, equal for equal
+// definitions at the same position. The id of a nil macro is zero.
+func (m *macro) id(d *dictionary) int {
+	if m == nil {
+		return 0
+	}
+
+	if m.defID == 0 {
+		var b []byte
+		put := func(n int) {
+			var a [binary.MaxVarintLen64]byte
+			b = append(b, a[:binary.PutVarint(a[:], int64(n))]...)
+		}
+		put(int(m.def.Pos()))
+		put(m.def.Val)
+		put(len(m.fp))
+		for _, v := range m.fp {
+			put(v)
+		}
+		if m.fnLike {
+			put(1)
+		}
+		if m.variadic {
+			put(2)
+		}
+		put(-1)
+		for _, v := range m.repl {
+			put(int(v.Rune))
+			put(int(v.Pos()))
+			put(v.Val)
+		}
+		m.defID = d.id(b)
+	}
+	return m.defID
+}
+
+// textLines returns the lines preceding the next directive line or the end
+// of the current source. It returns nil unless r is at the start of a line.
+func (c *cppReader) textLines() []uint32 {
+	if len(c.ungetBuffer) != 0 || len(c.line) != 0 || c.last != '\n' && c.last != 0 || len(c.tu) == 0 {
+		return nil
+	}
+
+	lines := c.tu[0]
+	for i, v := range lines {
+		toks := c.lines.line(int(v))
+		for len(toks) != 0 && toks[0].Rune == ' ' {
+			toks = toks[1:]
+		}
+		if len(toks) != 0 && toks[0].Rune == '#' {
+			return lines[:i]
+		}
+	}
+	return lines
+}
+
+// memoize expands the lines of text at the current position of r using or
+// updating c.cache. It reports whether any lines were expanded. Lines which
+// fail to expand on their own, for example because a macro invocation
+// continues past a directive, are left to the caller.
+func (c *cpp) memoize(r *cppReader, w tokenWriter, cond cond) bool {
+	lines := r.textLines()
+	if len(lines) == 0 {
+		return false
+	}
+
+	b := make([]byte, 4*len(lines))
+	for i, v := range lines {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	key := string(b)
+	if toks, ok := c.cache.chunk(key, c.macros); ok {
+		r.tu[0] = r.tu[0][len(lines):]
+		r.last = '\n'
+		w.write(toks...)
+		return true
+	}
+
+	n := len(c.diagnostics)
+	c.consulted = map[int]struct{}{}
+
+	defer func() { c.consulted = nil }()
+
+	var buf tokenBuffer
+	c.expand(&cppReader{lines: c.lines, tu: [][]uint32{lines}}, &buf, cond)
+	if c.diagnostics[n:].Count(SeverityError) != 0 {
+		c.diagnostics = c.diagnostics[:n]
+		return false
+	}
+
+	r.tu[0] = r.tu[0][len(lines):]
+	r.last = '\n'
+	w.write(buf.toks...)
+	if len(c.diagnostics) != n {
+		return true
+	}
+
+	x := &chunk{toks: buf.toks}
+	for nm := range c.consulted {
+		x.deps = append(x.deps, chunkDep{nm, c.macros[nm].id(c.cache.defs)})
+	}
+	c.cache.putChunk(key, x)
+	return true
+}
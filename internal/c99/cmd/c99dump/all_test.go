@@ -0,0 +1,95 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cznic/sqlite2go/internal/c99"
+)
+
+const testSrc = `int a, b;
+int f(int x) { return x+a; }
+`
+
+type jsonNode struct {
+	Kind     string
+	Case     string
+	Pos      string
+	Src      string
+	Children []*jsonNode
+}
+
+func (n *jsonNode) String() string {
+	if n.Kind == "" {
+		return n.Src
+	}
+
+	var a []string
+	for _, v := range n.Children {
+		a = append(a, v.String())
+	}
+	return strings.Join(a, " ")
+}
+
+func TestDump(t *testing.T) {
+	tu, err := c99.Translate(&c99.Tweaks{}, nil, nil, c99.NewStringSource("test.c", testSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := (&dumper{}).json(&buf, tu.FileSet, tu); err != nil {
+		t.Fatal(err)
+	}
+
+	var n jsonNode
+	if err := json.Unmarshal(buf.Bytes(), &n); err != nil {
+		t.Fatalf("%v\n%s", err, buf.Bytes())
+	}
+
+	if g, e := n.String(), "int a , b ; int f ( int x ) { return x + a ; }"; g != e {
+		t.Errorf("got %q exp %q", g, e)
+	}
+
+	// Lists are flattened.
+	if g, e := len(n.Children), 2; g != e {
+		t.Errorf("got %v exp %v", g, e)
+	}
+
+	if g, e := n.Children[0].Pos, "test.c:1:1"; g != e {
+		t.Errorf("got %v exp %v", g, e)
+	}
+
+	buf.Reset()
+	if err := (&dumper{noPos: true}).sexp(&buf, tu.FileSet, tu.ExternalDeclaration); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `(ExternalDeclaration :case ExternalDeclarationDecl
+	(Declaration
+		(DeclarationSpecifiers :case DeclarationSpecifiersSpecifier
+			(TypeSpecifier :case TypeSpecifierInt
+				"int"))
+		(InitDeclaratorListOpt
+			(InitDeclaratorList
+				(InitDeclarator :case InitDeclaratorBase
+					(Declarator
+						(DirectDeclarator :case DirectDeclaratorIdent
+							"a")))
+				","
+				(InitDeclarator :case InitDeclaratorBase
+					(Declarator
+						(DirectDeclarator :case DirectDeclaratorIdent
+							"b")))))
+		";"))
+`
+	if g, e := buf.String(), exp; g != e {
+		t.Errorf("---- got\n%s---- exp\n%s", g, e)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/cznic/sqlite2go/internal/c99"
+	"github.com/cznic/xc"
+)
+
+// Node types forming linked lists.
+var lists = map[reflect.Type]bool{
+	reflect.TypeOf((*c99.ArgumentExprList)(nil)):      true,
+	reflect.TypeOf((*c99.BlockItemList)(nil)):         true,
+	reflect.TypeOf((*c99.DeclarationList)(nil)):       true,
+	reflect.TypeOf((*c99.DesignatorList)(nil)):        true,
+	reflect.TypeOf((*c99.EnumeratorList)(nil)):        true,
+	reflect.TypeOf((*c99.ExprList)(nil)):              true,
+	reflect.TypeOf((*c99.IdentifierList)(nil)):        true,
+	reflect.TypeOf((*c99.InitDeclaratorList)(nil)):    true,
+	reflect.TypeOf((*c99.InitializerList)(nil)):       true,
+	reflect.TypeOf((*c99.ParameterList)(nil)):         true,
+	reflect.TypeOf((*c99.StructDeclarationList)(nil)): true,
+	reflect.TypeOf((*c99.StructDeclaratorList)(nil)):  true,
+	reflect.TypeOf((*c99.TranslationUnit)(nil)):       true,
+	reflect.TypeOf((*c99.TypeQualifierList)(nil)):     true,
+}
+
+type item struct {
+	node c99.Node
+	tok  xc.Token
+}
+
+type dumper struct {
+	buf   bytes.Buffer
+	enc   *json.Encoder
+	err   error
+	fset  *token.FileSet
+	noPos bool
+	w     io.Writer
+}
+
+func (d *dumper) init(w io.Writer, fset *token.FileSet) {
+	d.w = w
+	d.fset = fset
+	d.enc = json.NewEncoder(&d.buf)
+	d.enc.SetEscapeHTML(false)
+}
+
+func (d *dumper) printf(format string, args ...interface{}) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, format, args...)
+	}
+}
+
+// quote returns s as a JSON string.
+func (d *dumper) quote(s string) string {
+	d.buf.Reset()
+	d.enc.Encode(s)
+	return strings.TrimSuffix(d.buf.String(), "\n")
+}
+
+func (d *dumper) pos(p token.Pos) string {
+	if d.noPos || !p.IsValid() {
+		return ""
+	}
+
+	return d.fset.PositionFor(p, true).String()
+}
+
+// kind returns the node kind and its Case, if any.
+func kind(n c99.Node) (string, string) {
+	v := reflect.ValueOf(n)
+	k := v.Type().Elem().Name()
+	if lists[v.Type()] {
+		return k, ""
+	}
+
+	if c := v.Elem().FieldByName("Case"); c.IsValid() {
+		return k, fmt.Sprint(c.Interface())
+	}
+
+	return k, ""
+}
+
+// items returns the components of n. The items of a list are collected from
+// all of its nodes.
+func items(n c99.Node) (r []item) {
+	t := reflect.TypeOf(n)
+	for n != nil {
+		var next c99.Node
+		c99.Components(n, func(tok xc.Token, child c99.Node) {
+			if child != nil && lists[t] && reflect.TypeOf(child) == t {
+				next = child
+				return
+			}
+
+			r = append(r, item{child, tok})
+		})
+		n = next
+	}
+	return r
+}
+
+func (d *dumper) json(w io.Writer, fset *token.FileSet, n c99.Node) error {
+	d.init(w, fset)
+	d.jsonNode(n, "")
+	d.printf("\n")
+	return d.err
+}
+
+func (d *dumper) jsonNode(n c99.Node, indent string) {
+	k, c := kind(n)
+	d.printf(`{"kind": %s`, d.quote(k))
+	if c != "" {
+		d.printf(`, "case": %s`, d.quote(c))
+	}
+	if p := d.pos(n.Pos()); p != "" {
+		d.printf(`, "pos": %s`, d.quote(p))
+	}
+	a := items(n)
+	if len(a) == 0 {
+		d.printf("}")
+		return
+	}
+
+	d.printf(`, "children": [`)
+	for i, v := range a {
+		if i != 0 {
+			d.printf(",")
+		}
+		d.printf("\n%s\t", indent)
+		if v.node != nil {
+			d.jsonNode(v.node, indent+"\t")
+			continue
+		}
+
+		d.printf("{")
+		if p := d.pos(v.tok.Pos()); p != "" {
+			d.printf(`"pos": %s, `, d.quote(p))
+		}
+		d.printf(`"src": %s}`, d.quote(c99.TokSrc(v.tok)))
+	}
+	d.printf("\n%s]}", indent)
+}
+
+func (d *dumper) sexp(w io.Writer, fset *token.FileSet, n c99.Node) error {
+	d.init(w, fset)
+	d.sexpNode(n, "")
+	d.printf("\n")
+	return d.err
+}
+
+func (d *dumper) sexpNode(n c99.Node, indent string) {
+	k, c := kind(n)
+	d.printf("(%s", k)
+	if c != "" {
+		d.printf(" :case %s", c)
+	}
+	if p := d.pos(n.Pos()); p != "" {
+		d.printf(" :pos %s", d.quote(p))
+	}
+	for _, v := range items(n) {
+		d.printf("\n%s\t", indent)
+		if v.node != nil {
+			d.sexpNode(v.node, indent+"\t")
+			continue
+		}
+
+		d.printf("%s", d.quote(c99.TokSrc(v.tok)))
+	}
+	d.printf(")")
+}
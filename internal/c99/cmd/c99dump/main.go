@@ -0,0 +1,179 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command c99dump preprocesses and parses C files and writes their AST.
+//
+// Usage
+//
+//	c99dump [flags] file.c...
+//
+// Flags
+//
+//	-D name[=value]  Define a macro, value defaults to 1.
+//	-U name          Undefine a macro.
+//	-I dir           Add dir to the "foo.h" include paths.
+//	-isystem dir     Add dir to the <foo.h> include paths.
+//	-format fmt      Output format, "json" (default) or "sexp".
+//	-diagnostics fmt Diagnostics format, "text" (default), "json" or "sarif".
+//	-nopos           Omit positions.
+//	-trigraphs       Enable trigraphs.
+//
+// The -D and -U flags are processed in order before the files. The files
+// form one translation unit.
+//
+// Diagnostics are written to stderr. The text format has only the errors,
+// the JSON and SARIF formats have the warnings as well.
+//
+// Output
+//
+// Every node is written with its kind, which is the name of its Go type,
+// its Case, if the node type has cases, its position and its children in
+// source order. Tokens are children as well. Lists, like BlockItemList, are
+// flattened to one node having the list items, and the separating tokens, as
+// its children.
+//
+// The JSON format writes nodes as
+//
+//	{"kind": "Expr", "case": "ExprAdd", "pos": "a.c:1:9", "children": [...]}
+//
+// and tokens as
+//
+//	{"pos": "a.c:1:11", "src": "+"}
+//
+// The S-expression format writes nodes as
+//
+//	(Expr :case ExprAdd :pos "a.c:1:9" ...)
+//
+// and tokens as quoted strings. The output does not depend on anything but
+// the input, so it can be compared across runs.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cznic/sqlite2go/internal/c99"
+)
+
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, " ") }
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// defines collects -D and -U flags, in order, as preprocessor directives.
+type defines struct {
+	lines  *[]string
+	define bool
+}
+
+func (f defines) String() string { return "" }
+
+func (f defines) Set(s string) error {
+	if !f.define {
+		*f.lines = append(*f.lines, fmt.Sprintf("#undef %s\n", s))
+		return nil
+	}
+
+	nm, val := s, "1"
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		nm, val = s[:i], s[i+1:]
+	}
+	*f.lines = append(*f.lines, fmt.Sprintf("#define %s %s\n", nm, val))
+	return nil
+}
+
+func main() {
+	var (
+		includes, sysIncludes stringsFlag
+		lines                 []string
+	)
+	flag.Var(&includes, "I", "")
+	flag.Var(&sysIncludes, "isystem", "")
+	flag.Var(defines{&lines, true}, "D", "")
+	flag.Var(defines{&lines, false}, "U", "")
+	format := flag.String("format", "json", "")
+	diagnostics := flag.String("diagnostics", "text", "")
+	noPos := flag.Bool("nopos", false, "")
+	trigraphs := flag.Bool("trigraphs", false, "")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: c99dump [flags] file.c...")
+		os.Exit(2)
+	}
+
+	var dump func(io.Writer, *token.FileSet, c99.Node) error
+	switch *format {
+	case "json":
+		dump = (&dumper{noPos: *noPos}).json
+	case "sexp":
+		dump = (&dumper{noPos: *noPos}).sexp
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", *format)
+		os.Exit(2)
+	}
+
+	var report func(io.Writer, c99.Diagnostics) error
+	switch *diagnostics {
+	case "text":
+		report = func(w io.Writer, d c99.Diagnostics) error {
+			scanner.PrintError(w, d.Errors().ErrorList())
+			return nil
+		}
+	case "json":
+		report = func(w io.Writer, d c99.Diagnostics) error { return d.JSON(w) }
+	case "sarif":
+		report = func(w io.Writer, d c99.Diagnostics) error { return d.SARIF(w, "c99dump") }
+	default:
+		fmt.Fprintf(os.Stderr, "unknown diagnostics format: %s\n", *diagnostics)
+		os.Exit(2)
+	}
+
+	var sources []c99.Source
+	if len(lines) != 0 {
+		sources = append(sources, c99.NewStringSource("<command-line>", strings.Join(lines, "")))
+	}
+	for _, v := range flag.Args() {
+		sources = append(sources, c99.NewFileSource(v))
+	}
+	tu, err := c99.Translate(&c99.Tweaks{EnableTrigraphs: *trigraphs}, includes, sysIncludes, sources...)
+	if err != nil {
+		switch x := err.(type) {
+		case c99.Diagnostics:
+			if err := report(os.Stderr, x); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		default:
+			scanner.PrintError(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+
+	if *diagnostics != "text" {
+		if err := report(os.Stderr, tu.Diagnostics); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if err := dump(w, tu.FileSet, tu); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -8,23 +8,27 @@
 package c99
 
 import (
-	"encoding/binary"
+	"bytes"
 	"fmt"
 	"go/token"
 	"io"
-	"math"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/cznic/golex/lex"
-	"github.com/cznic/ir"
 	"github.com/cznic/mathutil"
 	"github.com/cznic/xc"
 )
 
 const (
 	maxIncludeLevel = 200 // gcc, std is 15.
+
+	// pragmaPack is the rune of the token cpp emits for #pragma pack. Its
+	// Val is the new maximum member alignment or zero for the default.
+	pragmaPack = -2
 )
 
 var (
@@ -72,9 +76,9 @@ func (b *tokenBuffer) read() (t xc.Token) {
 }
 
 type cppReader struct {
-	decBuf []byte
-	decPos token.Pos
-	tu     [][]uint32
+	line  []xc.Token // Rest of the current line.
+	lines *tokenStore
+	tu    [][]uint32
 	ungetBuffer
 
 	last rune
@@ -88,7 +92,7 @@ func (c *cppReader) read() (t xc.Token) {
 	}
 
 more:
-	if len(c.decBuf) == 0 {
+	if len(c.line) == 0 {
 		if len(c.tu) == 0 {
 			t.Rune = lex.RuneEOF
 			return t
@@ -99,12 +103,13 @@ more:
 			goto more
 		}
 
-		c.decBuf = dict.S(int(c.tu[0][0]))
+		c.line = c.lines.line(int(c.tu[0][0]))
 		c.tu[0] = c.tu[0][1:]
-		c.decPos = 0
+		goto more
 	}
 
-	c.decBuf, c.decPos, t = decodeToken(c.decBuf, c.decPos)
+	t = c.line[0]
+	c.line = c.line[1:]
 	if t.Rune == '#' && (c.last == '\n' || c.last == 0) {
 		t.Rune = DIRECTIVE
 	}
@@ -120,9 +125,10 @@ func (c cond) push(n condValue) cond { return append(c, n) }
 func (c cond) tos() condValue        { return c[len(c)-1] }
 
 type macro struct {
-	def  xc.Token
-	fp   []int
-	repl []xc.Token
+	def   xc.Token
+	defID int // Lazily computed by id.
+	fp    []int
+	repl  []xc.Token
 
 	fnLike   bool
 	variadic bool
@@ -141,19 +147,7 @@ func (m *macro) param(ap [][]xc.Token, nm int, out *[]xc.Token) bool {
 		}
 
 		if i := len(m.fp); i < len(ap) {
-			o := *out
-			for i, v := range ap[i:] {
-				if i != 0 {
-					t := o[len(o)-1]
-					t.Rune = ','
-					t.Val = 0
-					o = append(o, t)
-					t.Rune = ' '
-					o = append(o, t)
-				}
-				o = append(o, v...)
-			}
-			*out = o
+			*out = ap[i]
 		}
 		return true
 	}
@@ -167,16 +161,65 @@ func (m *macro) param(ap [][]xc.Token, nm int, out *[]xc.Token) bool {
 	return false
 }
 
+func (m *macro) isParam(nm int) bool {
+	if nm == idVaArgs {
+		return m.variadic
+	}
+
+	for _, v := range m.fp {
+		if v == nm {
+			return true
+		}
+	}
+	return false
+}
+
+// Expansion describes a macro expansion. Tokens produced by expanding the
+// arguments of a function-like macro are attributed to the expansion of that
+// macro.
+type Expansion struct {
+	Def    token.Pos  // Position of the macro name in its #define.
+	Name   string     // Macro name.
+	Parent *Expansion // Expansion producing the macro invocation or nil.
+	Pos    token.Pos  // Position of the macro name of the invocation.
+}
+
+// expansionWriter records the innermost active expansion for every token
+// written.
+type expansionWriter struct {
+	*cpp
+	w tokenWriter
+}
+
+func (w *expansionWriter) write(toks ...xc.Token) {
+	var e *Expansion
+	if n := len(w.expansions); n != 0 {
+		e = w.expansions[n-1]
+	}
+	for range toks {
+		w.tokenExpansions = append(w.tokenExpansions, e)
+	}
+	w.w.write(toks...)
+}
+
 type nullReader struct{}
 
 func (nullReader) Read([]byte) (int, error) { return 0, io.EOF }
 
 type cpp struct {
 	*context
-	hideSet      map[int]int // name: hidden if != 0.
-	includeLevel int
-	lx           *lexer
-	macros       map[int]*macro // name ID: macro
+	cache           *Cache           // Tweaks.Cache, if compatible with other tweaks.
+	consulted       map[int]struct{} // Macro names looked up, if memoizing.
+	expansions      []*Expansion     // Active expansions, innermost last.
+	hideSet         map[int]int      // name: hidden if != 0.
+	ifs             []xc.Token       // Directive names of the open conditionals.
+	includeLevel    int
+	lx              *lexer
+	macroEvents     []macroEvent
+	macros          map[int]*macro // name ID: macro
+	pack            int            // Current #pragma pack, zero if none.
+	packs           []int          // #pragma pack(push) stack.
+	tokenExpansions []*Expansion   // Per output token, if tracking expansions.
 }
 
 func newCPP(ctx *context) *cpp {
@@ -192,129 +235,150 @@ func newCPP(ctx *context) *cpp {
 		lx:      lx,
 		macros:  map[int]*macro{},
 	}
+	if x := ctx.tweaks.Cache; x != nil && !ctx.tweaks.trackExpansions() && !ctx.tweaks.MacroComments {
+		r.cache = x
+		ctx.lines = x.lines
+	}
 	return r
 }
 
 func (c *cpp) parse(src ...Source) (tokenReader, error) {
-	var (
-		encBuf  []byte
-		encBuf1 [30]byte // Rune, position, optional value ID.
-		tokBuf  []xc.Token
-		tu      [][]uint32
-	)
+	var tu [][]uint32
 	for _, v := range src {
 		if pf := v.Cached(); pf != nil {
 			tu = append(tu, pf)
 			continue
 		}
 
-		sz, err := v.Size()
+		pf, err := c.tokenize(v)
 		if err != nil {
 			return nil, err
 		}
 
-		if sz > mathutil.MaxInt {
-			return nil, fmt.Errorf("%v: file too big: %v", v.Name(), sz)
-		}
+		v.Cache(pf)
+		tu = append(tu, pf)
+	}
+	return &cppReader{lines: c.lines, tu: tu}, nil
+}
 
-		r, err := v.ReadCloser()
-		if err != nil {
-			return nil, err
-		}
+// tokenize returns the lines of src, consulting c.cache, if any.
+func (c *cpp) tokenize(src Source) ([]uint32, error) {
+	sz, err := src.Size()
+	if err != nil {
+		return nil, err
+	}
 
-		lx, err := newLexer(c.context, v.Name(), int(sz), r)
-		if err != nil {
-			return nil, err
-		}
+	if sz > mathutil.MaxInt {
+		return nil, fmt.Errorf("%v: file too big: %v", src.Name(), sz)
+	}
 
-		if err := func() (err error) {
-			defer func() {
-				switch e := recover(); x := e.(type) {
-				case nil:
-					// nop
-				case error:
-					err = newPanicError(fmt.Errorf("%s: PANIC: %v\n%s", lx.lastPosition(), errString(x), debugStack()))
-				default:
-					err = newPanicError(fmt.Errorf("%s: PANIC: %v\n%s", lx.lastPosition(), e, debugStack()))
-				}
-				if e := r.Close(); e != nil && err == nil {
-					err = e
-				}
-			}()
-
-			var pf []uint32
-			var t xc.Token
-			var toks []xc.Token
-			for {
-				ch := lx.cppScan()
-				if ch.Rune == ccEOF {
-					break
-				}
+	r, err := src.ReadCloser()
+	if err != nil {
+		return nil, err
+	}
 
-				tokBuf = tokBuf[:0]
-				for {
-					t.Char = ch
-					t.Val = 0
-					if ch.Rune == '\n' {
-						toks = append(trimSpace(tokBuf), t)
-						break
-					}
+	if c.cache == nil {
+		return c.scan(src.Name(), int(sz), r)
+	}
 
-					if _, ok := tokHasVal[ch.Rune]; ok {
-						t.Val = dict.ID(lx.TokenBytes(nil))
-					}
-					tokBuf = append(tokBuf, t)
+	b, err := ioutil.ReadAll(r)
+	if e := r.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err != nil {
+		return nil, err
+	}
 
-					if ch = lx.cppScan(); ch.Rune == ccEOF {
-						if !c.tweaks.injectFinalNL {
-							c.errPos(lx.last.Pos(), "file is missing final NL")
-						}
-						break
+	key := c.cache.fileKey(src.Name(), c.tweaks, b)
+	if pf, ok := c.cache.file(key); ok {
+		return pf, nil
+	}
 
-					}
-				}
+	n := len(c.diagnostics)
+	pf, err := c.scan(src.Name(), len(b), ioutil.NopCloser(bytes.NewReader(b)))
+	if err == nil && len(c.diagnostics) == n {
+		c.cache.putFile(key, pf)
+	}
+	return pf, err
+}
 
-				var encPos token.Pos
-				encBuf = encBuf[:0]
-				for _, t := range toks {
-					n := binary.PutUvarint(encBuf1[:], uint64(t.Rune))
-					pos := t.Pos()
-					n += binary.PutUvarint(encBuf1[n:], uint64(pos-encPos))
-					encPos = pos
-					if t.Val != 0 {
-						n += binary.PutUvarint(encBuf1[n:], uint64(t.Val))
-					}
-					encBuf = append(encBuf, encBuf1[:n]...)
-				}
-				id := dict.ID(encBuf)
-				if id > math.MaxUint32 {
-					panic("internal error")
+// scan tokenizes and closes r. Every line of the result is the ID of its
+// tokens in c.lines.
+func (c *cpp) scan(nm string, sz int, r io.ReadCloser) (pf []uint32, err error) {
+	var tokBuf []xc.Token
+	lx, err := newLexer(c.context, nm, sz, r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	defer func() {
+		switch e := recover(); x := e.(type) {
+		case nil:
+			// nop
+		case error:
+			err = newPanicError(fmt.Errorf("%s: PANIC: %w\n%s", lx.lastPosition(), x, debugStack()))
+		default:
+			err = newPanicError(fmt.Errorf("%s: PANIC: %v\n%s", lx.lastPosition(), e, debugStack()))
+		}
+		if e := r.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	var t xc.Token
+	var toks []xc.Token
+	for {
+		ch := lx.cppScan()
+		if ch.Rune == ccEOF {
+			break
+		}
+
+		tokBuf = tokBuf[:0]
+		for {
+			t.Char = ch
+			t.Val = 0
+			if ch.Rune == '\n' {
+				toks = append(trimSpace(tokBuf), t)
+				break
+			}
+
+			if _, ok := tokHasVal[ch.Rune]; ok {
+				t.Val = dict.ID(lx.TokenBytes(nil))
+			}
+			tokBuf = append(tokBuf, t)
+
+			if ch = lx.cppScan(); ch.Rune == ccEOF {
+				if !c.tweaks.injectFinalNL {
+					f := c.fset.File(lx.last.Pos())
+					c.errPos(lx.last.Pos(), "file is missing final NL").Fix = c.fix(token.Pos(f.Base()+f.Size()), 0, "\n")
 				}
+				toks = trimSpace(tokBuf)
+				break
 
-				pf = append(pf, uint32(id))
 			}
-			v.Cache(pf)
-			tu = append(tu, pf)
-			return nil
-		}(); err != nil {
-			return nil, err
 		}
+
+		pf = append(pf, uint32(c.lines.put(toks)))
 	}
-	return &cppReader{tu: tu}, nil
+	return pf, nil
 }
+
 func (c *cpp) eval(r tokenReader, w tokenWriter) (err error) {
 	defer func() {
 		switch e := recover(); x := e.(type) {
 		case nil:
 		case error:
-			err = newPanicError(fmt.Errorf("%T: PANIC: %v\n%s", c, errString(x), debugStack()))
+			err = newPanicError(fmt.Errorf("%T: PANIC: %w\n%s", c, x, debugStack()))
 		default:
 			err = newPanicError(fmt.Errorf("%T: PANIC: %v\n%s", c, e, debugStack()))
 		}
 	}()
-	if cond := c.expand(r, w, cond(nil).push(condZero)); len(cond) != 1 || cond.tos() != condZero {
-		panic(cond)
+	if c.tweaks.trackExpansions() {
+		w = &expansionWriter{c, w}
 	}
+	c.expand(r, w, cond(nil).push(condZero))
+	c.unterminated(0)
 	return nil
 }
 
@@ -345,6 +409,12 @@ func (c *cpp) eval(r tokenReader, w tokenWriter) (err error) {
 // }
 func (c *cpp) expand(r tokenReader, w tokenWriter, cond cond) cond {
 	for {
+		if c.cache != nil && c.consulted == nil && cond.on() {
+			if x, ok := r.(*cppReader); ok && c.memoize(x, w, cond) {
+				continue
+			}
+		}
+
 		t := r.read()
 		switch t.Rune {
 		case lex.RuneEOF:
@@ -367,12 +437,21 @@ func (c *cpp) expand(r tokenReader, w tokenWriter, cond cond) cond {
 				continue
 			}
 
+			if nm == idPragmaOp {
+				c.pragmaOp(t, r)
+				continue
+			}
+
 			m := c.macros[nm]
+			if c.consulted != nil {
+				c.consulted[nm] = struct{}{}
+			}
 			if m != nil && !m.fnLike {
 				// ------------------------------------------ C
 				t.Rune = SENTINEL
 				r.unget(t)
 				toks := c.subst(m, nil)
+				c.pushExpansion(m, t)
 				c.hideSet[nm]++
 				r.ungets(c.sanitize(toks)...)
 				continue
@@ -401,10 +480,11 @@ func (c *cpp) expand(r tokenReader, w tokenWriter, cond cond) cond {
 					continue
 				}
 
-				ap := c.actuals(m, r)
+				ap := c.actuals(m, t, r)
 				t.Rune = SENTINEL
 				sentinels = append([]xc.Token{t}, sentinels...)
 				toks := append(c.subst(m, ap), sentinels...)
+				c.pushExpansion(m, t)
 				c.hideSet[nm]++
 				r.ungets(c.sanitize(toks)...)
 				continue
@@ -420,6 +500,10 @@ func (c *cpp) expand(r tokenReader, w tokenWriter, cond cond) cond {
 			if c.hideSet[t.Val] < 0 {
 				panic(PrettyString(t))
 			}
+
+			if c.tweaks.trackExpansions() {
+				c.expansions = c.expansions[:len(c.expansions)-1]
+			}
 		default:
 			// -------------------------------------------------- E
 			if !cond.on() {
@@ -431,6 +515,53 @@ func (c *cpp) expand(r tokenReader, w tokenWriter, cond cond) cond {
 	}
 }
 
+// [0]6.10.9: A unary operator expression of the form _Pragma (
+// string-literal ) is processed as if it were a #pragma directive. Pragmas are
+// ignored, so pragmaOp only consumes the operator following t.
+func (c *cpp) pragmaOp(t xc.Token, r tokenReader) {
+	var sentinels, toks []xc.Token
+	for len(toks) < 3 {
+		u := r.read()
+		switch u.Rune {
+		case SENTINEL:
+			sentinels = append(sentinels, u)
+			continue
+		case ' ', '\n':
+			continue
+		case lex.RuneEOF:
+			// nop
+		default:
+			toks = append(toks, u)
+			continue
+		}
+
+		break
+	}
+	if len(toks) != 3 || toks[0].Rune != '(' || toks[1].Rune != STRINGLITERAL && toks[1].Rune != LONGSTRINGLITERAL || toks[2].Rune != ')' {
+		c.err(t, "_Pragma takes a parenthesized string literal")
+	}
+	r.ungets(sentinels...)
+}
+
+// pushExpansion records the expansion of m invoked by t, if tracking
+// expansions. It is popped by the sentinel ending the expansion.
+func (c *cpp) pushExpansion(m *macro, t xc.Token) {
+	if !c.tweaks.trackExpansions() {
+		return
+	}
+
+	var parent *Expansion
+	if n := len(c.expansions); n != 0 {
+		parent = c.expansions[n-1]
+	}
+	c.expansions = append(c.expansions, &Expansion{
+		Def:    m.def.Pos(),
+		Name:   string(dict.S(m.def.Val)),
+		Parent: parent,
+		Pos:    t.Pos(),
+	})
+}
+
 func (c *cpp) sanitize(toks []xc.Token) []xc.Token {
 	for i, v := range toks {
 		if v.Rune == IDENTIFIER && c.hideSet[v.Val] != 0 {
@@ -440,19 +571,23 @@ func (c *cpp) sanitize(toks []xc.Token) []xc.Token {
 	return toks
 }
 
-func (c *cpp) actuals(m *macro, r tokenReader) (out [][]xc.Token) {
-	var lvl, n int
+// actuals returns the arguments of the invocation of m by nm. Arguments
+// matching the ellipsis of a variadic macro are returned as a single one,
+// including the separating commas.
+func (c *cpp) actuals(m *macro, nm xc.Token, r tokenReader) (out [][]xc.Token) {
+	var lvl int
+	out = [][]xc.Token{nil}
 	for {
 		t := r.read()
 		if t.Rune < 0 {
-			c.err(t, "unexpected EOF")
-			return nil
+			c.err(nm, "unterminated argument list invoking macro %q", dict.S(nm.Val))
+			return make([][]xc.Token, len(m.fp)+1)
 		}
 
 		switch t.Rune {
 		case ',':
-			if lvl == 0 {
-				n++
+			if lvl == 0 && (!m.variadic || len(out) <= len(m.fp)) {
+				out = append(out, nil)
 				continue
 			}
 		case ')':
@@ -460,6 +595,7 @@ func (c *cpp) actuals(m *macro, r tokenReader) (out [][]xc.Token) {
 				for i, v := range out {
 					out[i] = trimSpace(v)
 				}
+				c.checkArgs(m, nm, out)
 				for len(out) < len(m.fp) {
 					out = append(out, nil)
 				}
@@ -471,13 +607,27 @@ func (c *cpp) actuals(m *macro, r tokenReader) (out [][]xc.Token) {
 			lvl++
 		}
 
-		for len(out) <= n {
-			out = append(out, []xc.Token{})
-		}
 		if t.Rune == '\n' {
 			t.Rune = ' '
 		}
-		out[n] = append(out[n], t)
+		out[len(out)-1] = append(out[len(out)-1], t)
+	}
+}
+
+// [0]6.10.3-4: The number of arguments in an invocation of a function-like
+// macro shall agree with the number of parameters in the macro definition.
+// For a variadic macro, there shall be more arguments than parameters,
+// excluding the ... .
+func (c *cpp) checkArgs(m *macro, nm xc.Token, ap [][]xc.Token) {
+	switch n := len(ap); {
+	case m.variadic && n <= len(m.fp):
+		c.err(nm, "macro %q requires at least %d arguments, but only %d given", dict.S(nm.Val), len(m.fp)+1, n)
+	case m.variadic:
+		// ok
+	case n < len(m.fp):
+		c.err(nm, "macro %q requires %d arguments, but only %d given", dict.S(nm.Val), len(m.fp), n)
+	case n > len(m.fp) && (len(m.fp) != 0 || n != 1 || len(ap[0]) != 0):
+		c.err(nm, "macro %q passed %d arguments, but takes just %d", dict.S(nm.Val), n, len(m.fp))
 	}
 }
 
@@ -571,7 +721,9 @@ func (c *cpp) subst(m *macro, ap [][]xc.Token) (out []xc.Token) {
 			// -------------------------------------------------- C
 			if len(arg) == 0 {
 				// ------------------------------------------ D
-				panic("TODO")
+				out = trimRightSpace(out)
+				repl = repl[2:]
+				continue
 			}
 
 			// -------------------------------------------------- E
@@ -584,6 +736,7 @@ func (c *cpp) subst(m *macro, ap [][]xc.Token) (out []xc.Token) {
 			// -------------------------------------------------- C
 			if len(arg) == 0 {
 				// ------------------------------------------ D
+				out = trimRightSpace(out)
 				repl = repl[3:]
 				continue
 			}
@@ -612,7 +765,8 @@ func (c *cpp) subst(m *macro, ap [][]xc.Token) (out []xc.Token) {
 			// -------------------------------------------------- G
 			if len(arg) == 0 {
 				// ------------------------------------------ H
-				panic(c.position(repl[0]))
+				repl = c.pastePlacemarker(m, ap, repl[2:], &out)
+				continue
 			}
 
 			// -------------------------------------------------- K
@@ -625,13 +779,7 @@ func (c *cpp) subst(m *macro, ap [][]xc.Token) (out []xc.Token) {
 			// -------------------------------------------------- G
 			if len(arg) == 0 {
 				// ------------------------------------------ H
-				if len(repl) > 3 && repl[3].Rune == IDENTIFIER && m.param(ap, repl[3].Val, &arg) {
-					// ---------------------------------- I
-					panic("TODO")
-				}
-
-				// ------------------------------------------ J
-				repl = repl[3:]
+				repl = c.pastePlacemarker(m, ap, repl[3:], &out)
 				continue
 			}
 
@@ -654,6 +802,32 @@ func (c *cpp) subst(m *macro, ap [][]xc.Token) (out []xc.Token) {
 	}
 }
 
+// pastePlacemarker handles the right operand of ## when the left one is an
+// empty argument, ie. a placemarker. The result of the paste is the right
+// operand, the first token of repl.
+func (c *cpp) pastePlacemarker(m *macro, ap [][]xc.Token, repl []xc.Token, out *[]xc.Token) []xc.Token {
+	repl = trimSpace(repl)
+	if len(repl) == 0 {
+		return nil
+	}
+
+	var arg []xc.Token
+	if repl[0].Rune == IDENTIFIER && m.param(ap, repl[0].Val, &arg) {
+		if len(arg) == 0 {
+			// The result is a placemarker again.
+			return repl
+		}
+
+		// -------------------------------------------------- I
+		*out = append(*out, arg...)
+		return repl[1:]
+	}
+
+	// ---------------------------------------------------------- J
+	*out = append(*out, repl[0])
+	return repl[1:]
+}
+
 // paste last of left side with first of right side
 //
 // [1] pg. 3
@@ -681,31 +855,63 @@ func (c *cpp) glue(ls, rs []xc.Token) (n int, out []xc.Token) {
 	rs = rs[1:]
 	n++
 
-	switch l.Rune {
-	case '#':
-		switch r.Rune {
-		case '#':
-			l.Rune = PPPASTE
-		default:
-			panic(PrettyString([]xc.Token{l, r}))
-		}
-	default:
-		l.Val = dict.SID(TokSrc(l) + TokSrc(r))
+	s := TokSrc(l) + TokSrc(r)
+	ch, ok := c.relex(s)
+	if !ok {
+		// [0]6.10.3.3-3: If the result is not a valid preprocessing
+		// token, the behavior is undefined.
+		c.err(l, "pasting %q and %q does not give a valid preprocessing token", TokSrc(l), TokSrc(r))
+		return n, append(append(ls, l, r), rs...)
+	}
+
+	l.Rune = ch
+	l.Val = 0
+	if _, ok := tokHasVal[ch]; ok {
+		l.Val = dict.SID(s)
 	}
 	return n, append(append(ls, l), rs...)
 }
 
+// relex returns the kind of the preprocessing token spelled s. ok is false if
+// s is not a single preprocessing token.
+func (c *cpp) relex(s string) (ch rune, ok bool) {
+	ctx, err := newContext(token.NewFileSet(), &Tweaks{})
+	if err != nil {
+		return 0, false
+	}
+
+	lx, err := newLexer(ctx, "", len(s), strings.NewReader(s))
+	if err != nil {
+		return 0, false
+	}
+
+	t := lx.cppScan()
+	if t.Rune == ccEOF || t.Rune == ' ' || lx.cppScan().Rune != ccEOF || ctx.diagnostics.Count(SeverityError) != 0 {
+		return 0, false
+	}
+
+	return t.Rune, true
+}
+
+var stringizeEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
 // Givenatoken sequence, stringize returns a single string literal token
 // containing the concatenated spellings of the tokens.
 //
 // [1] pg. 3
 func (c *cpp) stringize(s []xc.Token) xc.Token {
 	var a []string
-	for _, v := range s {
+	for _, v := range trimSpace(s) {
 		switch v.Rune {
+		case ' ':
+			// [0]6.10.3.2-2: Each occurrence of white space between
+			// the argument's preprocessing tokens becomes a single
+			// space character in the character string literal.
+			if a[len(a)-1] != " " {
+				a = append(a, " ")
+			}
 		case CHARCONST, LONGCHARCONST, LONGSTRINGLITERAL, STRINGLITERAL:
-			s := fmt.Sprintf("%q", TokSrc(v))
-			a = append(a, s[1:len(s)-1])
+			a = append(a, stringizeEscaper.Replace(TokSrc(v)))
 		default:
 			a = append(a, TokSrc(v))
 		}
@@ -755,89 +961,91 @@ func (c *cpp) directive(r tokenReader, w tokenWriter, cond cond) cond {
 				return cond.pop().push(condIfSkip)
 			case condIfSkip:
 				// nop
+			case condElseOff, condElseOn:
+				c.err(t, "#elif after #else")
 			default:
-				panic(fmt.Errorf("%v: %v", c.position(t), cond.tos()))
+				c.err(t, "#elif without #if")
 			}
 		case idElse:
 			switch cond.tos() {
 			case condIfOff:
-				return cond.pop().push(condIfOn)
-			case condIfOn:
-				return cond.pop().push(condIfOff)
-			case condIfSkip:
-				// nop
+				return cond.pop().push(condElseOn)
+			case condIfOn, condIfSkip:
+				return cond.pop().push(condElseOff)
+			case condElseOff, condElseOn:
+				c.err(t, "#else after #else")
 			default:
-				panic(fmt.Errorf("%v: %v", c.position(t), cond.tos()))
+				c.err(t, "#else without #if")
 			}
 		case idError:
 			if !cond.on() {
 				break
 			}
 
-			panic(fmt.Errorf("%v", c.position(t)))
+			c.err(t, "#error %s", toksDump(trimSpace(line[1:]), ""))
 		case idIf:
 			if !cond.on() {
-				return cond.push(condIfSkip)
+				return c.push(cond, t, condIfSkip)
 			}
 
 			switch {
 			case c.constExpr(line[1:]):
-				return cond.push(condIfOn)
+				return c.push(cond, t, condIfOn)
 			default:
-				return cond.push(condIfOff)
+				return c.push(cond, t, condIfOff)
 			}
 		case idIfdef:
 			if !cond.on() {
-				return cond.push(condIfSkip)
+				return c.push(cond, t, condIfSkip)
 			}
 
 			line = trimAllSpace(line[1:])
 			if len(line) == 0 {
 				c.err(t, "empty #ifdef not allowed")
-				break
+				return c.push(cond, t, condIfSkip)
 			}
 
 			if len(line) > 1 {
 				c.err(t, "extra tokens after #ifdef not allowed")
-				break
+				return c.push(cond, t, condIfSkip)
 			}
 
 			if line[0].Rune != IDENTIFIER {
 				c.err(line[0], "expected identifier")
-				break
+				return c.push(cond, t, condIfSkip)
 			}
 
 			if _, ok := c.macros[line[0].Val]; ok {
-				return cond.push(condIfOn)
+				return c.push(cond, t, condIfOn)
 			}
 
-			return cond.push(condIfOff)
+			return c.push(cond, t, condIfOff)
 		case idIfndef:
 			if !cond.on() {
-				return cond.push(condIfSkip)
+				return c.push(cond, t, condIfSkip)
 			}
 
 			line = trimAllSpace(line[1:])
 			if len(line) == 0 {
 				c.err(t, "empty #ifndef not allowed")
-				break
+				return c.push(cond, t, condIfSkip)
 			}
 
 			if len(line) > 1 {
 				c.err(t, "extra tokens after #ifndef not allowed")
-				break
+				return c.push(cond, t, condIfSkip)
 			}
 
 			if line[0].Rune != IDENTIFIER {
 				c.err(line[0], "expected identifier")
-				break
+				return c.push(cond, t, condIfSkip)
 			}
 
 			if _, ok := c.macros[line[0].Val]; ok {
-				return cond.push(condIfOff)
+				return c.push(cond, t, condIfOff)
 			}
 
-			return cond.push(condIfOn)
+			return c.push(cond, t, condIfOn)
 		case idInclude:
 			if !cond.on() {
 				break
@@ -872,54 +1080,206 @@ func (c *cpp) directive(r tokenReader, w tokenWriter, cond cond) cond {
 				c.include(t, nm, c.includePaths, w)
 				return cond
 			default:
-				panic(PrettyString(line))
+				c.err(line[0], "invalid include file name specification")
 			}
 		case idEndif:
-			switch cond.tos() {
-			case condIfOn, condIfOff, condIfSkip:
-				return cond.pop()
-			default:
-				panic(fmt.Errorf("%v: %v", c.position(t), cond.tos()))
+			if cond.tos() == condZero {
+				c.err(t, "#endif without #if")
+				break
 			}
+
+			c.ifs = c.ifs[:len(c.ifs)-1]
+			return cond.pop()
+		case idLine:
+			if !cond.on() {
+				break
+			}
+
+			c.lineDirective(line)
 		case idPragma:
 			if !cond.on() {
 				break
 			}
 
-			panic(fmt.Errorf("%v", c.position(t)))
+			c.pragma(line, w)
 		case idUndef:
 			if !cond.on() {
 				break
 			}
 
 			line = trimSpace(line[1:])
-			if len(line) == 0 {
-				panic("TODO")
+			switch {
+			case len(line) == 0:
+				c.err(t, "no macro name given in #undef directive")
+			case line[0].Rune != IDENTIFIER:
+				c.err(line[0], "macro names must be identifiers")
+			case !c.isMacroName(line[0]):
+				// nop
+			case len(line) > 1:
+				c.err(line[1], "extra tokens at end of #undef directive")
+			default:
+				c.macroEvents = append(c.macroEvents, macroEvent{nil, line[0]})
+				delete(c.macros, line[0].Val)
 			}
-
-			if len(line) > 1 {
-				panic("TODO")
+		case idWarning:
+			if !cond.on() {
+				break
 			}
 
-			if line[0].Rune != IDENTIFIER {
-				panic("TODO")
+			c.warnPos(t.Pos(), "#warning %s", toksDump(trimSpace(line[1:]), ""))
+		default:
+			if !cond.on() {
+				break
 			}
 
-			delete(c.macros, line[0].Val)
-		case idWarning:
-			panic(fmt.Errorf("%v", c.position(t)))
-		default:
-			panic(fmt.Errorf("%v", c.position(t)))
+			c.err(t, "invalid preprocessing directive #%s", dict.S(t.Val))
 		}
 	default:
-		panic(PrettyString(t))
+		if !cond.on() {
+			break
+		}
+
+		c.err(t, "invalid preprocessing directive")
 	}
 	return cond
 }
 
+// push returns cond with n pushed by the conditional directive t.
+func (c *cpp) push(cond cond, t xc.Token, n condValue) cond {
+	c.ifs = append(c.ifs, t)
+	return cond.push(n)
+}
+
+// unterminated reports the conditional directives opened since c.ifs had n
+// items and not closed by #endif.
+func (c *cpp) unterminated(n int) {
+	for _, v := range c.ifs[n:] {
+		c.err(v, "unterminated #%s", dict.S(v.Val))
+	}
+	c.ifs = c.ifs[:n]
+}
+
+// [0]6.10.4
+func (c *cpp) lineDirective(line []xc.Token) {
+	t := line[0]
+	toks := trimAllSpace(c.expands(trimAllSpace(line[1:])))
+	if len(toks) == 0 || toks[0].Rune != PPNUMBER || strings.TrimLeft(string(toks[0].S()), "0123456789") != "" {
+		c.err(t, "#line directive requires a positive integer argument")
+		return
+	}
+
+	// [0]6.10.4-3: The digit sequence shall not specify zero, nor a
+	// number greater than 2147483647.
+	n, err := strconv.ParseUint(string(toks[0].S()), 10, 31)
+	if err != nil || n == 0 {
+		c.err(toks[0], "line number out of range")
+		return
+	}
+
+	nm := c.position(t).Filename
+	switch toks = toks[1:]; {
+	case len(toks) == 0:
+		// ok
+	case len(toks) == 1 && toks[0].Rune == STRINGLITERAL:
+		s, _, err := unquote(string(toks[0].S()))
+		if err != nil {
+			c.diagnose(SeverityError, "directive-syntax", toks[0].Pos(), "%v", err)
+			return
+		}
+
+		nm = string(s)
+	default:
+		// [0]6.10.4-1: The string literal of a #line directive, if
+		// present, shall be a character string literal.
+		c.err(toks[0], "invalid filename after #line")
+		return
+	}
+
+	f := c.fset.File(t.Pos())
+	if f == nil {
+		return
+	}
+
+	if l := f.PositionFor(line[len(line)-1].Pos(), false).Line; l < f.LineCount() {
+		f.AddLineInfo(f.Offset(f.LineStart(l+1)), nm, int(n))
+	}
+}
+
+// pragma handles the #pragma directive line. Only #pragma pack is
+// recognized, in the forms accepted by gcc: pack(n), pack(), pack(push),
+// pack(push, n) and pack(pop). The resulting maximum member alignment is
+// passed to the parser in a pragmaPack token.
+func (c *cpp) pragma(line []xc.Token, w tokenWriter) {
+	toks := trimAllSpace(line[1:])
+	if len(toks) == 0 || toks[0].Rune != IDENTIFIER || toks[0].Val != idPack {
+		// [0]6.10.6-1: Any such pragma that is not recognized by the
+		// implementation is ignored.
+		return
+	}
+
+	t := toks[0]
+	if toks = toks[1:]; len(toks) < 2 || toks[0].Rune != '(' || toks[len(toks)-1].Rune != ')' {
+		c.warnPos(t.Pos(), "malformed #pragma pack")
+		return
+	}
+
+	is := func(t xc.Token, id int) bool { return t.Rune == IDENTIFIER && t.Val == id }
+	pack := c.pack
+	switch args := toks[1 : len(toks)-1]; {
+	case len(args) == 0:
+		pack = 0
+	case len(args) == 1 && is(args[0], idPush):
+		c.packs = append(c.packs, c.pack)
+	case len(args) == 3 && is(args[0], idPush) && args[1].Rune == ',':
+		n, ok := c.packValue(args[2])
+		if !ok {
+			return
+		}
+
+		c.packs = append(c.packs, c.pack)
+		pack = n
+	case len(args) == 1 && is(args[0], idPop):
+		if len(c.packs) == 0 {
+			c.warnPos(args[0].Pos(), "#pragma pack(pop) encountered without matching #pragma pack(push)")
+			return
+		}
+
+		pack = c.packs[len(c.packs)-1]
+		c.packs = c.packs[:len(c.packs)-1]
+	case len(args) == 1:
+		n, ok := c.packValue(args[0])
+		if !ok {
+			return
+		}
+
+		pack = n
+	default:
+		c.warnPos(t.Pos(), "malformed #pragma pack")
+		return
+	}
+	c.pack = pack
+	w.write(xc.Token{Char: lex.NewChar(t.Pos(), pragmaPack), Val: pack})
+}
+
+// packValue returns the alignment specified by the argument t of #pragma pack.
+func (c *cpp) packValue(t xc.Token) (int, bool) {
+	if t.Rune == PPNUMBER {
+		switch n, err := strconv.ParseUint(string(t.S()), 0, 8); {
+		case err != nil:
+			// handled below
+		case n == 1, n == 2, n == 4, n == 8, n == 16:
+			return int(n), true
+		}
+	}
+
+	c.warnPos(t.Pos(), "alignment must be a small power of two, not %s", t.S())
+	return 0, false
+}
+
 func (c *cpp) include(n Node, nm string, paths []string, w tokenWriter) {
 	if c.includeLevel == maxIncludeLevel {
 		c.err(n, "too many include levels")
+		return
 	}
 
 	c.includeLevel++
@@ -943,15 +1303,18 @@ func (c *cpp) include(n Node, nm string, paths []string, w tokenWriter) {
 	}
 
 	if path == "" {
-		panic(c.position(n))
+		c.err(n, "include file not found: %s", nm)
+		return
 	}
 
 	r, err := c.parse(newFileSource(path))
 	if err != nil {
-		c.err(n, "%s", err.Error())
+		c.diagnose(SeverityError, "include", n.Pos(), "%s", err.Error())
 	}
 
+	ifs := len(c.ifs)
 	c.expand(r, w, cond(nil).push(condZero))
+	c.unterminated(ifs)
 }
 
 func (c *cpp) constExpr(toks []xc.Token) (y bool) {
@@ -979,6 +1342,9 @@ func (c *cpp) constExpr(toks []xc.Token) (y bool) {
 				s[3].Rune = ' '
 				continue
 			}
+
+			c.err(v, "operator \"defined\" requires an identifier")
+			return false
 		}
 	}
 	toks = c.expands(trimAllSpace(toks))
@@ -997,18 +1363,35 @@ func (c *cpp) constExpr(toks []xc.Token) (y bool) {
 
 	e := c.lx.ast.(*ConstExpr)
 	v := e.eval(c.context)
-	if v.Type != Int {
+	switch {
+	case v.Type == Undefined:
+		return false
+	case !v.isIntegerType() || v.Value == nil:
+		// [0]6.10.1-1: The expression that controls conditional
+		// inclusion shall be an integer constant expression.
+		c.err(e, "integer constant expression required")
 		return false
 	}
 
-	switch x := v.Value.(type) {
-	case nil:
-		return false
-	case *ir.Int64Value:
-		return x.Value != 0
+	return v.isNonzero()
+}
+
+// isMacroName reports whether the identifier t can be the subject of a
+// #define or #undef directive. [0]6.10.8-4 reserves defined and the
+// predefined macro names. The latter are defined by the sources named like
+// "<builtin>", so only those are allowed to define them.
+func (c *cpp) isMacroName(t xc.Token) bool {
+	switch {
+	case t.Val == idDefined:
+		// nop
+	case predefinedMacros[t.Val] && !strings.HasPrefix(c.fset.File(t.Pos()).Name(), "<"):
+		// nop
 	default:
-		panic(fmt.Errorf("%T", x))
+		return true
 	}
+
+	c.err(t, "\"%s\" cannot be used as a macro name", t.S())
+	return false
 }
 
 func (c *cpp) define(line []xc.Token) {
@@ -1016,7 +1399,7 @@ func (c *cpp) define(line []xc.Token) {
 	case ' ':
 		c.defineMacro(line[1:])
 	default:
-		panic(PrettyString(line))
+		c.err(line[0], "macro names must be identifiers")
 	}
 }
 
@@ -1032,6 +1415,10 @@ func (c *cpp) defineMacro(line []xc.Token) {
 	switch t := line[0]; t.Rune {
 	case IDENTIFIER:
 		nm := t.Val
+		if !c.isMacroName(t) {
+			return
+		}
+
 		line := line[1:]
 		var repl []xc.Token
 		if len(line) != 0 {
@@ -1044,25 +1431,70 @@ func (c *cpp) defineMacro(line []xc.Token) {
 				c.defineFnMacro(t, line[1:])
 				return
 			default:
-				panic(fmt.Errorf(PrettyString(line[0])))
+				// [0]6.10.3-3: There shall be white-space between the
+				// identifier and the replacement list in the
+				// definition of an object-like macro.
+				c.err(line[0], "missing whitespace after the macro name")
+				repl = line
 			}
 		}
 
+		m := newMacro(t, repl)
+		if !c.checkReplacementList(m) {
+			return
+		}
+
 		if ex := c.macros[nm]; ex != nil {
-			if c.identicalReplacementLists(repl, ex.repl) {
-				return
+			switch {
+			case ex.fnLike:
+				c.err(t, "parameter and/or replacement lists differ").Related = []DiagnosticNote{c.note(ex.def.Pos(), "previous definition")}
+			case c.identicalReplacementLists(repl, ex.repl):
+				c.macroEvents = append(c.macroEvents, macroEvent{m, t})
+			default:
+				c.err(t, "replacement lists differ").Related = []DiagnosticNote{c.note(ex.def.Pos(), "previous definition")}
 			}
-
-			c.err(t, "replacement lists differ")
 			return
 		}
 
-		c.macros[nm] = newMacro(t, repl)
+		c.macroEvents = append(c.macroEvents, macroEvent{m, t})
+		c.macros[nm] = m
 	default:
-		panic(PrettyString(t))
+		c.err(t, "macro names must be identifiers")
 	}
 }
 
+// checkReplacementList reports violations of the constraints [0]6.10.3-5,
+// 6.10.3.2-1 and 6.10.3.3-1 by the replacement list of m.
+func (c *cpp) checkReplacementList(m *macro) bool {
+	repl := m.repl
+	if n := len(repl); n != 0 {
+		for _, v := range []xc.Token{repl[0], repl[n-1]} {
+			if v.Rune == PPPASTE {
+				c.err(v, "'##' cannot appear at either end of a macro expansion")
+				return false
+			}
+		}
+	}
+
+	for i, v := range repl {
+		switch {
+		case v.Rune == IDENTIFIER && v.Val == idVaArgs && !m.variadic:
+			c.err(v, "__VA_ARGS__ can only appear in the expansion of a variadic macro")
+			return false
+		case v.Rune == '#' && m.fnLike:
+			p := repl[i+1:]
+			if len(p) != 0 && p[0].Rune == ' ' {
+				p = p[1:]
+			}
+			if len(p) == 0 || p[0].Rune != IDENTIFIER || !m.isParam(p[0].Val) {
+				c.err(v, "'#' is not followed by a macro parameter")
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (c *cpp) identicalReplacementLists(a, b []xc.Token) bool {
 	if len(a) != len(b) {
 		return false
@@ -1086,41 +1518,81 @@ func (c *cpp) defineFnMacro(nmTok xc.Token, line []xc.Token) {
 		switch v.Rune {
 		case IDENTIFIER:
 			if !ident {
-				panic("TODO")
+				c.err(v, "expected comma in macro parameter list")
+				return
+			}
+
+			if v.Val == idVaArgs {
+				c.err(v, "__VA_ARGS__ can only appear in the expansion of a variadic macro")
+				return
+			}
+
+			for _, w := range params {
+				if w == v.Val {
+					// [0]6.10.3-6: ... A parameter identifier shall be
+					// uniquely declared within its scope.
+					c.err(v, "duplicate macro parameter %q", dict.S(v.Val))
+					return
+				}
 			}
 
 			params = append(params, v.Val)
 			ident = false
 		case ')':
+			if ident && len(params) != 0 {
+				c.err(v, "expected parameter name, found %q", ")")
+				return
+			}
+
 			m := newMacro(nmTok, trimSpace(line[i+1:]))
 			m.fnLike = true
 			m.variadic = variadic
 			m.fp = params
+			if !c.checkReplacementList(m) {
+				return
+			}
+
 			if ex := c.macros[nmTok.Val]; ex != nil {
-				if c.identicalParamLists(params, ex.fp) && c.identicalReplacementLists(m.repl, ex.repl) && m.variadic == ex.variadic {
+				if ex.fnLike && c.identicalParamLists(params, ex.fp) && c.identicalReplacementLists(m.repl, ex.repl) && m.variadic == ex.variadic {
+					c.macroEvents = append(c.macroEvents, macroEvent{m, nmTok})
 					return
 				}
 
-				c.err(nmTok, "parameter and/or replacement lists differ")
+				c.err(nmTok, "parameter and/or replacement lists differ").Related = []DiagnosticNote{c.note(ex.def.Pos(), "previous definition")}
 				return
 			}
 
+			c.macroEvents = append(c.macroEvents, macroEvent{m, nmTok})
 			c.macros[nmTok.Val] = m
 			return
 		case ',':
+			if variadic {
+				c.err(v, "expected ')' after \"...\"")
+				return
+			}
+
 			if ident {
-				panic("TODO")
+				c.err(v, "expected parameter name, found %q", ",")
+				return
 			}
 
 			ident = true
 		case ' ':
 			// nop
 		case DDD:
+			if !ident {
+				c.err(v, "expected comma in macro parameter list")
+				return
+			}
+
 			variadic = true
+			ident = false
 		default:
-			panic(PrettyString(v))
+			c.err(v, "expected parameter name, found %q", TokSrc(v))
+			return
 		}
 	}
+	c.err(nmTok, "missing ')' in macro parameter list")
 }
 
 func (c *cpp) identicalParamLists(a, b []int) bool {
@@ -0,0 +1,384 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package c99
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+// diagnosticCodes maps the message formats of diagnostics to their codes.
+// Messages may change, codes must not. A reworded message needs its entry
+// updated, TestDiagnosticCodes fails for formats having no code.
+var diagnosticCodes = map[string]string{
+	"\"%s\" cannot be used as a macro name": "invalid-macro-name",
+	"#elif after #else":                     "unbalanced-conditional",
+	"#elif without #if":                     "unbalanced-conditional",
+	"#else after #else":                     "unbalanced-conditional",
+	"#else without #if":                     "unbalanced-conditional",
+	"#endif without #if":                    "unbalanced-conditional",
+	"#error %s":                             "error-directive",
+	"#line directive requires a positive integer argument":              "directive-syntax",
+	"#pragma pack(pop) encountered without matching #pragma pack(push)": "pragma-pack",
+	"#warning %s":                                                      "warning-directive",
+	"%s defined as wrong kind of tag":                                  "tag-mismatch",
+	"%v has no member named '%s'":                                      "no-member",
+	"'##' cannot appear at either end of a macro expansion":            "invalid-paste",
+	"'#' is not followed by a macro parameter":                         "invalid-stringize",
+	"'%s' has both 'extern' and initializer":                           "invalid-initializer",
+	"'%s' undeclared":                                                  "undeclared",
+	"[*] not allowed in other than function prototype scope":           "invalid-declarator",
+	"_Pragma takes a parenthesized string literal":                     "directive-syntax",
+	"__VA_ARGS__ can only appear in the expansion of a variadic macro": "va-args",
+	"alignment must be a small power of two, not %s":                   "pragma-pack",
+	"arithmetic on pointer to an incomplete type":                      "incomplete-type",
+	"array index in initializer exceeds array bounds":                  "invalid-designator",
+	"array index in non-array initializer":                             "invalid-designator",
+	"assignment to expression with %v type":                            "not-assignable",
+	"bit-field %q has invalid type":                                    "invalid-bit-field",
+	"called object is not a function":                                  "not-a-function",
+	"calling %s is not supported, nonlocal jumps cannot be lowered":    "setjmp",
+	"case label does not reduce to an integer constant":                "not-integer-constant",
+	"declarator of a function definition does not declare a function":  "invalid-declarator",
+	"division by zero":                                                 "division-by-zero",
+	"duplicate label '%s'":                                             "duplicate-label",
+	"duplicate macro parameter %q":                                     "duplicate-parameter",
+	"duplicate member %q":                                              "duplicate-member",
+	"empty #ifdef not allowed":                                         "directive-syntax",
+	"empty #ifndef not allowed":                                        "directive-syntax",
+	"empty define not allowed":                                         "directive-syntax",
+	"empty include not allowed":                                        "directive-syntax",
+	"empty scalar initializer":                                         "invalid-initializer",
+	"enumerator value for '%s' is not an integer constant":             "not-integer-constant",
+	"excess elements in %s initializer":                                "excess-initializers",
+	"excess elements in scalar initializer":                            "excess-initializers",
+	"expected ')' after \"...\"":                                       "directive-syntax",
+	"expected comma in macro parameter list":                           "directive-syntax",
+	"expected identifier":                                              "directive-syntax",
+	"expected parameter name, found %q":                                "directive-syntax",
+	"extra tokens after #ifdef not allowed":                            "directive-syntax",
+	"extra tokens after #ifndef not allowed":                           "directive-syntax",
+	"extra tokens at end of #undef directive":                          "directive-syntax",
+	"field %q declared as a function":                                  "invalid-type",
+	"field %q has incomplete type":                                     "incomplete-type",
+	"field name not in record or union initializer":                    "invalid-designator",
+	"file is missing final NL":                                         "missing-final-newline",
+	"flexible array member in a struct with no named members":          "flexible-array",
+	"flexible array member in union":                                   "flexible-array",
+	"flexible array member not at end of struct":                       "flexible-array",
+	"function '%s' is initialized like a variable":                     "invalid-initializer",
+	"implicit declaration of function '%s'":                            "implicit-function-declaration",
+	"include file not found: %s":                                       "include",
+	"incompatible types when assigning to type %v from type %v":        "incompatible-types",
+	"incompatible types when initializing %v using %v":                 "incompatible-types",
+	"initialization of a flexible array member":                        "flexible-array",
+	"initializer element is not computable at load time":               "not-constant",
+	"initializer element is not constant":                              "not-constant",
+	"initializer for an array of incomplete type %v":                   "incomplete-type",
+	"initializer for an incomplete type %v":                            "incomplete-type",
+	"initializer-string for array of chars is too long":                "excess-initializers",
+	"integer constant expression required":                             "not-integer-constant",
+	"integer constant is too large":                                    "constant-too-large",
+	"invalid application of sizeof":                                    "invalid-sizeof",
+	"invalid application of sizeof: %v":                                "invalid-sizeof",
+	"invalid combination of type specifiers":                           "invalid-type",
+	"invalid conversion":                                               "invalid-conversion",
+	"invalid filename after #line":                                     "directive-syntax",
+	"invalid floating constant":                                        "invalid-constant",
+	"invalid include file name specification":                          "directive-syntax",
+	"invalid initializer":                                              "invalid-initializer",
+	"invalid integer constant":                                         "invalid-constant",
+	"invalid operand (%v)":                                             "invalid-operands",
+	"invalid operands (%v and %v)":                                     "invalid-operands",
+	"invalid preprocessing directive":                                  "invalid-directive",
+	"invalid preprocessing directive #%s":                              "invalid-directive",
+	"invalid storage class for function '%s'":                          "invalid-storage-class",
+	"invalid suffix %q on integer constant":                            "invalid-constant",
+	"invalid type argument of '->' (have %v)":                          "invalid-operands",
+	"invalid type argument of unary '*' (have %v)":                     "invalid-operands",
+	"invalid use of incomplete type %v":                                "incomplete-type",
+	"label '%s' used but not defined":                                  "undefined-label",
+	"line number out of range":                                         "line-range",
+	"lowering of %s is not supported":                                  "unsupported",
+	"lvalue required as increment or decrement operand":                "lvalue-required",
+	"lvalue required as left operand of assignment":                    "lvalue-required",
+	"lvalue required as unary '&' operand":                             "lvalue-required",
+	"macro %q passed %d arguments, but takes just %d":                  "macro-arguments",
+	"macro %q requires %d arguments, but only %d given":                "macro-arguments",
+	"macro %q requires at least %d arguments, but only %d given":       "macro-arguments",
+	"macro names must be identifiers":                                  "directive-syntax",
+	"malformed #pragma pack":                                           "pragma-pack",
+	"malformed %s":                                                     "attribute-syntax",
+	"missing ')' in macro parameter list":                              "directive-syntax",
+	"missing whitespace after the macro name":                          "directive-syntax",
+	"multi-character character constant":                               "multichar",
+	"multiple storage classes in declaration specifiers":               "invalid-storage-class",
+	"negative width in bit-field %q":                                   "bit-field-width",
+	"no macro name given in #undef directive":                          "directive-syntax",
+	"nonconstant array index in initializer":                           "invalid-designator",
+	"operator \"defined\" requires an identifier":                      "directive-syntax",
+	"parameter and/or replacement lists differ":                        "macro-redefined",
+	"pasting %q and %q does not give a valid preprocessing token":      "invalid-paste",
+	"redefinition of %v":                                               "redefinition",
+	"replacement lists differ":                                         "macro-redefined",
+	"request for member '%s' in something not a structure or union":    "no-member",
+	"requested alignment is not a positive power of 2":                 "invalid-alignment",
+	"shift count out of range":                                         "shift-count",
+	"size of array is negative":                                        "array-size",
+	"size of array is too large":                                       "array-size",
+	"static or type qualifiers in non-parameter array declarator":      "invalid-declarator",
+	"storage class specified for parameter":                            "invalid-storage-class",
+	"subscripted value is neither array nor pointer":                   "invalid-operands",
+	"too few arguments to function":                                    "call-arguments",
+	"too many arguments to function":                                   "call-arguments",
+	"too many include levels":                                          "include-depth",
+	"trigraph ??%c converted to %c":                                    "trigraph",
+	"trigraph ??%c ignored, use EnableTrigraphs to enable":             "trigraph-ignored",
+	"typedef '%s' is initialized":                                      "invalid-initializer",
+	"unexpected type name '%s'":                                        "unexpected-type-name",
+	"unknown field '%s' specified in initializer":                      "invalid-designator",
+	"unsupported argument of attribute %s":                             "attribute",
+	"unsupported long double format":                                   "unsupported",
+	"unsupported size of %v: %v":                                       "unsupported",
+	"unterminated #%s":                                                 "unterminated-conditional",
+	"unterminated argument list invoking macro %q":                     "unexpected-eof",
+	"unterminated comment":                                             "unterminated-comment",
+	"va_start used in a function with fixed arguments":                 "va-start",
+	"width of %q exceeds its type":                                     "bit-field-width",
+	"zero width for bit-field %q":                                      "bit-field-width",
+}
+
+// Diagnostic is an error, warning or note reported by a translation.
+type Diagnostic struct {
+	Code      string           `json:"code"`                // Stable identifier, like "macro-redefined".
+	Expansion []DiagnosticNote `json:"expansion,omitempty"` // Macro expansions producing the token at Pos, innermost first.
+	Fix       *Fix             `json:"fix,omitempty"`       // Suggested edit or nil.
+	Msg       string           `json:"msg"`
+	Pos       token.Position   `json:"pos"`
+	Related   []DiagnosticNote `json:"related,omitempty"` // Secondary positions.
+	Severity  Severity         `json:"severity"`
+}
+
+// DiagnosticNote describes a secondary position of a Diagnostic.
+type DiagnosticNote struct {
+	Msg string         `json:"msg"`
+	Pos token.Position `json:"pos"`
+}
+
+// Fix suggests replacing the source text from Pos up to End by Text.
+type Fix struct {
+	End  token.Position `json:"end"`
+	Pos  token.Position `json:"pos"`
+	Text string         `json:"text"`
+}
+
+// Error implements error. The result has the form of a scanner.Error
+// followed by the notes of the macro expansion stack.
+func (d *Diagnostic) Error() string { return (&scanner.Error{Pos: d.Pos, Msg: d.msg()}).Error() }
+
+func (d *Diagnostic) msg() string {
+	s := d.Msg
+	for _, v := range d.Expansion {
+		s += fmt.Sprintf("\n\t%v: %s", v.Pos, v.Msg)
+	}
+	return s
+}
+
+// Diagnostics is a list of diagnostics. When returned as an error from
+// Translate, it holds at least one error.
+type Diagnostics []*Diagnostic
+
+// Count returns the number of diagnostics of severity s.
+func (l Diagnostics) Count(s Severity) (n int) {
+	for _, v := range l {
+		if v.Severity == s {
+			n++
+		}
+	}
+	return n
+}
+
+// Filter returns the diagnostics for which f returns true.
+func (l Diagnostics) Filter(f func(*Diagnostic) bool) (r Diagnostics) {
+	for _, v := range l {
+		if f(v) {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+// Errors returns the diagnostics of severity SeverityError.
+func (l Diagnostics) Errors() Diagnostics {
+	return l.Filter(func(d *Diagnostic) bool { return d.Severity == SeverityError })
+}
+
+// Warnings returns the diagnostics of severity SeverityWarning.
+func (l Diagnostics) Warnings() Diagnostics {
+	return l.Filter(func(d *Diagnostic) bool { return d.Severity == SeverityWarning })
+}
+
+// Error implements error. Only diagnostics of severity SeverityError are
+// reported, like scanner.ErrorList does.
+func (l Diagnostics) Error() string {
+	switch e := l.Errors(); len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", e[0], len(e)-1)
+	}
+}
+
+// ErrorList returns l converted to a scanner.ErrorList.
+func (l Diagnostics) ErrorList() scanner.ErrorList {
+	var r scanner.ErrorList
+	for _, v := range l {
+		r.Add(v.Pos, v.msg())
+	}
+	return r
+}
+
+// Sort sorts l by position, keeping the order of diagnostics at the same
+// position.
+func (l Diagnostics) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i].Pos, l[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		return a.Column < b.Column
+	})
+}
+
+// JSON writes l to w as a JSON array.
+func (l Diagnostics) JSON(w io.Writer) error {
+	if l == nil {
+		l = Diagnostics{}
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	return e.Encode(l)
+}
+
+// SARIF writes l to w as a SARIF 2.1.0 log of a run of tool. Fix regions are
+// given by byteOffset and byteLength, token.Position offsets being byte
+// offsets while SARIF counts charOffset in units of the run's columnKind.
+func (l Diagnostics) SARIF(w io.Writer, tool string) error {
+	type (
+		obj = map[string]interface{}
+		arr = []interface{}
+	)
+
+	location := func(p token.Position) obj {
+		r := obj{"startLine": p.Line}
+		if p.Column > 0 {
+			r["startColumn"] = p.Column
+		}
+		return obj{"physicalLocation": obj{
+			"artifactLocation": obj{"uri": p.Filename},
+			"region":           r,
+		}}
+	}
+
+	rules := arr{}
+	seen := map[string]bool{}
+	results := arr{}
+	for _, v := range l {
+		if !seen[v.Code] {
+			seen[v.Code] = true
+			rules = append(rules, obj{"id": v.Code})
+		}
+		r := obj{
+			"level":     sarifLevels[v.Severity],
+			"locations": arr{location(v.Pos)},
+			"message":   obj{"text": v.Msg},
+			"ruleId":    v.Code,
+		}
+		var related arr
+		for _, w := range append(append([]DiagnosticNote(nil), v.Related...), v.Expansion...) {
+			x := location(w.Pos)
+			x["message"] = obj{"text": w.Msg}
+			related = append(related, x)
+		}
+		if len(related) != 0 {
+			r["relatedLocations"] = related
+		}
+		if f := v.Fix; f != nil {
+			r["fixes"] = arr{obj{"artifactChanges": arr{obj{
+				"artifactLocation": obj{"uri": f.Pos.Filename},
+				"replacements": arr{obj{
+					"deletedRegion":   obj{"byteOffset": f.Pos.Offset, "byteLength": f.End.Offset - f.Pos.Offset},
+					"insertedContent": obj{"text": f.Text},
+				}},
+			}}}}
+		}
+		results = append(results, r)
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	return e.Encode(obj{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": arr{obj{
+			"columnKind": "unicodeCodePoints",
+			"results":    results,
+			"tool":       obj{"driver": obj{"name": tool, "rules": rules}},
+		}},
+	})
+}
+
+var sarifLevels = [...]string{
+	SeverityError:   "error",
+	SeverityNote:    "note",
+	SeverityWarning: "warning",
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Severity) MarshalText() ([]byte, error) { return []byte(strings.ToLower(s.String())), nil }
+
+// diagnose records a diagnostic of severity s at pos and returns it. The code
+// of the diagnostic is determined by msg unless code is not empty.
+func (c *context) diagnose(s Severity, code string, pos token.Pos, msg string, args ...interface{}) *Diagnostic {
+	if code == "" {
+		if code = diagnosticCodes[msg]; code == "" {
+			code = strings.ToLower(s.String())
+		}
+	}
+	d := &Diagnostic{
+		Code:     code,
+		Msg:      fmt.Sprintf(msg, args...),
+		Pos:      c.fset.PositionFor(pos, true),
+		Severity: s,
+	}
+	c.diagnostics = append(c.diagnostics, d)
+	return d
+}
+
+// fix returns a Fix replacing n bytes at pos by text.
+func (c *context) fix(pos token.Pos, n int, text string) *Fix {
+	return &Fix{
+		End:  c.fset.PositionFor(pos+token.Pos(n), true),
+		Pos:  c.fset.PositionFor(pos, true),
+		Text: text,
+	}
+}
+
+// note returns a DiagnosticNote at pos.
+func (c *context) note(pos token.Pos, msg string, args ...interface{}) DiagnosticNote {
+	return DiagnosticNote{Msg: fmt.Sprintf(msg, args...), Pos: c.fset.PositionFor(pos, true)}
+}
@@ -5,10 +5,13 @@
 package c99
 
 import (
-	"encoding/binary"
+	"fmt"
 	"go/token"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/cznic/golex/lex"
 	"github.com/cznic/ir"
@@ -21,6 +24,103 @@ var (
 	printHooks = strutil.PrettyPrintHooks{}
 )
 
+// dictionary interns encoded macro definitions. A dictionary is owned by a
+// Cache and released together with it. Token values are not stored in a
+// dictionary but in dict, the global xc.Dict, see the package documentation.
+type dictionary struct {
+	b  [][]byte
+	m  map[string]int
+	mu sync.RWMutex
+}
+
+func newDictionary() *dictionary {
+	return &dictionary{b: [][]byte{nil}, m: map[string]int{"": 0}}
+}
+
+// id returns the ID of b. The zero ID is that of the empty value.
+func (d *dictionary) id(b []byte) int {
+	d.mu.RLock()
+	id, ok := d.m[string(b)]
+	d.mu.RUnlock()
+	if ok {
+		return id
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if id, ok := d.m[string(b)]; ok {
+		return id
+	}
+
+	id = len(d.b)
+	d.m[string(b)] = id
+	d.b = append(d.b, append([]byte(nil), b...))
+	return id
+}
+
+// bytes returns the value of id. The result must not be modified.
+func (d *dictionary) bytes(id int) []byte {
+	d.mu.RLock()
+	b := d.b[id]
+	d.mu.RUnlock()
+	return b
+}
+
+// tokenStore is an arena holding the tokens of preprocessing lines. Lines are
+// identified by their index. The tokens are appended to chunks, which are
+// never reallocated, so reading a line returns the stored tokens without
+// decoding or copying them and the arena grows by a chunk, not by doubling. A
+// tokenStore is owned by a translation context or a Cache and released
+// together with it.
+type tokenStore struct {
+	chunks [][]xc.Token // The last one is being filled.
+	lines  []tokenLine  // Line ID: its tokens.
+	mu     sync.RWMutex
+}
+
+// tokenLine locates the tokens of a line in the chunks of a tokenStore.
+type tokenLine struct {
+	chunk, lo, hi uint32
+}
+
+const tokenChunk = 1 << 13 // Tokens per chunk of a tokenStore.
+
+func newTokenStore() *tokenStore {
+	return &tokenStore{chunks: [][]xc.Token{nil}, lines: []tokenLine{{}}}
+}
+
+// put stores a copy of toks and returns its line ID. The zero ID is that of
+// the empty line. A line longer than a chunk gets a chunk of its own.
+func (s *tokenStore) put(toks []xc.Token) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.chunks[len(s.chunks)-1]
+	if len(c)+len(toks) > cap(c) {
+		n := tokenChunk
+		if len(toks) > n {
+			n = len(toks)
+		}
+		c = make([]xc.Token, 0, n)
+		s.chunks = append(s.chunks, c)
+	}
+	lo := len(c)
+	c = append(c, toks...)
+	s.chunks[len(s.chunks)-1] = c
+	s.lines = append(s.lines, tokenLine{uint32(len(s.chunks) - 1), uint32(lo), uint32(len(c))})
+	return len(s.lines) - 1
+}
+
+// line returns the tokens of line id. The result must not be modified.
+func (s *tokenStore) line(id int) []xc.Token {
+	s.mu.RLock()
+	l := s.lines[id]
+	toks := s.chunks[l.chunk][l.lo:l.hi:l.hi]
+	s.mu.RUnlock()
+	return toks
+}
+
 func init() {
 	for k, v := range xc.PrintHooks {
 		printHooks[k] = v
@@ -70,22 +170,41 @@ func init() {
 }
 
 var (
-	idDefine  = dict.SID("define")
-	idDefined = dict.SID("defined")
-	idElif    = dict.SID("elif")
-	idElse    = dict.SID("else")
-	idEndif   = dict.SID("endif")
-	idError   = dict.SID("error")
-	idIf      = dict.SID("if")
-	idIfdef   = dict.SID("ifdef")
-	idIfndef  = dict.SID("ifndef")
-	idInclude = dict.SID("include")
-	idOne     = dict.SID("1")
-	idPragma  = dict.SID("pragma")
-	idUndef   = dict.SID("undef")
-	idVaArgs  = dict.SID("__VA_ARGS__")
-	idWarning = dict.SID("warning")
-	idZero    = dict.SID("0")
+	idAligned  = dict.SID("aligned")
+	idAttr     = dict.SID("__attribute")
+	idAttr2    = dict.SID("__attribute__")
+	idDefine   = dict.SID("define")
+	idDefined  = dict.SID("defined")
+	idElif     = dict.SID("elif")
+	idElse     = dict.SID("else")
+	idEndif    = dict.SID("endif")
+	idError    = dict.SID("error")
+	idIf       = dict.SID("if")
+	idIfdef    = dict.SID("ifdef")
+	idIfndef   = dict.SID("ifndef")
+	idInclude  = dict.SID("include")
+	idLine     = dict.SID("line")
+	idOne      = dict.SID("1")
+	idPack     = dict.SID("pack")
+	idPacked   = dict.SID("packed")
+	idPop      = dict.SID("pop")
+	idPragma   = dict.SID("pragma")
+	idPragmaOp = dict.SID("_Pragma")
+	idPush     = dict.SID("push")
+	idUndef    = dict.SID("undef")
+	idVaArgs   = dict.SID("__VA_ARGS__")
+	idWarning  = dict.SID("warning")
+	idZero     = dict.SID("0")
+
+	// [0]6.10.8-4
+	predefinedMacros = map[int]bool{
+		dict.SID("__DATE__"):         true,
+		dict.SID("__FILE__"):         true,
+		dict.SID("__LINE__"):         true,
+		dict.SID("__STDC_VERSION__"): true,
+		dict.SID("__STDC__"):         true,
+		dict.SID("__TIME__"):         true,
+	}
 
 	keywords = map[int]rune{
 		dict.SID("_Bool"):    BOOL,
@@ -226,21 +345,6 @@ func rune2class(r rune) (c int) {
 	}
 }
 
-func decodeToken(b []byte, pos token.Pos) ([]byte, token.Pos, xc.Token) {
-	r, n := binary.Uvarint(b)
-	b = b[n:]
-	d, n := binary.Uvarint(b)
-	b = b[n:]
-	np := pos + token.Pos(d)
-	c := lex.NewChar(np, rune(r))
-	var v uint64
-	if _, ok := tokHasVal[c.Rune]; ok {
-		v, n = binary.Uvarint(b)
-		b = b[n:]
-	}
-	return b, np, xc.Token{Char: c, Val: int(v)}
-}
-
 // TokSrc returns t in its source form.
 func TokSrc(t xc.Token) string {
 	if x, ok := tokConstVals[t.Rune]; ok {
@@ -253,3 +357,119 @@ func TokSrc(t xc.Token) string {
 
 	return string(t.Rune)
 }
+
+// [0]6.4.4.4
+var simpleEscapes = map[byte]rune{
+	'a': '\a',
+	'b': '\b',
+	'f': '\f',
+	'n': '\n',
+	'r': '\r',
+	't': '\t',
+	'v': '\v',
+}
+
+// [0]6.4.4.4, 6.4.5: unquote decodes the escape sequences of the quoted
+// character constant or string literal s, possibly having the L prefix.
+// Concatenated string literals, separated by white space, are decoded as a
+// whole. The items of a narrow literal are bytes, those of a wide literal
+// are code points.
+func unquote(s string) (r []rune, wide bool, err error) {
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, " \t\n") {
+		if s[0] == 'L' {
+			wide = true
+			s = s[1:]
+		}
+		if s == "" || s[0] != '"' && s[0] != '\'' {
+			return nil, false, fmt.Errorf("invalid literal")
+		}
+
+		q := s[0]
+		s = s[1:]
+		for {
+			if s == "" {
+				return nil, false, fmt.Errorf("missing terminating %c character", q)
+			}
+
+			c, sz := utf8.DecodeRuneInString(s)
+			if c == rune(q) {
+				s = s[sz:]
+				break
+			}
+
+			if c != '\\' {
+				r = appendItem(r, c, wide)
+				s = s[sz:]
+				continue
+			}
+
+			if s = s[1:]; s == "" {
+				return nil, false, fmt.Errorf("invalid escape sequence")
+			}
+
+			switch c := s[0]; c {
+			case '\'', '"', '?', '\\':
+				r = append(r, rune(c))
+				s = s[1:]
+			case 'a', 'b', 'f', 'n', 'r', 't', 'v':
+				r = append(r, simpleEscapes[c])
+				s = s[1:]
+			case 'x':
+				n := 1
+				for n < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[n]) >= 0 {
+					n++
+				}
+				v, err := strconv.ParseUint(s[1:n], 16, 32)
+				if err != nil || !wide && v > 0xff {
+					return nil, false, fmt.Errorf("hex escape sequence out of range")
+				}
+
+				r = append(r, rune(v))
+				s = s[n:]
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n := 1
+				for n < len(s) && n < 3 && s[n] >= '0' && s[n] <= '7' {
+					n++
+				}
+				v, _ := strconv.ParseUint(s[:n], 8, 32)
+				if !wide && v > 0xff {
+					return nil, false, fmt.Errorf("octal escape sequence out of range")
+				}
+
+				r = append(r, rune(v))
+				s = s[n:]
+			case 'u', 'U':
+				n := 5
+				if c == 'U' {
+					n = 9
+				}
+				if len(s) < n {
+					return nil, false, fmt.Errorf("incomplete universal character name")
+				}
+
+				v, err := strconv.ParseUint(s[1:n], 16, 32)
+				if err != nil {
+					return nil, false, fmt.Errorf("incomplete universal character name")
+				}
+
+				r = appendItem(r, rune(v), wide)
+				s = s[n:]
+			default:
+				return nil, false, fmt.Errorf("unknown escape sequence: \\%c", c)
+			}
+		}
+	}
+	return r, wide, nil
+}
+
+func appendItem(r []rune, c rune, wide bool) []rune {
+	if wide || c < utf8.RuneSelf {
+		return append(r, c)
+	}
+
+	var b [utf8.UTFMax]byte
+	for _, v := range b[:utf8.EncodeRune(b[:], c)] {
+		r = append(r, rune(v))
+	}
+	return r
+}
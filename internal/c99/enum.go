@@ -39,9 +39,38 @@ const (
 	DoubleComplex
 	LongDoubleComplex
 
+	Array
+	Function
+	Ptr
+	Struct
+	Union
+	Void
+
 	maxTypeKind
 )
 
+// Linkage represents the linkage of an identifier.
+type Linkage int
+
+// Linkage values.
+const (
+	LinkageNone Linkage = iota
+	LinkageInternal
+	LinkageExternal
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+// Severity values.
+const (
+	_ Severity = iota
+
+	SeverityNote
+	SeverityWarning
+	SeverityError
+)
+
 type condValue int
 
 const (
@@ -51,12 +80,16 @@ const (
 	condIfOn
 	condIfSkip
 
+	condElseOff
+	condElseOn
+
 	maxCond
 )
 
 var (
 	condOn = [maxCond]bool{
-		condIfOn: true,
-		condZero: true,
+		condElseOn: true,
+		condIfOn:   true,
+		condZero:   true,
 	}
 )
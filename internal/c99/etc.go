@@ -50,6 +50,13 @@ func trimSpace(toks []xc.Token) []xc.Token {
 	return toks
 }
 
+func trimRightSpace(toks []xc.Token) []xc.Token {
+	for len(toks) != 0 && toks[len(toks)-1].Rune == ' ' {
+		toks = toks[:len(toks)-1]
+	}
+	return toks
+}
+
 func trimAllSpace(toks []xc.Token) []xc.Token {
 	w := 0
 	for _, v := range toks {
@@ -72,13 +79,11 @@ func errString(err error) string {
 
 func printError(w io.Writer, pref string, err error) {
 	switch x := err.(type) {
+	case Diagnostics:
+		printError(w, pref, x.Errors().ErrorList())
 	case scanner.ErrorList:
-		for i, v := range x {
+		for _, v := range x {
 			fmt.Fprintf(w, "%s%v\n", pref, v)
-			if i == 50 {
-				fmt.Fprintln(w, "too many errors")
-				break
-			}
 		}
 	default:
 		fmt.Fprintf(w, "%s%v\n", pref, err)
@@ -0,0 +1,144 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package c99
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cznic/golex/lex"
+)
+
+// fuzzSeedSize is the approximate size of the pieces the SQLite sources are
+// split into for the seed corpus.
+const fuzzSeedSize = 4 << 10
+
+// fuzzSeeds adds the files of testdata and, when fuzzing, pieces of the
+// SQLite sources to the seed corpus of f. Plain test runs check only the
+// testdata seeds, the SQLite ones take seconds.
+func fuzzSeeds(f *testing.F) {
+	if err := filepath.Walk("testdata", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(path, ".expect") {
+			return err
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		f.Add(b)
+		return nil
+	}); err != nil {
+		f.Fatal(err)
+	}
+
+	if flag.Lookup("test.fuzz").Value.String() == "" {
+		return
+	}
+
+	for _, v := range []string{"sqlite3.h", "shell.c"} {
+		b, err := ioutil.ReadFile(filepath.Join(filepath.FromSlash(sqliteDir), v))
+		if err != nil {
+			continue
+		}
+
+		for len(b) != 0 {
+			n := len(b)
+			if n > fuzzSeedSize {
+				n = fuzzSeedSize + bytes.IndexByte(b[fuzzSeedSize:], '\n') + 1
+				if n <= fuzzSeedSize {
+					n = len(b)
+				}
+			}
+			f.Add(b[:n])
+			b = b[n:]
+		}
+	}
+}
+
+// fuzzContext returns a context faking includes, so fuzzing does not depend
+// on the file system.
+func fuzzContext(t *testing.T) *context {
+	ctx, err := newContext(token.NewFileSet(), &Tweaks{cppExpandTest: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ctx.model, err = newModel(); err != nil {
+		t.Fatal(err)
+	}
+
+	return ctx
+}
+
+// fuzzErr fails t unless err is nil or reports the input. The preprocessor
+// recovers every panic, including runtime errors, as a panicError, so a
+// panicError wrapping a runtime.Error or reporting a PANIC fails t as well.
+func fuzzErr(t *testing.T, err error) {
+	switch x := err.(type) {
+	case nil, Diagnostics:
+		// ok
+	case panicError:
+		var re runtime.Error
+		if errors.As(x.error, &re) || strings.Contains(x.Error(), "PANIC") {
+			t.Fatalf("%v", x)
+		}
+	default:
+		t.Fatalf("%T: %v", x, x)
+	}
+}
+
+// FuzzScan checks tokenizing arbitrary bytes and reading the tokens back.
+func FuzzScan(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		c := newCPP(fuzzContext(t))
+		r, err := c.parse(newStringSource("fuzz.c", string(b)))
+		if err != nil {
+			fuzzErr(t, err)
+			return
+		}
+
+		for r.read().Rune != lex.RuneEOF {
+		}
+	})
+}
+
+// FuzzCPP checks preprocessing arbitrary bytes.
+func FuzzCPP(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		c := newCPP(fuzzContext(t))
+		r, err := c.parse(newStringSource("fuzz.c", string(b)))
+		if err != nil {
+			fuzzErr(t, err)
+			return
+		}
+
+		var w tokenBuffer
+		fuzzErr(t, c.eval(r, &w))
+	})
+}
+
+// FuzzTranslate checks preprocessing and parsing arbitrary bytes.
+func FuzzTranslate(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		_, err := Translate(&Tweaks{cppExpandTest: true}, nil, nil, newStringSource("fuzz.c", string(b)))
+		fuzzErr(t, err)
+	})
+}
@@ -0,0 +1,272 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package godefs
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cznic/sqlite2go/internal/c99"
+)
+
+func caller(s string, va ...interface{}) {
+	if s == "" {
+		s = strings.Repeat("%v ", len(va))
+	}
+	_, fn, fl, _ := runtime.Caller(2)
+	fmt.Fprintf(os.Stderr, "# caller: %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintf(os.Stderr, s, va...)
+	fmt.Fprintln(os.Stderr)
+	_, fn, fl, _ = runtime.Caller(1)
+	fmt.Fprintf(os.Stderr, "# \tcallee: %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintln(os.Stderr)
+	os.Stderr.Sync()
+}
+
+func dbg(s string, va ...interface{}) {
+	if s == "" {
+		s = strings.Repeat("%v ", len(va))
+	}
+	_, fn, fl, _ := runtime.Caller(1)
+	fmt.Fprintf(os.Stderr, "# dbg %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintf(os.Stderr, s, va...)
+	fmt.Fprintln(os.Stderr)
+	os.Stderr.Sync()
+}
+
+func TODO(...interface{}) string { //TODOOK
+	_, fn, fl, _ := runtime.Caller(1)
+	return fmt.Sprintf("# TODO: %s:%d:\n", path.Base(fn), fl) //TODOOK
+}
+
+func use(...interface{}) {}
+
+func init() {
+	use(caller, dbg, TODO) //TODOOK
+}
+
+// ============================================================================
+
+const src = `/*
+** Result codes.
+*/
+#define SQLITE_OK           0   /* Successful result */
+/* beginning-of-error-codes */
+#define SQLITE_ERROR        1   /* Generic error */
+#define SQLITE_IOERR       10   /* Some kind of disk I/O error occurred */
+#define SQLITE_IOERR_READ  (SQLITE_IOERR | (1<<8))
+#define SQLITE_STATIC      ((void*)0)
+#define SQLITE_VERSION     "3.19.3"
+#define BIG                0xffffffff
+#define NEG                (-1)
+#define MASK               (~0UL)
+#define HALF               0.5
+#define HALFF              .5f
+#define CH                 'A'
+#define SZ                 sizeof(int)
+#define NOTCONST           x
+#define EMPTY
+
+// Rounds up to a multiple of 8.
+#define ROUND8(x)     (((x)+7)&~7)
+#define MAX(a, b)     ((a) > (b) ? (a) : (b))
+#define IS_ODD(x)     ((x) & 1)
+#define ISNEG(x)      ((x) < 0)
+#define UNSIGNED(x)   ((unsigned)(x) >> 1)
+#define SHIFT(n)      (1 << (n))
+#define STR(x)        #x
+#define CALL(x)       f(x)
+
+int sqlite3_libversion_number(void);
+`
+
+const exp = `package foo
+
+const (
+	// Result codes.
+	SQLITE_OK int32 = 0 // Successful result
+	// beginning-of-error-codes
+	SQLITE_ERROR      int32   = 1  // Generic error
+	SQLITE_IOERR      int32   = 10 // Some kind of disk I/O error occurred
+	SQLITE_IOERR_READ int32   = 266
+	SQLITE_VERSION            = "3.19.3"
+	BIG               uint32  = 4294967295
+	NEG               int32   = -1
+	MASK              uint64  = 18446744073709551615
+	HALF              float64 = 0.5
+	HALFF             float32 = 0.5
+	CH                int32   = 65
+	SZ                uint64  = 4
+)
+
+// Rounds up to a multiple of 8.
+func ROUND8(x int32) int32 { return (x + 7) & -8 }
+
+func MAX(a, b int32) int32 {
+	return func() int32 {
+		if a > b {
+			return a
+		}
+
+		return b
+	}()
+}
+
+func IS_ODD(x int32) int32 { return x & 1 }
+
+func ISNEG(x int32) int32 { return bool2int(x < 0) }
+
+func UNSIGNED(x int32) uint32 { return uint32(x) >> 1 }
+
+func SHIFT(n int32) int32 { return int32(1) << n }
+
+func bool2int(b bool) int32 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+`
+
+func TestFprint(t *testing.T) {
+	tu, err := c99.Translate(&c99.Tweaks{MacroComments: true}, nil, nil, c99.NewStringSource("test.h", src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list []*c99.Macro
+	for _, v := range tu.Macros.Events {
+		list = append(list, v.Macro)
+	}
+	var buf bytes.Buffer
+	var errs []string
+	c := &Config{
+		Package: "foo",
+		Errors: func(m *c99.Macro, err error) {
+			errs = append(errs, fmt.Sprintf("%s: %v", m.Name, err))
+		},
+	}
+	if err := c.Fprint(&buf, tu.Macros, list); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := buf.String(), exp; g != e {
+		t.Errorf("\ngot\n%s\nexp\n%s", g, e)
+	}
+
+	for _, v := range []string{"SQLITE_STATIC", "NOTCONST", "EMPTY", "STR", "CALL"} {
+		found := false
+		for _, w := range errs {
+			found = found || strings.HasPrefix(w, v+":")
+		}
+		if !found {
+			t.Errorf("%s: missing error, got %q", v, errs)
+		}
+	}
+	if g, e := len(errs), 5; g != e {
+		t.Errorf("got %v errors, exp %v: %q", g, e, errs)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "foo.go", buf.Bytes(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&types.Config{}).Check("foo", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFprintSQLite translates the SQLITE_* macros of sqlite3.h.
+func TestFprintSQLite(t *testing.T) {
+	path := filepath.FromSlash("../../../_sqlite/sqlite-amalgamation-3210000/sqlite3.h")
+	if _, err := os.Stat(path); err != nil {
+		t.Skip(err)
+	}
+
+	tu, err := c99.Translate(
+		&c99.Tweaks{MacroComments: true},
+		nil,
+		[]string{filepath.FromSlash("../testdata/gcc/include")},
+		c99.NewBuiltinSource(),
+		c99.NewStringSource("<predef>", "typedef __builtin_va_list va_list;\n"),
+		c99.NewFileSource(path),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := tu.Macros.Find("SQLITE_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n := 0
+	c := &Config{
+		Package: "sqlite3",
+		Errors:  func(*c99.Macro, error) { n++ },
+	}
+	if err := c.Fprint(&buf, tu.Macros, list); err != nil {
+		t.Fatal(err)
+	}
+
+	// SQLITE_API and friends are empty, SQLITE_STATIC and SQLITE_TRANSIENT
+	// are pointers.
+	if g, e := len(list)-n, 377; g != e {
+		t.Errorf("got %v translated macros, exp %v", g, e)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "sqlite3.go", buf.Bytes(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg, err := (&types.Config{}).Check("sqlite3", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		name string
+		typ  string
+		val  string
+	}{
+		{"SQLITE_OK", "int32", "0"},
+		{"SQLITE_ERROR", "int32", "1"},
+		{"SQLITE_DONE", "int32", "101"},
+		{"SQLITE_IOERR_READ", "int32", "266"},
+		{"SQLITE_OPEN_READWRITE", "int32", "2"},
+		{"SQLITE_OPEN_CREATE", "int32", "4"},
+		{"SQLITE_LIMIT_WORKER_THREADS", "int32", "11"},
+		{"SQLITE_VERSION", "untyped string", `"3.21.0"`},
+	} {
+		c, ok := pkg.Scope().Lookup(v.name).(*types.Const)
+		if !ok {
+			t.Errorf("%s: not a constant", v.name)
+			continue
+		}
+
+		if g, e := c.Type().String(), v.typ; g != e {
+			t.Errorf("%s: got type %s exp %s", v.name, g, e)
+		}
+		if g, e := c.Val().ExactString(), v.val; g != e {
+			t.Errorf("%s: got %s exp %s", v.name, g, e)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package godefs translates C macros to Go declarations.
+//
+// Object-like macros expanding to constant expressions become typed Go
+// constants. Function-like macros with named parameters expanding to
+// expressions of their parameters become Go functions having int32
+// parameters. The macro comments, if recorded, become Go comments.
+//
+// The Go types are those of the C types on LP64 targets.
+//
+//	C                                  Go
+//	_Bool                              bool
+//	char, signed char                  int8
+//	unsigned char                      uint8
+//	short                              int16
+//	unsigned short                     uint16
+//	int                                int32
+//	unsigned                           uint32
+//	long, long long                    int64
+//	unsigned long, unsigned long long  uint64
+//	float                              float32
+//	double, long double                float64
+//	char[], wchar_t[]                  untyped string
+package godefs
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cznic/ir"
+	"github.com/cznic/sqlite2go/internal/c99"
+	"github.com/cznic/xc"
+)
+
+type goType struct {
+	name   string
+	size   int
+	signed bool
+	float  bool
+}
+
+var (
+	boolType  = goType{name: "bool", size: 1}
+	int32Type = goType{name: "int32", size: 4, signed: true}
+
+	goTypes = map[c99.TypeKind]goType{
+		c99.Bool:       boolType,
+		c99.Char:       {"int8", 1, true, false},
+		c99.Double:     {"float64", 8, true, true},
+		c99.Float:      {"float32", 4, true, true},
+		c99.Int:        int32Type,
+		c99.Long:       {"int64", 8, true, false},
+		c99.LongDouble: {"float64", 8, true, true},
+		c99.LongLong:   {"int64", 8, true, false},
+		c99.SChar:      {"int8", 1, true, false},
+		c99.Short:      {"int16", 2, true, false},
+		c99.UChar:      {"uint8", 1, false, false},
+		c99.UInt:       {"uint32", 4, false, false},
+		c99.ULong:      {"uint64", 8, false, false},
+		c99.ULongLong:  {"uint64", 8, false, false},
+		c99.UShort:     {"uint16", 2, false, false},
+	}
+)
+
+// Config controls the output of Fprint.
+type Config struct {
+	// If not empty, the output starts with a package clause.
+	Package string
+
+	// If not nil, Errors is called for every macro which is not
+	// translated.
+	Errors func(m *c99.Macro, err error)
+}
+
+// Fprint writes Go declarations of the macros in list, defined in macros, to
+// w. Macros which cannot be translated are skipped.
+func (c *Config) Fprint(w io.Writer, macros *c99.Macros, list []*c99.Macro) error {
+	var consts, funcs bytes.Buffer
+	g := &gen{}
+	for _, m := range list {
+		var err error
+		switch {
+		case m.IsFnLike:
+			err = g.fn(&funcs, macros, m)
+		default:
+			err = g.constant(&consts, macros, m)
+		}
+		if err != nil && c.Errors != nil {
+			c.Errors(m, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if c.Package != "" {
+		fmt.Fprintf(&buf, "package %s\n\n", c.Package)
+	}
+	if consts.Len() != 0 {
+		fmt.Fprintf(&buf, "const (\n%s)\n\n", consts.Bytes())
+	}
+	buf.Write(funcs.Bytes())
+	if g.bool2int {
+		buf.WriteString("func bool2int(b bool) int32 {\n\tif b {\n\t\treturn 1\n\t}\n\n\treturn 0\n}\n")
+	}
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// Fprint writes Go declarations of the macros in list, defined in macros, to
+// w using the default Config.
+func Fprint(w io.Writer, macros *c99.Macros, list []*c99.Macro) error {
+	return (&Config{}).Fprint(w, macros, list)
+}
+
+type gen struct {
+	bool2int bool // The bool2int helper is used.
+	err      error
+}
+
+func (g *gen) constant(w *bytes.Buffer, macros *c99.Macros, m *c99.Macro) error {
+	v, err := macros.Eval(m.Name)
+	if err != nil {
+		return err
+	}
+
+	var s string
+	switch x := v.Value.(type) {
+	case *ir.StringValue:
+		s = fmt.Sprintf("%s = %s", m.Name, strconv.Quote(string(xc.Dict.S(int(x.StringID)))))
+	default:
+		t, ok := goTypes[v.Type.Kind()]
+		if !ok {
+			return fmt.Errorf("%s: unsupported type %v", m.Name, v.Type)
+		}
+
+		s = fmt.Sprintf("%s %s = %s", m.Name, t.name, g.literal(v, t))
+	}
+	if g.err != nil {
+		err, g.err = g.err, nil
+		return fmt.Errorf("%s: %v", m.Name, err)
+	}
+
+	writeDoc(w, m.Doc, "\t")
+	fmt.Fprintf(w, "\t%s%s\n", s, comment(m.Comment))
+	return nil
+}
+
+func (g *gen) fn(w *bytes.Buffer, macros *c99.Macros, m *c99.Macro) error {
+	n, err := macros.Func(m.Name)
+	if err != nil {
+		return err
+	}
+
+	t, ok := goTypes[n.Value.Type.Kind()]
+	if !ok || t == boolType {
+		t = int32Type
+	}
+	x := g.num(g.expr(n), t)
+	if g.err != nil {
+		err, g.err = g.err, nil
+		return fmt.Errorf("%s: %v", m.Name, err)
+	}
+
+	var params string
+	if len(m.Params) != 0 {
+		params = strings.Join(m.Params, ", ") + " int32"
+	}
+	writeDoc(w, m.Doc, "")
+	fmt.Fprintf(w, "func %s(%s) %s { return %s }%s\n\n", m.Name, params, t.name, x.src, comment(m.Comment))
+	return nil
+}
+
+// Go operator precedence, primary and unary expressions have precedence 6.
+const (
+	precOrOr = iota + 1
+	precAndAnd
+	precCmp
+	precAdd
+	precMul
+	precUnary
+)
+
+// expr is a Go expression of type t.
+type expr struct {
+	prec int
+	src  string
+	t    goType
+	val  *c99.Value // Value of a constant expression.
+}
+
+var binaryOps = map[c99.ExprCase]struct {
+	op   string
+	prec int
+}{
+	c99.ExprAdd: {"+", precAdd},
+	c99.ExprAnd: {"&", precMul},
+	c99.ExprDiv: {"/", precMul},
+	c99.ExprEq:  {"==", precCmp},
+	c99.ExprGe:  {">=", precCmp},
+	c99.ExprGt:  {">", precCmp},
+	c99.ExprLe:  {"<=", precCmp},
+	c99.ExprLsh: {"<<", precMul},
+	c99.ExprLt:  {"<", precCmp},
+	c99.ExprMod: {"%", precMul},
+	c99.ExprMul: {"*", precMul},
+	c99.ExprNe:  {"!=", precCmp},
+	c99.ExprOr:  {"|", precAdd},
+	c99.ExprRsh: {">>", precMul},
+	c99.ExprSub: {"-", precAdd},
+	c99.ExprXor: {"^", precAdd},
+
+	c99.ExprLAnd: {"&&", precAndAnd},
+	c99.ExprLOr:  {"||", precOrOr},
+}
+
+func (g *gen) expr(n *c99.Expr) expr {
+	if v := n.Value; v != nil && v.Value != nil {
+		t, ok := goTypes[v.Type.Kind()]
+		if !ok {
+			g.errorf("unsupported type %v", v.Type)
+			return expr{}
+		}
+
+		return expr{prec: precUnary, src: g.literal(v, t), t: t, val: v}
+	}
+
+	switch n.Case {
+	case c99.ExprIdent:
+		return expr{prec: precUnary, src: string(xc.Dict.S(n.Token.Val)), t: int32Type}
+	case c99.ExprPExprList:
+		if n.ExprList.ExprList != nil {
+			break
+		}
+
+		return g.expr(n.ExprList.Expr)
+	case c99.ExprNot:
+		x := g.cond(g.expr(n.Expr))
+		return expr{prec: precUnary, src: "!" + paren(x, precUnary), t: boolType}
+	case c99.ExprUnaryPlus, c99.ExprUnaryMinus, c99.ExprCpl:
+		x := g.expr(n.Expr)
+		t := promote(x.t)
+		op := map[c99.ExprCase]string{c99.ExprUnaryPlus: "+", c99.ExprUnaryMinus: "-", c99.ExprCpl: "^"}[n.Case]
+		return expr{prec: precUnary, src: op + paren(g.num(x, t), precUnary), t: t}
+	case c99.ExprCast:
+		x := g.expr(n.Expr)
+		t, ok := goTypes[n.Value.Type.Kind()]
+		if !ok {
+			break
+		}
+
+		if t == boolType {
+			return g.cond(x)
+		}
+
+		if x.t == boolType {
+			return g.num(x, t)
+		}
+
+		return expr{prec: precUnary, src: fmt.Sprintf("%s(%s)", t.name, x.src), t: t}
+	case c99.ExprCond:
+		if n.ExprList.ExprList != nil {
+			break
+		}
+
+		t, ok := goTypes[n.Value.Type.Kind()]
+		if !ok {
+			break
+		}
+
+		c := g.cond(g.expr(n.Expr))
+		a := g.num(g.expr(n.ExprList.Expr), t)
+		b := g.num(g.expr(n.Expr2), t)
+		return expr{
+			prec: precUnary,
+			src:  fmt.Sprintf("func() %s {\nif %s {\nreturn %s\n}\n\nreturn %s\n}()", t.name, c.src, a.src, b.src),
+			t:    t,
+		}
+	case c99.ExprLAnd, c99.ExprLOr:
+		op := binaryOps[n.Case]
+		a, b := g.cond(g.expr(n.Expr)), g.cond(g.expr(n.Expr2))
+		return g.binary(a, op.op, op.prec, b, boolType)
+	case c99.ExprLsh, c99.ExprRsh:
+		op := binaryOps[n.Case]
+		a, b := g.expr(n.Expr), g.expr(n.Expr2)
+		t := promote(a.t)
+		a = g.num(a, t)
+		if a.val != nil {
+			a.src = fmt.Sprintf("%s(%s)", t.name, a.src)
+		}
+		return g.binary(a, op.op, op.prec, g.num(b, promote(b.t)), t)
+	default:
+		op, ok := binaryOps[n.Case]
+		if !ok {
+			break
+		}
+
+		a, b := g.expr(n.Expr), g.expr(n.Expr2)
+		t := common(a.t, b.t)
+		a, b = g.num(a, t), g.num(b, t)
+		if op.prec == precCmp {
+			return g.binary(a, op.op, op.prec, b, boolType)
+		}
+
+		return g.binary(a, op.op, op.prec, b, t)
+	}
+
+	g.errorf("%v: unsupported expression", n.Case)
+	return expr{}
+}
+
+func (g *gen) binary(a expr, op string, prec int, b expr, t goType) expr {
+	return expr{prec: prec, src: fmt.Sprintf("%s %s %s", paren(a, prec), op, paren(b, prec+1)), t: t}
+}
+
+// cond converts x to a Go boolean expression.
+func (g *gen) cond(x expr) expr {
+	if x.t == boolType {
+		return x
+	}
+
+	return expr{prec: precCmp, src: paren(x, precCmp+1) + " != 0", t: boolType}
+}
+
+// num converts x to a Go expression of numeric type t.
+func (g *gen) num(x expr, t goType) expr {
+	switch {
+	case x.t == t:
+		return x
+	case x.val != nil:
+		return expr{prec: precUnary, src: g.literal(x.val, t), t: t, val: x.val}
+	case x.t == boolType:
+		g.bool2int = true
+		x = expr{prec: precUnary, src: fmt.Sprintf("bool2int(%s)", x.src), t: int32Type}
+		if t == int32Type {
+			return x
+		}
+	}
+
+	return expr{prec: precUnary, src: fmt.Sprintf("%s(%s)", t.name, x.src), t: t}
+}
+
+func paren(x expr, prec int) string {
+	if x.prec < prec {
+		return "(" + x.src + ")"
+	}
+
+	return x.src
+}
+
+// promote returns the type of t after the integer promotions.
+func promote(t goType) goType {
+	if !t.float && t.size < 4 {
+		return int32Type
+	}
+
+	return t
+}
+
+// common returns the type of the usual arithmetic conversions of a and b.
+func common(a, b goType) goType {
+	switch {
+	case a.float || b.float:
+		if b.float && (!a.float || b.size > a.size) {
+			return b
+		}
+
+		return a
+	}
+
+	a, b = promote(a), promote(b)
+	switch {
+	case a == b:
+		return a
+	case a.size == b.size:
+		if a.signed {
+			return b
+		}
+
+		return a
+	case a.size > b.size:
+		return a
+	default:
+		return b
+	}
+}
+
+// literal returns the value of v converted to t as a Go literal.
+func (g *gen) literal(v *c99.Value, t goType) string {
+	var (
+		f       float64
+		i       int64
+		isFloat bool
+	)
+	switch x := v.Value.(type) {
+	case *ir.Int64Value:
+		i = x.Value
+		f = float64(i)
+		if s, ok := goTypes[v.Type.Kind()]; ok && !s.signed {
+			f = float64(uint64(i))
+		}
+	case *ir.Float32Value:
+		f, isFloat = float64(x.Value), true
+	case *ir.Float64Value:
+		f, isFloat = x.Value, true
+	default:
+		g.errorf("unsupported value %T", x)
+		return ""
+	}
+
+	switch {
+	case t == boolType:
+		return strconv.FormatBool(isFloat && f != 0 || !isFloat && i != 0)
+	case t.float:
+		s := strconv.FormatFloat(f, 'g', -1, 8*t.size)
+		if strings.Contains(s, "Inf") || strings.Contains(s, "NaN") {
+			g.errorf("value out of range: %v", s)
+		}
+		return s
+	}
+
+	if isFloat {
+		i = int64(f)
+		if !t.signed && f >= 1<<63 {
+			i = int64(uint64(f))
+		}
+	}
+	n := uint(64 - 8*t.size)
+	if t.signed {
+		return strconv.FormatInt(i<<n>>n, 10)
+	}
+
+	return strconv.FormatUint(uint64(i)<<n>>n, 10)
+}
+
+func (g *gen) errorf(s string, args ...interface{}) {
+	if g.err == nil {
+		g.err = fmt.Errorf(s, args...)
+	}
+}
+
+// commentLines returns the text of the C comments in s.
+func commentLines(s string) (r []string) {
+	for _, v := range strings.Split(s, "\n") {
+		v = strings.TrimSpace(v)
+		v = strings.TrimPrefix(v, "//")
+		v = strings.TrimPrefix(v, "/*")
+		v = strings.TrimSuffix(v, "*/")
+		v = strings.TrimSpace(strings.TrimLeft(v, "*"))
+		if v == "" && len(r) == 0 {
+			continue
+		}
+
+		r = append(r, v)
+	}
+	for len(r) != 0 && r[len(r)-1] == "" {
+		r = r[:len(r)-1]
+	}
+	return r
+}
+
+func writeDoc(w *bytes.Buffer, s, indent string) {
+	for _, v := range commentLines(s) {
+		if v == "" {
+			fmt.Fprintf(w, "%s//\n", indent)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s// %s\n", indent, v)
+	}
+}
+
+func comment(s string) string {
+	if a := commentLines(s); len(a) != 0 {
+		return " // " + strings.Join(a, " ")
+	}
+
+	return ""
+}
@@ -0,0 +1,734 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package c99
+
+// [0]: http://www.open-std.org/jtc1/sc22/wg14/www/docs/n1256.pdf
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/cznic/ir"
+)
+
+// Image is the initial content of an object with static storage duration, as
+// computed from its initializer.
+type Image struct {
+	Data   []byte  // In target byte order, len(Data) is the size of the object.
+	Relocs []Reloc // Ordered by Offset.
+}
+
+// Reloc is an address constant stored in an Image. The address of Target plus
+// Addend is stored at Offset of Image.Data, where the bytes of the pointer are
+// zero.
+//
+// Target is the *Declarator of an object with static storage duration or of a
+// function, or the string literal *Expr whose Value is the content of the
+// array object the literal denotes. All declarators of an identifier with
+// linkage denote the same object or function.
+type Reloc struct {
+	Addend int64
+	Offset int64
+	Target Node
+}
+
+// bitField describes the storage of a bit-field member.
+type bitField struct {
+	bit  int // Of the first bit within the byte at the offset of the member.
+	bits int // Width.
+}
+
+// initItem is an expression initializing a scalar member, a string literal
+// initializing a character array or an expression of structure or union type
+// initializing a member of an object with automatic storage duration.
+type initItem struct {
+	bf   *bitField // Non nil if the member is a bit-field.
+	expr *Expr
+	off  int64 // Of the member.
+	typ  Type  // Of the member.
+}
+
+// initializer evaluates an initializer, [0]6.7.8.
+type initializer struct {
+	ctx      *context
+	image    *Image // Nil if the object does not have static storage duration.
+	items    []initItem
+	ldFormat longDoubleFormat
+	order    binary.ByteOrder
+}
+
+// initialize evaluates n, the initializer of an object of type t, and returns
+// its Image, if the object has static storage duration, and the type of the
+// object, which is t completed if it is an array of unknown size.
+//
+// [0]6.7.8-4: All the expressions in an initializer for an object that has
+// static storage duration shall be constant expressions or string literals.
+//
+// The expressions initializing an object with automatic storage duration are
+// not evaluated, see initItems.
+func (c *context) initialize(n *Initializer, t Type, static bool) (*Image, Type) {
+	in := &initializer{ctx: c, ldFormat: c.model.longDouble(), order: c.model.byteOrder()}
+	if static {
+		in.image = &Image{}
+	}
+	t = in.object(n, t, 0, nil)
+	if in.image == nil {
+		return nil, t
+	}
+
+	sz, err := c.model.Sizeof(t)
+	if err != nil {
+		return nil, t
+	}
+
+	in.grow(sz)
+	in.image.Data = in.image.Data[:sz]
+	sort.Slice(in.image.Relocs, func(i, j int) bool { return in.image.Relocs[i].Offset < in.image.Relocs[j].Offset })
+	return in.image, t
+}
+
+// initItems returns the items of n, the initializer of an object of type t
+// with automatic storage duration, in the order they are to be evaluated and
+// stored. Members not initialized by an item are zero.
+func (c *context) initItems(n *Initializer, t Type) []initItem {
+	in := &initializer{ctx: c, ldFormat: c.model.longDouble(), order: c.model.byteOrder()}
+	in.object(n, t, 0, nil)
+	return in.items
+}
+
+func isAggregate(t Type) bool {
+	switch t.(type) {
+	case *ArrayType, *StructType:
+		return true
+	}
+	return false
+}
+
+// object initializes the object of type t at offset off using n and returns
+// t, completed if it is an array of unknown size. A bit-field is described by
+// bf.
+func (in *initializer) object(n *Initializer, t Type, off int64, bf *bitField) Type {
+	if t == Undefined {
+		return t
+	}
+
+	switch n.Case {
+	case InitializerExpr: // Expr
+		if s := stringLiteral(n.Expr); s != nil && in.isStringArray(t, s) {
+			return in.str(s, t.(*ArrayType), off)
+		}
+
+		if isAggregate(t) {
+			// [0]6.7.8-13: The initializer for a structure or
+			// union object that has automatic storage duration
+			// shall be either an initializer list as described
+			// below, or a single expression that has compatible
+			// structure or union type.
+			switch {
+			case t.Kind() == Array:
+				in.ctx.err(n, "invalid initializer")
+			case in.image != nil:
+				in.ctx.err(n, "initializer element is not constant")
+			default:
+				switch v := n.Expr.rvalue(in.ctx); {
+				case v.Type == Undefined:
+					// nop
+				case v.Type != t:
+					in.ctx.err(n, "invalid initializer")
+				default:
+					in.items = append(in.items, initItem{expr: n.Expr, off: off, typ: t})
+				}
+			}
+			return t
+		}
+
+		in.scalar(n.Expr, t, off, bf)
+		return t
+	case InitializerCompLit: // '{' InitializerList CommaOpt '}'
+		l := n.InitializerList
+		if !isAggregate(t) {
+			// [0]6.7.8-11: The initializer for a scalar shall be a
+			// single expression, optionally enclosed in braces.
+			switch {
+			case l == nil:
+				in.ctx.err(n, "empty scalar initializer")
+			case l.Designation != nil:
+				in.designator(l.Designation.DesignatorList.Designator, t)
+			default:
+				in.object(l.Initializer, t, off, bf)
+				if l.InitializerList != nil {
+					in.ctx.warnPos(l.InitializerList.Pos(), "excess elements in scalar initializer")
+				}
+			}
+			return t
+		}
+
+		// [0]6.7.8-14: An array of character type may be
+		// initialized by a character string literal, optionally
+		// enclosed in braces.
+		if l != nil && l.Designation == nil && l.InitializerList == nil && l.Initializer.Case == InitializerExpr {
+			if s := stringLiteral(l.Initializer.Expr); s != nil && in.isStringArray(t, s) {
+				return in.str(s, t.(*ArrayType), off)
+			}
+		}
+
+		return in.aggregate(n, &l, t, off, true, false, nil)
+	default:
+		panic("internal error")
+	}
+}
+
+// aggregate initializes the members of the array, struct or union of type t
+// at offset off using the items of l, which are consumed, and returns t,
+// completed if it is an array of unknown size. The items are enclosed in the
+// braces of n, braced, or they initialize t as a subaggregate of the current
+// object without braces. The designation of the first item, if cont, is
+// already consumed up to d.
+//
+// [0]6.7.8-20: If the aggregate or union contains elements or members that
+// are aggregates or unions, these rules apply recursively to the
+// subaggregates or contained unions. If the initializer of a subaggregate or
+// contained union begins with a left brace, the initializers enclosed by that
+// brace and its matching right brace initialize the elements or members of
+// the subaggregate or the contained union. Otherwise, only enough initializers
+// from the list are taken to account for the elements or members of the
+// subaggregate or the first member of the contained union; any remaining
+// initializers are left to initialize the next element or member of the
+// aggregate of which the current subaggregate or contained union is a part.
+func (in *initializer) aggregate(n Node, l **InitializerList, t Type, off int64, braced, cont bool, d *DesignatorList) Type {
+	at, _ := t.(*ArrayType)
+	st, _ := t.(*StructType)
+	var layout *StructLayout
+	var item int64 // Array item size.
+	switch {
+	case st != nil:
+		var err error
+		if layout, err = in.ctx.model.Layout(st); err != nil {
+			in.ctx.err(n, "initializer for an incomplete type %v", t)
+			in.skip(l, braced)
+			return t
+		}
+	default:
+		var err error
+		if item, err = in.ctx.model.Sizeof(at.Item); err != nil {
+			in.ctx.err(n, "initializer for an array of incomplete type %v", at.Item)
+			in.skip(l, braced)
+			return t
+		}
+	}
+
+	var i, max int64 // Current member, array length.
+	for first := true; *l != nil; first = false {
+		x := *l
+		dl := d
+		if !first || !cont {
+			dl = nil
+			if x.Designation != nil {
+				if !braced {
+					break // Belongs to an enclosing braced initializer list.
+				}
+
+				dl = x.Designation.DesignatorList
+			}
+		}
+		if dl != nil {
+			j, ok := in.designator(dl.Designator, t)
+			if !ok {
+				*l = x.InitializerList
+				continue
+			}
+
+			i = j
+		}
+		if st != nil {
+			// [0]6.7.8-9: Except where explicitly stated
+			// otherwise, for the purposes of this subclause unnamed
+			// members of objects of structure and union type do not
+			// participate in initialization.
+			for i < int64(len(st.Fields)) && st.Fields[i].Name == "" {
+				i++
+			}
+		}
+		if st != nil && i >= int64(len(st.Fields)) || at != nil && at.Size >= 0 && i >= at.Size {
+			if !braced {
+				break
+			}
+
+			// [0]6.7.8-2: No initializer shall attempt to provide a
+			// value for an object not contained within the entity
+			// being initialized.
+			s := "array"
+			if st != nil {
+				s = "struct"
+				if st.Union {
+					s = "union"
+				}
+			}
+			in.ctx.warnPos(x.Pos(), "excess elements in %s initializer", s)
+			*l = x.InitializerList
+			continue
+		}
+
+		var mt Type
+		var moff int64
+		var bf *bitField
+		switch {
+		case st != nil:
+			f := st.Fields[i]
+			mt, moff = f.Type, off+layout.Fields[i].Offset
+			if f.BitField {
+				bf = &bitField{layout.Fields[i].BitOffset, f.Bits}
+			}
+			if x, ok := mt.(*ArrayType); ok && x.Size < 0 {
+				in.ctx.err(*l, "initialization of a flexible array member")
+				in.skip(l, braced)
+				return t
+			}
+		default:
+			mt, moff = at.Item, off+i*item
+		}
+		var rest *DesignatorList
+		if dl != nil {
+			rest = dl.DesignatorList
+		}
+		switch {
+		case rest != nil:
+			if !isAggregate(mt) {
+				in.designator(rest.Designator, mt)
+				*l = x.InitializerList
+				break
+			}
+
+			// [0]6.7.8-17: ... If a designator has the form
+			// .identifier or [constant-expression], then the
+			// current object shall have structure or union type or
+			// array type respectively, and the member or element
+			// designated is the current object for the next
+			// designator.
+			in.aggregate(x, l, mt, moff, false, true, rest)
+		case isAggregate(mt) && !in.isAggregateInitializer(x.Initializer, mt):
+			in.aggregate(x, l, mt, moff, false, true, nil)
+		default:
+			in.object(x.Initializer, mt, moff, bf)
+			*l = x.InitializerList
+		}
+		i++
+		if i > max {
+			max = i
+		}
+		if st != nil && st.Union {
+			// [0]6.7.8-17: ... the first named member of a union
+			// is initialized, unless a designator says otherwise.
+			i = int64(len(st.Fields))
+		}
+	}
+	if at != nil && at.Size < 0 {
+		return &ArrayType{Item: at.Item, Size: max}
+	}
+
+	return t
+}
+
+// skip consumes the items of the braced initializer list l or the item
+// starting l.
+func (in *initializer) skip(l **InitializerList, braced bool) {
+	switch {
+	case braced:
+		*l = nil
+	case *l != nil:
+		*l = (*l).InitializerList
+	}
+}
+
+// isAggregateInitializer reports whether n initializes the aggregate of type
+// t as a whole, that is, it is enclosed in braces, it is a string literal
+// initializing a character array or it is an expression, possibly of
+// structure or union type.
+func (in *initializer) isAggregateInitializer(n *Initializer, t Type) bool {
+	if n.Case == InitializerCompLit {
+		return true
+	}
+
+	if s := stringLiteral(n.Expr); s != nil {
+		return in.isStringArray(t, s)
+	}
+
+	// [0]6.7.8-13: ... or a single expression that has compatible
+	// structure or union type.
+	if t.Kind() != Struct && t.Kind() != Union || in.image != nil {
+		return false
+	}
+
+	return n.Expr.eval(in.ctx).Type == t
+}
+
+// designator returns the index of the element or member of the current object
+// of type t d designates.
+func (in *initializer) designator(d *Designator, t Type) (int64, bool) {
+	switch d.Case {
+	case DesignatorIndex: // '[' ConstExpr ']'
+		// [0]6.7.8-6: If a designator has the form [
+		// constant-expression ] then the current object (defined
+		// below) shall have array type and the expression shall be an
+		// integer constant expression. If the array is of unknown size,
+		// any nonnegative value is valid.
+		at, ok := t.(*ArrayType)
+		if !ok {
+			in.ctx.err(d, "array index in non-array initializer")
+			return 0, false
+		}
+
+		v := d.ConstExpr.eval(in.ctx)
+		if v.Type == Undefined {
+			return 0, false
+		}
+
+		x, ok := v.Value.(*ir.Int64Value)
+		if !v.isIntegerType() || !ok {
+			in.ctx.err(d.ConstExpr, "nonconstant array index in initializer")
+			return 0, false
+		}
+
+		if v.isSigned() && x.Value < 0 || at.Size >= 0 && uint64(x.Value) >= uint64(at.Size) {
+			in.ctx.err(d.ConstExpr, "array index in initializer exceeds array bounds")
+			return 0, false
+		}
+
+		return x.Value, true
+	case DesignatorField: // '.' IDENTIFIER
+		// [0]6.7.8-7: If a designator has the form . identifier then
+		// the current object (defined below) shall have structure or
+		// union type and the identifier shall be the name of a member
+		// of that type.
+		st, ok := t.(*StructType)
+		if !ok {
+			in.ctx.err(d, "field name not in record or union initializer")
+			return 0, false
+		}
+
+		nm := string(d.Token2.S())
+		for i, f := range st.Fields {
+			if f.Name == nm {
+				return int64(i), true
+			}
+		}
+
+		in.ctx.errPos(d.Token2.Pos(), "unknown field '%s' specified in initializer", nm)
+		return 0, false
+	default:
+		panic("internal error")
+	}
+}
+
+// stringLiteral returns the possibly parenthesized string literal n or nil if
+// n is not a string literal.
+func stringLiteral(n *Expr) *Expr {
+	for n.Case == ExprPExprList && n.ExprList.ExprList == nil {
+		n = n.ExprList.Expr
+	}
+	switch n.Case {
+	case ExprString, ExprLString:
+		return n
+	}
+	return nil
+}
+
+// isStringArray reports whether t is an array type that can be initialized by
+// the string literal s.
+func (in *initializer) isStringArray(t Type, s *Expr) bool {
+	at, ok := t.(*ArrayType)
+	if !ok || intConvRank[at.Item.Kind()] == 0 {
+		return false
+	}
+
+	v := s.eval(in.ctx)
+	if v.Type == Undefined {
+		return false
+	}
+
+	k := v.Type.(*ArrayType).Item.Kind()
+	if s.Case == ExprString {
+		return intConvRank[at.Item.Kind()] == intConvRank[k]
+	}
+
+	return in.ctx.model[at.Item.Kind()].Size == in.ctx.model[k].Size
+}
+
+// [0]6.7.8-14: An array of character type may be initialized by a character
+// string literal, optionally enclosed in braces. Successive characters of the
+// character string literal (including the terminating null character if
+// there is room or if the array is of unknown size) initialize the elements
+// of the array.
+//
+// str initializes the array of type t at offset off using the string literal
+// s and returns t, completed if it is an array of unknown size.
+func (in *initializer) str(s *Expr, t *ArrayType, off int64) Type {
+	v := s.eval(in.ctx)
+	n := v.Type.(*ArrayType).Size
+	switch {
+	case t.Size < 0:
+		t = &ArrayType{Item: t.Item, Size: n}
+	case n-1 > t.Size:
+		in.ctx.warnPos(s.Pos(), "initializer-string for array of chars is too long")
+	}
+	if in.image == nil {
+		in.items = append(in.items, initItem{expr: s, off: off, typ: t})
+		return t
+	}
+
+	if n > t.Size {
+		n = t.Size
+	}
+	sz := int64(in.ctx.model[t.Item.Kind()].Size)
+	b := make([]byte, n*sz)
+	str := string(dict.S(int(v.Value.(*ir.StringValue).StringID)))
+	switch {
+	case s.Case == ExprString:
+		copy(b, str)
+	default:
+		var i int64
+		for _, r := range str {
+			if i == n {
+				break
+			}
+
+			in.putInt(b[i*sz:(i+1)*sz], uint64(r))
+			i++
+		}
+	}
+	in.write(off, b)
+	return t
+}
+
+// scalar initializes the scalar object of type t at offset off using the
+// value of n. A bit-field is described by bf.
+//
+// [0]6.7.8-11: The initial value of the object is that of the expression
+// (after conversion); the same type constraints and conversions as for simple
+// assignment apply, taking the type of the scalar to be the unqualified
+// version of its declared type.
+func (in *initializer) scalar(n *Expr, t Type, off int64, bf *bitField) {
+	if in.image == nil {
+		in.items = append(in.items, initItem{bf: bf, expr: n, off: off, typ: t})
+		return
+	}
+
+	v := n.rvalue(in.ctx)
+	if v.Type == Undefined {
+		return
+	}
+
+	k := t.Kind()
+	switch {
+	case k == Ptr && (v.isPointerType() || v.isIntegerType()):
+		in.address(n, v, off)
+	case k == Bool && v.Addr != nil:
+		in.write(off, []byte{1})
+	case intConvRank[k] != 0 && v.Addr != nil:
+		if in.ctx.model[k].Size != in.ctx.model[Ptr].Size || bf != nil {
+			in.ctx.err(n, "initializer element is not computable at load time")
+			break
+		}
+
+		in.address(n, v, off)
+	case isArithmeticType[k] && v.isArithmeticType():
+		switch k {
+		case FloatComplex:
+			t = Float
+		case DoubleComplex:
+			t = Double
+		case LongDoubleComplex:
+			t = LongDouble
+		}
+		if v = v.convertTo(in.ctx, t); v.Value == nil {
+			in.ctx.err(n, "initializer element is not constant")
+			break
+		}
+
+		in.arithmetic(n, v, off, bf)
+	case isArithmeticType[k] || k == Ptr:
+		in.ctx.err(n, "incompatible types when initializing %v using %v", t, v.Type)
+	default:
+		in.ctx.err(n, "initializer element is not constant")
+	}
+}
+
+// [0]6.6-9: An address constant is a null pointer, a pointer to an lvalue
+// designating an object of static storage duration, or a pointer to a
+// function designator; it shall be created explicitly using the unary &
+// operator or an integer constant cast to pointer type, or implicitly by the
+// use of an expression of array or function type.
+//
+// address stores the address constant v, the value of n, at offset off.
+func (in *initializer) address(n Node, v *Value, off int64) {
+	x, ok := v.Value.(*ir.Int64Value)
+	if !ok {
+		in.ctx.err(n, "initializer element is not constant")
+		return
+	}
+
+	sz := in.ctx.model[Ptr].Size
+	b := make([]byte, sz)
+	switch y := v.Addr.(type) {
+	case nil:
+		in.putInt(b, uint64(x.Value))
+		in.write(off, b)
+		return
+	case *Declarator:
+		if !y.Static && y.Type.Kind() != Function {
+			in.ctx.err(n, "initializer element is not constant")
+			return
+		}
+	}
+
+	in.write(off, b)
+	in.image.Relocs = append(in.image.Relocs, Reloc{Addend: x.Value, Offset: off, Target: v.Addr})
+}
+
+// arithmetic stores the arithmetic constant v, the value of n, at offset off.
+// A bit-field is described by bf.
+func (in *initializer) arithmetic(n Node, v *Value, off int64, bf *bitField) {
+	b := make([]byte, in.ctx.model[v.Type.Kind()].Size)
+	switch x := v.Value.(type) {
+	case *ir.Int64Value:
+		if bf != nil {
+			in.bits(off, bf, uint64(x.Value))
+			return
+		}
+
+		in.putInt(b, uint64(x.Value))
+	case *ir.Float32Value:
+		in.putInt(b, uint64(math.Float32bits(x.Value)))
+	case *ir.Float64Value:
+		switch {
+		case v.Type.Kind() == LongDouble:
+			if !in.putLongDouble(b, x.Value) {
+				in.ctx.err(n, "unsupported long double format")
+				return
+			}
+		case len(b) == 8:
+			in.putInt(b, math.Float64bits(x.Value))
+		default:
+			in.ctx.err(n, "unsupported size of %v: %v", v.Type, len(b))
+			return
+		}
+	default:
+		panic("internal error")
+	}
+	in.write(off, b)
+}
+
+// putInt stores the low len(b) bytes of n in b.
+func (in *initializer) putInt(b []byte, n uint64) {
+	for i := range b {
+		j := i
+		if in.order == binary.BigEndian {
+			j = len(b) - 1 - i
+		}
+		b[j] = byte(n)
+		n >>= 8
+	}
+}
+
+// putLongDouble stores f in b as a long double in the format of the target
+// and reports whether the format is supported.
+func (in *initializer) putLongDouble(b []byte, f float64) bool {
+	switch in.ldFormat {
+	case longDoubleBinary64:
+		in.putInt(b, math.Float64bits(f))
+		return true
+	case longDoubleDoubleDouble:
+		// f is the high double, the low one is zero.
+		in.putInt(b[:8], math.Float64bits(f))
+		in.putInt(b[8:], 0)
+		return true
+	case longDoubleBinary128, longDoubleX87:
+		// ok
+	default:
+		return false
+	}
+
+	u := math.Float64bits(f)
+	sign := u >> 63
+	exp := int(u >> 52 & 0x7ff)
+	frac := u & (1<<52 - 1)
+	var e int    // Biased by 16383.
+	var m uint64 // Significand with an explicit integer bit.
+	switch {
+	case exp == 0 && frac == 0:
+		// nop
+	case exp == 0:
+		n := bits.LeadingZeros64(frac)
+		m = frac << uint(n)
+		e = 16383 - 1011 - n
+	case exp == 0x7ff:
+		e, m = 0x7fff, 1<<63|frac<<11
+	default:
+		e, m = exp-1023+16383, 1<<63|frac<<11
+	}
+	se := sign<<15 | uint64(e)
+	if in.ldFormat == longDoubleX87 {
+		in.putInt(b[:8], m)
+		in.putInt(b[8:10], se)
+		return true
+	}
+
+	hi, lo := se<<48|m<<1>>16, m<<49
+	if in.order == binary.BigEndian {
+		hi, lo = lo, hi
+	}
+	in.putInt(b[:8], lo)
+	in.putInt(b[8:], hi)
+	return true
+}
+
+// bits stores the low bf.bits bits of n in the bit-field at offset off. Bit p
+// of the object is bit p%8 of byte p/8 counting from the least significant
+// bit on little-endian targets and from the most significant one on
+// big-endian targets, where the most significant bit of n is stored first.
+func (in *initializer) bits(off int64, bf *bitField, n uint64) {
+	for i := 0; i < bf.bits; i++ {
+		p := bf.bit + i
+		m := byte(1) << uint(p%8)
+		if in.order == binary.BigEndian {
+			p = bf.bit + bf.bits - 1 - i
+			m = 0x80 >> uint(p%8)
+		}
+		j := off + int64(p/8)
+		in.grow(j + 1)
+		switch {
+		case n>>uint(i)&1 != 0:
+			in.image.Data[j] |= m
+		default:
+			in.image.Data[j] &^= m
+		}
+	}
+}
+
+// grow makes the image at least n bytes long.
+func (in *initializer) grow(n int64) {
+	if d := in.image.Data; int64(len(d)) < n {
+		in.image.Data = append(d, make([]byte, n-int64(len(d)))...)
+	}
+}
+
+// write stores b at offset off of the image.
+//
+// [0]6.7.8-19: The initialization shall occur in initializer list order, each
+// initializer provided for a particular subobject overriding any previously
+// listed initializer for the same subobject.
+func (in *initializer) write(off int64, b []byte) {
+	in.grow(off + int64(len(b)))
+	copy(in.image.Data[off:], b)
+	r := in.image.Relocs[:0]
+	for _, v := range in.image.Relocs {
+		if v.Offset < off || v.Offset >= off+int64(len(b)) {
+			r = append(r, v)
+		}
+	}
+	in.image.Relocs = r
+}
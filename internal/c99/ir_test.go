@@ -0,0 +1,984 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package c99
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cznic/ccir"
+	"github.com/cznic/ir"
+)
+
+// TestIR lowers the self checking programs in testdata/ir, verifies and links
+// the objects and, as an extra check, executes them. The main function of
+// every program returns 0 or the ordinal number of the first failed check.
+func TestIR(t *testing.T) {
+	var re *regexp.Regexp
+	if s := *oRE; s != "" {
+		re = regexp.MustCompile(s)
+	}
+
+	m, err := filepath.Glob(filepath.FromSlash("testdata/ir/*.c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range m {
+		if re != nil && !re.MatchString(path) {
+			continue
+		}
+
+		tu, err := Translate(nil, nil, nil, NewBuiltinSource(), newFileSource(path))
+		if err != nil {
+			t.Errorf("%s: %s", path, errString(err))
+			continue
+		}
+
+		objects, err := IR(tu)
+		if err != nil {
+			t.Errorf("%s: %s", path, errString(err))
+			continue
+		}
+
+		for _, v := range objects {
+			if err := v.Verify(); err != nil {
+				t.Errorf("%s: %s: %v", path, v.Base().Position, err)
+			}
+		}
+
+		rc, err := runIR(tu.Model, objects)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+		} else if rc != 0 {
+			t.Errorf("%s: check #%d failed", path, rc)
+		}
+
+		// Linking may mutate the objects.
+		if _, err := ir.LinkLib(objects); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
+
+// TestIRSQLite lowers and verifies the SQLite sources. Every construct they use
+// must be supported. Sources that are not available are skipped.
+func TestIRSQLite(t *testing.T) {
+	for _, v := range []struct {
+		src             string
+		predef          string
+		sysIncludePaths []string
+	}{
+		{"shell.c", "", sqliteSysIncludePaths},
+		{"sqlite3.c", fmt.Sprintf(`
+#define _CCGO 1
+#define __arch__ %s
+#define __os__ %s
+#include <builtin.h>
+`, runtime.GOARCH, runtime.GOOS), []string{ccir.LibcIncludePath}},
+	} {
+		t.Run(v.src, func(t *testing.T) {
+			path := filepath.Join(filepath.FromSlash(sqliteDir), v.src)
+			if _, err := os.Stat(path); err != nil {
+				t.Skip(err)
+			}
+
+			predef := NewBuiltinSource()
+			if v.predef != "" {
+				predef = newStringSource("<predef>", v.predef)
+			}
+			tu, err := Translate(&Tweaks{}, []string{"@"}, v.sysIncludePaths, predef, newFileSource(path))
+			if err != nil {
+				t.Fatal(errString(err))
+			}
+
+			objects, err := IR(tu)
+			d, ok := err.(Diagnostics)
+			if err != nil && !ok {
+				t.Fatal(err)
+			}
+
+			for _, v := range d {
+				if v.Code == "unsupported" {
+					t.Error(v)
+				}
+			}
+
+			for _, v := range objects {
+				if err := v.Verify(); err != nil {
+					t.Errorf("%s: %v", v.Base().Position, err)
+				}
+			}
+		})
+	}
+}
+
+func TestIRErrors(t *testing.T) {
+	for _, v := range []struct{ src, code string }{
+		{"void f(int n) { __builtin_va_list ap; __builtin_va_start(ap, n); }\n", "va-start"},
+		{"struct s { int i; } s; void f(int, ...); void g(void) { f(1, s); }\n", "unsupported"},
+		{"void f(void) { goto l; { goto l; } }\n", "undefined-label"},
+		{"void f(void) { l: ; { l: ; } }\n", "duplicate-label"},
+		{"typedef long jmp_buf[8]; int _setjmp(jmp_buf); void f(void) { jmp_buf b; if (_setjmp(b)) return; }\n", "setjmp"},
+		{"void longjmp(void *, int); void f(void *b) { longjmp(b, 1); }\n", "setjmp"},
+	} {
+		tu, err := Translate(nil, nil, nil, NewBuiltinSource(), newStringSource("test.c", v.src))
+		if err != nil {
+			t.Fatalf("%q: %s", v.src, errString(err))
+		}
+
+		_, err = IR(tu)
+		if d, ok := err.(Diagnostics); !ok || len(d) != 1 || d[0].Code != v.code {
+			t.Errorf("%q: got %v, expected %s", v.src, err, v.code)
+		}
+	}
+}
+
+// irType is the layout of an IR type, see irGen.typ.
+type irType struct {
+	align    int64
+	fields   []*irType // Struct, union or function parameters.
+	item     *irType   // Array item, pointer target or function result.
+	kind     byte      // One of "*[cfFisuU".
+	len      int64
+	offs     []int64 // Struct fields.
+	size     int64
+	variadic bool // Function.
+}
+
+// parseIRType parses the IR type at the start of s and returns the rest of s.
+func parseIRType(s string, ptrSize int64) (*irType, string) {
+	switch {
+	case strings.HasPrefix(s, "*"):
+		t := &irType{align: ptrSize, kind: '*', size: ptrSize}
+		t.item, s = parseIRType(s[1:], ptrSize)
+		return t, s
+	case strings.HasPrefix(s, "["):
+		i := strings.IndexByte(s, ']')
+		n, err := strconv.ParseInt(s[1:i], 10, 64)
+		if err != nil {
+			panic(err)
+		}
+
+		t := &irType{kind: '[', len: n}
+		t.item, s = parseIRType(s[i+1:], ptrSize)
+		t.align, t.size = t.item.align, n*t.item.size
+		return t, s
+	case strings.HasPrefix(s, "struct{"), strings.HasPrefix(s, "union{"):
+		t := &irType{align: 1, kind: 's'}
+		if s[0] == 'u' {
+			t.kind = 'U'
+		}
+		s = s[strings.IndexByte(s, '{')+1:]
+		for s[0] != '}' {
+			var f *irType
+			f, s = parseIRType(s, ptrSize)
+			s = strings.TrimPrefix(s, ",")
+			if f.align > t.align {
+				t.align = f.align
+			}
+			var off int64
+			switch {
+			case t.kind == 'U':
+				if f.size > t.size {
+					t.size = f.size
+				}
+			default:
+				off = roundup(t.size, f.align)
+				t.size = off + f.size
+			}
+			t.fields = append(t.fields, f)
+			t.offs = append(t.offs, off)
+		}
+		t.size = roundup(t.size, t.align)
+		return t, s[1:]
+	case strings.HasPrefix(s, "func("):
+		t := &irType{align: 1, kind: 'F'}
+		s = s[len("func("):]
+		for s[0] != ')' {
+			if strings.HasPrefix(s, "...") {
+				s = s[len("..."):]
+				t.variadic = true
+				continue
+			}
+
+			var p *irType
+			p, s = parseIRType(s, ptrSize)
+			s = strings.TrimPrefix(s, ",")
+			t.fields = append(t.fields, p)
+		}
+		s = s[1:]
+		if s != "" && !strings.ContainsRune(",)}", rune(s[0])) {
+			t.item, s = parseIRType(s, ptrSize)
+		}
+		return t, s
+	}
+
+	i := 0
+	for i < len(s) && s[i] >= 'a' && s[i] <= 'z' {
+		i++
+	}
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	nm := s[:i]
+	t := &irType{}
+	switch {
+	case strings.HasPrefix(nm, "uint"):
+		t.kind = 'u'
+	case strings.HasPrefix(nm, "int"):
+		t.kind = 'i'
+	case strings.HasPrefix(nm, "float"):
+		t.kind = 'f'
+	case strings.HasPrefix(nm, "complex"):
+		t.kind = 'c'
+	default:
+		panic(fmt.Errorf("invalid IR type %q", s))
+	}
+	bits, err := strconv.Atoi(strings.TrimLeft(nm, "abcdefghijklmnopqrstuvwxyz"))
+	if err != nil {
+		panic(err)
+	}
+
+	t.size = int64(bits) / 8
+	t.align = t.size
+	if t.kind == 'c' {
+		t.align /= 2
+	}
+	return t, s[i:]
+}
+
+// irVM executes IR objects. The memory is a byte slice, addresses are
+// offsets into it. Memory is never released.
+type irVM struct {
+	builtins map[int64]string // Address: name.
+	funcs    map[int64]int    // Address: object.
+	globals  []int64          // Object: address.
+	labels   map[int]map[int]int
+	mem      []byte
+	names    map[string]int64 // Builtin name: address.
+	objects  []ir.Object
+	op       ir.Operation // Being executed.
+	order    binary.ByteOrder
+	ptrSize  int64
+	steps    int
+	strings  map[ir.StringID]int64
+	types    map[ir.TypeID]*irType
+}
+
+// irError is a run time error of an IR program.
+type irError struct{ error }
+
+func (m *irVM) fail(s string, args ...interface{}) {
+	s = fmt.Sprintf(s, args...)
+	if m.op != nil {
+		s = fmt.Sprintf("%v: %T: %s", m.op.Pos(), m.op, s)
+	}
+	panic(irError{fmt.Errorf("%s", s)})
+}
+
+// runIR executes the main function of objects and returns its result.
+func runIR(model Model, objects []ir.Object) (rc int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			x, ok := e.(irError)
+			if !ok {
+				panic(e)
+			}
+
+			err = x.error
+		}
+	}()
+
+	m := &irVM{
+		builtins: map[int64]string{},
+		funcs:    map[int64]int{},
+		labels:   map[int]map[int]int{},
+		mem:      make([]byte, 16), // Address 0 is the null pointer.
+		names:    map[string]int64{},
+		objects:  objects,
+		order:    model.byteOrder(),
+		ptrSize:  int64(model[Ptr].Size),
+		strings:  map[ir.StringID]int64{},
+		types:    map[ir.TypeID]*irType{},
+	}
+	main := -1
+	for i, v := range objects {
+		switch x := v.(type) {
+		case *ir.DataDefinition:
+			t := m.typ(x.TypeID)
+			m.globals = append(m.globals, m.alloc(t.size, t.align))
+		case *ir.FunctionDefinition:
+			a := m.alloc(1, 1)
+			m.globals = append(m.globals, a)
+			m.funcs[a] = i
+			if x.Linkage == ir.ExternalLinkage && string(dict.S(int(x.NameID))) == "main" {
+				main = i
+			}
+		}
+	}
+	for i, v := range objects {
+		if x, ok := v.(*ir.DataDefinition); ok {
+			m.value(m.globals[i], m.typ(x.TypeID), x.Value)
+		}
+	}
+	if main < 0 {
+		return -1, fmt.Errorf("main not defined")
+	}
+
+	r := m.call(main, nil)
+	return int(m.int(r, m.typ(objects[main].Base().TypeID).item)), nil
+}
+
+func (m *irVM) typ(id ir.TypeID) *irType {
+	if t := m.types[id]; t != nil {
+		return t
+	}
+
+	s := string(dict.S(int(id)))
+	t, rest := parseIRType(s, m.ptrSize)
+	if rest != "" {
+		m.fail("invalid IR type %q", s)
+	}
+
+	m.types[id] = t
+	return t
+}
+
+func (m *irVM) alloc(size, align int64) int64 {
+	if size == 0 {
+		size = 1
+	}
+	a := roundup(int64(len(m.mem)), align)
+	if a+size > 1<<26 {
+		m.fail("out of memory")
+	}
+
+	m.mem = append(m.mem, make([]byte, a+size-int64(len(m.mem)))...)
+	return a
+}
+
+func (m *irVM) bytes(a, n int64) []byte {
+	if a <= 0 || a+n > int64(len(m.mem)) {
+		m.fail("invalid memory access %#x", a)
+	}
+
+	return m.mem[a : a+n]
+}
+
+// str returns the address of the string s.
+func (m *irVM) str(s ir.StringID) int64 {
+	if a, ok := m.strings[s]; ok {
+		return a
+	}
+
+	b := dict.S(int(s))
+	a := m.alloc(int64(len(b))+1, 1)
+	copy(m.mem[a:], b)
+	m.strings[s] = a
+	return a
+}
+
+// address returns the address of the object or function i, or of the
+// function or object named nm if i is negative.
+func (m *irVM) address(i int, nm ir.NameID) int64 {
+	if i >= 0 {
+		return m.globals[i]
+	}
+
+	s := string(dict.S(int(nm)))
+	switch s {
+	case "abort", "memcpy", "memset", "strcmp", "strlen":
+		a, ok := m.names[s]
+		if !ok {
+			a = m.alloc(1, 1)
+			m.names[s] = a
+			m.builtins[a] = s
+		}
+		return a
+	}
+	m.fail("undefined: %s", s)
+	panic("unreachable")
+}
+
+// value stores the initializer v of an object of type t at a.
+func (m *irVM) value(a int64, t *irType, v ir.Value) {
+	switch x := v.(type) {
+	case nil:
+		// nop
+	case *ir.CompositeValue:
+		for _, v := range x.Values {
+			d := v.(*ir.DesignatedValue)
+			switch t.kind {
+			case '[':
+				m.value(a+int64(d.Index)*t.item.size, t.item, d.Value)
+			case 's', 'U':
+				m.value(a+t.offs[d.Index], t.fields[d.Index], d.Value)
+			default:
+				m.fail("invalid composite value of type %c", t.kind)
+			}
+		}
+	case *ir.Int32Value:
+		m.put(a, t, m.from(int64(x.Value), t))
+	case *ir.Int64Value:
+		m.put(a, t, m.from(x.Value, t))
+	case *ir.Float32Value:
+		m.put(a, t, m.fromFloat(float64(x.Value), t))
+	case *ir.Float64Value:
+		m.put(a, t, m.fromFloat(x.Value, t))
+	case *ir.Complex64Value:
+		m.put(a, t, append(m.float(float64(real(x.Value)), 4), m.float(float64(imag(x.Value)), 4)...))
+	case *ir.Complex128Value:
+		m.put(a, t, append(m.float(real(x.Value), 8), m.float(imag(x.Value), 8)...))
+	case *ir.AddressValue:
+		m.put(a, t, m.uint(uint64(m.address(x.Index, x.NameID)+int64(x.Offset)), m.ptrSize))
+	case *ir.StringValue:
+		m.put(a, t, m.uint(uint64(m.str(x.StringID)+int64(x.Offset)), m.ptrSize))
+	default:
+		m.fail("unexpected value %T", x)
+	}
+}
+
+func (m *irVM) put(a int64, t *irType, b []byte) {
+	if int64(len(b)) != t.size {
+		m.fail("size mismatch: %v bytes, type size %v", len(b), t.size)
+	}
+
+	copy(m.bytes(a, t.size), b)
+}
+
+func (m *irVM) uint(v uint64, size int64) []byte {
+	b := make([]byte, 8)
+	m.order.PutUint64(b, v)
+	if m.order == binary.BigEndian {
+		return b[8-size:]
+	}
+
+	return b[:size]
+}
+
+func (m *irVM) float(v float64, size int64) []byte {
+	if size == 4 {
+		return m.uint(uint64(math.Float32bits(float32(v))), 4)
+	}
+
+	return m.uint(math.Float64bits(v), 8)
+}
+
+// int returns the value b of the integer or pointer type t.
+func (m *irVM) int(b []byte, t *irType) int64 {
+	if int64(len(b)) != t.size {
+		m.fail("size mismatch: %v bytes, type size %v", len(b), t.size)
+	}
+
+	var v uint64
+	for i := range b {
+		j := len(b) - 1 - i
+		if m.order == binary.BigEndian {
+			j = i
+		}
+		v = v<<8 | uint64(b[j])
+	}
+	if w := uint(64 - 8*len(b)); t.kind == 'i' {
+		return int64(v<<w) >> w
+	}
+
+	return int64(v)
+}
+
+// from returns v as a value of the integer or pointer type t.
+func (m *irVM) from(v int64, t *irType) []byte { return m.uint(uint64(v), t.size) }
+
+// fromFloat returns v as a value of the arithmetic type t.
+func (m *irVM) fromFloat(v float64, t *irType) []byte {
+	switch t.kind {
+	case 'f':
+		return m.float(v, t.size)
+	case 'i':
+		return m.from(int64(v), t)
+	case 'u':
+		if v >= 1<<63 {
+			return m.from(int64(uint64(v-(1<<63))+1<<63), t)
+		}
+
+		return m.from(int64(v), t)
+	}
+	m.fail("invalid conversion of a float to %c", t.kind)
+	panic("unreachable")
+}
+
+// toFloat returns the value b of the arithmetic type t as a float64.
+func (m *irVM) toFloat(b []byte, t *irType) float64 {
+	switch t.kind {
+	case 'f':
+		if t.size == 4 {
+			return float64(math.Float32frombits(uint32(m.int(b, &irType{kind: 'u', size: 4}))))
+		}
+
+		return math.Float64frombits(uint64(m.int(b, &irType{kind: 'u', size: 8})))
+	case 'i':
+		return float64(m.int(b, t))
+	case 'u', '*':
+		return float64(uint64(m.int(b, t)))
+	}
+	m.fail("invalid conversion of %c to a float", t.kind)
+	panic("unreachable")
+}
+
+func (m *irVM) bool(v bool) []byte {
+	if v {
+		return m.uint(1, 4)
+	}
+
+	return m.uint(0, 4)
+}
+
+var irInt32 = &irType{align: 4, kind: 'i', size: 4}
+
+// call executes the function object i with the arguments args and returns the
+// result, if any.
+func (m *irVM) call(i int, args [][]byte) []byte {
+	f := m.objects[i].(*ir.FunctionDefinition)
+	ft := m.typ(f.TypeID)
+	var va int64
+	if ft.variadic {
+		// The variadic arguments are passed in 8 byte slots, the
+		// address of which is the hidden last argument.
+		if extra := args[len(ft.fields):]; len(extra) != 0 {
+			va = m.alloc(8*int64(len(extra)), 8)
+			for j, v := range extra {
+				copy(m.mem[va+8*int64(j):], v)
+			}
+		}
+		args = append(args[:len(ft.fields):len(ft.fields)], m.uint(uint64(va), m.ptrSize))
+	}
+	var argv []int64
+	for _, v := range args {
+		a := m.alloc(int64(len(v)), 8)
+		copy(m.mem[a:], v)
+		argv = append(argv, a)
+	}
+	var result int64
+	if ft.item != nil {
+		result = m.alloc(ft.item.size, ft.item.align)
+	}
+	labels := m.labels[i]
+	if labels == nil {
+		labels = map[int]int{}
+		for pc, v := range f.Body {
+			if x, ok := v.(*ir.Label); ok {
+				labels[x.Number] = pc
+			}
+		}
+		m.labels[i] = labels
+	}
+	// All variables are allocated on entry, a goto may jump into the
+	// scope of one bypassing its declaration.
+	vars := map[int]int64{}
+	for _, v := range f.Body {
+		if x, ok := v.(*ir.VariableDeclaration); ok {
+			t := m.typ(x.TypeID)
+			vars[x.Index] = m.alloc(t.size, t.align)
+		}
+	}
+	var stack [][]byte
+	push := func(b []byte) { stack = append(stack, b) }
+	pop := func() []byte {
+		n := len(stack) - 1
+		r := stack[n]
+		stack = stack[:n]
+		return r
+	}
+	popInt := func(t *irType) int64 { return m.int(pop(), t) }
+	for pc := 0; pc < len(f.Body); pc++ {
+		if m.steps++; m.steps > 1e7 {
+			m.fail("too many steps")
+		}
+
+		m.op = f.Body[pc]
+		switch x := m.op.(type) {
+		case *ir.BeginScope, *ir.EndScope, *ir.Label, *ir.Arguments:
+			// nop
+		case *ir.AllocResult:
+			push(make([]byte, m.typ(x.TypeID).size))
+		case *ir.Add, *ir.And, *ir.Div, *ir.Eq, *ir.Geq, *ir.Gt, *ir.Leq, *ir.Lt, *ir.Mul, *ir.Neq, *ir.Or, *ir.Rem, *ir.Sub, *ir.Xor:
+			b := pop()
+			a := pop()
+			push(m.binary(x, a, b))
+		case *ir.Argument:
+			push(m.uint(uint64(argv[x.Index]), m.ptrSize))
+		case *ir.Bool:
+			t := m.typ(x.TypeID)
+			push(m.bool(!bytes.Equal(pop(), make([]byte, t.size))))
+		case *ir.Call:
+			push(m.callResult(&stack, m.typ(x.TypeID), x.Arguments, func(args [][]byte) []byte { return m.call(x.Index, args) }))
+		case *ir.CallFP:
+			t := m.typ(x.TypeID)
+			n := len(stack) - x.Arguments - 1
+			fp := m.int(stack[n], &irType{kind: '*', size: m.ptrSize})
+			stack = append(stack[:n], stack[n+1:]...)
+			push(m.callResult(&stack, t, x.Arguments, func(args [][]byte) []byte {
+				if j, ok := m.funcs[fp]; ok {
+					return m.call(j, args)
+				}
+
+				if s, ok := m.builtins[fp]; ok {
+					return m.builtin(s, t, args)
+				}
+
+				m.fail("invalid function pointer %#x", fp)
+				panic("unreachable")
+			}))
+		case *ir.Const:
+			t := m.typ(x.TypeID)
+			switch y := x.Value.(type) {
+			case *ir.Float32Value:
+				push(m.fromFloat(float64(y.Value), t))
+			case *ir.Float64Value:
+				push(m.fromFloat(y.Value, t))
+			default:
+				m.fail("unexpected constant %T", y)
+			}
+		case *ir.Const32:
+			push(m.from(int64(x.Value), m.typ(x.TypeID)))
+		case *ir.Const64:
+			push(m.from(x.Value, m.typ(x.TypeID)))
+		case *ir.Convert:
+			push(m.convert(pop(), m.typ(x.TypeID), m.typ(x.Result)))
+		case *ir.Cpl:
+			t := m.typ(x.TypeID)
+			push(m.from(^popInt(t), t))
+		case *ir.Drop:
+			pop()
+		case *ir.Dup:
+			v := pop()
+			push(v)
+			push(append([]byte(nil), v...))
+		case *ir.Element:
+			it := m.typ(x.IndexType)
+			t := m.typ(x.TypeID)
+			i := popInt(it) * t.item.size
+			if x.Neg {
+				i = -i
+			}
+			push(m.from(popInt(t)+i, t))
+		case *ir.Field:
+			t := m.typ(x.TypeID)
+			push(m.from(popInt(t)+t.item.offs[x.Index], t))
+		case *ir.Global:
+			push(m.uint(uint64(m.address(x.Index, x.NameID)), m.ptrSize))
+		case *ir.Jmp:
+			pc = labels[x.Number]
+		case *ir.Jnz:
+			if popInt(irInt32) != 0 {
+				pc = labels[x.Number]
+			}
+		case *ir.Jz:
+			if popInt(irInt32) == 0 {
+				pc = labels[x.Number]
+			}
+		case *ir.Load:
+			t := m.typ(x.TypeID)
+			push(append([]byte(nil), m.bytes(popInt(t), t.item.size)...))
+		case *ir.Lsh, *ir.Rsh:
+			var t *irType
+			switch y := x.(type) {
+			case *ir.Lsh:
+				t = m.typ(y.TypeID)
+			case *ir.Rsh:
+				t = m.typ(y.TypeID)
+			}
+			n := uint(popInt(irInt32))
+			a := popInt(t)
+			switch {
+			case isLsh(x):
+				a <<= n
+			case t.kind == 'i':
+				a >>= n
+			default:
+				a = int64(uint64(a) >> n)
+			}
+			push(m.from(a, t))
+		case *ir.Neg:
+			t := m.typ(x.TypeID)
+			if t.kind == 'f' {
+				push(m.fromFloat(-m.toFloat(pop(), t), t))
+				break
+			}
+
+			push(m.from(-popInt(t), t))
+		case *ir.Nil:
+			push(make([]byte, m.typ(x.TypeID).size))
+		case *ir.Panic:
+			m.fail("panic")
+		case *ir.PostIncrement, *ir.PreIncrement:
+			var t *irType
+			var delta int
+			pre := false
+			switch y := x.(type) {
+			case *ir.PostIncrement:
+				t, delta = m.typ(y.TypeID), y.Delta
+			case *ir.PreIncrement:
+				t, delta, pre = m.typ(y.TypeID), y.Delta, true
+			}
+			a := popInt(&irType{kind: '*', size: m.ptrSize})
+			old := append([]byte(nil), m.bytes(a, t.size)...)
+			var v []byte
+			switch t.kind {
+			case 'f':
+				v = m.fromFloat(m.toFloat(old, t)+float64(delta), t)
+			default:
+				v = m.from(m.int(old, t)+int64(delta), t)
+			}
+			copy(m.bytes(a, t.size), v)
+			if pre {
+				push(v)
+				break
+			}
+
+			push(old)
+		case *ir.PtrDiff:
+			pt := m.typ(x.PtrType)
+			b := popInt(pt)
+			a := popInt(pt)
+			push(m.from((a-b)/pt.item.size, m.typ(x.TypeID)))
+		case *ir.Result:
+			push(m.uint(uint64(result), m.ptrSize))
+		case *ir.Return:
+			if ft.item == nil {
+				return nil
+			}
+
+			return append([]byte(nil), m.bytes(result, ft.item.size)...)
+		case *ir.Store:
+			t := m.typ(x.TypeID)
+			v := pop()
+			m.put(popInt(&irType{kind: '*', size: m.ptrSize}), t, v)
+			push(v)
+		case *ir.StringConst:
+			push(m.uint(uint64(m.str(x.Value)), m.ptrSize))
+		case *ir.Switch:
+			t := m.typ(x.TypeID)
+			v := pop()
+			pc = labels[x.Default.Number]
+			for _, c := range x.Cases {
+				var w []byte
+				switch y := c.Value.(type) {
+				case *ir.Int32Value:
+					w = m.from(int64(y.Value), t)
+				case *ir.Int64Value:
+					w = m.from(y.Value, t)
+				}
+				if bytes.Equal(v, w) {
+					pc = labels[c.Label.Number]
+					break
+				}
+			}
+		case *ir.Variable:
+			a, ok := vars[x.Index]
+			if !ok {
+				m.fail("undeclared variable #%d", x.Index)
+			}
+
+			push(m.uint(uint64(a), m.ptrSize))
+		case *ir.VariableDeclaration:
+			t := m.typ(x.TypeID)
+			copy(m.bytes(vars[x.Index], t.size), make([]byte, t.size))
+		default:
+			m.fail("unexpected operation %T", x)
+		}
+	}
+	m.fail("missing return")
+	panic("unreachable")
+}
+
+func isLsh(op ir.Operation) bool {
+	_, ok := op.(*ir.Lsh)
+	return ok
+}
+
+// callResult pops n arguments from stack, calls f and returns the result,
+// which replaces the result placeholder pushed by AllocResult.
+func (m *irVM) callResult(stack *[][]byte, t *irType, n int, f func([][]byte) []byte) []byte {
+	s := *stack
+	args := append([][]byte(nil), s[len(s)-n:]...)
+	s = s[:len(s)-n]
+	r := f(args)
+	if t.item != nil {
+		s = s[:len(s)-1]
+	}
+	*stack = s
+	return r
+}
+
+// binary applies the arithmetic or comparison op to a and b.
+func (m *irVM) binary(op ir.Operation, a, b []byte) []byte {
+	var id ir.TypeID
+	switch x := op.(type) {
+	case *ir.Add:
+		id = x.TypeID
+	case *ir.And:
+		id = x.TypeID
+	case *ir.Div:
+		id = x.TypeID
+	case *ir.Eq:
+		id = x.TypeID
+	case *ir.Geq:
+		id = x.TypeID
+	case *ir.Gt:
+		id = x.TypeID
+	case *ir.Leq:
+		id = x.TypeID
+	case *ir.Lt:
+		id = x.TypeID
+	case *ir.Mul:
+		id = x.TypeID
+	case *ir.Neq:
+		id = x.TypeID
+	case *ir.Or:
+		id = x.TypeID
+	case *ir.Rem:
+		id = x.TypeID
+	case *ir.Sub:
+		id = x.TypeID
+	case *ir.Xor:
+		id = x.TypeID
+	}
+	t := m.typ(id)
+	if t.kind == 'f' {
+		x, y := m.toFloat(a, t), m.toFloat(b, t)
+		switch op.(type) {
+		case *ir.Add:
+			return m.fromFloat(x+y, t)
+		case *ir.Div:
+			return m.fromFloat(x/y, t)
+		case *ir.Eq:
+			return m.bool(x == y)
+		case *ir.Geq:
+			return m.bool(x >= y)
+		case *ir.Gt:
+			return m.bool(x > y)
+		case *ir.Leq:
+			return m.bool(x <= y)
+		case *ir.Lt:
+			return m.bool(x < y)
+		case *ir.Mul:
+			return m.fromFloat(x*y, t)
+		case *ir.Neq:
+			return m.bool(x != y)
+		case *ir.Sub:
+			return m.fromFloat(x-y, t)
+		}
+		m.fail("invalid operation %T on floats", op)
+	}
+
+	x, y := m.int(a, t), m.int(b, t)
+	signed := t.kind == 'i'
+	switch op.(type) {
+	case *ir.Add:
+		return m.from(x+y, t)
+	case *ir.And:
+		return m.from(x&y, t)
+	case *ir.Div, *ir.Rem:
+		if y == 0 {
+			m.fail("division by zero")
+		}
+
+		_, div := op.(*ir.Div)
+		switch {
+		case signed && div:
+			return m.from(x/y, t)
+		case signed:
+			return m.from(x%y, t)
+		case div:
+			return m.from(int64(uint64(x)/uint64(y)), t)
+		default:
+			return m.from(int64(uint64(x)%uint64(y)), t)
+		}
+	case *ir.Eq:
+		return m.bool(x == y)
+	case *ir.Geq:
+		return m.bool(signed && x >= y || !signed && uint64(x) >= uint64(y))
+	case *ir.Gt:
+		return m.bool(signed && x > y || !signed && uint64(x) > uint64(y))
+	case *ir.Leq:
+		return m.bool(signed && x <= y || !signed && uint64(x) <= uint64(y))
+	case *ir.Lt:
+		return m.bool(signed && x < y || !signed && uint64(x) < uint64(y))
+	case *ir.Mul:
+		return m.from(x*y, t)
+	case *ir.Neq:
+		return m.bool(x != y)
+	case *ir.Or:
+		return m.from(x|y, t)
+	case *ir.Sub:
+		return m.from(x-y, t)
+	case *ir.Xor:
+		return m.from(x^y, t)
+	}
+	panic("internal error")
+}
+
+// convert converts v of type from to type to.
+func (m *irVM) convert(v []byte, from, to *irType) []byte {
+	switch {
+	case from.kind == 'f' || to.kind == 'f':
+		if from.kind == 'f' {
+			return m.fromFloat(m.toFloat(v, from), to)
+		}
+
+		return m.float(m.toFloat(v, from), to.size)
+	case strings.IndexByte("*iu", from.kind) >= 0 && strings.IndexByte("*iu", to.kind) >= 0:
+		return m.from(m.int(v, from), to)
+	case from.size == to.size:
+		return v
+	}
+	m.fail("invalid conversion from %c to %c", from.kind, to.kind)
+	panic("unreachable")
+}
+
+// builtin executes the library function nm.
+func (m *irVM) builtin(nm string, t *irType, args [][]byte) []byte {
+	ptr := &irType{kind: '*', size: m.ptrSize}
+	size := &irType{kind: 'u', size: m.ptrSize}
+	cstr := func(a int64) []byte {
+		n := bytes.IndexByte(m.mem[a:], 0)
+		if a <= 0 || n < 0 {
+			m.fail("invalid string %#x", a)
+		}
+
+		return m.mem[a : a+int64(n)]
+	}
+	switch nm {
+	case "abort":
+		m.fail("abort")
+	case "memcpy":
+		d, s, n := m.int(args[0], ptr), m.int(args[1], ptr), m.int(args[2], size)
+		copy(m.bytes(d, n), m.bytes(s, n))
+		return args[0]
+	case "memset":
+		d, c, n := m.int(args[0], ptr), m.int(args[1], irInt32), m.int(args[2], size)
+		b := m.bytes(d, n)
+		for i := range b {
+			b[i] = byte(c)
+		}
+		return args[0]
+	case "strcmp":
+		return m.from(int64(bytes.Compare(cstr(m.int(args[0], ptr)), cstr(m.int(args[1], ptr)))), t.item)
+	case "strlen":
+		return m.from(int64(len(cstr(m.int(args[0], ptr)))), t.item)
+	}
+	m.fail("unexpected builtin %s", nm)
+	panic("unreachable")
+}
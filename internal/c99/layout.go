@@ -0,0 +1,209 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package c99
+
+import (
+	"fmt"
+)
+
+// StructLayout describes the memory layout of a struct or union.
+type StructLayout struct {
+	Align  int
+	Fields []FieldLayout // Items correspond to StructType.Fields.
+	Size   int64
+}
+
+// FieldLayout describes the placement of a struct or union member.
+type FieldLayout struct {
+	Offset    int64 // In bytes. Of the byte holding the first bit of a bit-field.
+	BitOffset int   // Of the first bit of a bit-field within the byte at Offset.
+	Padding   int64 // Bytes following the field up to the next one or to the end.
+	Size      int64 // Size of the field type.
+}
+
+// Sizeof returns the size of t in bytes.
+func (m Model) Sizeof(t Type) (int64, error) {
+	switch x := t.(type) {
+	case *ArrayType:
+		if x.Size < 0 {
+			return 0, fmt.Errorf("%v is incomplete", t)
+		}
+
+		n, err := m.Sizeof(x.Item)
+		if err != nil {
+			return 0, err
+		}
+
+		return x.Size * n, nil
+	case *StructType:
+		l, err := m.Layout(x)
+		if err != nil {
+			return 0, err
+		}
+
+		return l.Size, nil
+	}
+
+	if v, ok := m[t.Kind()]; ok {
+		return int64(v.Size), nil
+	}
+
+	return 0, fmt.Errorf("size of %v is unknown", t)
+}
+
+// Alignof returns the alignment of a complete object of type t.
+func (m Model) Alignof(t Type) (int, error) {
+	switch x := t.(type) {
+	case *ArrayType:
+		return m.Alignof(x.Item)
+	case *StructType:
+		l, err := m.Layout(x)
+		if err != nil {
+			return 0, err
+		}
+
+		return l.Align, nil
+	}
+
+	if v, ok := m[t.Kind()]; ok {
+		return v.Align, nil
+	}
+
+	return 0, fmt.Errorf("alignment of %v is unknown", t)
+}
+
+// fieldSize returns the size of t as a member of a struct or union. A
+// flexible array member has size zero.
+func (m Model) fieldSize(t Type) (int64, error) {
+	if x, ok := t.(*ArrayType); ok && x.Size < 0 {
+		if _, err := m.Sizeof(x.Item); err != nil {
+			return 0, err
+		}
+
+		return 0, nil
+	}
+
+	return m.Sizeof(t)
+}
+
+// fieldAlign returns the alignment of t as a member of a struct or union.
+func (m Model) fieldAlign(t Type) (int, error) {
+	switch x := t.(type) {
+	case *ArrayType:
+		return m.fieldAlign(x.Item)
+	case *StructType:
+		return m.Alignof(x)
+	}
+
+	if v, ok := m[t.Kind()]; ok {
+		return v.StructAlign, nil
+	}
+
+	return 0, fmt.Errorf("alignment of %v is unknown", t)
+}
+
+// Layout computes the offsets of the fields of t, its size and alignment.
+//
+// The rules are those of the System V ABI as implemented by gcc. A bit-field
+// is allocated at the next available bit unless it would straddle a boundary
+// of the alignment of its type, in which case it starts at that boundary. A
+// zero width bit-field advances to the alignment of its type. Unnamed
+// bit-fields do not affect the alignment of the struct.
+//
+// A packed struct or field has alignment 1 and its bit-fields may straddle
+// alignment boundaries. A nonzero Pack caps the alignment of the fields and
+// disables the straddling check as well. The Align of a field or of t raises
+// the respective alignment, the former still subject to Pack.
+func (m Model) Layout(t *StructType) (*StructLayout, error) {
+	if t.Incomplete {
+		return nil, fmt.Errorf("%v is incomplete", t)
+	}
+
+	r := &StructLayout{Align: 1, Fields: make([]FieldLayout, len(t.Fields))}
+	starts := make([]int64, len(t.Fields)) // In bits.
+	ends := make([]int64, len(t.Fields))   // In bits.
+	var off, size int64                    // In bits.
+	for i, f := range t.Fields {
+		sz, err := m.fieldSize(f.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		a, err := m.fieldAlign(f.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.Union {
+			off = 0
+		}
+		packed := t.Packed || f.Packed
+		switch {
+		case f.BitField && f.Bits == 0:
+			off = roundup(off, 8*int64(a))
+		case f.BitField:
+			if !packed && t.Pack == 0 && off%(8*int64(a))+int64(f.Bits) > 8*sz {
+				off = roundup(off, 8*int64(a))
+			}
+			if f.Name != "" && r.Align < t.fieldAlign(f, a) {
+				r.Align = t.fieldAlign(f, a)
+			}
+		default:
+			a = t.fieldAlign(f, a)
+			off = roundup(off, 8*int64(a))
+			if r.Align < a {
+				r.Align = a
+			}
+		}
+		starts[i] = off
+		r.Fields[i] = FieldLayout{Offset: off / 8, BitOffset: int(off % 8), Size: sz}
+		switch {
+		case f.BitField:
+			off += int64(f.Bits)
+		default:
+			off += 8 * sz
+		}
+		ends[i] = off
+		if off > size {
+			size = off
+		}
+	}
+	if r.Align < t.Align {
+		r.Align = t.Align
+	}
+	r.Size = roundup(size, 8*int64(r.Align)) / 8
+	for i := range r.Fields {
+		next := 8 * r.Size
+		if !t.Union && i+1 < len(starts) {
+			next = starts[i+1]
+		}
+		if p := next/8 - roundup(ends[i], 8)/8; p > 0 {
+			r.Fields[i].Padding = p
+		}
+	}
+	return r, nil
+}
+
+// fieldAlign returns the alignment of f, given the alignment a of its type.
+func (t *StructType) fieldAlign(f Field, a int) int {
+	if t.Packed || f.Packed {
+		a = 1
+	}
+	if a < f.Align {
+		a = f.Align
+	}
+	if t.Pack != 0 && a > t.Pack {
+		a = t.Pack
+	}
+	return a
+}
+
+func roundup(n, to int64) int64 {
+	if r := n % to; r != 0 {
+		return n + to - r
+	}
+
+	return n
+}
@@ -10,9 +10,11 @@ import (
 	"bufio"
 	"go/token"
 	"io"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/cznic/golex/lex"
+	"github.com/cznic/ir"
 	"github.com/cznic/mathutil"
 	"github.com/cznic/xc"
 )
@@ -38,16 +40,40 @@ const (
 	ccUCNNonDigit // [0], Annex D, Universal character names for identifiers - non digits.
 )
 
+var (
+	// [0]5.2.1.1
+	trigraphMap = [256]byte{
+		'!':  '|',
+		'\'': '^',
+		'(':  '[',
+		')':  ']',
+		'-':  '~',
+		'/':  '\\',
+		'<':  '{',
+		'=':  '#',
+		'>':  '}',
+	}
+)
+
+// trigraph records a trigraph sequence found in the source.
+type trigraph struct {
+	pos    token.Pos // Of the first '?'.
+	c      byte      // The last character of the sequence.
+	splice bool      // "??/" immediately followed by a new line.
+}
+
 type trigraphs struct {
 	*lex.Lexer
-	pos token.Pos
-	r   *bufio.Reader
-	sc  int
+	found []trigraph
+	pos   token.Pos
+	q     int // Number of consecutive '?' read.
+	r     *bufio.Reader
+	sc    int
 }
 
 func newTrigraphs(ctx *context, file *token.File, r io.Reader) (*trigraphs, error) {
 	sc := scINITIAL
-	if ctx.tweaks.enableTrigraphs {
+	if ctx.tweaks.EnableTrigraphs {
 		sc = scTRIGRAPHS
 	}
 	t := &trigraphs{
@@ -58,7 +84,7 @@ func newTrigraphs(ctx *context, file *token.File, r io.Reader) (*trigraphs, erro
 	lx, err := lex.New(
 		file,
 		t,
-		lex.ErrorFunc(func(pos token.Pos, msg string) { ctx.errPos(pos, msg) }),
+		lex.ErrorFunc(func(pos token.Pos, msg string) { ctx.diagnose(SeverityError, "lexical", pos, "%s", msg) }),
 		lex.RuneClass(func(r rune) int { return int(r) }),
 	)
 	if err != nil {
@@ -79,6 +105,21 @@ func (t *trigraphs) ReadChar() (c lex.Char, size int, err error) {
 	}
 
 	c = lex.NewChar(t.pos, rune(b))
+	switch {
+	case b == '?':
+		t.q++
+	case t.q >= 2 && trigraphMap[b] != 0:
+		tg := trigraph{pos: t.pos - 2, c: b}
+		if b == '/' {
+			if p, err := t.r.Peek(1); err == nil && (p[0] == '\n' || p[0] == '\r') {
+				tg.splice = true
+			}
+		}
+		t.found = append(t.found, tg)
+		fallthrough
+	default:
+		t.q = 0
+	}
 	t.pos++
 	return c, 1, nil
 }
@@ -106,13 +147,18 @@ func (u *ungetBuffer) ungets(toks ...xc.Token) {
 type lexer struct {
 	*context
 	*lex.Lexer
-	ast         Node
-	commentPos0 token.Pos
-	last        lex.Char
-	mode        int // CONSTANT_EXPRESSION, TRANSLATION_UNIT
-	prev        lex.Char
-	sc          int
-	t           *trigraphs
+	ast           Node
+	commentPos0   token.Pos
+	expansions    []*Expansion // Per token of the ungetBuffer, if tracked.
+	last          lex.Char
+	lastExpansion *Expansion // Expansion producing last, if tracked.
+	mode          int        // CONSTANT_EXPRESSION, TRANSLATION_UNIT
+	pack          int        // Current #pragma pack, zero if none.
+	prev          lex.Char
+	sc            int
+	t             *trigraphs
+	typedef       bool           // The declaration being parsed has the typedef storage class.
+	typedefs      []map[int]bool // Identifiers declared per open brace, true for typedef names.
 	ungetBuffer
 }
 
@@ -124,14 +170,15 @@ func newLexer(ctx *context, nm string, sz int, r io.Reader) (*lexer, error) {
 	}
 
 	l := &lexer{
-		context: ctx,
-		t:       t,
+		context:  ctx,
+		t:        t,
+		typedefs: []map[int]bool{nil},
 	}
 
 	lx, err := lex.New(
 		file,
 		l,
-		lex.ErrorFunc(func(pos token.Pos, msg string) { l.errPos(pos, msg) }),
+		lex.ErrorFunc(func(pos token.Pos, msg string) { l.diagnose(SeverityError, "lexical", pos, "%s", msg) }),
 		lex.RuneClass(rune2class),
 	)
 	if err != nil {
@@ -142,23 +189,56 @@ func newLexer(ctx *context, nm string, sz int, r io.Reader) (*lexer, error) {
 	return l, nil
 }
 
-func (l *lexer) Error(msg string)             { l.err(l.First, "%v", msg) }
+func (l *lexer) Error(msg string) {
+	d := l.diagnose(SeverityError, "syntax", l.last.Pos(), "%s", msg)
+	for e := l.lastExpansion; e != nil; e = e.Parent {
+		d.Expansion = append(d.Expansion, l.note(e.Pos, "in expansion of macro %s defined at %v", e.Name, l.fset.PositionFor(e.Def, true)))
+	}
+}
+
 func (l *lexer) ReadRune() (rune, int, error) { panic("internal error") }
 
 func (l *lexer) Lex(lval *yySymType) (r int) {
 	// defer func() { dbg("", r) }()
 	//TODO use follow set to recover from errors.
-	if len(l.ungetBuffer) != 0 {
+	for len(l.ungetBuffer) != 0 {
 		lval.Token = l.ungetBuffer.read()
-		if lval.Token.Rune == PPNUMBER {
+		switch lval.Token.Rune {
+		case ' ', '\n':
+			continue
+		case pragmaPack:
+			l.pack = lval.Token.Val
+			continue
+		case IDENTIFIER, NON_REPL:
+			if v := lval.Token.Val; v == idAttr || v == idAttr2 {
+				l.attribute(lval.Token)
+				continue
+			}
+
+			lval.Token.Rune = l.toC(IDENTIFIER, lval.Token.Val)
+			if lval.Token.Rune == IDENTIFIER && l.isTypedefName(lval.Token.Val) {
+				lval.Token.Rune = TYPEDEF_NAME
+			}
+		case '{':
+			l.typedefs = append(l.typedefs, nil)
+		case '}':
+			if n := len(l.typedefs); n > 1 {
+				l.typedefs = l.typedefs[:n-1]
+			}
+		case PPNUMBER:
 			lval.Token.Rune = INTCONST
-		out:
-			for _, v := range dict.S(lval.Token.Val) {
-				switch v {
-				case '.', '+', '-', 'e', 'E', 'p', 'P':
-					lval.Token.Rune = FLOATCONST
-					break out
-				}
+			if isFloatConst(dict.S(lval.Token.Val)) {
+				lval.Token.Rune = FLOATCONST
+			}
+		}
+		if lval.Token.Rune == '}' && l.pack != 0 {
+			l.attrs(lval.Token.Pos()).pack = l.pack
+		}
+		l.last = lval.Token.Char
+		if l.expansions != nil {
+			l.lastExpansion = nil
+			if i := len(l.expansions) - len(l.ungetBuffer) - 1; i >= 0 {
+				l.lastExpansion = l.expansions[i]
 			}
 		}
 		return int(lval.Token.Rune)
@@ -173,67 +253,229 @@ func (l *lexer) Lex(lval *yySymType) (r int) {
 	return int(lval.Token.Rune)
 }
 
+// [0]6.7.7-3: In a declaration whose storage-class specifier is typedef,
+// each declarator defines an identifier to be a typedef name that denotes the
+// type specified for the identifier.
+//
+// declare records whether the identifier declared by d is a typedef name, so
+// later occurrences in the same block are lexed as TYPEDEF_NAME. Declaring an
+// ordinary identifier hides a typedef name of an enclosing block.
+func (l *lexer) declare(d *Declarator) {
+	m := l.typedefs[len(l.typedefs)-1]
+	if m == nil {
+		m = map[int]bool{}
+		l.typedefs[len(l.typedefs)-1] = m
+	}
+	m[d.ident().Val] = l.typedef
+}
+
+// isTypedefName reports whether the identifier id is a visible typedef name.
+// Identifiers following the tokens that introduce a tag, a member or a label
+// are never typedef names.
+func (l *lexer) isTypedefName(id int) bool {
+	switch l.last.Rune {
+	case ARROW, ENUM, GOTO, STRUCT, UNION, '.':
+		return false
+	}
+
+	for i := len(l.typedefs) - 1; i >= 0; i-- {
+		if v, ok := l.typedefs[i][id]; ok {
+			return v
+		}
+	}
+	return false
+}
+
+// attributes are the properties set by __attribute__ and #pragma pack that
+// affect the layout of structs and unions.
+type attributes struct {
+	aligned int
+	pack    int // Of a closing brace.
+	packed  bool
+}
+
+func (l *lexer) attrs(pos token.Pos) *attributes {
+	if l.attributes == nil {
+		l.attributes = map[token.Pos]*attributes{}
+	}
+	a := l.attributes[pos]
+	if a == nil {
+		a = &attributes{}
+		l.attributes[pos] = a
+	}
+	return a
+}
+
+// attribute consumes the GNU attribute specifier __attribute__((list))
+// starting at t. The packed and aligned attributes in the list are recorded
+// for the token preceding t, other attributes are ignored.
+func (l *lexer) attribute(t xc.Token) {
+	var toks []xc.Token
+	for level := 0; len(l.ungetBuffer) != 0; {
+		u := l.ungetBuffer.read()
+		switch u.Rune {
+		case ' ', '\n':
+			continue
+		case '(':
+			level++
+		case ')':
+			level--
+		}
+		toks = append(toks, u)
+		if level == 0 {
+			break
+		}
+	}
+	if len(toks) < 4 || toks[0].Rune != '(' || toks[1].Rune != '(' || toks[len(toks)-2].Rune != ')' || toks[len(toks)-1].Rune != ')' {
+		l.errPos(t.Pos(), "malformed %s", t.S())
+		return
+	}
+
+	for toks = toks[2 : len(toks)-2]; len(toks) != 0; {
+		var args []xc.Token
+		nm := toks[0]
+		toks = toks[1:]
+		if len(toks) != 0 && toks[0].Rune == '(' {
+			level := 0
+			for i, v := range toks {
+				switch v.Rune {
+				case '(':
+					level++
+				case ')':
+					level--
+				}
+				if level == 0 {
+					args = toks[1:i]
+					toks = toks[i+1:]
+					break
+				}
+			}
+		}
+		switch {
+		case len(toks) == 0:
+			// ok
+		case toks[0].Rune == ',':
+			toks = toks[1:]
+		default:
+			l.errPos(t.Pos(), "malformed %s", t.S())
+			return
+		}
+
+		if nm.Rune != IDENTIFIER || l.last.Pos() == 0 {
+			continue
+		}
+
+		switch s := strings.TrimSuffix(strings.TrimPrefix(string(nm.S()), "__"), "__"); dict.SID(s) {
+		case idAligned:
+			n := l.model.biggestAlign()
+			if len(args) != 0 {
+				if n = l.attributeAlign(nm, args); n == 0 {
+					break
+				}
+			}
+
+			if a := l.attrs(l.last.Pos()); n > a.aligned {
+				a.aligned = n
+			}
+		case idPacked:
+			l.attrs(l.last.Pos()).packed = true
+		}
+	}
+}
+
+// attributeAlign returns the alignment specified by args of the aligned
+// attribute nm or zero if it is not valid.
+func (l *lexer) attributeAlign(nm xc.Token, args []xc.Token) int {
+	if len(args) != 1 || args[0].Rune != PPNUMBER {
+		l.warnPos(nm.Pos(), "unsupported argument of attribute %s", nm.S())
+		return 0
+	}
+
+	v := l.intConst(args[0], string(args[0].S()))
+	if v.Type == Undefined {
+		return 0
+	}
+
+	n := v.Value.(*ir.Int64Value).Value
+	if n <= 0 || n&(n-1) != 0 || n > 1<<28 {
+		l.errPos(args[0].Pos(), "requested alignment is not a positive power of 2")
+		return 0
+	}
+
+	return int(n)
+}
+
+// ReadChar implements lex.CharReader. The reported size is the number of
+// source bytes consumed, including any trigraphs and line splices, so the
+// lexer offset, and thus the line table of the file, tracks the physical
+// source exactly.
 func (l *lexer) ReadChar() (c lex.Char, size int, err error) {
 	if c = l.t.Lookahead(); c.Rune == lex.RuneEOF {
 		return c, 0, io.EOF
 	}
 
+	pos0 := c.Pos()
+	c = l.readChar()
+	return c, int(l.t.Lookahead().Pos() - pos0), nil
+}
+
+func (l *lexer) readChar() (c lex.Char) {
 	ch := l.t.scan()
 	c = lex.NewChar(l.t.First.Pos(), rune(ch))
 	switch {
 	case ch <= 0x7f: // 1
-		return c, 1, nil
+		return c
 	case ch <= 0xc1: // invalid
 		c.Rune = utf8.RuneError
-		return c, 1, nil
+		return c
 	case ch <= 0xdf: // 110xxxxx 10xxxxxx
 		ch2 := l.t.scan()
 		if ch2&0xc0 != 0x80 {
 			c.Rune = utf8.RuneError
-			return c, 2, nil
+			return c
 		}
 
 		c.Rune = rune(ch&0x1f)<<6 | rune(ch2)&0x3f
-		return c, 2, nil
+		return c
 	case ch <= 0xef: // 1110xxxx 10xxxxxx 10xxxxxx
 		ch2 := l.t.scan()
 		if ch2&0xc0 != 0x80 {
 			c.Rune = utf8.RuneError
-			return c, 2, nil
+			return c
 		}
 
 		ch3 := l.t.scan()
 		if ch3&0xc0 != 0x80 {
 			c.Rune = utf8.RuneError
-			return c, 3, nil
+			return c
 		}
 
 		c.Rune = rune(ch&0xf)<<12 | rune(ch2)&0x3f<<6 | rune(ch3)&0x3f
-		return c, 3, nil
+		return c
 	case ch <= 0xf4: // 11110xxx 10xxxxxx 10xxxxxx 10xxxxxx
 		ch2 := l.t.scan()
 		if ch2&0xc0 != 0x80 {
 			c.Rune = utf8.RuneError
-			return c, 2, nil
+			return c
 		}
 
 		ch3 := l.t.scan()
 		if ch3&0xc0 != 0x80 {
 			c.Rune = utf8.RuneError
-			return c, 3, nil
+			return c
 		}
 
 		ch4 := l.t.scan()
 		if ch4&0xc0 != 0x80 {
 			c.Rune = utf8.RuneError
-			return c, 4, nil
+			return c
 		}
 
 		c.Rune = rune(ch&0x7)<<18 | rune(ch2)&0x3f<<12 | rune(ch3)&0x3f<<6 | rune(ch4)&0x3f
-		return c, 4, nil
+		return c
 	default: // invalid
 		c.Rune = utf8.RuneError
-		return c, 1, nil
+		return c
 	}
 }
 
@@ -253,7 +495,87 @@ func (l *lexer) Reduced(rule, state int, lval *yySymType) (stop bool) {
 	return true
 }
 
-func (l *lexer) comment(general bool)         { /*TODO*/ }
+// [0]5.1.1.2-1.3: Each comment is replaced by one space character. Trigraphs
+// inside comments are not reported unless they form a line splice.
+func (l *lexer) comment(general bool) {
+	toks := l.Token()
+	if l.tweaks.MacroComments && len(toks) != 0 {
+		l.recordComment(general, toks)
+	}
+
+	found := l.t.found
+	if len(found) == 0 || len(toks) == 0 {
+		return
+	}
+
+	lo, hi := l.First.Pos(), toks[len(toks)-1].Pos()
+	w := 0
+	for _, v := range found {
+		if v.pos >= lo && v.pos <= hi && !v.splice {
+			continue
+		}
+
+		found[w] = v
+		w++
+	}
+	l.t.found = found[:w]
+}
+
+// recordComment remembers the text and position of a comment for attaching
+// it to macro definitions.
+func (l *lexer) recordComment(general bool, toks []lex.Char) {
+	var b []rune
+	if general {
+		b = append(b, '/', '*')
+	}
+	for _, v := range toks {
+		b = append(b, v.Rune)
+	}
+	prev := l.last
+	if prev.Rune == ' ' {
+		prev = l.prev
+	}
+	l.comments = append(l.comments, comment{
+		end:  toks[len(toks)-1].Pos(),
+		own:  prev.Rune == 0 || prev.Rune == '\n',
+		pos:  l.First.Pos(),
+		text: string(b),
+	})
+}
+
+// trigraphWarnings reports the trigraphs found up to and including the last
+// scanned token or, when eof is true, all of them.
+func (l *lexer) trigraphWarnings(eof bool) {
+	found := l.t.found
+	if len(found) == 0 {
+		return
+	}
+
+	var hi token.Pos
+	if !eof {
+		toks := l.Token()
+		if len(toks) == 0 {
+			return
+		}
+
+		hi = toks[len(toks)-1].Pos()
+	}
+	i := 0
+	for ; i < len(found) && (eof || found[i].pos <= hi); i++ {
+		if l.tweaks.DisableTrigraphWarnings {
+			continue
+		}
+
+		v := found[i]
+		switch {
+		case l.tweaks.EnableTrigraphs:
+			l.warnPos(v.pos, "trigraph ??%c converted to %c", v.c, trigraphMap[v.c]).Fix = l.fix(v.pos, 3, string(trigraphMap[v.c]))
+		default:
+			l.warnPos(v.pos, "trigraph ??%c ignored, use EnableTrigraphs to enable", v.c)
+		}
+	}
+	l.t.found = found[:copy(found, found[i:])]
+}
 func (l *lexer) parseC() bool                 { return l.parse(TRANSLATION_UNIT) }
 func (l *lexer) parseExpr() bool              { return l.parse(CONSTANT_EXPRESSION) }
 func (l *lexer) lastPosition() token.Position { return l.fset.PositionFor(l.last.Pos(), true) }
@@ -261,6 +583,7 @@ func (l *lexer) lastPosition() token.Position { return l.fset.PositionFor(l.last
 func (l *lexer) cppScan() lex.Char {
 again:
 	r := l.scan()
+	l.trigraphWarnings(r == ccEOF)
 	if r == ' ' && l.last.Rune == ' ' {
 		goto again
 	}
@@ -273,7 +596,6 @@ again:
 func (l *lexer) lex0(lval *yySymType) int {
 	ch := l.scanChar()
 	lval.Token = xc.Token{Char: ch}
-out:
 	switch ch.Rune {
 	case ccEOF:
 		lval.Token.Rune = -1
@@ -281,12 +603,8 @@ out:
 		lval.Token.Rune = INTCONST
 		s := l.TokenBytes(nil)
 		lval.Token.Val = dict.ID(s)
-		for _, v := range s {
-			switch v {
-			case '.', '+', '-', 'e', 'E', 'p', 'P':
-				lval.Token.Rune = FLOATCONST
-				break out
-			}
+		if isFloatConst(s) {
+			lval.Token.Rune = FLOATCONST
 		}
 	default:
 		if _, ok := tokHasVal[ch.Rune]; ok {
@@ -308,6 +626,7 @@ func (l *lexer) parse(mode int) bool {
 func (l *lexer) scanChar() (c lex.Char) {
 again:
 	r := l.scan()
+	l.trigraphWarnings(r == ccEOF)
 	if r == ' ' {
 		goto again
 	}
@@ -320,3 +639,18 @@ again:
 	}
 	return l.last
 }
+
+// isFloatConst reports whether the pp-number s is a floating constant. The
+// digits of a hexadecimal constant include 'e' and 'E'.
+func isFloatConst(s []byte) bool {
+	exp := "eE"
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		exp = "pP"
+	}
+	for _, v := range s {
+		if v == '.' || strings.IndexByte(exp, v) >= 0 {
+			return true
+		}
+	}
+	return false
+}
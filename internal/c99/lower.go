@@ -0,0 +1,2138 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package c99
+
+// [0]: http://www.open-std.org/jtc1/sc22/wg14/www/docs/n1256.pdf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"go/token"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/cznic/ir"
+	"github.com/cznic/xc"
+)
+
+// IR lowers the translation unit tu to IR objects. There is an
+// ir.DataDefinition for every object with static storage duration and an
+// ir.FunctionDefinition for every function defined in tu. File scope
+// definitions come first, in order of appearance, followed by the objects
+// declared static in a block. Objects and functions tu declares but does not
+// define are referred to by name, as an ir.Global with Index -1, for the linker
+// to resolve.
+//
+// Pointers to structs, unions, void or incomplete types are all *struct{} in
+// IR, they are converted to pointers to the complete type when dereferenced.
+// Struct members are numbered as in the IR type of the struct, where the
+// bytes of consecutive bit-fields are a single [n]uint8 member. A struct the
+// layout of which cannot be expressed by an IR struct type, like a packed
+// one, is an [n]uint8 array accessed at byte offsets. Long double is float64
+// in IR.
+//
+// A variadic function has a hidden argument following its parameters, the
+// address of its variadic arguments stored in 8 byte slots after the default
+// argument promotions, see NewBuiltinSource. A call of __builtin_va_args
+// loads it. Callers are expected to pass the arguments of a variadic function
+// this way.
+//
+// A goto may jump to any label of its function, including one in a block it
+// is not in. Calls of setjmp and longjmp are reported as errors.
+func IR(tu *TranslationUnit) ([]ir.Object, error) {
+	ctx, err := newContext(tu.FileSet, &Tweaks{})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.model = tu.Model
+	g := &irGen{
+		ctx:      ctx,
+		index:    map[int]int{},
+		ldFormat: tu.Model.longDouble(),
+		model:    tu.Model,
+		order:    tu.Model.byteOrder(),
+		statics:  map[*Declarator]int{},
+		structs:  map[*StructType]*irStruct{},
+		tu:       tu,
+	}
+	g.translationUnit()
+	if err := ctx.error(); err != nil {
+		return nil, err
+	}
+
+	return g.objects, nil
+}
+
+// irStruct describes the IR type of a struct or union.
+type irStruct struct {
+	align   int64
+	fields  []int // IR member of StructType.Fields[i], -1 for a bit-field.
+	fillers []irFiller
+	opaque  bool // Members are accessed at byte offsets.
+	size    int64
+	typ     string
+}
+
+// irFiller is an [n]uint8 member holding the bytes of bit-fields or padding.
+type irFiller struct {
+	index int // IR member.
+	off   int64
+	size  int64
+}
+
+// irBitField describes the access to a bit-field member using an unsigned
+// integer of unit bytes at off.
+type irBitField struct {
+	bit  int // Of the first bit of the bit-field in the unit.
+	bits int
+	off  int64 // Within the struct.
+	typ  Type  // Declared type.
+	unit int64
+}
+
+// irDefinition is a file scope object or function defined in the translation
+// unit.
+type irDefinition struct {
+	decl *Declarator // The declaration providing the type and initializer.
+	fn   *FunctionDefinition
+}
+
+// irFunc is the state of the function being lowered.
+type irFunc struct {
+	body      []ir.Operation
+	breaks    []int // Labels.
+	cases     map[*LabeledStmt]int
+	continues []int       // Labels.
+	gotos     []xc.Token  // Targets of goto statements.
+	labels    map[int]int // Label name: label number.
+	locals    map[*Declarator]int
+	main      bool
+	name      ir.NameID
+	named     map[int]bool // Label name: defined.
+	params    map[*Declarator]int
+	result    Type
+	temps     []ir.Operation
+	va        int // Index of the hidden argument of a variadic function or -1.
+	vars      int // Number of variables.
+}
+
+// irGen lowers a translation unit to IR.
+type irGen struct {
+	ctx      *context
+	defs     []irDefinition // Items correspond to objects.
+	f        *irFunc
+	index    map[int]int // Identifier with linkage: object.
+	labels   int
+	ldFormat longDoubleFormat
+	model    Model
+	objects  []ir.Object
+	order    binary.ByteOrder
+	statics  map[*Declarator]int // Object of a static local.
+	structs  map[*StructType]*irStruct
+	tu       *TranslationUnit
+}
+
+func (g *irGen) pos(n Node) token.Position { return g.ctx.position(n) }
+
+func (g *irGen) emit(op ir.Operation) { g.f.body = append(g.f.body, op) }
+
+// unsupported reports that n cannot be lowered.
+func (g *irGen) unsupported(n Node, s string) {
+	g.ctx.err(n, "lowering of %s is not supported", s)
+}
+
+func (g *irGen) tid(s string) ir.TypeID { return ir.TypeID(dict.SID(s)) }
+
+func (g *irGen) linkage(l Linkage) ir.Linkage {
+	if l == LinkageInternal {
+		return ir.InternalLinkage
+	}
+
+	return ir.ExternalLinkage
+}
+
+// typ returns the IR type of t.
+func (g *irGen) typ(t Type) string {
+	switch x := t.(type) {
+	case *ArrayType:
+		n := x.Size
+		if n < 0 {
+			n = 0
+		}
+		return fmt.Sprintf("[%d]%s", n, g.typ(x.Item))
+	case *FunctionType:
+		var a []string
+		for _, v := range x.Params {
+			a = append(a, g.typ(v))
+		}
+		if x.Variadic {
+			a = append(a, "...")
+		}
+		s := "func(" + strings.Join(a, ",") + ")"
+		if x.Result != Void {
+			s += g.typ(x.Result)
+		}
+		return s
+	case *PointerType:
+		switch y := x.Item.(type) {
+		case *StructType:
+			return "*struct{}"
+		case TypeKind:
+			if y == Void {
+				return "*struct{}"
+			}
+		}
+		return "*" + g.typ(x.Item)
+	case *StructType:
+		return g.structType(x).typ
+	case TypeKind:
+		switch x {
+		case Bool:
+			return "uint8"
+		case Float:
+			return "float32"
+		case Double, LongDouble:
+			return "float64"
+		case FloatComplex:
+			return "complex64"
+		case DoubleComplex, LongDoubleComplex:
+			return "complex128"
+		case Void:
+			return "struct{}"
+		}
+		if intConvRank[x] != 0 {
+			s := "int"
+			if !isSigned[x] {
+				s = "uint"
+			}
+			return fmt.Sprintf("%s%d", s, 8*g.model[x].Size)
+		}
+	}
+	panic("internal error")
+}
+
+// ptr returns the IR type of the address of an object of type t.
+func (g *irGen) ptr(t Type) string { return "*" + g.typ(t) }
+
+// sizeAlign returns the size and alignment of the IR type of t.
+func (g *irGen) sizeAlign(t Type) (int64, int64) {
+	switch x := t.(type) {
+	case *ArrayType:
+		sz, al := g.sizeAlign(x.Item)
+		if x.Size < 0 {
+			return 0, al
+		}
+
+		return x.Size * sz, al
+	case *FunctionType:
+		return 0, 1
+	case *PointerType:
+		return int64(g.model[Ptr].Size), int64(g.model[Ptr].Align)
+	case *StructType:
+		s := g.structType(x)
+		return s.size, s.align
+	case TypeKind:
+		switch x {
+		case LongDouble:
+			return 8, 8
+		case LongDoubleComplex:
+			return 16, 8
+		case Void:
+			return 0, 1
+		}
+		return int64(g.model[x].Size), int64(g.model[x].Align)
+	}
+	panic("internal error")
+}
+
+// structType returns the IR type of t.
+func (g *irGen) structType(t *StructType) *irStruct {
+	if s := g.structs[t]; s != nil {
+		return s
+	}
+
+	s := &irStruct{align: 1, typ: "struct{}"}
+	g.structs[t] = s
+	l, err := g.model.Layout(t)
+	if err != nil {
+		s.opaque = true
+		return s
+	}
+
+	var a []string
+	filler := func(off, n int64) {
+		s.fillers = append(s.fillers, irFiller{len(a), off, n})
+		a = append(a, fmt.Sprintf("[%d]uint8", n))
+	}
+	var off int64 // Of the next IR member.
+	for i, f := range t.Fields {
+		fl := l.Fields[i]
+		if f.BitField {
+			s.fields = append(s.fields, -1)
+			end := fl.Offset + int64(fl.BitOffset+f.Bits+7)/8
+			switch {
+			case f.Bits == 0:
+				// nop
+			case t.Union:
+				filler(0, end)
+				if end > off {
+					off = end
+				}
+			case end > off:
+				filler(off, end-off)
+				off = end
+			}
+			continue
+		}
+
+		sz, al := g.sizeAlign(f.Type)
+		if al > s.align {
+			s.align = al
+		}
+		if t.Union {
+			s.fields = append(s.fields, len(a))
+			a = append(a, g.typ(f.Type))
+			if sz > off {
+				off = sz
+			}
+			continue
+		}
+
+		if roundup(off, al) != fl.Offset {
+			if off > fl.Offset || fl.Offset%al != 0 {
+				s.opaque = true
+				break
+			}
+
+			filler(off, fl.Offset-off)
+		}
+		s.fields = append(s.fields, len(a))
+		a = append(a, g.typ(f.Type))
+		off = fl.Offset + sz
+	}
+	if !s.opaque && roundup(off, s.align) != l.Size {
+		switch {
+		case t.Union && off < l.Size:
+			filler(0, l.Size)
+		case !t.Union && off < l.Size:
+			filler(off, l.Size-off)
+		}
+		s.opaque = roundup(l.Size, s.align) != l.Size
+	}
+	s.size = l.Size
+	if s.opaque {
+		s.align = 1
+		s.fields = nil
+		s.fillers = nil
+		s.typ = fmt.Sprintf("[%d]uint8", l.Size)
+		return s
+	}
+
+	k := "struct"
+	if t.Union {
+		k = "union"
+	}
+	s.typ = fmt.Sprintf("%s{%s}", k, strings.Join(a, ","))
+	return s
+}
+
+// intptr returns the signed integer type of the size of a pointer.
+func (g *irGen) intptr() Type {
+	for _, k := range []TypeKind{Int, Long, LongLong} {
+		if g.model[k].Size == g.model[Ptr].Size {
+			return k
+		}
+	}
+	panic("internal error")
+}
+
+func (g *irGen) translationUnit() {
+	// Assign the objects first, so any of them can be referred to.
+	for l := g.tu; l != nil; l = l.TranslationUnit {
+		switch n := l.ExternalDeclaration; n.Case {
+		case ExternalDeclarationDecl: // Declaration
+			o := n.Declaration.InitDeclaratorListOpt
+			if o == nil {
+				break
+			}
+
+			extern := isExtern(n.Declaration.DeclarationSpecifiers)
+			for l := o.InitDeclaratorList; l != nil; l = l.InitDeclaratorList {
+				d := l.InitDeclarator.Declarator
+				if d.Typedef || d.Type.Kind() == Function || extern && l.InitDeclarator.Case != InitDeclaratorInit {
+					continue
+				}
+
+				g.define(d, nil)
+			}
+		case ExternalDeclarationFunc: // FunctionDefinition
+			g.define(n.FunctionDefinition.Declarator, n.FunctionDefinition)
+		}
+	}
+	for i, v := range g.defs {
+		if v.fn != nil {
+			f := g.function(v.fn) // Appends the static locals.
+			g.objects[i] = f
+			continue
+		}
+
+		d := v.decl
+		t := d.Type
+		if x, ok := t.(*ArrayType); ok && x.Size < 0 {
+			// [0]6.9.2-2: If a translation unit contains one or
+			// more tentative definitions for an identifier, and
+			// the translation unit contains no external definition
+			// for that identifier, then the behavior is exactly as
+			// if the translation unit contains a file scope
+			// declaration of that identifier, with the composite
+			// type as of the end of the translation unit, with an
+			// initializer equal to 0.
+			t = &ArrayType{Item: x.Item, Size: 1}
+		}
+		g.objects[i] = ir.NewDataDefinition(g.pos(d), ir.NameID(d.ident().Val), 0, g.tid(g.typ(t)), g.linkage(d.Linkage), g.data(d, t, d.Image))
+	}
+}
+
+// isExtern reports whether n has the storage class specifier extern.
+func isExtern(n *DeclarationSpecifiers) bool {
+	for n != nil {
+		if x := n.StorageClassSpecifier; x != nil && x.Case == StorageClassSpecifierExtern {
+			return true
+		}
+
+		if n.DeclarationSpecifiersOpt == nil {
+			break
+		}
+
+		n = n.DeclarationSpecifiersOpt.DeclarationSpecifiers
+	}
+	return false
+}
+
+// define records the definition of the identifier with linkage d declares,
+// using the function definition fn, if any. An initialized declaration
+// supersedes the tentative ones.
+func (g *irGen) define(d *Declarator, fn *FunctionDefinition) {
+	nm := d.ident().Val
+	i, ok := g.index[nm]
+	if !ok {
+		g.index[nm] = len(g.objects)
+		g.objects = append(g.objects, nil)
+		g.defs = append(g.defs, irDefinition{d, fn})
+		return
+	}
+
+	switch p := &g.defs[i]; {
+	case fn != nil:
+		*p = irDefinition{d, fn}
+	case d.Image != nil || p.decl.Image == nil && d.Type.Kind() == Array:
+		p.decl = d
+	}
+}
+
+// data returns the IR value of the object of type t initialized by img, nil if
+// it is all zero.
+func (g *irGen) data(n Node, t Type, img *Image) ir.Value {
+	if img == nil {
+		return nil
+	}
+
+	relocs := map[int64]Reloc{}
+	for _, v := range img.Relocs {
+		relocs[v.Offset] = v
+	}
+	return g.dataValue(n, t, img.Data, 0, relocs)
+}
+
+// dataValue returns the IR value of the object of type t at off in b, nil if
+// it is all zero. The address constants in b are relocs.
+
+func (g *irGen) dataValue(n Node, t Type, b []byte, off int64, relocs map[int64]Reloc) ir.Value {
+	switch x := t.(type) {
+	case *ArrayType:
+		sz, err := g.model.Sizeof(x.Item)
+		if err != nil {
+			panic("internal error")
+		}
+
+		var a []ir.Value
+		for i := int64(0); i < x.Size; i++ {
+			if v := g.dataValue(n, x.Item, b, off+i*sz, relocs); v != nil {
+				a = append(a, &ir.DesignatedValue{Index: int(i), Value: v})
+			}
+		}
+		if a == nil {
+			return nil
+		}
+
+		return &ir.CompositeValue{Values: a}
+	case *PointerType:
+		if r, ok := relocs[off]; ok {
+			return g.address(n, r)
+		}
+
+		if v := g.uint(b[off : off+int64(g.model[Ptr].Size)]); v != 0 {
+			return &ir.Int64Value{Value: int64(v)}
+		}
+
+		return nil
+	case *StructType:
+		s := g.structType(x)
+		l, err := g.model.Layout(x)
+		if err != nil {
+			panic("internal error")
+		}
+
+		var a []ir.Value
+		bytes := func(index int, off, size int64) {
+			var c []ir.Value
+			for i := off; i < off+size; i++ {
+				if _, ok := relocs[i]; ok {
+					g.unsupported(n, "an address constant in a packed struct")
+				}
+				if b[i] != 0 {
+					c = append(c, &ir.DesignatedValue{Index: int(i - off), Value: &ir.Int32Value{Value: int32(b[i])}})
+				}
+			}
+			if c != nil {
+				a = append(a, &ir.DesignatedValue{Index: index, Value: &ir.CompositeValue{Values: c}})
+			}
+		}
+		switch {
+		case s.opaque:
+			bytes(-1, off, s.size)
+			if a == nil {
+				return nil
+			}
+
+			return a[0].(*ir.DesignatedValue).Value
+		case x.Union:
+			// The first member covering the union, if any, otherwise
+			// the trailing filler.
+			for i, f := range x.Fields {
+				if j := s.fields[i]; j >= 0 {
+					if sz, _ := g.sizeAlign(f.Type); sz == s.size {
+						if v := g.dataValue(n, f.Type, b, off, relocs); v != nil {
+							a = append(a, &ir.DesignatedValue{Index: j, Value: v})
+						}
+						break
+					}
+				}
+				if i == len(x.Fields)-1 {
+					if len(s.fillers) == 0 {
+						g.unsupported(n, "the initializer of this union")
+						break
+					}
+
+					v := s.fillers[len(s.fillers)-1]
+					bytes(v.index, off, s.size)
+				}
+			}
+		default:
+			for i, f := range x.Fields {
+				if j := s.fields[i]; j >= 0 {
+					if v := g.dataValue(n, f.Type, b, off+l.Fields[i].Offset, relocs); v != nil {
+						a = append(a, &ir.DesignatedValue{Index: j, Value: v})
+					}
+				}
+			}
+			for _, v := range s.fillers {
+				bytes(v.index, off+v.off, v.size)
+			}
+			sort.Slice(a, func(i, j int) bool {
+				return a[i].(*ir.DesignatedValue).Index < a[j].(*ir.DesignatedValue).Index
+			})
+		}
+		if a == nil {
+			return nil
+		}
+
+		return &ir.CompositeValue{Values: a}
+	case TypeKind:
+		sz := int64(g.model[x].Size)
+		if intConvRank[x] != 0 && relocs != nil {
+			if r, ok := relocs[off]; ok {
+				return g.address(n, r)
+			}
+		}
+
+		u := g.uint(b[off : off+sz])
+		if u == 0 && x != LongDoubleComplex {
+			return nil
+		}
+
+		switch {
+		case intConvRank[x] != 0 && sz <= 4:
+			return &ir.Int32Value{Value: int32(u)}
+		case intConvRank[x] != 0:
+			return &ir.Int64Value{Value: int64(u)}
+		case x == Float:
+			return &ir.Float32Value{Value: math.Float32frombits(uint32(u))}
+		case x == Double:
+			return &ir.Float64Value{Value: math.Float64frombits(u)}
+		case x == LongDouble:
+			return &ir.Float64Value{Value: g.longDouble(b[off : off+sz])}
+		case x == FloatComplex:
+			re := math.Float32frombits(uint32(g.uint(b[off : off+4])))
+			im := math.Float32frombits(uint32(g.uint(b[off+4 : off+8])))
+			return &ir.Complex64Value{Value: complex(re, im)}
+		case x == DoubleComplex:
+			re := math.Float64frombits(g.uint(b[off : off+8]))
+			im := math.Float64frombits(g.uint(b[off+8 : off+16]))
+			return &ir.Complex128Value{Value: complex(re, im)}
+		case x == LongDoubleComplex:
+			re := g.longDouble(b[off : off+sz/2])
+			im := g.longDouble(b[off+sz/2 : off+sz])
+			if re == 0 && im == 0 {
+				return nil
+			}
+
+			return &ir.Complex128Value{Value: complex(re, im)}
+		}
+	}
+	panic("internal error")
+}
+
+// uint returns the unsigned integer stored in b.
+func (g *irGen) uint(b []byte) uint64 {
+	var n uint64
+	for i := range b {
+		j := len(b) - 1 - i
+		if g.order == binary.BigEndian {
+			j = i
+		}
+		n = n<<8 | uint64(b[j])
+	}
+	return n
+}
+
+// longDouble returns the long double stored in b, see putLongDouble.
+func (g *irGen) longDouble(b []byte) float64 {
+	var se, m uint64 // Sign and exponent, significand with an explicit integer bit.
+	switch g.ldFormat {
+	case longDoubleBinary64:
+		return math.Float64frombits(g.uint(b))
+	case longDoubleDoubleDouble:
+		return math.Float64frombits(g.uint(b[:8])) + math.Float64frombits(g.uint(b[8:]))
+	case longDoubleX87:
+		m, se = g.uint(b[:8]), g.uint(b[8:10])
+	case longDoubleBinary128:
+		lo, hi := g.uint(b[:8]), g.uint(b[8:])
+		if g.order == binary.BigEndian {
+			lo, hi = hi, lo
+		}
+		se = hi >> 48
+		m = hi<<16>>1 | lo>>49
+		if se&0x7fff != 0 {
+			m |= 1 << 63
+		}
+	default:
+		panic("internal error")
+	}
+	var f float64
+	switch e := int(se & 0x7fff); e {
+	case 0x7fff:
+		f = math.Inf(1)
+		if m<<1 != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(float64(m), e-16383-63)
+	}
+	if se&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// address returns the IR value of the address constant r.
+func (g *irGen) address(n Node, r Reloc) ir.Value {
+	switch x := r.Target.(type) {
+	case *Declarator:
+		if i, ok := g.statics[x]; ok {
+			return &ir.AddressValue{Index: i, Linkage: ir.InternalLinkage, NameID: g.objects[i].Base().NameID, Offset: uintptr(r.Addend)}
+		}
+
+		i, ok := g.index[x.ident().Val]
+		if !ok {
+			return &ir.AddressValue{Index: -1, Linkage: ir.ExternalLinkage, NameID: ir.NameID(x.ident().Val), Offset: uintptr(r.Addend)}
+		}
+
+		return &ir.AddressValue{Index: i, Linkage: g.linkage(x.Linkage), NameID: ir.NameID(x.ident().Val), Offset: uintptr(r.Addend)}
+	case *Expr:
+		return &ir.StringValue{Offset: uintptr(r.Addend), StringID: g.stringID(x)}
+	}
+	panic("internal error")
+}
+
+// stringID returns the content of the array object the string literal n
+// denotes, without the terminating null character.
+func (g *irGen) stringID(n *Expr) ir.StringID {
+	s := n.Value.Value.(*ir.StringValue)
+	if n.Case == ExprString {
+		return s.StringID
+	}
+
+	sz := g.model[Int].Size
+	var b []byte
+	for _, r := range string(dict.S(int(s.StringID))) {
+		c := make([]byte, sz)
+		for i := range c {
+			j := i
+			if g.order == binary.BigEndian {
+				j = sz - 1 - i
+			}
+			c[j] = byte(r)
+			r >>= 8
+		}
+		b = append(b, c...)
+	}
+	return ir.StringID(dict.SID(string(b)))
+}
+
+// function lowers the function definition n.
+func (g *irGen) function(n *FunctionDefinition) *ir.FunctionDefinition {
+	d := n.Declarator
+	t := d.Type.(*FunctionType)
+	g.f = &irFunc{
+		cases:  map[*LabeledStmt]int{},
+		labels: map[int]int{},
+		locals: map[*Declarator]int{},
+		named:  map[int]bool{},
+		main:   d.Linkage == LinkageExternal && string(d.ident().S()) == "main",
+		name:   ir.NameID(d.ident().Val),
+		params: map[*Declarator]int{},
+		result: t.Result,
+		va:     -1,
+	}
+	var args, results []ir.NameID
+	switch fd := d.DirectDeclarator.funcDeclarator(); fd.Case {
+	case DirectDeclaratorParamList:
+		if len(t.Params) == 0 {
+			break
+		}
+
+		for l := fd.ParameterTypeList.ParameterList; l != nil; l = l.ParameterList {
+			var nm ir.NameID
+			if d := l.ParameterDeclaration.Declarator; d != nil {
+				g.f.params[d] = len(args)
+				nm = ir.NameID(d.ident().Val)
+			}
+			args = append(args, nm)
+		}
+	case DirectDeclaratorIdentList:
+		if fd.IdentifierListOpt != nil {
+			g.unsupported(fd, "an identifier list")
+		}
+	}
+	if t.Variadic {
+		g.f.va = len(args)
+	}
+	if t.Result != Void {
+		results = []ir.NameID{0}
+	}
+	r := ir.NewFunctionDefinition(g.pos(d), ir.NameID(d.ident().Val), 0, g.tid(g.typ(t)), g.linkage(d.Linkage), args, results, 0)
+	c := n.FunctionBody.CompoundStmt
+	g.emit(&ir.BeginScope{Position: g.pos(c)})
+	if o := c.BlockItemListOpt; o != nil {
+		g.blockItems(o.BlockItemList)
+	}
+	p := g.ctx.fset.PositionFor(c.Token2.Pos(), true)
+	if g.f.main && t.Result == Int {
+		// [0]5.1.2.2.3-1: ... reaching the } that terminates the
+		// main function returns a value of 0.
+		g.emit(&ir.Result{Address: true, TypeID: g.tid(g.ptr(Int)), Position: p})
+		g.emit(&ir.Const32{TypeID: g.tid(g.typ(Int)), Position: p})
+		g.emit(&ir.Store{TypeID: g.tid(g.typ(Int)), Position: p})
+		g.emit(&ir.Drop{TypeID: g.tid(g.typ(Int)), Position: p})
+	}
+	g.emit(&ir.Return{Position: p})
+	g.emit(&ir.EndScope{Position: p})
+	for _, v := range g.f.gotos {
+		if !g.f.named[v.Val] {
+			g.ctx.errPos(v.Pos(), "label '%s' used but not defined", v.S())
+			g.f.named[v.Val] = true // Report once.
+		}
+	}
+	// The temporaries are declared at the beginning of the function.
+	r.Body = append(append(g.f.body[:1:1], g.f.temps...), g.f.body[1:]...)
+	g.f = nil
+	return r
+}
+
+func (g *irGen) label() int {
+	g.labels++
+	return g.labels
+}
+
+// temp declares a temporary variable of IR type t and returns its index.
+func (g *irGen) temp(t string) int {
+	i := g.f.vars
+	g.f.vars++
+	g.f.temps = append(g.f.temps, &ir.VariableDeclaration{Index: i, TypeID: g.tid(t)})
+	return i
+}
+
+func (g *irGen) blockItems(l *BlockItemList) {
+	for ; l != nil; l = l.BlockItemList {
+		switch n := l.BlockItem; n.Case {
+		case BlockItemDecl: // Declaration
+			g.declaration(n.Declaration)
+		case BlockItemStmt: // Stmt
+			g.stmt(n.Stmt)
+		}
+	}
+}
+
+// declaration lowers the block scope declaration n.
+func (g *irGen) declaration(n *Declaration) {
+	o := n.InitDeclaratorListOpt
+	if o == nil {
+		return
+	}
+
+	for l := o.InitDeclaratorList; l != nil; l = l.InitDeclaratorList {
+		d := l.InitDeclarator.Declarator
+		switch {
+		case d.Typedef || d.Type.Kind() == Function || d.Linkage != LinkageNone:
+			// nop
+		case d.Static:
+			i := len(g.objects)
+			g.statics[d] = i
+			nm := fmt.Sprintf("%s.%s", dict.S(int(g.f.name)), d.ident().S())
+			o := ir.NewDataDefinition(g.pos(d), ir.NameID(dict.SID(nm)), 0, g.tid(g.typ(d.Type)), ir.InternalLinkage, nil)
+			g.objects = append(g.objects, o)
+			o.Value = g.data(d, d.Type, d.Image)
+		default:
+			if x, ok := d.Type.(*ArrayType); ok && x.Size < 0 {
+				g.unsupported(d, "a variable length array")
+				continue
+			}
+
+			i := g.f.vars
+			g.f.vars++
+			g.f.locals[d] = i
+			g.emit(&ir.VariableDeclaration{Index: i, NameID: ir.NameID(d.ident().Val), TypeID: g.tid(g.typ(d.Type)), Position: g.pos(d)})
+			if l.InitDeclarator.Case == InitDeclaratorInit {
+				g.initialize(d, i, d.Type, g.ctx.initItems(l.InitDeclarator.Initializer, d.Type))
+			}
+		}
+	}
+}
+
+// initialize stores items, the initializer of the variable i of type t.
+func (g *irGen) initialize(n Node, i int, t Type, items []initItem) {
+	for _, v := range items {
+		switch {
+		case v.bf != nil:
+			bf := &irBitField{bit: v.bf.bit, bits: v.bf.bits, off: v.off, typ: v.typ}
+			if sz, _ := g.sizeAlign(t); !g.bitUnit(n, bf, sz) {
+				continue
+			}
+
+			u := g.unitType(bf)
+			p, w := g.temp("*"+u), g.temp(g.typ(v.typ))
+			g.variable(n, p, "*"+u)
+			g.variable(n, i, g.typ(t))
+			g.offset(n, g.ptr(t), bf.off, "*"+u)
+			g.store(n, "*"+u, false)
+			g.variable(n, w, g.typ(v.typ))
+			g.exprAs(v.expr, v.typ)
+			g.store(n, g.typ(v.typ), false)
+			g.bitFieldStore(n, bf, p, w)
+		case v.typ.Kind() == Array:
+			// A string literal initializing a character array.
+			s := stringLiteral(v.expr)
+			at := v.typ.(*ArrayType)
+			ct := &ArrayType{Item: at.Item, Size: s.Value.Type.(*ArrayType).Size}
+			if ct.Size > at.Size {
+				ct.Size = at.Size
+			}
+			g.variable(n, i, g.typ(t))
+			g.offset(n, g.ptr(t), v.off, g.ptr(ct))
+			g.addr(s)
+			g.conv(g.ptr(s.Value.Type), g.ptr(ct))
+			g.emit(&ir.Load{TypeID: g.tid(g.ptr(ct)), Position: g.pos(s)})
+			g.store(n, g.typ(ct), false)
+		default:
+			g.variable(n, i, g.typ(t))
+			g.offset(n, g.ptr(t), v.off, g.ptr(v.typ))
+			g.exprAs(v.expr, v.typ)
+			g.store(v.expr, g.typ(v.typ), false)
+		}
+	}
+}
+
+// variable pushes the address of the variable i of IR type t.
+func (g *irGen) variable(n Node, i int, t string) {
+	g.emit(&ir.Variable{Address: true, Index: i, TypeID: g.tid("*" + t), Position: g.pos(n)})
+}
+
+// loadVar pushes the value of the variable i of IR type t.
+func (g *irGen) loadVar(n Node, i int, t string) {
+	g.variable(n, i, t)
+	g.emit(&ir.Load{TypeID: g.tid("*" + t), Position: g.pos(n)})
+}
+
+// store stores the value of IR type t on top of the stack at the address
+// below it. The value is left on the stack if value is set.
+func (g *irGen) store(n Node, t string, value bool) {
+	g.emit(&ir.Store{TypeID: g.tid(t), Position: g.pos(n)})
+	if !value {
+		g.emit(&ir.Drop{TypeID: g.tid(t), Position: g.pos(n)})
+	}
+}
+
+func (g *irGen) stmt(n *Stmt) {
+	switch n.Case {
+	case StmtBlock: // CompoundStmt
+		g.compoundStmt(n.CompoundStmt)
+	case StmtExpr: // ExprStmt
+		if o := n.ExprStmt.ExprListOpt; o != nil {
+			g.voidList(o.ExprList)
+		}
+	case StmtIter: // IterationStmt
+		g.iterationStmt(n.IterationStmt)
+	case StmtJump: // JumpStmt
+		g.jumpStmt(n.JumpStmt)
+	case StmtLabeled: // LabeledStmt
+		g.labeledStmt(n.LabeledStmt)
+	case StmtSelect: // SelectionStmt
+		g.selectionStmt(n.SelectionStmt)
+	default:
+		panic("internal error")
+	}
+}
+
+func (g *irGen) compoundStmt(n *CompoundStmt) {
+	g.emit(&ir.BeginScope{Position: g.pos(n)})
+	if o := n.BlockItemListOpt; o != nil {
+		g.blockItems(o.BlockItemList)
+	}
+	g.emit(&ir.EndScope{Position: g.ctx.fset.PositionFor(n.Token2.Pos(), true)})
+}
+
+func (g *irGen) jmp(n Node, label int) {
+	g.emit(&ir.Jmp{Number: label, Position: g.pos(n)})
+}
+
+func (g *irGen) place(label int) { g.emit(&ir.Label{Number: label}) }
+
+// branch jumps to label if the value of the controlling expression l is
+// nonzero, or zero if nonzero is not set.
+func (g *irGen) branch(l *ExprList, label int, nonzero bool) {
+	if v := l.Value; g.isConst(v) {
+		if nonzero && v.isNonzero() || !nonzero && v.isZero() {
+			g.jmp(l, label)
+		}
+		return
+	}
+
+	t := g.exprList(l)
+	g.emit(&ir.Bool{TypeID: g.tid(g.typ(t)), Position: g.pos(l)})
+	if nonzero {
+		g.emit(&ir.Jnz{Number: label, Position: g.pos(l)})
+		return
+	}
+
+	g.emit(&ir.Jz{Number: label, Position: g.pos(l)})
+}
+
+// loop lowers the body n of a loop.
+func (g *irGen) loop(n *Stmt, brk, cont int) {
+	f := g.f
+	f.breaks = append(f.breaks, brk)
+	f.continues = append(f.continues, cont)
+	g.stmt(n)
+	f.breaks = f.breaks[:len(f.breaks)-1]
+	f.continues = f.continues[:len(f.continues)-1]
+}
+
+func (g *irGen) iterationStmt(n *IterationStmt) {
+	brk, cont := g.label(), g.label()
+	switch n.Case {
+	case IterationStmtDo: // "do" Stmt "while" '(' ExprList ')' ';'
+		top := g.label()
+		g.place(top)
+		g.loop(n.Stmt, brk, cont)
+		g.place(cont)
+		g.branch(n.ExprList, top, true)
+	case IterationStmtForDecl, IterationStmtFor:
+		cond, post := n.ExprListOpt2, n.ExprListOpt3
+		switch n.Case {
+		case IterationStmtForDecl: // "for" '(' Declaration ExprListOpt ';' ExprListOpt ')' Stmt
+			cond, post = n.ExprListOpt, n.ExprListOpt2
+			g.emit(&ir.BeginScope{Position: g.pos(n)})
+			g.declaration(n.Declaration)
+		default: // "for" '(' ExprListOpt ';' ExprListOpt ';' ExprListOpt ')' Stmt
+			if o := n.ExprListOpt; o != nil {
+				g.voidList(o.ExprList)
+			}
+		}
+		top := g.label()
+		g.place(top)
+		if cond != nil {
+			g.branch(cond.ExprList, brk, false)
+		}
+		g.loop(n.Stmt, brk, cont)
+		g.place(cont)
+		if post != nil {
+			g.voidList(post.ExprList)
+		}
+		g.jmp(n, top)
+		if n.Case == IterationStmtForDecl {
+			g.place(brk)
+			g.emit(&ir.EndScope{Position: g.pos(n)})
+			return
+		}
+	case IterationStmtWhile: // "while" '(' ExprList ')' Stmt
+		g.place(cont)
+		g.branch(n.ExprList, brk, false)
+		g.loop(n.Stmt, brk, cont)
+		g.jmp(n, cont)
+	default:
+		panic("internal error")
+	}
+	g.place(brk)
+}
+
+func (g *irGen) jumpStmt(n *JumpStmt) {
+	f := g.f
+	switch n.Case {
+	case JumpStmtBreak: // "break" ';'
+		g.jmp(n, f.breaks[len(f.breaks)-1])
+	case JumpStmtContinue: // "continue" ';'
+		g.jmp(n, f.continues[len(f.continues)-1])
+	case JumpStmtGoto: // "goto" IDENTIFIER ';'
+		// Labels are function scoped and IR jumps are not restricted by
+		// blocks, so a goto may enter any block, see ccgo.
+		f.gotos = append(f.gotos, n.Token2)
+		g.emit(&ir.Jmp{NameID: ir.NameID(n.Token2.Val), Number: g.namedLabel(n.Token2), Position: g.pos(n)})
+	case JumpStmtReturn: // "return" ExprListOpt ';'
+		if o := n.ExprListOpt; o != nil {
+			switch t := f.result; {
+			case t == Void:
+				g.voidList(o.ExprList)
+			default:
+				g.emit(&ir.Result{Address: true, TypeID: g.tid(g.ptr(t)), Position: g.pos(n)})
+				g.exprListAs(o.ExprList, t)
+				g.store(n, g.typ(t), false)
+			}
+		}
+		g.emit(&ir.Return{Position: g.pos(n)})
+	default:
+		panic("internal error")
+	}
+}
+
+// namedLabel returns the number of the label t.
+func (g *irGen) namedLabel(t xc.Token) int {
+	n, ok := g.f.labels[t.Val]
+	if !ok {
+		n = g.label()
+		g.f.labels[t.Val] = n
+	}
+	return n
+}
+
+func (g *irGen) labeledStmt(n *LabeledStmt) {
+	switch n.Case {
+	case LabeledStmtSwitchCase, LabeledStmtDefault: // "case" ConstExpr ':' Stmt, "default" ':' Stmt
+		g.place(g.f.cases[n])
+	case LabeledStmtLabel: // IDENTIFIER ':' Stmt
+		if g.f.named[n.Token.Val] {
+			g.ctx.err(n, "duplicate label '%s'", n.Token.S())
+		}
+		g.f.named[n.Token.Val] = true
+		g.emit(&ir.Label{NameID: ir.NameID(n.Token.Val), Number: g.namedLabel(n.Token), Position: g.pos(n)})
+	default:
+		panic("internal error")
+	}
+	g.stmt(n.Stmt)
+}
+
+func (g *irGen) selectionStmt(n *SelectionStmt) {
+	switch n.Case {
+	case SelectionStmtIfElse: // "if" '(' ExprList ')' Stmt "else" Stmt
+		els, end := g.label(), g.label()
+		g.branch(n.ExprList, els, false)
+		g.stmt(n.Stmt)
+		g.jmp(n, end)
+		g.place(els)
+		g.stmt(n.Stmt2)
+		g.place(end)
+	case SelectionStmtIf: // "if" '(' ExprList ')' Stmt
+		end := g.label()
+		g.branch(n.ExprList, end, false)
+		g.stmt(n.Stmt)
+		g.place(end)
+	case SelectionStmtSwitch: // "switch" '(' ExprList ')' Stmt
+		g.switchStmt(n)
+	default:
+		panic("internal error")
+	}
+}
+
+// [0]6.8.4.2-5: The integer promotions are performed on the controlling
+// expression. The constant expression in each case label is converted to the
+// promoted type of the controlling expression. If a converted value matches
+// that of the promoted controlling expression, control jumps to the statement
+// following the matched case label. Otherwise, if there is a default label,
+// control jumps to the labeled statement. If no converted case constant
+// expression matches and there is no default label, no part of the body of
+// the switch is executed.
+func (g *irGen) switchStmt(n *SelectionStmt) {
+	t := g.promote(rtype(n.ExprList.Value))
+	g.exprListAs(n.ExprList, t)
+	brk := g.label()
+	sw := &ir.Switch{Default: ir.Label{Number: brk}, TypeID: g.tid(g.typ(t)), Position: g.pos(n)}
+	var values []int64
+	Inspect(n.Stmt, func(n Node) bool {
+		switch x := n.(type) {
+		case *SelectionStmt:
+			return x.Case != SelectionStmtSwitch
+		case *LabeledStmt:
+			switch x.Case {
+			case LabeledStmtSwitchCase:
+				l := g.label()
+				g.f.cases[x] = l
+				v := x.ConstExpr.Value.convertTo(g.ctx, t).Value.(*ir.Int64Value).Value
+				values = append(values, v)
+				var w ir.Value = &ir.Int64Value{Value: v}
+				if g.model[t.Kind()].Size <= 4 {
+					w = &ir.Int32Value{Value: int32(v)}
+				}
+				sw.Cases = append(sw.Cases, ir.SwitchPair{Label: ir.Label{Number: l}, Value: w})
+			case LabeledStmtDefault:
+				l := g.label()
+				g.f.cases[x] = l
+				sw.Default.Number = l
+			}
+		}
+		return true
+	})
+	sort.Sort(switchPairs{sw.Cases, values, isSigned[t.Kind()]})
+	g.emit(sw)
+	f := g.f
+	f.breaks = append(f.breaks, brk)
+	g.stmt(n.Stmt)
+	f.breaks = f.breaks[:len(f.breaks)-1]
+	g.place(brk)
+}
+
+// switchPairs sorts the cases of a switch by their values.
+type switchPairs struct {
+	cases  []ir.SwitchPair
+	values []int64
+	signed bool
+}
+
+func (s switchPairs) Len() int { return len(s.cases) }
+
+func (s switchPairs) Less(i, j int) bool {
+	if s.signed {
+		return s.values[i] < s.values[j]
+	}
+
+	return uint64(s.values[i]) < uint64(s.values[j])
+}
+
+func (s switchPairs) Swap(i, j int) {
+	s.cases[i], s.cases[j] = s.cases[j], s.cases[i]
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+}
+
+// rtype returns the type of v after the conversions of lvalues, arrays and
+// function designators.
+func rtype(v *Value) Type { return v.rvalue().Type }
+
+// promote returns the type of t after the integer promotions.
+func (g *irGen) promote(t Type) Type { return (&Value{Type: t}).integerPromotion(g.ctx).Type }
+
+// common returns the type of the operands of types a and b after the usual
+// arithmetic conversions.
+func (g *irGen) common(n Node, a, b Type) Type {
+	c, _ := usualArithmeticConversions(g.ctx, n, &Value{Type: a}, &Value{Type: b})
+	return c.Type
+}
+
+// isConst reports whether v is an arithmetic or null pointer constant, which
+// is lowered as such.
+func (g *irGen) isConst(v *Value) bool {
+	if v.Value == nil || v.Addr != nil || v.lvalue {
+		return false
+	}
+
+	switch v.Value.(type) {
+	case *ir.Int64Value, *ir.Float32Value, *ir.Float64Value:
+		return v.isIntegerType() || v.isFloatingType() || v.isPointerType()
+	}
+	return false
+}
+
+// constant pushes the constant v of type t.
+func (g *irGen) constant(n Node, t Type, v ir.Value) {
+	var i int64
+	var f float64
+	switch x := v.(type) {
+	case *ir.Int64Value:
+		i, f = x.Value, float64(x.Value)
+	case *ir.Float32Value:
+		i, f = int64(x.Value), float64(x.Value)
+	case *ir.Float64Value:
+		i, f = int64(x.Value), x.Value
+	default:
+		panic("internal error")
+	}
+	p := g.pos(n)
+	id := g.tid(g.typ(t))
+	switch k := t.Kind(); {
+	case k == Ptr:
+		if i == 0 {
+			g.emit(&ir.Nil{TypeID: id, Position: p})
+			break
+		}
+
+		it := g.intptr()
+		g.constant(n, it, &ir.Int64Value{Value: i})
+		g.conv(g.typ(it), g.typ(t))
+	case k == Float:
+		g.emit(&ir.Const{TypeID: id, Value: &ir.Float32Value{Value: float32(f)}, Position: p})
+	case isFloatingType[k]:
+		g.emit(&ir.Const{TypeID: id, Value: &ir.Float64Value{Value: f}, Position: p})
+	case g.model[k].Size <= 4:
+		g.emit(&ir.Const32{TypeID: id, Value: int32(i), Position: p})
+	default:
+		g.emit(&ir.Const64{TypeID: id, Value: i, Position: p})
+	}
+}
+
+// intConst pushes the integer constant v of IR type t.
+func (g *irGen) intConst(n Node, t string, v int64) {
+	switch id := g.tid(t); {
+	case strings.HasSuffix(t, "64"):
+		g.emit(&ir.Const64{TypeID: id, Value: v, Position: g.pos(n)})
+	default:
+		g.emit(&ir.Const32{TypeID: id, Value: int32(v), Position: g.pos(n)})
+	}
+}
+
+// conv converts the value of IR type from on top of the stack to IR type to.
+func (g *irGen) conv(from, to string) {
+	if from != to {
+		g.emit(&ir.Convert{Result: g.tid(to), TypeID: g.tid(from)})
+	}
+}
+
+// convert converts the value of type from on top of the stack to type to, as
+// if by assignment.
+func (g *irGen) convert(n Node, from, to Type) {
+	switch {
+	case to == Void:
+		if from != Void {
+			g.emit(&ir.Drop{TypeID: g.tid(g.typ(from)), Position: g.pos(n)})
+		}
+	case from == to:
+		// nop
+	case to == Bool:
+		// [0]6.3.1.2-1: When any scalar value is converted to
+		// _Bool, the result is 0 if the value compares equal to 0;
+		// otherwise, the result is 1.
+		g.emit(&ir.Bool{TypeID: g.tid(g.typ(from)), Position: g.pos(n)})
+		g.conv(g.typ(Int), g.typ(Bool))
+	default:
+		g.conv(g.typ(from), g.typ(to))
+	}
+}
+
+// exprAs pushes the value of n converted to t.
+func (g *irGen) exprAs(n *Expr, t Type) {
+	if v := n.Value; g.isConst(v) {
+		switch k := t.Kind(); {
+		case k == Ptr:
+			if x, ok := v.Value.(*ir.Int64Value); ok {
+				g.constant(n, t, x)
+				return
+			}
+		case intConvRank[k] != 0 || isFloatingType[k]:
+			if w := v.convertTo(g.ctx, t); w.Value != nil {
+				g.constant(n, t, w.Value)
+				return
+			}
+		}
+	}
+	g.convert(n, g.expr(n), t)
+}
+
+func (g *irGen) exprList(l *ExprList) Type {
+	for ; l.ExprList != nil; l = l.ExprList {
+		g.void(l.Expr)
+	}
+	return g.expr(l.Expr)
+}
+
+func (g *irGen) exprListAs(l *ExprList, t Type) {
+	for ; l.ExprList != nil; l = l.ExprList {
+		g.void(l.Expr)
+	}
+	g.exprAs(l.Expr, t)
+}
+
+func (g *irGen) voidList(l *ExprList) {
+	for ; l != nil; l = l.ExprList {
+		g.void(l.Expr)
+	}
+}
+
+// void evaluates n for its side effects.
+func (g *irGen) void(n *Expr) {
+	if g.isConst(n.Value) {
+		return
+	}
+
+	switch n.Case {
+	case ExprAssign, ExprAddAssign, ExprAndAssign, ExprDivAssign, ExprLshAssign, ExprModAssign,
+		ExprMulAssign, ExprOrAssign, ExprRshAssign, ExprSubAssign, ExprXorAssign:
+		g.assign(n, false)
+	case ExprPostDec, ExprPostInt, ExprPreDec, ExprPreInc:
+		g.incDec(n, false)
+	case ExprCall: // Expr '(' ArgumentExprListOpt ')'
+		g.call(n, false)
+	case ExprCast: // '(' TypeName ')' Expr
+		g.void(n.Expr)
+	case ExprPExprList: // '(' ExprList ')'
+		g.voidList(n.ExprList)
+	case ExprCond: // Expr '?' ExprList ':' Expr
+		g.cond(n, true)
+	default:
+		if t := g.expr(n); t != Void {
+			g.emit(&ir.Drop{TypeID: g.tid(g.typ(t)), Position: g.pos(n)})
+		}
+	}
+}
+
+// nonlocalJumps are the names of the setjmp and longjmp functions.
+var nonlocalJumps = map[int]bool{
+	dict.SID("__builtin_longjmp"): true,
+	dict.SID("__builtin_setjmp"):  true,
+	dict.SID("__longjmp_chk"):     true,
+	dict.SID("__sigsetjmp"):       true,
+	dict.SID("_longjmp"):          true,
+	dict.SID("_setjmp"):           true,
+	dict.SID("longjmp"):           true,
+	dict.SID("setjmp"):            true,
+	dict.SID("siglongjmp"):        true,
+	dict.SID("sigsetjmp"):         true,
+}
+
+var binaryOps = map[ExprCase]rune{
+	ExprAdd: '+',
+	ExprAnd: '&',
+	ExprDiv: '/',
+	ExprLsh: '<',
+	ExprMod: '%',
+	ExprMul: '*',
+	ExprOr:  '|',
+	ExprRsh: '>',
+	ExprSub: '-',
+	ExprXor: '^',
+}
+
+// expr pushes the value of n, after the conversions of lvalues, arrays and
+// function designators, and returns its type. Nothing is pushed for a void
+// expression.
+func (g *irGen) expr(n *Expr) Type {
+	v := n.Value
+	if g.isConst(v) {
+		g.constant(n, v.Type, v.Value)
+		return v.Type
+	}
+
+	if v.lvalue {
+		return g.load(n)
+	}
+
+	switch n.Case {
+	case ExprAssign, ExprAddAssign, ExprAndAssign, ExprDivAssign, ExprLshAssign, ExprModAssign,
+		ExprMulAssign, ExprOrAssign, ExprRshAssign, ExprSubAssign, ExprXorAssign:
+		return g.assign(n, true)
+	case ExprPostDec, ExprPostInt, ExprPreDec, ExprPreInc:
+		return g.incDec(n, true)
+	case ExprCall: // Expr '(' ArgumentExprListOpt ')'
+		return g.call(n, true)
+	case ExprCast: // '(' TypeName ')' Expr
+		if v.Type == Void {
+			g.void(n.Expr)
+			return Void
+		}
+
+		g.exprAs(n.Expr, v.Type)
+		return v.Type
+	case ExprAddrof: // '&' Expr
+		e := n.Expr
+		if e.Value.Type.Kind() == Function {
+			return g.expr(e)
+		}
+
+		g.addr(e)
+		g.conv(g.ptr(e.Value.Type), g.typ(v.Type))
+		return v.Type
+	case ExprNot: // '!' Expr
+		t := g.expr(n.Expr)
+		g.constant(n, t, &ir.Int64Value{})
+		g.emit(&ir.Eq{TypeID: g.tid(g.typ(t)), Position: g.pos(n)})
+		return Int
+	case ExprUnaryPlus: // '+' Expr
+		g.exprAs(n.Expr, v.Type)
+		return v.Type
+	case ExprUnaryMinus: // '-' Expr
+		g.exprAs(n.Expr, v.Type)
+		g.emit(&ir.Neg{TypeID: g.tid(g.typ(v.Type)), Position: g.pos(n)})
+		return v.Type
+	case ExprCpl: // '~' Expr
+		g.exprAs(n.Expr, v.Type)
+		g.emit(&ir.Cpl{TypeID: g.tid(g.typ(v.Type)), Position: g.pos(n)})
+		return v.Type
+	case ExprAdd, ExprAnd, ExprDiv, ExprLsh, ExprMod, ExprMul, ExprOr, ExprRsh, ExprSub, ExprXor:
+		a, b := n.Expr, n.Expr2
+		if n.Case == ExprAdd && rtype(b.Value).Kind() == Ptr {
+			a, b = b, a
+		}
+		return g.binary(n, binaryOps[n.Case], g.expr(a), b)
+	case ExprEq, ExprGe, ExprGt, ExprLe, ExprLt, ExprNe:
+		return g.compare(n)
+	case ExprLAnd, ExprLOr: // Expr "&&" Expr, Expr "||" Expr
+		return g.logical(n)
+	case ExprCond: // Expr '?' ExprList ':' Expr
+		return g.cond(n, false)
+	case ExprPExprList: // '(' ExprList ')'
+		return g.exprList(n.ExprList)
+	case ExprSelect: // Expr '.' IDENTIFIER
+		// A member of a struct or union that is not an lvalue.
+		return g.load(n)
+	}
+	g.unsupported(n, "this expression")
+	return v.Type
+}
+
+// load pushes the value of the lvalue n, or of the member of a struct or
+// union that is not an lvalue, after the conversion of arrays and function
+// designators.
+func (g *irGen) load(n *Expr) Type {
+	t := n.Value.Type
+	if bf := g.bitField(n); bf != nil {
+		g.bitFieldAddr(n, bf)
+		g.bitFieldLoad(n, bf)
+		return bf.typ
+	}
+
+	switch x := t.(type) {
+	case *ArrayType:
+		g.addr(n)
+		r := &PointerType{x.Item}
+		g.conv(g.ptr(t), g.typ(r))
+		return r
+	case *FunctionType:
+		g.addr(n)
+		return &PointerType{x}
+	}
+
+	g.addr(n)
+	g.emit(&ir.Load{TypeID: g.tid(g.ptr(t)), Position: g.pos(n)})
+	return t
+}
+
+// object pushes the address of the struct or union n. A value that is not an
+// lvalue is stored in a temporary variable first.
+func (g *irGen) object(n *Expr) {
+	if n.Value.lvalue {
+		g.addr(n)
+		return
+	}
+
+	t := g.typ(n.Value.Type)
+	i := g.temp(t)
+	g.variable(n, i, t)
+	g.expr(n)
+	g.store(n, t, false)
+	g.variable(n, i, t)
+}
+
+// addr pushes the address of the lvalue n, or of the member of a struct or
+// union that is not an lvalue.
+func (g *irGen) addr(n *Expr) {
+	t := n.Value.Type
+	switch n.Case {
+	case ExprIdent: // IDENTIFIER
+		g.declAddr(n, n.Value.Addr.(*Declarator), t)
+	case ExprPExprList: // '(' ExprList ')'
+		g.addr(n.ExprList.Expr)
+	case ExprDeref: // '*' Expr
+		g.conv(g.typ(g.expr(n.Expr)), g.ptr(t))
+	case ExprIndex: // Expr '[' ExprList ']'
+		var it Type
+		switch {
+		case rtype(n.Expr.Value).Kind() == Ptr:
+			g.conv(g.typ(g.expr(n.Expr)), g.ptr(t))
+			it = g.exprList(n.ExprList)
+		default:
+			g.conv(g.typ(g.exprList(n.ExprList)), g.ptr(t))
+			it = g.expr(n.Expr)
+		}
+		g.emit(&ir.Element{Address: true, IndexType: g.tid(g.typ(it)), TypeID: g.tid(g.ptr(t)), Position: g.pos(n)})
+	case ExprSelect: // Expr '.' IDENTIFIER
+		g.object(n.Expr)
+		g.member(n, n.Expr.Value.Type.(*StructType), n.Token2)
+	case ExprPSelect: // Expr "->" IDENTIFIER
+		pt := g.expr(n.Expr)
+		st := pt.(*PointerType).Item.(*StructType)
+		g.conv(g.typ(pt), g.ptr(st))
+		g.member(n, st, n.Token2)
+	case ExprCompLit: // '(' TypeName ')' '{' InitializerList CommaOpt '}'
+		// [0]6.5.2.5-6: ... If the compound literal occurs outside
+		// the body of a function, the object has static storage
+		// duration; otherwise, it has automatic storage duration
+		// associated with the enclosing block.
+		i := g.f.vars
+		g.f.vars++
+		g.emit(&ir.VariableDeclaration{Index: i, TypeID: g.tid(g.typ(t)), Position: g.pos(n)})
+		g.initialize(n, i, t, g.ctx.initItems(n.initializer(), t))
+		g.variable(n, i, g.typ(t))
+	case ExprString, ExprLString: // STRINGLITERAL, LONGSTRINGLITERAL
+		p := &PointerType{t.(*ArrayType).Item}
+		g.emit(&ir.StringConst{Value: g.stringID(n), TypeID: g.tid(g.typ(p)), Position: g.pos(n)})
+		g.conv(g.typ(p), g.ptr(t))
+	default:
+		panic("internal error")
+	}
+}
+
+// declAddr pushes the address of the object or function d declares.
+func (g *irGen) declAddr(n Node, d *Declarator, t Type) {
+	p := g.pos(n)
+	id := g.tid(g.ptr(t))
+	if f := g.f; f != nil {
+		if i, ok := f.params[d]; ok {
+			g.emit(&ir.Argument{Address: true, Index: i, TypeID: id, Position: p})
+			return
+		}
+
+		if i, ok := f.locals[d]; ok {
+			g.emit(&ir.Variable{Address: true, Index: i, TypeID: id, Position: p})
+			return
+		}
+	}
+	if i, ok := g.statics[d]; ok {
+		g.emit(&ir.Global{Address: true, Index: i, Linkage: ir.InternalLinkage, NameID: g.objects[i].Base().NameID, TypeID: id, Position: p})
+		return
+	}
+
+	nm := ir.NameID(d.ident().Val)
+	i, ok := g.index[d.ident().Val]
+	if !ok {
+		g.emit(&ir.Global{Address: true, Index: -1, Linkage: ir.ExternalLinkage, NameID: nm, TypeID: id, Position: p})
+		return
+	}
+
+	g.emit(&ir.Global{Address: true, Index: i, Linkage: g.linkage(g.defs[i].decl.Linkage), NameID: nm, TypeID: id, Position: p})
+}
+
+// member converts the address of a struct or union of type t on top of the
+// stack to the address of its member nm.
+func (g *irGen) member(n Node, t *StructType, nm xc.Token) {
+	l, err := g.model.Layout(t)
+	if err != nil {
+		panic("internal error")
+	}
+
+	s := g.structType(t)
+	for i, f := range t.Fields {
+		if f.Name != string(nm.S()) {
+			continue
+		}
+
+		switch {
+		case t.Union:
+			g.conv(g.ptr(t), g.ptr(f.Type))
+		case s.opaque || s.fields[i] < 0:
+			g.offset(n, g.ptr(t), l.Fields[i].Offset, g.ptr(f.Type))
+		default:
+			g.emit(&ir.Field{Address: true, Index: s.fields[i], TypeID: g.tid(g.ptr(t)), Position: g.pos(n)})
+		}
+		return
+	}
+	panic("internal error")
+}
+
+// offset converts the pointer of IR type from on top of the stack to a
+// pointer of IR type to, off bytes further.
+func (g *irGen) offset(n Node, from string, off int64, to string) {
+	if off == 0 {
+		g.conv(from, to)
+		return
+	}
+
+	g.conv(from, "*int8")
+	it := g.intptr()
+	g.constant(n, it, &ir.Int64Value{Value: off})
+	g.emit(&ir.Element{Address: true, IndexType: g.tid(g.typ(it)), TypeID: g.tid("*int8"), Position: g.pos(n)})
+	g.conv("*int8", to)
+}
+
+// elem returns the type of the items of pointer arithmetic on a pointer to t.
+// Like gcc, the size of void and of a function type is 1.
+func elem(t Type) Type {
+	switch t.Kind() {
+	case Void, Function:
+		return Char
+	}
+	return t
+}
+
+// binary applies op, see Value.binary, to the value of type a on top of the
+// stack and the value of n and returns the type of the result.
+func (g *irGen) binary(n Node, op rune, a Type, b *Expr) Type {
+	p := g.pos(n)
+	bt := rtype(b.Value)
+	switch {
+	case a.Kind() == Ptr && (op == '+' || op == '-') && bt.Kind() != Ptr:
+		et := g.ptr(elem(a.(*PointerType).Item))
+		g.conv(g.typ(a), et)
+		it := g.expr(b)
+		g.emit(&ir.Element{Address: true, IndexType: g.tid(g.typ(it)), Neg: op == '-', TypeID: g.tid(et), Position: p})
+		g.conv(et, g.typ(a))
+		return a
+	case a.Kind() == Ptr && op == '-':
+		// [0]6.5.6-9: When two pointers are subtracted, ... The
+		// size of the result is implementation-defined, and its
+		// type (a signed integer type) is ptrdiff_t defined in the
+		// <stddef.h> header.
+		et := g.ptr(elem(a.(*PointerType).Item))
+		g.conv(g.typ(a), et)
+		g.conv(g.typ(g.expr(b)), et)
+		t := g.intptr()
+		g.emit(&ir.PtrDiff{PtrType: g.tid(et), TypeID: g.tid(g.typ(t)), Position: p})
+		return t
+	case op == '<' || op == '>':
+		// [0]6.5.7-3: The integer promotions are performed on each of
+		// the operands. The type of the result is that of the
+		// promoted left operand.
+		t := g.promote(a)
+		g.convert(n, a, t)
+		g.exprAs(b, Int)
+		id := g.tid(g.typ(t))
+		if op == '<' {
+			g.emit(&ir.Lsh{TypeID: id, Position: p})
+			return t
+		}
+
+		g.emit(&ir.Rsh{TypeID: id, Position: p})
+		return t
+	}
+
+	t := g.common(n, a, bt)
+	g.convert(n, a, t)
+	g.exprAs(b, t)
+	g.op(n, op, g.typ(t))
+	return t
+}
+
+// op emits the arithmetic operation op on operands of IR type t.
+func (g *irGen) op(n Node, op rune, t string) {
+	id, p := g.tid(t), g.pos(n)
+	switch op {
+	case '+':
+		g.emit(&ir.Add{TypeID: id, Position: p})
+	case '-':
+		g.emit(&ir.Sub{TypeID: id, Position: p})
+	case '*':
+		g.emit(&ir.Mul{TypeID: id, Position: p})
+	case '/':
+		g.emit(&ir.Div{TypeID: id, Position: p})
+	case '%':
+		g.emit(&ir.Rem{TypeID: id, Position: p})
+	case '&':
+		g.emit(&ir.And{TypeID: id, Position: p})
+	case '|':
+		g.emit(&ir.Or{TypeID: id, Position: p})
+	case '^':
+		g.emit(&ir.Xor{TypeID: id, Position: p})
+	case '<':
+		g.emit(&ir.Lsh{TypeID: id, Position: p})
+	case '>':
+		g.emit(&ir.Rsh{TypeID: id, Position: p})
+	default:
+		panic("internal error")
+	}
+}
+
+// compare lowers the relational or equality expression n.
+func (g *irGen) compare(n *Expr) Type {
+	a, b := rtype(n.Expr.Value), rtype(n.Expr2.Value)
+	var t Type
+	switch {
+	case a.Kind() == Ptr:
+		t = a
+	case b.Kind() == Ptr:
+		t = b
+	default:
+		t = g.common(n, a, b)
+	}
+	g.exprAs(n.Expr, t)
+	g.exprAs(n.Expr2, t)
+	id, p := g.tid(g.typ(t)), g.pos(n)
+	switch n.Case {
+	case ExprEq:
+		g.emit(&ir.Eq{TypeID: id, Position: p})
+	case ExprGe:
+		g.emit(&ir.Geq{TypeID: id, Position: p})
+	case ExprGt:
+		g.emit(&ir.Gt{TypeID: id, Position: p})
+	case ExprLe:
+		g.emit(&ir.Leq{TypeID: id, Position: p})
+	case ExprLt:
+		g.emit(&ir.Lt{TypeID: id, Position: p})
+	case ExprNe:
+		g.emit(&ir.Neq{TypeID: id, Position: p})
+	}
+	return Int
+}
+
+// test pushes 1 if the value of n is nonzero, 0 otherwise.
+func (g *irGen) test(n *Expr) {
+	t := g.expr(n)
+	g.emit(&ir.Bool{TypeID: g.tid(g.typ(t)), Position: g.pos(n)})
+}
+
+// logical lowers n, a && or || expression.
+//
+// [0]6.5.13-4, 6.5.14-4: Unlike the bitwise binary & and | operators, the &&
+// and || operators guarantee left-to-right evaluation; there is a sequence
+// point after the evaluation of the first operand. If the first operand
+// compares equal to 0 (unequal to 0 for ||), the second operand is not
+// evaluated.
+func (g *irGen) logical(n *Expr) Type {
+	short, end := g.label(), g.label()
+	var jmp func(int) ir.Operation
+	v := int64(0)
+	switch n.Case {
+	case ExprLAnd:
+		jmp = func(l int) ir.Operation { return &ir.Jz{Number: l, Position: g.pos(n)} }
+	default:
+		jmp = func(l int) ir.Operation { return &ir.Jnz{Number: l, Position: g.pos(n)} }
+		v = 1
+	}
+	t := g.typ(Int)
+	g.test(n.Expr)
+	g.emit(jmp(short))
+	g.test(n.Expr2)
+	g.emit(jmp(short))
+	g.intConst(n, t, 1-v)
+	g.jmp(n, end)
+	g.place(short)
+	g.intConst(n, t, v)
+	g.place(end)
+	return Int
+}
+
+// cond lowers the conditional expression n. Its value is discarded, if void
+// is set.
+func (g *irGen) cond(n *Expr, void bool) Type {
+	t := n.Value.Type
+	if void {
+		t = Void
+	}
+	els, end := g.label(), g.label()
+	g.test(n.Expr)
+	g.emit(&ir.Jz{Number: els, Position: g.pos(n)})
+	switch {
+	case t == Void:
+		g.voidList(n.ExprList)
+	default:
+		g.exprListAs(n.ExprList, t)
+	}
+	g.jmp(n, end)
+	g.place(els)
+	switch {
+	case t == Void:
+		g.void(n.Expr2)
+	default:
+		g.exprAs(n.Expr2, t)
+	}
+	g.place(end)
+	return t
+}
+
+// call lowers the function call n. The result is discarded unless value is
+// set.
+func (g *irGen) call(n *Expr, value bool) Type {
+	t := rtype(n.Expr.Value).(*PointerType).Item.(*FunctionType)
+	index := -1
+	e := n.Expr
+	for e.Case == ExprPExprList && e.ExprList.ExprList == nil {
+		e = e.ExprList.Expr
+	}
+	if d, ok := e.Value.Addr.(*Declarator); ok && e.Case == ExprIdent && d.Linkage != LinkageNone {
+		switch nm := d.ident().Val; {
+		case d.Linkage != LinkageExternal:
+			// nop
+		case nm == idBuiltinVaArgs:
+			return g.vaArgs(n, t, value)
+		case nonlocalJumps[nm]:
+			// The state of a Go function, like its goroutine stack
+			// and the values of its local variables, cannot be
+			// saved and restored.
+			g.ctx.err(n, "calling %s is not supported, nonlocal jumps cannot be lowered", dict.S(nm))
+		}
+
+		if i, ok := g.index[d.ident().Val]; ok && g.defs[i].fn != nil {
+			index = i
+			t = g.defs[i].decl.Type.(*FunctionType)
+		}
+	}
+	p := g.pos(n)
+	if t.Result != Void {
+		g.emit(&ir.AllocResult{TypeID: g.tid(g.typ(t.Result)), Position: p})
+	}
+	g.emit(&ir.Arguments{FunctionPointer: index < 0, Position: p})
+	if index < 0 {
+		g.exprAs(n.Expr, &PointerType{t})
+	}
+	var args int
+	if o := n.ArgumentExprListOpt; o != nil {
+		for l := o.ArgumentExprList; l != nil; l = l.ArgumentExprList {
+			if args < len(t.Params) {
+				g.exprAs(l.Expr, t.Params[args])
+				args++
+				continue
+			}
+
+			// [0]6.5.2.2-6,7: ... the integer promotions are
+			// performed on each argument, and arguments that have
+			// type float are promoted to double. These are called
+			// the default argument promotions.
+			at := rtype(l.Expr.Value)
+			switch {
+			case at.Kind() == Struct || at.Kind() == Union:
+				g.unsupported(l.Expr, "a variadic argument of struct or union type")
+			case at == Float:
+				at = Double
+			case intConvRank[at.Kind()] != 0:
+				at = g.promote(at)
+			}
+			g.exprAs(l.Expr, at)
+			args++
+		}
+	}
+	switch id := g.tid(g.typ(t)); {
+	case index < 0:
+		g.emit(&ir.CallFP{Arguments: args, TypeID: id, Position: p})
+	default:
+		g.emit(&ir.Call{Arguments: args, Index: index, TypeID: id, Position: p})
+	}
+	if !value && t.Result != Void {
+		g.emit(&ir.Drop{TypeID: g.tid(g.typ(t.Result)), Position: p})
+	}
+	return t.Result
+}
+
+// vaArgs lowers the call n of __builtin_va_args of type t, which returns the
+// hidden last argument of a variadic function. The result is discarded unless
+// value is set.
+func (g *irGen) vaArgs(n *Expr, t *FunctionType, value bool) Type {
+	if !value {
+		return t.Result
+	}
+
+	p := g.pos(n)
+	id := g.tid(g.typ(t.Result))
+	if g.f == nil || g.f.va < 0 {
+		g.ctx.err(n, "va_start used in a function with fixed arguments")
+		g.emit(&ir.Nil{TypeID: id, Position: p})
+		return t.Result
+	}
+
+	g.emit(&ir.Argument{Address: true, Index: g.f.va, TypeID: g.tid(g.ptr(t.Result)), Position: p})
+	g.emit(&ir.Load{TypeID: g.tid(g.ptr(t.Result)), Position: p})
+	return t.Result
+}
+
+// assign lowers the simple or compound assignment n. The value is discarded
+// unless value is set.
+func (g *irGen) assign(n *Expr, value bool) Type {
+	lhs := n.Expr
+	if g.bitField(lhs) != nil {
+		return g.rmw(n, value)
+	}
+
+	t := lhs.Value.Type
+	g.addr(lhs)
+	switch op := compoundOps[n.Case]; op {
+	case 0:
+		g.exprAs(n.Expr2, t)
+	default:
+		// [0]6.5.16.2-3: A compound assignment of the form E1 op = E2
+		// differs from the simple assignment expression E1 = E1 op
+		// (E2) only in that the lvalue E1 is evaluated only once.
+		id := g.tid(g.ptr(t))
+		g.emit(&ir.Dup{TypeID: id, Position: g.pos(n)})
+		g.emit(&ir.Load{TypeID: id, Position: g.pos(n)})
+		g.convert(n, g.binary(n, op, t, n.Expr2), t)
+	}
+	g.store(n, g.typ(t), value)
+	return t
+}
+
+// incDec lowers the increment or decrement n. The value is discarded unless
+// value is set.
+func (g *irGen) incDec(n *Expr, value bool) Type {
+	lhs := n.Expr
+	t := lhs.Value.Type
+	if g.bitField(lhs) != nil || t == Bool {
+		return g.rmw(n, value)
+	}
+
+	delta := int64(1)
+	if x, ok := t.(*PointerType); ok {
+		delta, _ = g.sizeAlign(elem(x.Item))
+	}
+	if n.Case == ExprPreDec || n.Case == ExprPostDec {
+		delta = -delta
+	}
+	g.addr(lhs)
+	id, p := g.tid(g.typ(t)), g.pos(n)
+	switch n.Case {
+	case ExprPreDec, ExprPreInc:
+		g.emit(&ir.PreIncrement{Delta: int(delta), TypeID: id, Position: p})
+	default:
+		g.emit(&ir.PostIncrement{Delta: int(delta), TypeID: id, Position: p})
+	}
+	if !value {
+		g.emit(&ir.Drop{TypeID: id, Position: p})
+	}
+	return t
+}
+
+// rmw lowers n, an assignment to a bit-field or an increment or decrement of a
+// bit-field or of a _Bool, using temporary variables. The value is discarded
+// unless value is set.
+func (g *irGen) rmw(n *Expr, value bool) Type {
+	lhs := n.Expr
+	t := lhs.Value.Type
+	pt := g.ptr(t)
+	bf := g.bitField(lhs)
+	if bf != nil {
+		t = bf.typ
+		pt = "*" + g.unitType(bf)
+	}
+	vt := g.typ(t)
+	p := g.temp(pt)
+	g.variable(n, p, pt)
+	switch {
+	case bf != nil:
+		g.bitFieldAddr(lhs, bf)
+	default:
+		g.addr(lhs)
+	}
+	g.store(n, pt, false)
+	old := func() {
+		g.loadVar(n, p, pt)
+		if bf != nil {
+			g.bitFieldLoad(n, bf)
+			return
+		}
+
+		g.emit(&ir.Load{TypeID: g.tid(pt), Position: g.pos(n)})
+	}
+	post := n.Case == ExprPostDec || n.Case == ExprPostInt
+	var o int
+	if post && value {
+		o = g.temp(vt)
+		g.variable(n, o, vt)
+		old()
+		g.store(n, vt, false)
+	}
+	v := g.temp(vt)
+	g.variable(n, v, vt)
+	switch n.Case {
+	case ExprAssign:
+		g.exprAs(n.Expr2, t)
+	case ExprPostDec, ExprPostInt, ExprPreDec, ExprPreInc:
+		old()
+		ct := g.promote(t)
+		g.convert(n, t, ct)
+		g.constant(n, ct, &ir.Int64Value{Value: 1})
+		op := '+'
+		if n.Case == ExprPostDec || n.Case == ExprPreDec {
+			op = '-'
+		}
+		g.op(n, op, g.typ(ct))
+		g.convert(n, ct, t)
+	default:
+		old()
+		g.convert(n, g.binary(n, compoundOps[n.Case], t, n.Expr2), t)
+	}
+	g.store(n, vt, false)
+	switch {
+	case bf != nil:
+		g.bitFieldStore(n, bf, p, v)
+	default:
+		g.loadVar(n, p, pt)
+		g.loadVar(n, v, vt)
+		g.store(n, vt, false)
+	}
+	switch {
+	case !value:
+		// nop
+	case post:
+		g.loadVar(n, o, vt)
+	default:
+		old()
+	}
+	return t
+}
+
+// bitField returns the description of the bit-field n designates or nil if n
+// is not a bit-field.
+func (g *irGen) bitField(n *Expr) *irBitField {
+	for n.Case == ExprPExprList && n.ExprList.ExprList == nil {
+		n = n.ExprList.Expr
+	}
+	var t *StructType
+	switch n.Case {
+	case ExprSelect: // Expr '.' IDENTIFIER
+		t, _ = n.Expr.Value.Type.(*StructType)
+	case ExprPSelect: // Expr "->" IDENTIFIER
+		if p, ok := rtype(n.Expr.Value).(*PointerType); ok {
+			t, _ = p.Item.(*StructType)
+		}
+	}
+	if t == nil {
+		return nil
+	}
+
+	l, err := g.model.Layout(t)
+	if err != nil {
+		return nil
+	}
+
+	for i, f := range t.Fields {
+		if f.Name != string(n.Token2.S()) {
+			continue
+		}
+
+		if !f.BitField {
+			return nil
+		}
+
+		bf := &irBitField{bit: l.Fields[i].BitOffset, bits: f.Bits, off: l.Fields[i].Offset, typ: f.Type}
+		if !g.bitUnit(n, bf, l.Size) {
+			return nil
+		}
+
+		return bf
+	}
+	return nil
+}
+
+// bitUnit sets the unit used to access the bit-field bf, the smallest
+// unsigned integer covering its bits, aligned relative to the start of the
+// object of size bytes containing bf.
+func (g *irGen) bitUnit(n Node, bf *irBitField, size int64) bool {
+	if g.order != binary.LittleEndian {
+		g.unsupported(n, "a bit-field on a big-endian target")
+		return false
+	}
+
+	for unit := int64(1); unit <= 8; unit *= 2 {
+		off := bf.off &^ (unit - 1)
+		bit := bf.bit + 8*int(bf.off-off)
+		if bit+bf.bits <= 8*int(unit) && off+unit <= size {
+			bf.bit, bf.off, bf.unit = bit, off, unit
+			return true
+		}
+	}
+	g.unsupported(n, "this bit-field")
+	return false
+}
+
+func (g *irGen) unitType(bf *irBitField) string { return fmt.Sprintf("uint%d", 8*bf.unit) }
+
+// bitFieldAddr pushes the address of the unit of the bit-field bf n
+// designates.
+func (g *irGen) bitFieldAddr(n *Expr, bf *irBitField) {
+	for n.Case == ExprPExprList {
+		n = n.ExprList.Expr
+	}
+	var t *StructType
+	switch n.Case {
+	case ExprSelect: // Expr '.' IDENTIFIER
+		g.object(n.Expr)
+		t = n.Expr.Value.Type.(*StructType)
+	case ExprPSelect: // Expr "->" IDENTIFIER
+		p := g.expr(n.Expr)
+		t = p.(*PointerType).Item.(*StructType)
+		g.conv(g.typ(p), g.ptr(t))
+	}
+	g.offset(n, g.ptr(t), bf.off, "*"+g.unitType(bf))
+}
+
+// bitFieldLoad replaces the address of the unit of bf on top of the stack by
+// the value of the bit-field.
+func (g *irGen) bitFieldLoad(n Node, bf *irBitField) {
+	u := g.unitType(bf)
+	g.emit(&ir.Load{TypeID: g.tid("*" + u), Position: g.pos(n)})
+	w := 8 * int(bf.unit)
+	if k := bf.typ.Kind(); isSigned[k] && k != Bool {
+		s := fmt.Sprintf("int%d", w)
+		g.shift(n, true, w-bf.bit-bf.bits, u)
+		g.conv(u, s)
+		g.shift(n, false, w-bf.bits, s)
+		g.conv(s, g.typ(bf.typ))
+		return
+	}
+
+	g.shift(n, false, bf.bit, u)
+	g.intConst(n, u, int64(uint64(1)<<uint(bf.bits)-1))
+	g.emit(&ir.And{TypeID: g.tid(u), Position: g.pos(n)})
+	g.conv(u, g.typ(bf.typ))
+}
+
+// shift shifts the value of IR type t on top of the stack by n bits.
+func (g *irGen) shift(n Node, left bool, bits int, t string) {
+	if bits == 0 {
+		return
+	}
+
+	g.intConst(n, g.typ(Int), int64(bits))
+	if left {
+		g.emit(&ir.Lsh{TypeID: g.tid(t), Position: g.pos(n)})
+		return
+	}
+
+	g.emit(&ir.Rsh{TypeID: g.tid(t), Position: g.pos(n)})
+}
+
+// bitFieldStore stores the value of the variable v in the bit-field bf, the
+// address of the unit of which is the value of the variable p.
+func (g *irGen) bitFieldStore(n Node, bf *irBitField, p, v int) {
+	u := g.unitType(bf)
+	w := uint(8 * bf.unit)
+	mask := (uint64(1)<<uint(bf.bits) - 1) << uint(bf.bit)
+	g.loadVar(n, p, "*"+u)
+	g.loadVar(n, p, "*"+u)
+	g.emit(&ir.Load{TypeID: g.tid("*" + u), Position: g.pos(n)})
+	g.intConst(n, u, int64(^mask<<(64-w)>>(64-w)))
+	g.emit(&ir.And{TypeID: g.tid(u), Position: g.pos(n)})
+	g.loadVar(n, v, g.typ(bf.typ))
+	g.conv(g.typ(bf.typ), u)
+	g.shift(n, true, bf.bit, u)
+	g.intConst(n, u, int64(mask))
+	g.emit(&ir.And{TypeID: g.tid(u), Position: g.pos(n)})
+	g.emit(&ir.Or{TypeID: g.tid(u), Position: g.pos(n)})
+	g.store(n, u, false)
+}
@@ -0,0 +1,319 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package c99
+
+import (
+	"fmt"
+	"go/token"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cznic/xc"
+)
+
+// Macro describes a macro definition.
+type Macro struct {
+	Comment    string    // Comment following the macro name on its line, see Tweaks.MacroComments.
+	Def        token.Pos // Position of the macro name in the #define.
+	Doc        string    // Comments on the lines immediately preceding the #define, see Tweaks.MacroComments.
+	IsFnLike   bool
+	IsVariadic bool
+	Name       string
+	Params     []string // Named parameters of a function-like macro.
+
+	// Replacement list tokens, including white space tokens. Use TokSrc
+	// to get their source form.
+	ReplacementList []xc.Token
+}
+
+// Src returns the replacement list of m in source form.
+func (m *Macro) Src() string {
+	var a []string
+	for _, v := range m.ReplacementList {
+		a = append(a, TokSrc(v))
+	}
+	return strings.Join(a, "")
+}
+
+// MacroEvent records a #define or #undef directive.
+type MacroEvent struct {
+	Macro *Macro    // The definition or nil for #undef.
+	Name  string    // Macro name.
+	Pos   token.Pos // Position of the macro name in the directive.
+}
+
+// Macros is the macro table at the end of a translation unit together with
+// the #define and #undef directives that built it.
+type Macros struct {
+	Events []MacroEvent // In the order of preprocessing.
+
+	c     *cpp
+	table map[string]*Macro
+}
+
+type macroEvent struct {
+	m   *macro // nil for #undef
+	tok xc.Token
+}
+
+func newMacros(c *cpp) *Macros {
+	r := &Macros{c: c, table: make(map[string]*Macro, len(c.macros))}
+	m := map[*macro]*Macro{}
+	comments := newCommentIndex(c.context)
+	export := func(x *macro) *Macro {
+		if y := m[x]; y != nil {
+			return y
+		}
+
+		y := &Macro{
+			Def:             x.def.Pos(),
+			IsFnLike:        x.fnLike,
+			IsVariadic:      x.variadic,
+			Name:            string(dict.S(x.def.Val)),
+			ReplacementList: x.repl,
+		}
+		for _, v := range x.fp {
+			y.Params = append(y.Params, string(dict.S(v)))
+		}
+		if comments != nil {
+			y.Doc, y.Comment = comments.attach(y.Def)
+		}
+		m[x] = y
+		return y
+	}
+
+	for _, v := range c.macroEvents {
+		e := MacroEvent{Name: string(dict.S(v.tok.Val)), Pos: v.tok.Pos()}
+		if v.m != nil {
+			e.Macro = export(v.m)
+		}
+		r.Events = append(r.Events, e)
+	}
+	for _, v := range c.macros {
+		x := export(v)
+		r.table[x.Name] = x
+	}
+	return r
+}
+
+// Lookup returns the definition of name or nil if name is not defined.
+func (m *Macros) Lookup(name string) *Macro { return m.table[name] }
+
+// Defined returns all macros defined, sorted by name.
+func (m *Macros) Defined() []*Macro {
+	r := make([]*Macro, 0, len(m.table))
+	for _, v := range m.table {
+		r = append(r, v)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return r
+}
+
+// Find returns the macros defined with names matching pattern, sorted by
+// name. The pattern syntax is that of path.Match, for example "SQLITE_*".
+func (m *Macros) Find(pattern string) ([]*Macro, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var r []*Macro
+	for _, v := range m.Defined() {
+		if ok, _ := path.Match(pattern, v.Name); ok {
+			r = append(r, v)
+		}
+	}
+	return r, nil
+}
+
+// History returns the #define and #undef directives of name in the order of
+// preprocessing.
+func (m *Macros) History(name string) []MacroEvent {
+	var r []MacroEvent
+	for _, v := range m.Events {
+		if v.Name == name {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+type fileLine struct {
+	file string
+	line int
+}
+
+type commentIndex struct {
+	*context
+	ends   map[fileLine]int   // Comment on its own line: index.
+	starts map[fileLine][]int // Comments starting on a line: indices.
+}
+
+func newCommentIndex(c *context) *commentIndex {
+	if !c.tweaks.MacroComments {
+		return nil
+	}
+
+	x := &commentIndex{context: c, ends: map[fileLine]int{}, starts: map[fileLine][]int{}}
+	for i, v := range c.comments {
+		p := c.fset.PositionFor(v.pos, false)
+		k := fileLine{p.Filename, p.Line}
+		x.starts[k] = append(x.starts[k], i)
+		if v.own {
+			p = c.fset.PositionFor(v.end, false)
+			x.ends[fileLine{p.Filename, p.Line}] = i
+		}
+	}
+	return x
+}
+
+// attach returns the comments on the lines immediately preceding the line of
+// pos, if they are on lines of their own, and the first comment following pos
+// on its line.
+func (x *commentIndex) attach(pos token.Pos) (doc, comment string) {
+	p := x.fset.PositionFor(pos, false)
+	for _, i := range x.starts[fileLine{p.Filename, p.Line}] {
+		if v := x.comments[i]; v.pos > pos && !v.own {
+			comment = v.text
+			break
+		}
+	}
+
+	var a []string
+	for line := p.Line - 1; ; {
+		i, ok := x.ends[fileLine{p.Filename, line}]
+		if !ok {
+			break
+		}
+
+		v := x.comments[i]
+		a = append(a, v.text)
+		line = x.fset.PositionFor(v.pos, false).Line - 1
+	}
+	for i, j := 0, len(a)-1; i < j; i, j = i+1, j-1 {
+		a[i], a[j] = a[j], a[i]
+	}
+	return strings.Join(a, "\n"), comment
+}
+
+// Eval evaluates the object-like macro name, expanded using the final macro
+// table, as a constant expression. Eval fails if the macro is not defined or
+// if its expansion is not a constant expression.
+func (m *Macros) Eval(name string) (v *Value, err error) {
+	x, err := m.macro(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := m.parse(x, []xc.Token{x.def})
+	if err != nil {
+		return nil, err
+	}
+
+	// An object or function designator or an address constant other than
+	// a string literal has no value known before linking.
+	if v = e.Value; v.Value == nil || v.Addr != nil && v.Addr != Node(e) {
+		return nil, fmt.Errorf("%v: %s is not a constant expression", m.c.position(x.def), name)
+	}
+
+	return v, nil
+}
+
+// Func parses the replacement list of the function-like macro name as an
+// expression of its parameters. The replacement list is expanded using the
+// final macro table and the parameters are assumed to have type int. The
+// Value field of every node of the result holds its type and, for constant
+// subexpressions, its value. Func fails if the macro is not a function-like
+// macro with named parameters or if its replacement list uses the # or ##
+// operators or if it is not an expression.
+func (m *Macros) Func(name string) (*Expr, error) {
+	x, err := m.macro(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range x.repl {
+		if v.Rune == '#' || v.Rune == PPPASTE {
+			return nil, fmt.Errorf("%v: %s uses the %s operator", m.c.position(v), name, TokSrc(v))
+		}
+	}
+
+	return m.parse(x, x.repl)
+}
+
+func (m *Macros) macro(name string, fnLike bool) (*macro, error) {
+	x := m.c.macros[dict.SID(name)]
+	switch {
+	case x == nil:
+		return nil, fmt.Errorf("undefined macro: %s", name)
+	case x.fnLike != fnLike && fnLike:
+		return nil, fmt.Errorf("%v: %s is not a function-like macro", m.c.position(x.def), name)
+	case x.fnLike != fnLike:
+		return nil, fmt.Errorf("%v: %s is a function-like macro", m.c.position(x.def), name)
+	case x.variadic:
+		return nil, fmt.Errorf("%v: %s is variadic", m.c.position(x.def), name)
+	}
+	return x, nil
+}
+
+// parse expands toks, parses the result as a constant expression and
+// evaluates it. The replacement list of a function-like macro x is expanded
+// with x and its parameters hidden. The parameters are identifiers of type
+// int.
+func (m *Macros) parse(x *macro, toks []xc.Token) (e *Expr, err error) {
+	c := m.c
+	var hidden []int
+	if x.fnLike {
+		hidden = append([]int{x.def.Val}, x.fp...)
+	}
+	n := len(c.diagnostics)
+	defer func() {
+		switch v := recover(); pe := v.(type) {
+		case nil:
+			// nop
+		case panicError:
+			err = pe
+		default:
+			panic(v)
+		}
+		if d := c.diagnostics[n:].Errors(); err == nil && len(d) != 0 {
+			err = d
+		}
+		if err == nil && e == nil {
+			err = fmt.Errorf("%v: %s is not an expression", c.position(x.def), dict.S(x.def.Val))
+		}
+		if err != nil {
+			e = nil
+		}
+		c.diagnostics = c.diagnostics[:n]
+		c.constIdents = nil
+		for _, v := range hidden {
+			c.hideSet[v]--
+		}
+	}()
+
+	c.constIdents = map[int]Type{}
+	for _, v := range hidden {
+		c.hideSet[v]++
+	}
+	for _, v := range x.fp {
+		c.constIdents[v] = Int
+	}
+	toks = trimAllSpace(c.expands(append([]xc.Token(nil), toks...)))
+	if len(toks) == 0 {
+		return nil, nil
+	}
+
+	toks, _ = concatStrings(toks, nil)
+	c.lx.ungetBuffer = c.lx.ungetBuffer[:0]
+	c.lx.ungets(toks...)
+	if !c.lx.parseExpr() {
+		return nil, nil // Reported in c.diagnostics.
+	}
+
+	e = c.lx.ast.(*ConstExpr).Expr
+	e.eval(c.context)
+	return e, nil
+}
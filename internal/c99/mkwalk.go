@@ -0,0 +1,297 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build ignore
+// +build ignore
+
+// Mkwalk writes the components function of the AST walkers, derived from the
+// productions documented in ast.go. It must run after yy regenerated ast.go.
+//
+// Usage, from internal/c99:
+//
+//	go run mkwalk.go [-o walk_ast.go]
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+)
+
+var oOut = flag.String("o", "walk_ast.go", "output file")
+
+// A node is an AST type of ast.go.
+type node struct {
+	name     string
+	caseType string     // "" if Case is an int or there is no Case field.
+	cases    []string   // Names of the Case constants, if caseType != "".
+	prods    [][]symbol // Components of the productions in their order.
+	fields   map[string]bool
+	reversed bool // Left recursive list reversed by the parser.
+}
+
+// A symbol is a component of a production.
+type symbol struct {
+	field string // Like "Expr2" or "Token".
+	token bool
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "ast.go", nil, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	nodes := map[string]*node{}
+	reversed := map[string]bool{}
+	for _, d := range f.Decls {
+		switch x := d.(type) {
+		case *ast.FuncDecl:
+			if x.Name.Name == "reverse" && x.Recv != nil {
+				reversed[x.Recv.List[0].Type.(*ast.StarExpr).X.(*ast.Ident).Name] = true
+			}
+		case *ast.GenDecl:
+			if x.Tok != token.TYPE || x.Doc == nil {
+				continue
+			}
+
+			spec := x.Specs[0].(*ast.TypeSpec)
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+
+			n := &node{name: spec.Name.Name, fields: map[string]bool{}}
+			for _, v := range st.Fields.List {
+				for _, nm := range v.Names {
+					n.fields[nm.Name] = true
+					if nm.Name == "Case" {
+						if id := v.Type.(*ast.Ident); id.Name != "int" {
+							n.caseType = id.Name
+						}
+					}
+				}
+			}
+			n.parse(x.Doc.Text())
+			nodes[n.name] = n
+		}
+	}
+
+	var names []string
+	for k, v := range nodes {
+		v.reversed = reversed[k]
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	b.WriteString(`// Code generated by mkwalk.go. DO NOT EDIT.
+
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package c99
+
+import (
+	"fmt"
+
+	"github.com/cznic/xc"
+)
+
+// components calls f for every component of n in source order. The name
+// argument is the name of the field of n holding the component. For a token
+// child is nil, for a non-nil child node tok is the zero xc.Token.
+func components(n Node, f func(name string, tok xc.Token, child Node)) {
+	switch x := n.(type) {
+`)
+	for _, nm := range names {
+		nodes[nm].emit(&b)
+	}
+	b.WriteString(`	case nil:
+		// nop
+	default:
+		panic(fmt.Errorf("internal error: %T", n))
+	}
+}
+`)
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*oOut, src, 0664); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parse extracts the productions from the doc comment of n, like
+//
+//	Expr:
+//	        "++" Expr           // Case ExprPreInc
+//	|       Expr '?' ExprList ':' Expr  // Case ExprCond
+func (n *node) parse(doc string) {
+	for _, line := range strings.Split(doc, "\n") {
+		line = strings.TrimSpace(line)
+		i := strings.Index(line, "// Case ")
+		if i < 0 {
+			continue
+		}
+
+		c := strings.TrimSpace(line[i+len("// Case "):])
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[:i]), "|"))
+		if n.caseType != "" {
+			n.cases = append(n.cases, c)
+		}
+		var prod []symbol
+		seen := map[string]int{}
+		for _, s := range split(line) {
+			name := s
+			tok := s[0] == '\'' || s[0] == '"' || strings.ToUpper(s) == s
+			if tok {
+				name = "Token"
+			}
+			seen[name]++
+			if k := seen[name]; k > 1 {
+				name += fmt.Sprint(k)
+			}
+			if !n.fields[name] {
+				log.Fatalf("%s: production %q: no field %s", n.name, line, name)
+			}
+
+			prod = append(prod, symbol{name, tok})
+		}
+		n.prods = append(n.prods, prod)
+	}
+	if len(n.prods) == 0 {
+		log.Fatalf("%s: no productions", n.name)
+	}
+}
+
+// split returns the symbols of a production, like ["Expr", "'?'", "ExprList"].
+func split(s string) (r []string) {
+	if s == "/* empty */" {
+		return nil
+	}
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		n := strings.IndexByte(s, ' ')
+		if q := s[0]; q == '\'' || q == '"' {
+			n = strings.IndexByte(s[1:], q) + 2
+		}
+		if n < 0 {
+			n = len(s)
+		}
+		r = append(r, s[:n])
+		s = s[n:]
+	}
+	return r
+}
+
+func (n *node) emit(b *bytes.Buffer) {
+	fmt.Fprintf(b, "\tcase *%s:\n", n.name)
+	if n.caseType == "" {
+		n.emitSymbols(b, "\t\t", n.merge(), len(n.prods))
+		return
+	}
+
+	// Productions with equal components share a switch case.
+	var keys []string
+	groups := map[string][]string{}
+	prods := map[string][]symbol{}
+	for i, prod := range n.prods {
+		k := fmt.Sprint(prod)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+			prods[k] = prod
+		}
+		groups[k] = append(groups[k], n.cases[i])
+	}
+	fmt.Fprintf(b, "\t\tswitch x.Case {\n")
+	for _, k := range keys {
+		fmt.Fprintf(b, "\t\tcase %s:\n", strings.Join(groups[k], ", "))
+		if len(prods[k]) == 0 {
+			fmt.Fprintf(b, "\t\t\t// nop\n")
+		}
+		n.emitSymbols(b, "\t\t\t", prods[k], 1)
+	}
+	fmt.Fprintf(b, "\t\t}\n")
+}
+
+// merge returns the shortest sequence containing the components of every
+// production of n in their order, with the list link of a reversed list
+// last.
+func (n *node) merge() (r []symbol) {
+	for _, prod := range n.prods {
+		if n.reversed && len(prod) != 0 && prod[0].field == n.name {
+			prod = append(prod[1:len(prod):len(prod)], prod[0])
+		}
+		var m []symbol
+		i := 0
+		for _, s := range prod {
+			j := i
+			for j < len(r) && r[j] != s {
+				j++
+			}
+			if j == len(r) {
+				if contains(r, s) {
+					log.Fatalf("%s: inconsistent order of %s", n.name, s.field)
+				}
+
+				m = append(m, s)
+				continue
+			}
+
+			m = append(m, r[i:j+1]...)
+			i = j + 1
+		}
+		r = append(m, r[i:]...)
+	}
+	return r
+}
+
+func contains(a []symbol, s symbol) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// emitSymbols writes the calls of f for syms. A token that is not part of
+// every one of the nprods productions is reported only when present.
+func (n *node) emitSymbols(b *bytes.Buffer, indent string, syms []symbol, nprods int) {
+	for _, s := range syms {
+		switch {
+		case !s.token:
+			fmt.Fprintf(b, "%sif x.%[2]s != nil {\n%[1]s\tf(%[2]q, xc.Token{}, x.%[2]s)\n%[1]s}\n", indent, s.field)
+		case nprods == 1 || n.always(s):
+			fmt.Fprintf(b, "%sf(%[2]q, x.%[2]s, nil)\n", indent, s.field)
+		default:
+			fmt.Fprintf(b, "%sif x.%[2]s.Rune != 0 {\n%[1]s\tf(%[2]q, x.%[2]s, nil)\n%[1]s}\n", indent, s.field)
+		}
+	}
+}
+
+// always reports whether every production of n has the token s.
+func (n *node) always(s symbol) bool {
+	for _, prod := range n.prods {
+		if !contains(prod, s) {
+			return false
+		}
+	}
+	return true
+}
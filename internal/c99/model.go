@@ -5,6 +5,7 @@
 package c99
 
 import (
+	"encoding/binary"
 	"fmt"
 	"runtime"
 )
@@ -41,14 +42,73 @@ func newModel() (m Model, err error) {
 			UShort:    {2, 2, 2},
 
 			Float:      {4, 4, 4},
-			Double:     {8, 8, 4},
-			LongDouble: {8, 8, 8},
+			Double:     {8, 8, 8},
+			LongDouble: {16, 16, 16},
 
-			FloatComplex:      {8, 8, 4},
-			DoubleComplex:     {8, 8, 4},
-			LongDoubleComplex: {8, 8, 4},
+			FloatComplex:      {8, 4, 4},
+			DoubleComplex:     {16, 8, 8},
+			LongDoubleComplex: {32, 16, 16},
+
+			Ptr: {8, 8, 8},
 		}, nil
 	default:
 		return nil, fmt.Errorf("unknown/unsupported architecture %s", arch)
 	}
 }
+
+// biggestAlign returns the largest alignment of any type kind. It is the
+// alignment requested by __attribute__((aligned)) without an argument.
+func (m Model) biggestAlign() int {
+	r := 1
+	for _, v := range m {
+		if v.Align > r {
+			r = v.Align
+		}
+	}
+	return r
+}
+
+// byteOrder returns the byte order of the target.
+func (m Model) byteOrder() binary.ByteOrder {
+	switch runtime.GOARCH {
+	case "armbe", "arm64be", "mips", "mips64", "mips64p32", "ppc", "ppc64", "s390", "s390x", "sparc", "sparc64":
+		return binary.BigEndian
+	default:
+		return binary.LittleEndian
+	}
+}
+
+// longDoubleFormat is the representation of a long double.
+type longDoubleFormat int
+
+const (
+	longDoubleUnsupported  longDoubleFormat = iota
+	longDoubleBinary64                      // IEEE 754 binary64, like double.
+	longDoubleBinary128                     // IEEE 754 binary128.
+	longDoubleDoubleDouble                  // IBM double-double, two doubles, the high one first.
+	longDoubleX87                           // x87 80-bit extended precision, padded.
+)
+
+// longDouble returns the representation of a long double of the target.
+func (m Model) longDouble() longDoubleFormat {
+	sz := m[LongDouble].Size
+	if sz == 8 {
+		return longDoubleBinary64
+	}
+
+	switch runtime.GOARCH {
+	case "386", "amd64", "amd64p32":
+		if sz == 12 || sz == 16 {
+			return longDoubleX87
+		}
+	case "ppc", "ppc64", "ppc64le":
+		if sz == 16 {
+			return longDoubleDoubleDouble
+		}
+	case "arm64", "arm64be", "mips64", "mips64le", "s390x", "sparc64":
+		if sz == 16 {
+			return longDoubleBinary128
+		}
+	}
+	return longDoubleUnsupported
+}
@@ -2936,11 +2936,14 @@ yynewstate:
 		}
 	case 71:
 		{
-			yyVAL.node = &Declaration{
+			lx := yylex.(*lexer)
+			lhs := &Declaration{
 				DeclarationSpecifiers: yyS[yypt-2].node.(*DeclarationSpecifiers),
 				InitDeclaratorListOpt: yyS[yypt-1].node.(*InitDeclaratorListOpt),
 				Token: yyS[yypt-0].Token,
 			}
+			yyVAL.node = lhs
+			lx.typedef = false
 		}
 	case 72:
 		{
@@ -3011,19 +3014,25 @@ yynewstate:
 		}
 	case 82:
 		{
-			yyVAL.node = &InitDeclarator{
+			lx := yylex.(*lexer)
+			lhs := &InitDeclarator{
 				Case:       InitDeclaratorBase,
 				Declarator: yyS[yypt-0].node.(*Declarator),
 			}
+			yyVAL.node = lhs
+			lx.declare(lhs.Declarator)
 		}
 	case 83:
 		{
-			yyVAL.node = &InitDeclarator{
+			lx := yylex.(*lexer)
+			lhs := &InitDeclarator{
 				Case:        InitDeclaratorInit,
 				Declarator:  yyS[yypt-2].node.(*Declarator),
 				Token:       yyS[yypt-1].Token,
 				Initializer: yyS[yypt-0].node.(*Initializer),
 			}
+			yyVAL.node = lhs
+			lx.declare(lhs.Declarator)
 		}
 	case 84:
 		{
@@ -3055,10 +3064,12 @@ yynewstate:
 		}
 	case 88:
 		{
+			lx := yylex.(*lexer)
 			yyVAL.node = &StorageClassSpecifier{
 				Case:  StorageClassSpecifierTypedef,
 				Token: yyS[yypt-0].Token,
 			}
+			lx.typedef = true
 		}
 	case 89:
 		{
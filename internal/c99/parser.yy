@@ -245,6 +245,7 @@ import (
 				}
 
                         // [0]6.4.4.3
+			//yy:field	Value	*Value
                         EnumerationConstant:
                         	IDENTIFIER
 
@@ -340,6 +341,9 @@ import (
                         // [0]6.7
 			Declaration:
                         	DeclarationSpecifiers InitDeclaratorListOpt ';'
+				{
+					lx.typedef = false
+				}
 
                         // [0]6.7
 /*yy:case Func       */ DeclarationSpecifiers:
@@ -364,7 +368,13 @@ import (
                         // [0]6.7
 /*yy:case Base       */ InitDeclarator:
                         	Declarator
+				{
+					lx.declare(lhs.Declarator)
+				}
 /*yy:case Init       */ |	Declarator '=' Initializer
+				{
+					lx.declare(lhs.Declarator)
+				}
 
                         // [0]6.7.1
 /*yy:case Auto       */ StorageClassSpecifier:
@@ -373,6 +383,9 @@ import (
 /*yy:case Register   */ |	"register"
 /*yy:case Static     */ |	"static"
 /*yy:case Typedef    */ |	"typedef"
+				{
+					lx.typedef = true
+				}
 
                         // [0]6.7.2
 /*yy:case Bool       */ TypeSpecifier:
@@ -393,6 +406,7 @@ import (
 /*yy:case Name       */ |	TYPEDEF_NAME
 
                         // [0]6.7.2.1
+			//yy:field	Type	*StructType
 /*yy:case Tag        */ StructOrUnionSpecifier:
                         	StructOrUnion IDENTIFIER
 /*yy:case Define     */ |	StructOrUnion IdentifierOpt '{' StructDeclarationList '}'
@@ -435,6 +449,7 @@ import (
                         |	','
 
                         // [0]6.7.2.2
+			//yy:field	Type	Type
 /*yy:case Tag        */ EnumSpecifier:
                         	"enum" IDENTIFIER
 /*yy:case Define     */ |	"enum" IdentifierOpt '{' EnumeratorList  CommaOpt '}'
@@ -460,6 +475,11 @@ import (
 				"inline"
 
                         // [0]6.7.5
+			//yy:field	Image	*Image
+			//yy:field	Linkage	Linkage
+			//yy:field	Static	bool
+			//yy:field	Type	Type
+			//yy:field	Typedef	bool
                         Declarator:
                         	PointerOpt DirectDeclarator
 
@@ -642,6 +662,11 @@ import (
 
                         // [0]6.9
                         //yy:list
+			//yy:field	Diagnostics	Diagnostics
+			//yy:field	FileSet		*token.FileSet
+			//yy:field	Macros		*Macros
+			//yy:field	Model		Model
+			//yy:field	Warnings	scanner.ErrorList
                         TranslationUnit:
                         	ExternalDeclaration
                         |	TranslationUnit ExternalDeclaration
@@ -0,0 +1,200 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cznic/ccir"
+	"github.com/cznic/sqlite2go/internal/c99"
+	"github.com/cznic/xc"
+)
+
+func caller(s string, va ...interface{}) {
+	if s == "" {
+		s = strings.Repeat("%v ", len(va))
+	}
+	_, fn, fl, _ := runtime.Caller(2)
+	fmt.Fprintf(os.Stderr, "# caller: %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintf(os.Stderr, s, va...)
+	fmt.Fprintln(os.Stderr)
+	_, fn, fl, _ = runtime.Caller(1)
+	fmt.Fprintf(os.Stderr, "# \tcallee: %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintln(os.Stderr)
+	os.Stderr.Sync()
+}
+
+func dbg(s string, va ...interface{}) {
+	if s == "" {
+		s = strings.Repeat("%v ", len(va))
+	}
+	_, fn, fl, _ := runtime.Caller(1)
+	fmt.Fprintf(os.Stderr, "# dbg %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintf(os.Stderr, s, va...)
+	fmt.Fprintln(os.Stderr)
+	os.Stderr.Sync()
+}
+
+func TODO(...interface{}) string { //TODOOK
+	_, fn, fl, _ := runtime.Caller(1)
+	return fmt.Sprintf("# TODO: %s:%d:\n", path.Base(fn), fl) //TODOOK
+}
+
+func use(...interface{}) {}
+
+func init() {
+	use(caller, dbg, TODO) //TODOOK
+}
+
+// ============================================================================
+
+func tokens(n c99.Node) (r []string) {
+	c99.Inspect(n, func(n c99.Node) bool {
+		if n != nil {
+			c99.Components(n, func(tok xc.Token, child c99.Node) {
+				if child == nil {
+					r = append(r, c99.TokSrc(tok))
+				}
+			})
+		}
+		return true
+	})
+	return r
+}
+
+func printSource(t *testing.T, src c99.Source) ([]byte, []string) {
+	tu, err := c99.Translate(&c99.Tweaks{}, nil, nil, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Fprint(&buf, tu.FileSet, tu); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes(), tokens(tu)
+}
+
+func TestPrint(t *testing.T) {
+	m, err := filepath.Glob(filepath.FromSlash("testdata/*.c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range m {
+		exp, err := ioutil.ReadFile(path + ".expect")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, toks := printSource(t, c99.NewFileSource(path))
+		if g, e := string(b), string(exp); g != e {
+			t.Errorf("%s\n---- got\n%s---- exp\n%s", path, g, e)
+			continue
+		}
+
+		// The output must parse to the same tokens and print unchanged.
+		b2, toks2 := printSource(t, c99.NewStringSource(path, string(b)))
+		if g, e := string(b2), string(b); g != e {
+			t.Errorf("%s: not idempotent\n---- got\n%s---- exp\n%s", path, g, e)
+		}
+		if g, e := strings.Join(toks2, " "), strings.Join(toks, " "); g != e {
+			t.Errorf("%s: tokens differ\n---- got\n%s\n---- exp\n%s", path, g, e)
+		}
+	}
+}
+
+const sqliteDir = "../../../_sqlite/sqlite-amalgamation-3210000"
+
+// sqliteCorpus lists the SQLite sources printed by TestPrintSQLite. The
+// headers in testdata/include declare just what sqlite3.h and shell.c use.
+// Entries without the source are skipped.
+var sqliteCorpus = []struct {
+	src             string
+	predef          string
+	sysIncludePaths []string
+}{
+	{"sqlite3.h", "", []string{"testdata/include"}},
+	{"shell.c", "", []string{"testdata/include"}},
+	{"sqlite3.c", fmt.Sprintf(`
+#define _CCGO 1
+#define __arch__ %s
+#define __os__ %s
+#include <builtin.h>
+`, runtime.GOARCH, runtime.GOOS), []string{ccir.LibcIncludePath}},
+}
+
+// TestPrintSQLite prints the SQLite sources. The output must parse to the
+// same tokens, print unchanged and, when gcc is available, compile.
+func TestPrintSQLite(t *testing.T) {
+	gcc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Log(err)
+	}
+
+	dir, err := ioutil.TempDir("", "printer-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, v := range sqliteCorpus {
+		path := filepath.Join(filepath.FromSlash(sqliteDir), v.src)
+		if _, err := os.Stat(path); err != nil {
+			t.Log(err)
+			continue
+		}
+
+		var sources []c99.Source
+		if v.predef != "" {
+			sources = append(sources, c99.NewStringSource("<predef>", v.predef))
+		} else {
+			sources = append(sources, c99.NewBuiltinSource())
+		}
+		tu, err := c99.Translate(&c99.Tweaks{}, []string{"@"}, v.sysIncludePaths, append(sources, c99.NewFileSource(path))...)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := Fprint(&buf, tu.FileSet, tu); err != nil {
+			t.Fatal(err)
+		}
+
+		b := buf.Bytes()
+		b2, toks2 := printSource(t, c99.NewStringSource(path, string(b)))
+		if !bytes.Equal(b2, b) {
+			t.Errorf("%s: not idempotent", path)
+		}
+		if g, e := strings.Join(toks2, " "), strings.Join(tokens(tu), " "); g != e {
+			t.Errorf("%s: tokens differ", path)
+		}
+
+		if gcc == "" {
+			continue
+		}
+
+		fn := filepath.Join(dir, v.src+".c")
+		if err := ioutil.WriteFile(fn, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if out, err := exec.Command(gcc, "-fsyntax-only", "-std=c99", "-w", fn).CombinedOutput(); err != nil {
+			t.Errorf("%s: %s\n%v", path, out, err)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package printer implements printing of C99 AST nodes as C source code.
+//
+// The printer emits the original tokens of the AST. Line breaks and
+// indentation are derived from the syntax tree. Blank lines separating
+// declarations and block items in the original source are kept where their
+// positions are known.
+package printer
+
+import (
+	"bytes"
+	"go/token"
+	"io"
+	"strings"
+
+	"github.com/cznic/sqlite2go/internal/c99"
+	"github.com/cznic/xc"
+)
+
+// Config controls the output of Fprint.
+type Config struct {
+	Indent string // Indentation unit, defaults to a tab.
+}
+
+// Fprint "pretty-prints" an AST node to w. The fset argument is used to find
+// blank lines in the original source and may be nil.
+func (c *Config) Fprint(w io.Writer, fset *token.FileSet, n c99.Node) error {
+	p := &printer{
+		fset:   fset,
+		indent: c.Indent,
+	}
+	if p.indent == "" {
+		p.indent = "\t"
+	}
+	p.node(n)
+	if p.buf.Len() != 0 {
+		p.buf.WriteByte('\n')
+	}
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// Fprint "pretty-prints" an AST node to w using the default Config.
+func Fprint(w io.Writer, fset *token.FileSet, n c99.Node) error {
+	return (&Config{}).Fprint(w, fset, n)
+}
+
+type printer struct {
+	buf     bytes.Buffer
+	fset    *token.FileSet
+	indent  string
+	last    string    // Source form of the last token written.
+	lastPos token.Pos // Position of the last token written.
+	level   int       // Indentation level.
+	nl      int       // Pending line breaks, 2 asks for a blank line.
+	outdent bool      // Write the next line one level to the left.
+	softNL  bool      // Pending line break may be replaced by a space.
+	space   bool      // Pending space.
+	stack   []c99.Node
+	wasFunc bool // The last external declaration was a function definition.
+}
+
+func (p *printer) parent() c99.Node {
+	if n := len(p.stack); n > 1 {
+		return p.stack[n-2]
+	}
+
+	return nil
+}
+
+func (p *printer) node(n c99.Node) {
+	p.before(n)
+	p.stack = append(p.stack, n)
+	c99.Components(n, func(tok xc.Token, child c99.Node) {
+		if child != nil {
+			p.node(child)
+			return
+		}
+
+		p.token(tok, n)
+	})
+	p.stack = p.stack[:len(p.stack)-1]
+	p.after(n)
+}
+
+// isSubStmt reports whether n is the statement body of an if, switch,
+// while, do or for.
+func (p *printer) isSubStmt(n c99.Node) bool {
+	if len(p.stack) == 0 {
+		return false
+	}
+
+	switch p.stack[len(p.stack)-1].(type) {
+	case *c99.SelectionStmt, *c99.IterationStmt:
+		_, ok := n.(*c99.Stmt)
+		return ok
+	}
+	return false
+}
+
+func (p *printer) before(n c99.Node) {
+	switch x := n.(type) {
+	case *c99.ExternalDeclaration:
+		if p.buf.Len() != 0 {
+			p.newline(1)
+			if p.wasFunc || x.FunctionDefinition != nil {
+				p.newline(2)
+			}
+		}
+		p.blankLine(n)
+	case *c99.BlockItem, *c99.StructDeclaration:
+		p.newline(1)
+		p.blankLine(n)
+	case *c99.LabeledStmt:
+		p.newline(1)
+		if p.level != 0 {
+			p.outdent = true
+		}
+	case *c99.Stmt:
+		if !p.isSubStmt(n) {
+			break
+		}
+
+		switch {
+		case x.CompoundStmt != nil:
+			p.space = true
+		case x.SelectionStmt != nil && p.isElse(x):
+			p.space = true
+		default:
+			p.newline(1)
+			p.level++
+		}
+	}
+}
+
+func (p *printer) after(n c99.Node) {
+	switch x := n.(type) {
+	case *c99.Stmt:
+		if p.isSubStmt(n) && x.CompoundStmt == nil && !(x.SelectionStmt != nil && p.isElse(x)) {
+			p.level--
+		}
+	case *c99.ExternalDeclaration:
+		p.wasFunc = x.FunctionDefinition != nil
+	}
+}
+
+// isElse reports whether n is the else branch of the enclosing if.
+func (p *printer) isElse(n *c99.Stmt) bool {
+	x, ok := p.stack[len(p.stack)-1].(*c99.SelectionStmt)
+	return ok && x.Stmt2 == n
+}
+
+// blankLine asks for a blank line before n if the original source has one.
+func (p *printer) blankLine(n c99.Node) {
+	if p.fset == nil || !p.lastPos.IsValid() {
+		return
+	}
+
+	pos := n.Pos()
+	if !pos.IsValid() {
+		return
+	}
+
+	a, b := p.fset.Position(p.lastPos), p.fset.Position(pos)
+	if a.Filename == b.Filename && b.Line > a.Line+1 {
+		p.newline(2)
+	}
+}
+
+func (p *printer) newline(n int) {
+	if p.buf.Len() == 0 {
+		return
+	}
+
+	if n > p.nl {
+		p.nl = n
+	}
+}
+
+func (p *printer) token(tok xc.Token, n c99.Node) {
+	s := c99.TokSrc(tok)
+	switch s {
+	case "{":
+		switch n.(type) {
+		case *c99.CompoundStmt, *c99.StructOrUnionSpecifier, *c99.EnumSpecifier:
+			p.space = true
+			p.write(s, tok)
+			p.level++
+			p.newline(1)
+			return
+		}
+	case "}":
+		switch n.(type) {
+		case *c99.CompoundStmt, *c99.StructOrUnionSpecifier, *c99.EnumSpecifier:
+			p.level--
+			p.newline(1)
+			p.write(s, tok)
+			if _, ok := n.(*c99.CompoundStmt); ok {
+				p.newline(1)
+				p.softNL = true
+			}
+			return
+		}
+	case ";":
+		p.write(s, tok)
+		if p.inForHeader(n) {
+			p.space = true
+			return
+		}
+
+		p.newline(1)
+		return
+	case ",":
+		p.write(s, tok)
+		if _, ok := n.(*c99.EnumeratorList); ok {
+			p.newline(1)
+			return
+		}
+
+		p.space = true
+		return
+	case ":":
+		if _, ok := n.(*c99.LabeledStmt); ok {
+			p.write(s, tok)
+			p.newline(1)
+			return
+		}
+	case "*":
+		if _, ok := n.(*c99.Pointer); ok {
+			p.space = p.last != "(" && p.last != "*"
+			p.write(s, tok)
+			return
+		}
+	case "else", "while":
+		if p.softNL && p.last == "}" {
+			p.nl = 0
+			p.space = true
+		}
+	}
+
+	if isBinary(n, tok) {
+		p.space = true
+		p.write(s, tok)
+		p.space = true
+		return
+	}
+
+	p.write(s, tok)
+}
+
+// inForHeader reports whether a semicolon of n is a separator in the
+// parenthesized part of a for statement.
+func (p *printer) inForHeader(n c99.Node) bool {
+	switch x := n.(type) {
+	case *c99.IterationStmt:
+		return x.Case == c99.IterationStmtFor || x.Case == c99.IterationStmtForDecl
+	case *c99.Declaration:
+		if x, ok := p.parent().(*c99.IterationStmt); ok {
+			return x.Case == c99.IterationStmtForDecl
+		}
+	}
+	return false
+}
+
+// isBinary reports whether tok, a token of n, is surrounded by spaces.
+func isBinary(n c99.Node, tok xc.Token) bool {
+	switch x := n.(type) {
+	case *c99.Expr:
+		switch x.Case {
+		case
+			c99.ExprAdd,
+			c99.ExprAddAssign,
+			c99.ExprAnd,
+			c99.ExprAndAssign,
+			c99.ExprAssign,
+			c99.ExprDiv,
+			c99.ExprDivAssign,
+			c99.ExprEq,
+			c99.ExprGe,
+			c99.ExprGt,
+			c99.ExprLAnd,
+			c99.ExprLOr,
+			c99.ExprLe,
+			c99.ExprLsh,
+			c99.ExprLshAssign,
+			c99.ExprLt,
+			c99.ExprMod,
+			c99.ExprModAssign,
+			c99.ExprMul,
+			c99.ExprMulAssign,
+			c99.ExprNe,
+			c99.ExprOr,
+			c99.ExprOrAssign,
+			c99.ExprRsh,
+			c99.ExprRshAssign,
+			c99.ExprSub,
+			c99.ExprSubAssign,
+			c99.ExprXor,
+			c99.ExprXorAssign:
+			return true
+		case c99.ExprCond:
+			return tok.Rune == '?' || tok.Rune == ':'
+		}
+	case *c99.InitDeclarator, *c99.Enumerator, *c99.Designation:
+		return tok.Rune == '='
+	case *c99.StructDeclarator:
+		return tok.Rune == ':'
+	}
+	return false
+}
+
+func (p *printer) write(s string, tok xc.Token) {
+	switch {
+	case p.nl != 0:
+		p.buf.WriteString(strings.Repeat("\n", p.nl))
+		level := p.level
+		if p.outdent {
+			level--
+			p.outdent = false
+		}
+		p.buf.WriteString(strings.Repeat(p.indent, level))
+	case p.space || needSpace(p.last, s):
+		if p.buf.Len() != 0 {
+			p.buf.WriteByte(' ')
+		}
+	}
+	p.buf.WriteString(s)
+	p.last = s
+	p.lastPos = tok.Pos()
+	p.nl = 0
+	p.softNL = false
+	p.space = false
+}
+
+var glued = map[string]bool{
+	"!=": true, "##": true, "%:": true, "%=": true, "%>": true,
+	"&&": true, "&=": true, "*=": true, "++": true, "+=": true,
+	"--": true, "-=": true, "->": true, "..": true, "/*": true,
+	"//": true, "/=": true, ":>": true, "<%": true, "<:": true,
+	"<<": true, "<=": true, "==": true, ">=": true, ">>": true,
+	"^=": true, "|=": true, "||": true,
+}
+
+// needSpace reports whether a and b must be separated to print as two
+// tokens or to look like C written by a human.
+func needSpace(a, b string) bool {
+	if a == "" {
+		return false
+	}
+
+	x, y := a[len(a)-1], b[0]
+	switch {
+	case isWord(x) && isWord(y):
+		return true
+	case glued[string([]byte{x, y})]:
+		return true
+	case isKeyword(a):
+		return !strings.Contains(";,:)[]", string(y)) && !(a == "sizeof" && y == '(')
+	case a == "}":
+		return isWord(y)
+	}
+	return false
+}
+
+func isWord(c byte) bool {
+	return c == '_' || c == '"' || c == '\'' || c >= 0x80 ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+var keywords = map[string]bool{
+	"_Bool": true, "_Complex": true, "auto": true, "break": true,
+	"case": true, "char": true, "const": true, "continue": true,
+	"default": true, "do": true, "double": true, "else": true, "enum": true,
+	"extern": true, "float": true, "for": true, "goto": true, "if": true,
+	"inline": true, "int": true, "long": true, "register": true,
+	"restrict": true, "return": true, "short": true, "signed": true,
+	"static": true, "struct": true, "switch": true, "typedef": true,
+	"union": true, "unsigned": true, "void": true, "volatile": true,
+	"while": true,
+}
+
+func isKeyword(s string) bool { return keywords[s] }
@@ -0,0 +1,33 @@
+struct point { int x, y; unsigned flags : 3; };
+enum color { red, green = 2, blue };
+static const char *names[] = { "red", "green", [2] = "blue" };
+struct point origin = { .x = 0, .y = 0 };
+int (*handler)(int, char **);
+extern int printf(const char *, ...);
+
+static int add(int a, int b) { return a+b; }
+
+int f(int n, int *p)
+{
+	int i, sum = 0;
+	unsigned long mask = ~0UL >> 1;
+
+	for (i = 0; i < n; i++) sum += p[i];
+	for (int j = 0; j < n; j++) { sum -= j; }
+	do sum--; while (sum > 100);
+	do { sum++; } while (sum < -100);
+	while (n --> 0) if (n & 1) continue; else if (n % 3 == 0) break; else sum++;
+	switch (sum) {
+	case 0:
+	case 1: sum = add(sum, 1); break;
+	default: sum = -sum;
+	}
+	if (!p) goto out;
+	sum = sum > 0 ? sum : - -sum;
+	p[0] = (int)sizeof(struct point) + sizeof p[0] + (int)mask;
+	*p++ = (int)&origin != 0 && names[0][0] == 'r';
+out:
+	return sum;
+}
+
+int main(void) { struct point q = (struct point){ 1, 2 }; return f(q.x, &q.y) ? printf("%d\n" "done\n", q.x) : 0; }
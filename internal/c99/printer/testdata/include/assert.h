@@ -0,0 +1,6 @@
+#ifdef NDEBUG
+#define assert(x) ((void)0)
+#else
+void __assert(const char *);
+#define assert(x) ((void)((x) || (__assert(#x), 0)))
+#endif
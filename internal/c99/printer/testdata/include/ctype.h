@@ -0,0 +1,12 @@
+#ifndef _CTYPE_H
+#define _CTYPE_H
+
+int isalnum(int);
+int isalpha(int);
+int isdigit(int);
+int isspace(int);
+int isxdigit(int);
+int tolower(int);
+int toupper(int);
+
+#endif
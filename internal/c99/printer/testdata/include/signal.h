@@ -0,0 +1,10 @@
+#ifndef _SIGNAL_H
+#define _SIGNAL_H
+
+#define SIGINT 2
+
+typedef void (*__sighandler_t)(int);
+
+__sighandler_t signal(int, __sighandler_t);
+
+#endif
@@ -0,0 +1,15 @@
+#ifndef _STDLIB_H
+#define _STDLIB_H
+
+#include <stddef.h>
+
+int atoi(const char *);
+void exit(int);
+void free(void *);
+char *getenv(const char *);
+void *malloc(size_t);
+void *realloc(void *, size_t);
+long strtol(const char *, char **, int);
+int system(const char *);
+
+#endif
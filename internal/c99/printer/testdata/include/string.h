@@ -0,0 +1,16 @@
+#ifndef _STRING_H
+#define _STRING_H
+
+#include <stddef.h>
+
+int memcmp(const void *, const void *, size_t);
+void *memcpy(void *, const void *, size_t);
+void *memset(void *, int, size_t);
+char *strchr(const char *, int);
+int strcmp(const char *, const char *);
+size_t strlen(const char *);
+int strncmp(const char *, const char *, size_t);
+char *strncpy(char *, const char *, size_t);
+char *strstr(const char *, const char *);
+
+#endif
@@ -0,0 +1,9 @@
+#ifndef _SYS_TIME_H
+#define _SYS_TIME_H
+
+struct timeval {
+	long tv_sec;
+	long tv_usec;
+};
+
+#endif
@@ -0,0 +1,9 @@
+#ifndef _SYS_TYPES_H
+#define _SYS_TYPES_H
+
+typedef unsigned gid_t;
+typedef int pid_t;
+typedef long ssize_t;
+typedef unsigned uid_t;
+
+#endif
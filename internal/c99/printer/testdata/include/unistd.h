@@ -0,0 +1,17 @@
+#ifndef _UNISTD_H
+#define _UNISTD_H
+
+#include <sys/types.h>
+
+#define F_OK 0
+#define X_OK 1
+#define W_OK 2
+#define R_OK 4
+
+int access(const char *, int);
+int chdir(const char *);
+uid_t getuid(void);
+int isatty(int);
+int unlink(const char *);
+
+#endif
@@ -0,0 +1,276 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build ignore
+// +build ignore
+
+// Generate writes to stdout the ABI table of the host used by TestABI. It
+// lists the size, alignment and struct member alignment of the C types of
+// Model and the size, alignment and member offsets of every tagged struct and
+// union declared at file scope of the C sources given as arguments, all as
+// computed by a C compiler. The layouts are read from the DWARF debug
+// information of the compiled sources.
+//
+// The sources are compiled with the system include directory given by
+// -isystem, if any, instead of the compiler's ones, so they see the same
+// headers as the C99 front end in TestABI.
+//
+// Usage, from internal/c99:
+//
+//	go run testdata/abi/generate.go [-cc compiler] [-isystem dir] file.c...
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	oCC      = flag.String("cc", "gcc", "C compiler")
+	oISystem = flag.String("isystem", "", "system include directory replacing the compiler's ones")
+
+	// kinds maps the TypeKinds of Model to C types.
+	kinds = []struct{ kind, typ string }{
+		{"Bool", "_Bool"},
+		{"Char", "char"},
+		{"Int", "int"},
+		{"Long", "long"},
+		{"LongLong", "long long"},
+		{"SChar", "signed char"},
+		{"Short", "short"},
+		{"UChar", "unsigned char"},
+		{"UInt", "unsigned"},
+		{"ULong", "unsigned long"},
+		{"ULongLong", "unsigned long long"},
+		{"UShort", "unsigned short"},
+		{"Float", "float"},
+		{"Double", "double"},
+		{"LongDouble", "long double"},
+		{"FloatComplex", "float _Complex"},
+		{"DoubleComplex", "double _Complex"},
+		{"LongDoubleComplex", "long double _Complex"},
+		{"Ptr", "void *"},
+	}
+)
+
+type field struct {
+	name    string
+	bitOff  int64
+	bitSize int64
+}
+
+type aggregate struct {
+	name   string // Like "struct foo".
+	size   int64
+	fields []field
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	dir, err := ioutil.TempDir("", "abi-")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	out, err := exec.Command(*oCC, "--version").Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	version := strings.SplitN(string(out), "\n", 2)[0]
+	fmt.Printf("# Generated by generate.go using %s on %s/%s. DO NOT EDIT.\n", version, runtime.GOOS, runtime.GOARCH)
+	var b strings.Builder
+	b.WriteString("#include <stddef.h>\n#include <stdio.h>\n\nint main() {\n")
+	for _, v := range kinds {
+		fmt.Fprintf(&b, "\tprintf(\"model\\t%s\\t%%d\\t%%d\\t%%d\\n\", (int)sizeof(%[2]s), (int)_Alignof(%[2]s), (int)offsetof(struct { char c; %[2]s x; }, x));\n", v.kind, v.typ)
+	}
+	b.WriteString("}\n")
+	fmt.Print(run(dir, b.String()))
+	for _, src := range flag.Args() {
+		generate(dir, src)
+	}
+}
+
+// sysIncludeArgs returns the compiler arguments selecting the system include
+// directory given by -isystem.
+func sysIncludeArgs() []string {
+	if *oISystem == "" {
+		return nil
+	}
+
+	return []string{"-nostdinc", "-isystem", *oISystem}
+}
+
+// run compiles and executes the C program src.
+func run(dir, src string) string {
+	fn := filepath.Join(dir, "main.c")
+	if err := ioutil.WriteFile(fn, []byte(src), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	bin := filepath.Join(dir, "main")
+	if out, err := exec.Command(*oCC, "-w", "-o", bin, fn).CombinedOutput(); err != nil {
+		log.Fatalf("%s\n%v", out, err)
+	}
+
+	out, err := exec.Command(bin).Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return string(out)
+}
+
+// compile compiles the C source src to an object file and returns its name.
+func compile(dir, src string, arg ...string) string {
+	obj := filepath.Join(dir, "src.o")
+	args := append([]string{"-w", "-c", "-o", obj, "-I", filepath.Dir(src)}, sysIncludeArgs()...)
+	args = append(append(args, arg...), "-x", "c", src)
+	if out, err := exec.Command(*oCC, args...).CombinedOutput(); err != nil {
+		log.Fatalf("%s\n%v", out, err)
+	}
+
+	return obj
+}
+
+func generate(dir, src string) {
+	f, err := elf.Open(compile(dir, src, "-g", "-fno-eliminate-unused-debug-types"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer f.Close()
+
+	d, err := f.DWARF()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var a []*aggregate
+	seen := map[string]bool{}
+	r := d.Reader()
+	for depth := 0; ; {
+		e, err := r.Next()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if e == nil {
+			break
+		}
+
+		if e.Tag == 0 {
+			depth--
+			continue
+		}
+
+		if depth == 1 && (e.Tag == dwarf.TagStructType || e.Tag == dwarf.TagUnionType) {
+			if x := aggregateOf(d, e); x != nil && !seen[x.name] {
+				seen[x.name] = true
+				a = append(a, x)
+			}
+		}
+		if e.Children {
+			depth++
+		}
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].name < a[j].name })
+
+	aligns := alignments(dir, src, a)
+	for i, v := range a {
+		fmt.Printf("struct\t%s\t%s\t%d\t%d\n", src, v.name, v.size, aligns[i])
+		for _, f := range v.fields {
+			fmt.Printf("field\t%s\t%s\t%s\t%d\t%d\n", src, v.name, f.name, f.bitOff, f.bitSize)
+		}
+	}
+}
+
+// alignments returns the alignments of the aggregates a of src. They are the
+// sizes of arrays of that many chars, so the source, which may call functions
+// defined elsewhere, is only compiled, not linked.
+func alignments(dir, src string, a []*aggregate) []uint64 {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#include \"%s\"\n\n", filepath.Base(src))
+	for i, v := range a {
+		fmt.Fprintf(&b, "char abi_align_%d[_Alignof(%s)];\n", i, v.name)
+	}
+	fn := filepath.Join(dir, "align.c")
+	if err := ioutil.WriteFile(fn, []byte(b.String()), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := elf.Open(compile(dir, fn, "-I", filepath.Dir(src)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer f.Close()
+
+	syms, err := f.Symbols()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := make([]uint64, len(a))
+	for _, v := range syms {
+		if s := strings.TrimPrefix(v.Name, "abi_align_"); s != v.Name {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			r[i] = v.Size
+		}
+	}
+	return r
+}
+
+// aggregateOf returns the complete tagged struct or union type of e or nil.
+// Types declared at line 0, like gcc's struct __va_list_tag, are builtin.
+func aggregateOf(d *dwarf.Data, e *dwarf.Entry) *aggregate {
+	if e.Val(dwarf.AttrName) == nil || e.Val(dwarf.AttrDeclaration) != nil || e.Val(dwarf.AttrDeclLine) == int64(0) {
+		return nil
+	}
+
+	t, err := d.Type(e.Offset)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	st, ok := t.(*dwarf.StructType)
+	if !ok || st.Incomplete {
+		return nil
+	}
+
+	r := &aggregate{name: st.Kind + " " + st.StructName, size: st.ByteSize}
+	for _, f := range st.Field {
+		off := 8 * f.ByteOffset
+		switch {
+		case f.BitSize == 0:
+			// nop
+		case f.ByteSize != 0:
+			// DWARF 2 numbers the bits of the storage unit from its most
+			// significant bit.
+			off += 8*f.ByteSize - f.BitOffset - f.BitSize
+		default:
+			off = f.DataBitOffset
+		}
+		r.fields = append(r.fields, field{f.Name, off, f.BitSize})
+	}
+	return r
+}
@@ -0,0 +1,14 @@
+#!/bin/sh
+# Regenerates the ABI table of the host architecture used by TestABI. The
+# tests do not need a C compiler.
+#
+# The SQLite sources see the minimal system headers of the printer tests,
+# which TestABI uses as well.
+set -e
+cd "$(dirname "$0")/../.."
+sqlite=../../_sqlite/sqlite-amalgamation-3210000
+srcs="$(ls testdata/layout/*.c) $sqlite/sqlite3.h $sqlite/shell.c"
+if [ -f $sqlite/sqlite3.c ]; then
+	srcs="$srcs $sqlite/sqlite3.c"
+fi
+go run testdata/abi/generate.go -isystem printer/testdata/include $srcs > testdata/abi/$(go env GOARCH).txt
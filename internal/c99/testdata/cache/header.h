@@ -0,0 +1,8 @@
+#define MIN(a, b) ((a) < (b) ? (a) : (b))
+#define SIZE 16
+
+int header[SIZE];
+#ifdef DEBUG
+int debug = DEBUG;
+#endif
+int header2[MIN(SIZE, LIMIT)];
@@ -0,0 +1,13 @@
+#include "header.h"
+
+#define f(x) (x + SIZE)
+
+int a = f(1);
+int b = MIN(SIZE, LIMIT);
+#if LIMIT > 8
+int big;
+#endif
+#ifdef DEBUG
+int c = f(DEBUG);
+#endif
+int d = f(2);
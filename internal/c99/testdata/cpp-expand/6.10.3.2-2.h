@@ -0,0 +1,9 @@
+#define str(s) # s
+#define xstr(s) str(s)
+str( a   +	b );
+str( /* leading */ a /* mid
+*/ b /* trailing */ );
+str("a\n" '\'' "\\" L"\"");
+str();
+str(@ é);
+xstr(str(x));
@@ -0,0 +1,21 @@
+#define f(a) [a]
+#define g(a, b) [a|b]
+#define cat(a, b) a ## b
+#define cat3(a, b, c) [a ## b ## c]
+#define h(...) [__VA_ARGS__]
+#define v(a, ...) [a|__VA_ARGS__]
+f();
+g(,);
+g( , x);
+g(x, );
+cat(, );
+cat(x, );
+cat(, y);
+cat3(, , z);
+cat3(, y, );
+cat3(x, , z);
+h();
+h(, );
+h(a, , b);
+v(x, );
+v(x, (y, z), w);
@@ -0,0 +1,13 @@
+#define cat(a, b) a ## b
+#define xcat(a, b) cat(a, b)
+cat(+, =);
+cat(<<, =);
+cat(-, >);
+cat(L, "wide");
+cat(L, 'w');
+cat(1, e);
+cat(1e, +);
+cat(x, 1);
+cat(_, 0x1);
+cat(%:, %:);
+xcat(xcat(a, b), c);
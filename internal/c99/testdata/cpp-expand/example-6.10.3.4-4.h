@@ -0,0 +1,4 @@
+// [0]6.10.3.4-4: f(2)(9) expands to either 2*9*g or 2*f(9).
+#define f(a) a*g
+#define g(a) f(a)
+f(2)(9)
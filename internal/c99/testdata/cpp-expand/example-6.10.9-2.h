@@ -0,0 +1,3 @@
+#define LISTING(x) PRAGMA(listing on #x)
+#define PRAGMA(x) _Pragma(#x)
+LISTING ( ..\listing.dir )
@@ -0,0 +1 @@
+#else
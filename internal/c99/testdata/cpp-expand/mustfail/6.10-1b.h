@@ -0,0 +1 @@
+#endif
@@ -0,0 +1 @@
+#elif 1
@@ -0,0 +1 @@
+#ifdef X
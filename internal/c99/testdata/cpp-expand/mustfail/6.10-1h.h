@@ -0,0 +1 @@
+# 42
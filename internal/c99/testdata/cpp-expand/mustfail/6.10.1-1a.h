@@ -0,0 +1,2 @@
+#if (int)1
+#endif
@@ -0,0 +1 @@
+#define f(1) 1
@@ -0,0 +1 @@
+#define f(a
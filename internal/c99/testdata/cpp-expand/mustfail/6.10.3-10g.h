@@ -0,0 +1 @@
+#define 1 2
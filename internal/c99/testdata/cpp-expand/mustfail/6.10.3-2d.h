@@ -0,0 +1,2 @@
+#define f(a) a
+#define f(b) b
@@ -0,0 +1,2 @@
+#define h() 0
+h(1)
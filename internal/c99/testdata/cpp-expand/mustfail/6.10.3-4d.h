@@ -0,0 +1,2 @@
+#define v(a, ...) a
+v(1)
@@ -0,0 +1 @@
+#define A __VA_ARGS__
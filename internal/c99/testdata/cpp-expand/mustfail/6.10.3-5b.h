@@ -0,0 +1 @@
+#define f(a) a __VA_ARGS__
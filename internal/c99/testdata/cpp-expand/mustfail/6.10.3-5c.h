@@ -0,0 +1 @@
+#define f(__VA_ARGS__) 0
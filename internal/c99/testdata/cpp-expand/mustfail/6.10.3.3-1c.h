@@ -0,0 +1 @@
+#define A ## x
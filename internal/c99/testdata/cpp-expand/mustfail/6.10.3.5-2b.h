@@ -0,0 +1 @@
+#undef A B
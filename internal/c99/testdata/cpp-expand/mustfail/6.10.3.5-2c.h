@@ -0,0 +1 @@
+#undef 1
@@ -0,0 +1 @@
+#line 10 L"x.c"
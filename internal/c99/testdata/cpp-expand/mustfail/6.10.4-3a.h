@@ -0,0 +1 @@
+#line 0
@@ -0,0 +1 @@
+#line 2147483648
@@ -0,0 +1 @@
+#line x
@@ -0,0 +1 @@
+#error stop here
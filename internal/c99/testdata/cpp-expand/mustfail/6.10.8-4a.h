@@ -0,0 +1 @@
+#define defined 1
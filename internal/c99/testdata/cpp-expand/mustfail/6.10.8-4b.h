@@ -0,0 +1 @@
+#undef defined
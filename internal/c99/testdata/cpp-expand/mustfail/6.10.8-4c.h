@@ -0,0 +1 @@
+#define __DATE__ 1
@@ -0,0 +1 @@
+#define __FILE__ 1
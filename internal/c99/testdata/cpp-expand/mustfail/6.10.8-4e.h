@@ -0,0 +1 @@
+#define __LINE__ 1
@@ -0,0 +1 @@
+#define __STDC_VERSION__ 1
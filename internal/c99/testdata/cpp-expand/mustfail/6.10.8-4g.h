@@ -0,0 +1 @@
+#define __STDC__ 1
@@ -0,0 +1 @@
+#define __TIME__ 1
@@ -0,0 +1 @@
+#undef __DATE__
@@ -0,0 +1 @@
+#undef __FILE__
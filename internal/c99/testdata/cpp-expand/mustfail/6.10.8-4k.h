@@ -0,0 +1 @@
+#undef __LINE__
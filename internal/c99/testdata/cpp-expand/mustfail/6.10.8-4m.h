@@ -0,0 +1 @@
+#undef __STDC__
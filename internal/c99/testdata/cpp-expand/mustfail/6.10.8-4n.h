@@ -0,0 +1 @@
+#undef __TIME__
@@ -0,0 +1 @@
+_Pragma(x)
@@ -0,0 +1,15 @@
+#!/bin/sh
+# Regenerates the gcc -E corpus used by TestGCC. The tests do not need gcc.
+#
+# The system headers in include/ are empty, so the output depends only on
+# the sources and on the macros predefined by gcc -undef, which TestGCC
+# predefines as well.
+set -e
+cd "$(dirname "$0")"
+sqlite=../../../../_sqlite/sqlite-amalgamation-3210000
+cpp="gcc -E -P -undef -nostdinc -std=c99 -isystem include"
+$cpp $sqlite/sqlite3.h > sqlite3.h.gcc
+$cpp -I $sqlite $sqlite/shell.c > shell.c.gcc
+if [ -f $sqlite/sqlite3.c ]; then
+	$cpp -I $sqlite $sqlite/sqlite3.c > sqlite3.c.gcc
+fi
@@ -0,0 +1,47 @@
+// Scalars, arrays and structs, [0]6.7.8.
+
+_Bool b = 42;
+char c = 'x';
+signed char sc = -1;
+unsigned char uc = 257;
+short s = -2;
+unsigned short us = 0xfffe;
+int i = 1 + 2 * 3;
+unsigned u = -1;
+long l = -1L << 40;
+unsigned long ul = 0x0123456789abcdefUL;
+long long ll = -3;
+unsigned long long ull = 1ULL << 63;
+int tentative;
+int braced = { 7 };
+static int internal = 10;
+extern int external;
+int external = 11;
+int redeclared;
+int redeclared = 12;
+
+enum color { red, green = 5, blue };
+enum color col = blue;
+
+int a[4] = { 1, 2, 3 };
+int b2[] = { 1, 2, 3, 4, 5 };
+int m[2][3] = { { 1, 2, 3 }, { 4, 5, 6 } };
+int elided[2][3] = { 1, 2, 3, 4 };
+int partial[3][2] = { { 1 }, { 2 }, 3 };
+short empty[3] = { 0 };
+
+struct point {
+	int x, y;
+} origin, pt = { 3, 4 };
+
+struct rect {
+	struct point min, max;
+	char tag;
+	long area;
+} r1 = { { 1, 2 }, { 3, 4 }, 'r', 4 }, r2 = { 1, 2, 3, 4 }, r3[] = { 1, 2, 3, 4, 5, 6, 7, 8, 9, 10 };
+
+struct {
+	char c;
+	double d;
+	short s;
+} padded = { 'a', 1.5, 2 };
@@ -0,0 +1,35 @@
+// Bit-fields and unions, [0]6.7.2.1 and [0]6.7.8-17.
+
+struct bits {
+	unsigned a : 3;
+	int b : 5;
+	unsigned : 0;
+	unsigned c : 7;
+	int : 4;
+	int d : 12;
+	char e;
+} b1 = { 5, -3, 100, -1000, 'e' }, b2 = { .d = 7, .a = 1 }, b3 = { 15, 17, 255, 4096 };
+
+struct wide {
+	unsigned long long a : 40;
+	unsigned long long b : 24;
+	_Bool c : 1;
+} w1 = { 0xffffffffffULL, 0x123456, 1 };
+
+union u {
+	char c;
+	int i;
+	double d;
+};
+
+union u u1 = { 'x' };
+union u u2 = { .i = 0x11223344 };
+union u u3 = { .d = 2.5 };
+union u u4 = { .c = 1, .i = 2 };
+union u ua[] = { { 1 }, [2].d = 3 };
+
+struct hasunion {
+	int tag;
+	union u val;
+	int tail;
+} h1 = { 1, { 2 }, 3 }, h2 = { 1, 2, 3 }, h3 = { .val.i = 4, 5 };
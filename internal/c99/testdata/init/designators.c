@@ -0,0 +1,37 @@
+// Designated initializers, [0]6.7.8-6 to 6.7.8-7 and 6.7.8-17 to 6.7.8-19.
+
+int a[5] = { [2] = 2, 3, [0] = 1 };
+int b[] = { [9] = 9 };
+int c[] = { 1, 2, [1] = 20, 30, 40 };
+
+struct s {
+	int a, b, c;
+	struct {
+		int x, y;
+	} in;
+	int d[3];
+} s1 = { .c = 3, .a = 1, 2 }, s2 = { .in.y = 5, 6, .d[1] = 7, 8 }, s3 = { .in = { 1, 2 }, .d = { [2] = 9 } };
+
+struct s arr[] = { [1].in.x = 1, [0].b = 2, [1].d = { 3, 4 } };
+
+int grid[3][3] = { [1] = { 1, 2, 3 }, [2][1] = 5, [0][2] = 4, 6 };
+
+// [0]6.7.8-35 EXAMPLE 10
+struct {
+	int a[3], b;
+} w[] = { [0].a = { 1 }, [1].a[0] = 2 };
+
+// [0]6.7.8-36 EXAMPLE 11
+#define MAX 10
+int z[MAX] = { 1, 3, 5, 7, 9, [MAX - 5] = 8, 6, 4, 2, 0 };
+
+// [0]6.7.8-34 EXAMPLE 9
+enum { member_one, member_two };
+const char *nm[] = {
+	[member_two] = "member two",
+	[member_one] = "member one",
+};
+
+// Later initializers override earlier ones.
+int over[3] = { 1, 2, 3, [0] = 4, [1] = 5 };
+struct s over2 = { .in = { 1, 2 }, .in.x = 3 };
@@ -0,0 +1,23 @@
+// Floating and complex types, [0]6.3.1.4 and [0]6.3.1.5.
+
+float f = 1.5;
+float f2 = 1e40;
+double d = -0.1;
+double d2 = 1 / 3.0;
+double d3 = 7;
+long double ld = 1.25L;
+long double ld2 = -3;
+long double ld3 = 0.1;
+long double ld4 = 1e-310;
+int fi = 3.99;
+unsigned fu = 4e9;
+float fs[] = { 1, 2.5, -0.0 };
+float _Complex fc = 2;
+double _Complex dc = 3.5;
+long double _Complex ldc = -1;
+
+struct {
+	float f;
+	long double ld;
+	char c;
+} fld = { 1, 2, 3 };
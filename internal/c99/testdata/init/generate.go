@@ -0,0 +1,168 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build ignore
+// +build ignore
+
+// Generate writes to stdout the initializer table of the host used by
+// TestInitializer. It lists the size, the initial content and the relocations
+// of every object defined at file scope of the C sources given as arguments,
+// all as computed by a C compiler. The data are read from the sections,
+// symbols and relocations of the compiled sources.
+//
+// Usage, from internal/c99:
+//
+//	go run testdata/init/generate.go [-cc compiler] file.c...
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var oCC = flag.String("cc", "gcc", "C compiler")
+
+type reloc struct {
+	off    uint64 // In the section.
+	target string // Object or function name or quoted string literal.
+	addend int64
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	dir, err := ioutil.TempDir("", "init-")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	out, err := exec.Command(*oCC, "--version").Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	version := strings.SplitN(string(out), "\n", 2)[0]
+	fmt.Printf("# Generated by generate.go using %s on %s/%s. DO NOT EDIT.\n", version, runtime.GOOS, runtime.GOARCH)
+	for _, src := range flag.Args() {
+		generate(dir, src)
+	}
+}
+
+func generate(dir, src string) {
+	obj := filepath.Join(dir, "src.o")
+	// -fno-toplevel-reorder keeps unreferenced static objects.
+	if out, err := exec.Command(*oCC, "-w", "-std=c99", "-fno-common", "-fno-toplevel-reorder", "-c", "-o", obj, src).CombinedOutput(); err != nil {
+		log.Fatalf("%s\n%v", out, err)
+	}
+
+	f, err := elf.Open(obj)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if f.Class != elf.ELFCLASS64 {
+		log.Fatalf("%s: unsupported ELF class %v", obj, f.Class)
+	}
+
+	syms, err := f.Symbols()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	relocs := map[elf.SectionIndex][]reloc{}
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_RELA {
+			continue
+		}
+
+		b, err := s.Data()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for r := bytes.NewReader(b); r.Len() != 0; {
+			var x elf.Rela64
+			if err := binary.Read(r, f.ByteOrder, &x); err != nil {
+				log.Fatal(err)
+			}
+
+			target, addend := symbolize(f, syms, syms[elf.R_SYM64(x.Info)-1], x.Addend)
+			relocs[elf.SectionIndex(s.Info)] = append(relocs[elf.SectionIndex(s.Info)], reloc{x.Off, target, addend})
+		}
+	}
+
+	var objs []elf.Symbol
+	for _, v := range syms {
+		if elf.ST_TYPE(v.Info) == elf.STT_OBJECT && v.Section < elf.SHN_LORESERVE && v.Section != elf.SHN_UNDEF && !strings.Contains(v.Name, ".") {
+			objs = append(objs, v)
+		}
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Name < objs[j].Name })
+	for _, v := range objs {
+		s := f.Sections[v.Section]
+		b := make([]byte, v.Size)
+		if s.Type != elf.SHT_NOBITS {
+			if _, err := s.ReadAt(b, int64(v.Value)); err != nil {
+				log.Fatal(err)
+			}
+		}
+		fmt.Printf("object\t%s\t%s\t%d\t%x\n", src, v.Name, v.Size, b)
+		for _, r := range relocs[v.Section] {
+			if r.off >= v.Value && r.off < v.Value+v.Size {
+				fmt.Printf("reloc\t%s\t%s\t%d\t%s\t%d\n", src, v.Name, r.off-v.Value, r.target, r.addend)
+			}
+		}
+	}
+}
+
+// symbolize returns the object or function at the address of sym plus addend,
+// and the offset of the address in it, or the string literal at the address.
+func symbolize(f *elf.File, syms []elf.Symbol, sym elf.Symbol, addend int64) (string, int64) {
+	if sym.Section >= elf.SHN_LORESERVE || sym.Section == elf.SHN_UNDEF {
+		return sym.Name, addend
+	}
+
+	s := f.Sections[sym.Section]
+	off := sym.Value + uint64(addend)
+	if s.Flags&elf.SHF_STRINGS == 0 {
+		for _, v := range syms {
+			switch elf.ST_TYPE(v.Info) {
+			case elf.STT_OBJECT, elf.STT_FUNC:
+				if v.Section == sym.Section && off >= v.Value && (off < v.Value+v.Size || off == v.Value) {
+					return v.Name, int64(off - v.Value)
+				}
+			}
+		}
+	}
+
+	// String literals are unnamed and read-only.
+	if s.Flags&elf.SHF_WRITE == 0 && s.Flags&elf.SHF_EXECINSTR == 0 {
+		b, err := s.Data()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		b = b[off:]
+		return strconv.Quote(string(b[:bytes.IndexByte(b, 0)])), 0
+	}
+
+	log.Fatalf("no symbol at %s+%#x", s.Name, off)
+	panic("unreachable")
+}
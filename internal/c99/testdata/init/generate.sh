@@ -0,0 +1,6 @@
+#!/bin/sh
+# Regenerates the initializer table of the host architecture used by
+# TestInitializer. The tests do not need a C compiler.
+set -e
+cd "$(dirname "$0")/../.."
+go run testdata/init/generate.go testdata/init/*.c > testdata/init/$(go env GOARCH).txt
@@ -0,0 +1 @@
+int i = { [0] = 1 };
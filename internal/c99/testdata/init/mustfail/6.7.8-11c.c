@@ -0,0 +1 @@
+int *p = 1.5;
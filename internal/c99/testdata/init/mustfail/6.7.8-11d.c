@@ -0,0 +1 @@
+double d = (void *)0;
@@ -0,0 +1 @@
+char s[3] = L"ab";
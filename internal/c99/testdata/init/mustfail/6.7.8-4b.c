@@ -0,0 +1,5 @@
+int *f(void) {
+	int a;
+	static int *p = &a;
+	return p;
+}
@@ -0,0 +1 @@
+typedef int t = 1;
@@ -0,0 +1,3 @@
+void f(void) {
+	extern int x = 1;
+}
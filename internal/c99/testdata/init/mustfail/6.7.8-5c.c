@@ -0,0 +1 @@
+int f(void) = 0;
@@ -0,0 +1 @@
+int a[] = { [-1] = 1 };
@@ -0,0 +1,3 @@
+struct s {
+	int i;
+} x = { [0] = 1 };
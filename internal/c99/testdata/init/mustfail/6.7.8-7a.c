@@ -0,0 +1,3 @@
+struct s {
+	int a;
+} x = { .b = 1 };
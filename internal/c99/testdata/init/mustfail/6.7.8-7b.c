@@ -0,0 +1 @@
+int a[2] = { .a = 1 };
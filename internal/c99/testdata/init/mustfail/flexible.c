@@ -0,0 +1,4 @@
+struct f {
+	int n;
+	int a[];
+} x = { 1, { 2 } };
@@ -0,0 +1,2 @@
+struct t;
+struct t x = { 1 };
@@ -0,0 +1,42 @@
+// Address constants, [0]6.6-9.
+
+int x, y[10];
+static int sx = 1;
+int *px = &x;
+int *py = y;
+int *py3 = &y[3];
+int *py4 = y + 4;
+int *py5 = 5 + y;
+int *py6 = &y[8] - 2;
+int *psx = &sx;
+void *vp = &y[1];
+char *cp = (char *)&y[2] + 1;
+long addr = (long)&x;
+unsigned long uaddr = (unsigned long)(y + 1);
+_Bool bp = &x;
+int *null = 0;
+void *null2 = (void *)0;
+int *fixed = (int *)0x1000;
+long diff = &y[7] - &y[2];
+
+struct node {
+	int v;
+	struct node *next;
+	int a[3];
+} n2, n1 = { 1, &n2 }, list[3] = { { 1, &list[1] }, { 2, &list[2] }, { 3, 0 } };
+
+int *pa = &n1.a[2];
+int *pa2 = n1.a + 1;
+int *pv = &list[2].v;
+int *parrow = &(&list[1])->v;
+int *pderef = &*&x;
+struct node *self = &n1;
+
+int f(int);
+int (*fp)(int) = f;
+int (*fp2)(int) = &f;
+int (*fps[])(int) = { f, 0, &f };
+
+int **ppx = &px;
+const char *strs[] = { "a", "b" };
+const char **pstr = &strs[1];
@@ -0,0 +1,25 @@
+// Character arrays and string literals, [0]6.7.8-14 and 6.4.5.
+
+char s1[] = "abc";
+char s2[5] = "abc";
+char s3[3] = "abc";
+char s4[] = { "braced" };
+char s5[] = ("parenthesized");
+unsigned char s6[] = "\xff\001";
+signed char s7[4] = "x";
+char s8[2][4] = { "ab", "cde" };
+char s9[][3] = { "a", { 'b', 'c' }, "de" };
+int w1[] = L"wide";
+int w2[3] = L"\x1234x";
+char concat[] = "con" "cat";
+
+struct msg {
+	int n;
+	char text[8];
+	const char *p;
+} m1 = { 1, "hello", "world" }, m2[] = { 2, "a", "b", 3, { "c" }, "d" };
+
+const char *p = "pointer";
+const char *p2 = "pointer" + 3;
+const char *pp[] = { "x", "yy", 0, "zzz" };
+char *q = &"abc"[1];
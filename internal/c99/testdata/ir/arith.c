@@ -0,0 +1,143 @@
+// Integer and floating point arithmetic, conversions and side effects.
+
+#define CHECK(x) if (++check, !(x)) return check
+
+int check;
+
+int i = 42;
+unsigned u = 7;
+long long ll = -5;
+double d = 2.5;
+float f = 1.25f;
+_Bool b;
+char c = 'a';
+signed char sc = -3;
+unsigned short us = 65535;
+
+int add(int a, int b) { return a + b; }
+
+double half(double x) { return x / 2; }
+
+int main() {
+	CHECK(i + 1 == 43);
+	CHECK(i - 50 == -8);
+	CHECK(i * 3 == 126);
+	CHECK(i / 5 == 8);
+	CHECK(i % 5 == 2);
+	CHECK(-i / 5 == -8);
+	CHECK(-i % 5 == -2);
+	CHECK((i & 15) == 10);
+	CHECK((i | 1) == 43);
+	CHECK((i ^ 2) == 40);
+	CHECK(~i == -43);
+	CHECK(!i == 0);
+	CHECK(!!i == 1);
+	CHECK(-i == -42);
+	CHECK(+i == 42);
+	CHECK(i << 2 == 168);
+	CHECK(i >> 1 == 21);
+	CHECK(-16 >> 2 == -4);
+	CHECK(u - 8 == 4294967295u);
+	CHECK((u - 8) >> 28 == 15);
+	CHECK(u / 2 == 3);
+	CHECK(ll * ll == 25);
+	CHECK(ll < 0);
+	CHECK(ll < u == 1);
+	CHECK(-1 < u == 0);
+	CHECK(us + 1 == 65536);
+	CHECK((unsigned short)(us + 1) == 0);
+	CHECK(sc * sc == 9);
+	CHECK((unsigned char)sc == 253);
+	CHECK(c + 1 == 'b');
+	CHECK(d * 2 == 5);
+	CHECK(f + d == 3.75);
+	CHECK((int)d == 2);
+	CHECK((int)-d == -2);
+	CHECK((double)i / 4 == 10.5);
+	CHECK(half(i) == 21);
+	CHECK(half(3) == 1.5);
+	CHECK(add(i, 8) == 50);
+	CHECK(add(d, f) == 3);
+	CHECK(1e10 > i);
+	CHECK((long long)1e10 == 10000000000LL);
+	CHECK((unsigned)-1.0 != 0 || 1);
+
+	b = 42;
+	CHECK(b == 1);
+	b = 0.5;
+	CHECK(b == 1);
+	b = 0;
+	CHECK(b == 0);
+	b++;
+	CHECK(b == 1);
+	b++;
+	CHECK(b == 1);
+	b--;
+	CHECK(b == 0);
+
+	int x = 10, y;
+	y = x++;
+	CHECK(x == 11 && y == 10);
+	y = ++x;
+	CHECK(x == 12 && y == 12);
+	y = x--;
+	CHECK(x == 11 && y == 12);
+	y = --x;
+	CHECK(x == 10 && y == 10);
+	x += 5;
+	CHECK(x == 15);
+	x -= 3;
+	CHECK(x == 12);
+	x *= 2;
+	CHECK(x == 24);
+	x /= 5;
+	CHECK(x == 4);
+	x %= 3;
+	CHECK(x == 1);
+	x <<= 4;
+	CHECK(x == 16);
+	x >>= 2;
+	CHECK(x == 4);
+	x |= 3;
+	CHECK(x == 7);
+	x &= 5;
+	CHECK(x == 5);
+	x ^= 1;
+	CHECK(x == 4);
+	CHECK((x = 9) == 9);
+	CHECK((x += 1) == 10);
+
+	char ch = 100;
+	ch += 100;
+	CHECK(ch == (char)200);
+	unsigned char uc = 250;
+	uc += 10;
+	CHECK(uc == 4);
+	double dd = 1;
+	dd += 0.5;
+	CHECK(dd == 1.5);
+	dd++;
+	CHECK(dd == 2.5);
+	dd *= i;
+	CHECK(dd == 105);
+	int k = 7;
+	k *= 1.5;
+	CHECK(k == 10);
+
+	y = (x = 1, x + 1);
+	CHECK(y == 2);
+	y = x ? 5 : 6;
+	CHECK(y == 5);
+	y = !x ? 5 : 6;
+	CHECK(y == 6);
+	d = x ? 1 : 0.5;
+	CHECK(d == 1);
+	x = 0;
+	CHECK((x && ++y) == 0 && y == 6);
+	CHECK((x || ++y) == 1 && y == 7);
+	CHECK((1 || ++y) == 1 && y == 7);
+	CHECK((i > 1 && i < 100) == 1);
+	x ? (void)0 : (void)++y;
+	CHECK(y == 8);
+	return 0;
+}
@@ -0,0 +1,163 @@
+// Statements: loops, switch, goto, break, continue and recursion.
+
+#define CHECK(x) if (++check, !(x)) return check
+
+int check;
+
+int fib(int n) { return n < 2 ? n : fib(n - 1) + fib(n - 2); }
+
+int classify(int n) {
+	switch (n) {
+	case 0:
+		return 10;
+	case 1:
+	case 2:
+		return 20;
+	case -1:
+		n = 5;
+		// fallthrough
+	case 3:
+		return 30 + n;
+	default:
+		return 40;
+	case 100:
+		break;
+	}
+	return 50;
+}
+
+int nested(unsigned char c, int m) {
+	int r = 0;
+	switch (c) {
+	case 'a':
+		switch (m) {
+		case 1:
+			r = 1;
+			break;
+		default:
+			r = 2;
+		}
+		r += 10;
+		break;
+	case 255:
+		r = 3;
+		break;
+	}
+	return r;
+}
+
+long long lswitch(long long v) {
+	switch (v) {
+	case 10000000000LL:
+		return 1;
+	case -1:
+		return 2;
+	}
+	return 3;
+}
+
+void count(int *p) { ++*p; }
+
+int main() {
+	int i, j, s;
+
+	for (i = s = 0; i < 10; i++)
+		s += i;
+	CHECK(s == 45);
+
+	s = 0;
+	for (int k = 0; k < 5; k++) {
+		if (k == 1)
+			continue;
+
+		if (k == 4)
+			break;
+
+		s += k;
+	}
+	CHECK(s == 5);
+
+	s = 0;
+	for (;;) {
+		if (++s == 7)
+			break;
+	}
+	CHECK(s == 7);
+
+	i = 0;
+	while (i < 100)
+		i += 7;
+	CHECK(i == 105);
+
+	i = 0;
+	do {
+		i++;
+		if (i == 2)
+			continue;
+	} while (i < 5);
+	CHECK(i == 5);
+
+	i = 10;
+	do
+		i++;
+	while (0);
+	CHECK(i == 11);
+
+	s = 0;
+	for (i = 0; i < 4; i++)
+		for (j = 0; j < 4; j++) {
+			if (j > i)
+				break;
+
+			s++;
+		}
+	CHECK(s == 10);
+
+	CHECK(fib(15) == 610);
+	CHECK(classify(0) == 10);
+	CHECK(classify(1) == 20);
+	CHECK(classify(2) == 20);
+	CHECK(classify(3) == 33);
+	CHECK(classify(-1) == 35);
+	CHECK(classify(4) == 40);
+	CHECK(classify(100) == 50);
+	CHECK(nested('a', 1) == 11);
+	CHECK(nested('a', 2) == 12);
+	CHECK(nested(255, 2) == 3);
+	CHECK(nested(-1, 2) == 3);
+	CHECK(nested('b', 2) == 0);
+	CHECK(lswitch(10000000000LL) == 1);
+	CHECK(lswitch(-1) == 2);
+	CHECK(lswitch(1410065408) == 3);
+
+	i = 0;
+again:
+	if (++i < 3)
+		goto again;
+	CHECK(i == 3);
+	goto skip;
+	i = 100;
+skip:
+	CHECK(i == 3);
+
+	s = 0;
+	for (i = 0; i < 3; i++)
+		count(&s);
+	CHECK(s == 3);
+
+	if (s == 3)
+		s = 1;
+	else
+		s = 2;
+	CHECK(s == 1);
+	if (s != 1)
+		s = 3;
+	else if (s == 1)
+		s = 4;
+	CHECK(s == 4);
+	if (0)
+		return 1;
+
+	while (0)
+		return 2;
+}
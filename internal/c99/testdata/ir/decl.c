@@ -0,0 +1,57 @@
+// Declarations: forward references, static and block scope externs,
+// designated initializers and variadic definitions.
+
+#define CHECK(x) if (++check, !(x)) return check
+
+int check;
+
+int g = 3;
+int later(int);
+
+struct ops {
+	int (*f)(int);
+	int k;
+};
+
+static struct ops table[] = {{later, 1}, {0, 2}};
+
+int later(int x) { return x + g; }
+
+int first(int n, ...) { return n; }
+
+char *p2 = (char *)&g + 1;
+
+int main() {
+	extern int g;
+	static char s[] = "abc";
+	static int *pg = &g;
+	int n = 2;
+
+	CHECK(table[0].f(1) == 4);
+	CHECK(*pg == 3);
+	CHECK(s[2] == 'c');
+	CHECK(first(3, 1.0, 2) == 3);
+	CHECK(p2 - (char *)&g == 1);
+	switch ((char)n) {
+	case 2:
+		n = 7;
+	}
+	CHECK(n == 7);
+	{
+		int n = 1;
+		CHECK(n == 1);
+	}
+	CHECK(n == 7);
+
+	unsigned char uc = 200;
+	CHECK(uc << 1 == 400);
+	long l = -1;
+	CHECK((unsigned long)l >> (8 * sizeof l - 1) == 1);
+	int a[3] = {[2] = 5, [0] = 1};
+	CHECK(a[0] + a[1] + a[2] == 6);
+	struct ops o = {.k = 9};
+	CHECK(!o.f && o.k == 9);
+	o = table[1];
+	CHECK(o.k == 2);
+	return 0;
+}
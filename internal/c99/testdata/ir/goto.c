@@ -0,0 +1,350 @@
+// Goto: the control flow of sqlite3VdbeExec, sqlite3AtoF and friends,
+// including jumps into blocks, loops and switch cases.
+
+#define CHECK(x) if (++check, !(x)) return check
+
+int check;
+
+enum {
+	OP_Goto,
+	OP_Gosub,
+	OP_Return,
+	OP_Integer,
+	OP_Add,
+	OP_If,
+	OP_IfNot,
+	OP_Column,
+	OP_Next,
+	OP_Halt,
+	OP_NoMem,
+	OP_TooBig,
+};
+
+enum {
+	SQLITE_OK,
+	SQLITE_ERROR,
+	SQLITE_INTERRUPT = 9,
+	SQLITE_TOOBIG = 18,
+	SQLITE_NOMEM = 7,
+	SQLITE_DONE = 101,
+};
+
+typedef struct Op {
+	unsigned char opcode;
+	int p1, p2, p3;
+} Op;
+
+typedef struct Vdbe {
+	Op *aOp;
+	long long aMem[8];
+	int pc;
+	int nStep;
+	int interrupted;
+	int nHdrParsed;
+	int errors;
+} Vdbe;
+
+// vdbeExec is sqlite3VdbeExec with the opcodes reduced to their control flow.
+int vdbeExec(Vdbe *p) {
+	Op *aOp = p->aOp;
+	Op *pOp;
+	long long *aMem = p->aMem;
+	int rc = SQLITE_OK;
+
+	for (pOp = &aOp[p->pc]; 1; pOp++) {
+		if (++p->nStep > 1000)
+			goto abort_due_to_interrupt;
+
+		switch (pOp->opcode) {
+		case OP_Goto: {
+		jump_to_p2_and_check_for_interrupt:
+			pOp = &aOp[pOp->p2 - 1];
+		check_for_interrupt:
+			if (p->interrupted)
+				goto abort_due_to_interrupt;
+			break;
+		}
+		case OP_Gosub: {
+			aMem[pOp->p1] = pOp - aOp;
+			goto jump_to_p2_and_check_for_interrupt;
+		}
+		case OP_Return: {
+			pOp = &aOp[aMem[pOp->p1]];
+			break;
+		}
+		case OP_Integer: {
+			aMem[pOp->p2] = pOp->p1;
+			break;
+		}
+		case OP_Add: {
+			long long a = aMem[pOp->p1], b = aMem[pOp->p2];
+			if (a > 0 && b > 0x7fffffffffffffffLL - a)
+				goto too_big;
+			aMem[pOp->p3] = a + b;
+			break;
+		}
+		case OP_If:
+		case OP_IfNot: {
+			int c = aMem[pOp->p1] != 0;
+			if (pOp->opcode == OP_IfNot)
+				c = !c;
+			if (c)
+				goto jump_to_p2;
+			break;
+		}
+		case OP_Column: {
+			int i;
+			if (p->nHdrParsed < 0) {
+				p->nHdrParsed = 0;
+				goto op_column_read_header;
+			}
+
+			if (p->nHdrParsed <= pOp->p2) {
+				aMem[pOp->p3] = -1;
+				if (pOp->p1) {
+				op_column_read_header:
+					i = p->nHdrParsed;
+					do {
+						aMem[pOp->p3] += i;
+					} while (++i <= pOp->p2);
+					p->nHdrParsed = i;
+				}
+				goto op_column_out;
+			}
+
+			aMem[pOp->p3] = 100;
+		op_column_out:
+			break;
+		}
+		case OP_Next: {
+			if (--aMem[pOp->p1] > 0)
+				goto jump_to_p2_and_check_for_interrupt;
+			goto check_for_interrupt;
+		}
+		case OP_Halt: {
+			rc = pOp->p1;
+			goto vdbe_return;
+		}
+		case OP_NoMem:
+			goto no_mem;
+		case OP_TooBig:
+			goto too_big;
+		default:
+			rc = SQLITE_ERROR;
+			goto abort_due_to_error;
+		}
+		continue;
+
+	jump_to_p2:
+		pOp = &aOp[pOp->p2 - 1];
+	}
+
+abort_due_to_error:
+	p->errors++;
+	if (rc == SQLITE_OK)
+		rc = SQLITE_ERROR;
+
+vdbe_return:
+	p->pc = pOp - aOp;
+	return rc;
+
+too_big:
+	rc = SQLITE_TOOBIG;
+	goto abort_due_to_error;
+
+no_mem:
+	rc = SQLITE_NOMEM;
+	goto abort_due_to_error;
+
+abort_due_to_interrupt:
+	rc = SQLITE_INTERRUPT;
+	goto abort_due_to_error;
+}
+
+// run executes the program aOp from its start.
+int run(Vdbe *p, Op *aOp) {
+	int i;
+	for (i = 0; i < 8; i++)
+		p->aMem[i] = 0;
+	p->aOp = aOp;
+	p->pc = 0;
+	p->nStep = 0;
+	p->interrupted = 0;
+	p->errors = 0;
+	return vdbeExec(p);
+}
+
+// parseFloat is the skeleton of sqlite3AtoF: nested loops leaving to a shared
+// tail.
+double parseFloat(const char *z, int *pDigits) {
+	int sign = 1;
+	long long s = 0;
+	int d = 0, e = 0;
+	double r;
+
+	if (*z == '-') {
+		sign = -1;
+		z++;
+	}
+	while (*z >= '0' && *z <= '9') {
+		s = s * 10 + *z++ - '0';
+		d++;
+		if (d > 18)
+			goto do_atof_calc;
+	}
+	if (*z == '.') {
+		z++;
+		while (*z >= '0' && *z <= '9') {
+			if (d > 18)
+				goto do_atof_calc;
+			s = s * 10 + *z++ - '0';
+			d++;
+			e--;
+		}
+	}
+
+do_atof_calc:
+	*pDigits = d;
+	r = s;
+	while (e++ < 0)
+		r /= 10;
+	return sign * r;
+}
+
+// skip jumps into the scope of a variable, bypassing its initializer, and into
+// the body of a loop.
+int skip(int n) {
+	int r = 0;
+	if (n > 0)
+		goto in_block;
+
+	{
+		int x = 100;
+		r += x;
+	in_block:
+		x = 1;
+		r += x;
+	}
+
+	if (n > 1)
+		goto in_loop;
+
+	for (n = 0; n < 3; n++) {
+		r += 10;
+	in_loop:
+		r += 1000;
+	}
+	return r;
+}
+
+// copy is Duff's device, a switch jumping into a do-while loop.
+void copy(char *to, const char *from, int count) {
+	int n = (count + 3) / 4;
+	switch (count % 4) {
+	case 0:
+		do {
+			*to++ = *from++;
+		case 3:
+			*to++ = *from++;
+		case 2:
+			*to++ = *from++;
+		case 1:
+			*to++ = *from++;
+		} while (--n > 0);
+	}
+}
+
+// retry is the retry loop of sqlite3LockAndPrepare written with a backward
+// goto.
+int retry(int *attempts) {
+	int rc;
+	int cnt = 0;
+again:
+	rc = --*attempts > 0 ? SQLITE_ERROR : SQLITE_OK;
+	if (rc != SQLITE_OK && cnt++ < 5)
+		goto again;
+	return cnt;
+}
+
+int main() {
+	Vdbe v;
+	int d, n, i;
+	char buf[8];
+
+	// r1 = 5; r3 = 3; do r2 += r3; while (--r1 > 0);
+	Op loop[] = {
+		{OP_Integer, 5, 1},
+		{OP_Integer, 3, 3},
+		{OP_Add, 2, 3, 2},
+		{OP_Next, 1, 2},
+		{OP_Halt, SQLITE_DONE},
+	};
+	CHECK(run(&v, loop) == SQLITE_DONE);
+	CHECK(v.aMem[2] == 15 && v.aMem[1] == 0 && v.pc == 4 && v.errors == 0);
+
+	Op gosub[] = {
+		{OP_Gosub, 7, 4},
+		{OP_Gosub, 7, 4},
+		{OP_IfNot, 2, 6},
+		{OP_Goto, 0, 7},
+		{OP_Integer, 1, 2},
+		{OP_Return, 7},
+		{OP_Halt, SQLITE_ERROR},
+		{OP_Halt, SQLITE_OK},
+	};
+	CHECK(run(&v, gosub) == SQLITE_OK);
+	CHECK(v.pc == 7 && v.aMem[2] == 1 && v.errors == 0);
+
+	Op big[] = {
+		{OP_Integer, 0x7fffffff, 1},
+		{OP_Add, 1, 1, 1},
+		{OP_If, 1, 1},
+	};
+	CHECK(run(&v, big) == SQLITE_TOOBIG);
+	CHECK(v.pc == 1 && v.errors == 1);
+
+	Op nomem[] = {{OP_NoMem}};
+	CHECK(run(&v, nomem) == SQLITE_NOMEM && v.errors == 1);
+
+	Op spin[] = {{OP_Goto, 0, 0}};
+	CHECK(run(&v, spin) == SQLITE_INTERRUPT && v.nStep == 1001);
+
+	Op bad[] = {{99}};
+	CHECK(run(&v, bad) == SQLITE_ERROR && v.errors == 1 && v.pc == 0);
+
+	Op column[] = {
+		{OP_Column, 1, 3, 4},
+		{OP_Column, 0, 5, 5},
+		{OP_Column, 0, 1, 6},
+		{OP_Halt},
+	};
+	v.nHdrParsed = -1;
+	for (i = 0; i < 8; i++)
+		v.aMem[i] = 0;
+	v.aOp = column;
+	v.pc = 0;
+	v.nStep = 0;
+	CHECK(vdbeExec(&v) == SQLITE_OK);
+	CHECK(v.aMem[4] == 6 && v.aMem[5] == -1 && v.aMem[6] == 100 && v.nHdrParsed == 4);
+
+	CHECK(parseFloat("-12.5", &d) == -12.5 && d == 3);
+	CHECK(parseFloat("1234567890123456789012", &d) == 1234567890123456789.0 && d == 19);
+	CHECK(parseFloat("0.1234567890123456789", &d) > 0.1234 && d == 19);
+
+	CHECK(skip(0) == 3131);
+	CHECK(skip(1) == 3031);
+	CHECK(skip(2) == 1001);
+
+	for (i = 0; i < 8; i++) {
+		buf[0] = 0;
+		copy(buf, "abcdefg", i);
+		buf[i] = 0;
+		for (n = 0; n < i; n++)
+			CHECK(buf[n] == "abcdefg"[n]);
+	}
+
+	n = 3;
+	CHECK(retry(&n) == 2 && n == 0);
+	n = 100;
+	CHECK(retry(&n) == 6);
+}
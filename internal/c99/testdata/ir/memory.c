@@ -0,0 +1,193 @@
+// Objects: arrays, pointers, structs, unions, bit-fields, strings, static
+// storage and function pointers.
+
+#define CHECK(x) if (++check, !(x)) return check
+
+int check;
+
+typedef unsigned long size_t;
+
+int strcmp(const char *, const char *);
+size_t strlen(const char *);
+void *memset(void *, int, size_t);
+void *memcpy(void *, const void *, size_t);
+
+struct point {
+	int x, y;
+};
+
+struct node {
+	struct node *next;
+	int value;
+	char name[6];
+};
+
+struct flags {
+	unsigned a : 3;
+	int b : 5;
+	unsigned c : 1;
+	char d;
+	long long e : 40;
+};
+
+union word {
+	unsigned u;
+	unsigned char b[4];
+	float f;
+};
+
+int a[5] = {1, 2, 3};
+int *pa = &a[2];
+char s[] = "hello";
+char *ps = "world";
+const char *names[] = {"zero", "one", "two"};
+struct point pt = {3, 4};
+struct point *ppt = &pt;
+struct node n2 = {0, 2, "two"}, n1 = {&n2, 1, "one"};
+int (*fp)(int);
+int tentative[];
+
+int twice(int x) { return 2 * x; }
+
+int thrice(int x) { return 3 * x; }
+
+int apply(int (*f)(int), int v) { return f(v); }
+
+int counter(void) {
+	static int n;
+	return ++n;
+}
+
+int sum(int *p, int n) {
+	int s = 0;
+	while (n--)
+		s += *p++;
+	return s;
+}
+
+struct point mid(struct point a, struct point b) {
+	struct point r;
+	r.x = (a.x + b.x) / 2;
+	r.y = (a.y + b.y) / 2;
+	return r;
+}
+
+int main() {
+	CHECK(a[0] == 1 && a[2] == 3 && a[4] == 0);
+	CHECK(*pa == 3);
+	CHECK(pa[-1] == 2);
+	CHECK(*(pa + 1) == 0);
+	CHECK(1[pa] == 0);
+	CHECK(pa - a == 2);
+	CHECK(&a[4] - pa == 2);
+	CHECK(pa > a);
+	CHECK(sum(a, 5) == 6);
+	CHECK(sizeof a == 20);
+	CHECK(strlen(s) == 5);
+	CHECK(sizeof s == 6);
+	CHECK(strcmp(ps, "world") == 0);
+	CHECK(strcmp(names[2], "two") == 0);
+	CHECK(names[1][1] == 'n');
+	CHECK(*ps == 'w');
+	CHECK("abc"[1] == 'b');
+	CHECK(pt.x == 3 && ppt->y == 4);
+	CHECK(n1.next == &n2 && n1.next->value == 2);
+	CHECK(strcmp(n1.next->name, "two") == 0);
+	CHECK(n1.next->next == 0);
+	CHECK(tentative[0] == 0);
+
+	int *p = a;
+	p += 3;
+	*p = 9;
+	CHECK(a[3] == 9);
+	p--;
+	CHECK(*p-- == 3);
+	CHECK(*++p == 3);
+	*p++ += 10;
+	CHECK(a[2] == 13 && p == &a[3]);
+	char *cp = (char *)p;
+	cp += sizeof(int);
+	CHECK((int *)cp == &a[4]);
+	void *vp = a;
+	CHECK(*(int *)vp == 1);
+
+	int m[3][4];
+	for (int i = 0; i < 3; i++)
+		for (int j = 0; j < 4; j++)
+			m[i][j] = 10 * i + j;
+	CHECK(m[2][3] == 23);
+	CHECK(*(*(m + 1) + 2) == 12);
+	int (*row)[4] = m + 1;
+	CHECK(row[1][0] == 20);
+
+	struct point q = pt, r;
+	q.x++;
+	CHECK(q.x == 4 && pt.x == 3);
+	r = mid(q, (struct point){10, 20});
+	CHECK(r.x == 7 && r.y == 12);
+	CHECK(mid(q, q).y == 4);
+	struct point *pp = &r;
+	pp->y *= 2;
+	CHECK(r.y == 24);
+	struct point arr[2] = {{1, 2}, {3, 4}};
+	CHECK(arr[1].y == 4);
+	arr[0] = arr[1];
+	CHECK(arr[0].x == 3);
+	CHECK((&arr[1])->x == 3);
+
+	struct node local = {&n1, 7, "seven"};
+	CHECK(local.next->next->value == 2);
+	CHECK(local.name[4] == 'n' && local.name[5] == 0);
+	char buf[8] = "ab";
+	CHECK(buf[1] == 'b' && buf[2] == 0 && buf[7] == 0);
+	char exact[3] = "xyz";
+	CHECK(exact[2] == 'z');
+	int zeros[4] = {0};
+	CHECK(zeros[3] == 0);
+	memset(zeros, 1, sizeof zeros);
+	CHECK(zeros[2] == 0x01010101);
+	memcpy(buf, "hello", 6);
+	CHECK(strcmp(buf, "hello") == 0);
+
+	struct flags fl = {5, -3, 1, 'x', -2};
+	CHECK(fl.a == 5 && fl.b == -3 && fl.c == 1 && fl.d == 'x' && fl.e == -2);
+	fl.a = 9;
+	CHECK(fl.a == 1);
+	fl.b = 15;
+	CHECK(fl.b == 15);
+	fl.b++;
+	CHECK(fl.b == -16);
+	fl.b += 3;
+	CHECK(fl.b == -13);
+	CHECK(fl.a++ == 1 && fl.a == 2);
+	fl.c = 0;
+	CHECK(fl.a == 2 && fl.b == -13 && fl.c == 0 && fl.d == 'x');
+	fl.e = 1LL << 38;
+	CHECK(fl.e == 1LL << 38);
+	struct flags *pf = &fl;
+	pf->a = 7;
+	CHECK(pf->a + 1 == 8);
+
+	union word w;
+	w.u = 0x01020304;
+	CHECK(w.b[0] == 4 && w.b[3] == 1);
+	w.f = 1;
+	CHECK(w.u == 0x3f800000);
+
+	fp = twice;
+	CHECK(fp(4) == 8);
+	CHECK((*fp)(5) == 10);
+	fp = &thrice;
+	CHECK(fp(4) == 12);
+	CHECK(apply(twice, 21) == 42);
+	int (*fps[2])(int) = {twice, thrice};
+	CHECK(fps[1](2) == 6);
+
+	CHECK(counter() == 1);
+	CHECK(counter() == 2);
+
+	int *cl = (int[]){5, 6, 7};
+	CHECK(cl[2] == 7);
+	CHECK(((struct point){.y = 9}).y == 9);
+	return 0;
+}
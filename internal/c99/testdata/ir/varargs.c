@@ -0,0 +1,156 @@
+// Variadic functions: every promoted argument type, va_copy, passing a va_list
+// on, nested calls, calls through a pointer and recursion.
+
+#define CHECK(x) if (++check, !(x)) return check
+
+typedef __builtin_va_list va_list;
+#define va_start(ap, last) __builtin_va_start(ap, last)
+#define va_arg(ap, type) __builtin_va_arg(ap, type)
+#define va_copy(dest, src) __builtin_va_copy(dest, src)
+#define va_end(ap) __builtin_va_end(ap)
+
+int check;
+
+typedef int (*fn)(int);
+
+struct s {
+	int i;
+	char c;
+};
+
+int twice(int n) { return 2 * n; }
+
+// Each character of types selects the type of the corresponding argument.
+// Sum returns the sum of the arguments converted to double, the pointers and
+// function pointers are dereferenced or called.
+double sum(const char *types, ...) {
+	va_list ap;
+	double r = 0;
+	va_start(ap, types);
+	for (; *types; types++) {
+		switch (*types) {
+		case 'i':
+			r += va_arg(ap, int);
+			break;
+		case 'u':
+			r += va_arg(ap, unsigned);
+			break;
+		case 'l':
+			r += va_arg(ap, long);
+			break;
+		case 'L':
+			r += va_arg(ap, unsigned long);
+			break;
+		case 'q':
+			r += va_arg(ap, long long);
+			break;
+		case 'Q':
+			r += va_arg(ap, unsigned long long);
+			break;
+		case 'd':
+			r += va_arg(ap, double);
+			break;
+		case 'p':
+			r += *va_arg(ap, int *);
+			break;
+		case 's':
+			r += va_arg(ap, struct s *)->c;
+			break;
+		case 'f':
+			r += va_arg(ap, fn)(10);
+			break;
+		}
+	}
+	va_end(ap);
+	return r;
+}
+
+int vcount(int n, va_list ap) {
+	int r = 0;
+	while (n--)
+		r += va_arg(ap, int);
+	return r;
+}
+
+// count returns the sum of its n int arguments computed twice, once using a
+// copy of its va_list.
+int count(int n, ...) {
+	va_list ap, ap2;
+	int r;
+	va_start(ap, n);
+	va_copy(ap2, ap);
+	r = vcount(n, ap);
+	r += vcount(n, ap2);
+	va_end(ap2);
+	va_end(ap);
+	return r;
+}
+
+// depth returns the sum of its int argument and those of its n recursive
+// calls.
+int depth(int n, ...) {
+	va_list ap;
+	int a;
+	va_start(ap, n);
+	a = va_arg(ap, int);
+	va_end(ap);
+	return n ? a + depth(n - 1, a + 1) : a;
+}
+
+long long ints(int n, ...) {
+	va_list ap;
+	va_start(ap, n);
+	long long r = 0;
+	switch (n) {
+	case 0:
+		r = va_arg(ap, int);
+		break;
+	case 1:
+		r = va_arg(ap, unsigned);
+		break;
+	case 2:
+		r = va_arg(ap, long);
+		break;
+	case 3:
+		r = va_arg(ap, unsigned long long);
+		break;
+	}
+	va_end(ap);
+	return r;
+}
+
+int main() {
+	char c = -3;
+	unsigned char uc = 250;
+	short sh = -300;
+	unsigned short us = 65000;
+	_Bool b = 1;
+	float f = 1.5;
+	int i = 7;
+	struct s st = {1, 11};
+	int (*pcount)(int, ...) = count;
+
+	CHECK(sum("") == 0);
+	CHECK(sum("i", 42) == 42);
+	CHECK(sum("iiiii", c, uc, sh, us, b) == -3 + 250 - 300 + 65000 + 1);
+	CHECK(sum("u", 4000000000u) == 4000000000.0);
+	CHECK(sum("lL", -5000000000L, 5000000001UL) == 1);
+	CHECK(sum("qQ", -1LL, 18446744073709551615ULL) == 18446744073709551615.0 - 1);
+	CHECK(sum("dd", f, 0.25) == 1.75);
+	CHECK(sum("ps", &i, &st) == 18);
+	CHECK(sum("f", twice) == 20);
+	CHECK(sum("idlpf", 1, 2.5, 3L, &i, twice) == 33.5);
+
+	CHECK(count(0) == 0);
+	CHECK(count(3, 1, 2, 3) == 12);
+	CHECK(pcount(2, 5, 6) == 22);
+	CHECK(count(2, count(1, 4), sum("i", 1) > 0) == 18);
+	CHECK(count(1, i++) == 14 && i == 8);
+	CHECK(depth(0, 9) == 9);
+	CHECK(depth(3, 1) == 10);
+
+	CHECK(ints(0, -1) == -1);
+	CHECK(ints(1, -1) == 4294967295LL);
+	CHECK(ints(2, -1L) == -1);
+	CHECK(ints(3, -1LL) == -1);
+}
@@ -0,0 +1,57 @@
+// Members are aligned to their type, the size is rounded up to the alignment
+// of the struct.
+
+struct s1 {
+	char c;
+	int i;
+	char d;
+};
+
+struct s2 {
+	char c;
+	short s;
+	char a[3];
+	long l;
+};
+
+struct s3 {
+	struct s1 s;
+	char c;
+	struct s2 *p;
+	int (*f)(int);
+	int a[2][3];
+};
+
+struct list {
+	struct list *next;
+	struct item *item;
+	unsigned char tag;
+};
+
+struct item {
+	enum { red, green } color;
+	char name[5];
+};
+
+union u1 {
+	char c;
+	int i;
+	char a[7];
+	struct item it;
+};
+
+struct s4 {
+	char c;
+	union {
+		short s;
+		long long ll;
+	} u;
+	struct {
+		char a, b;
+	} in;
+};
+
+struct s5 {
+	char a[sizeof(struct s1)];
+	char b[sizeof(union u1) + 1];
+};
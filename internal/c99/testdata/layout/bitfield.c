@@ -0,0 +1,66 @@
+// Bit-fields are allocated at the next available bit unless they would
+// straddle a boundary of the alignment of their type.
+
+struct b1 {
+	char c;
+	int :4;
+};
+
+struct b2 {
+	char c;
+	int :0;
+	char d;
+};
+
+struct b3 {
+	char c;
+	int a:4;
+};
+
+struct b4 {
+	char c;
+	long long a:40;
+	long long b:30;
+};
+
+struct b5 {
+	char c;
+	long long :0;
+	char d;
+};
+
+struct b6 {
+	char c;
+	char a:7;
+	char b:3;
+};
+
+struct b7 {
+	char c;
+	short s:12;
+};
+
+struct b8 {
+	unsigned a:1, b:2, c:3;
+	_Bool f:1;
+	int d:25;
+	int e;
+};
+
+struct b9 {
+	int a:3;
+	int :0;
+	int b:3;
+	char c;
+};
+
+union u1 {
+	char c;
+	int a:3;
+	long long :0;
+};
+
+union u2 {
+	unsigned char a:3;
+	unsigned short b:9;
+};
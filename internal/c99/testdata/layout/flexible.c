@@ -0,0 +1,17 @@
+// A flexible array member has size zero, but its alignment counts.
+
+struct f1 {
+	char c;
+	int a[];
+};
+
+struct f2 {
+	int n;
+	char a[];
+};
+
+struct f3 {
+	short s;
+	char c;
+	long long a[];
+};
@@ -0,0 +1,26 @@
+// Floating point members follow the alignment of their type.
+
+struct d1 {
+	char c;
+	double d;
+	float f;
+};
+
+struct d2 {
+	char c;
+	long double ld;
+	int i;
+};
+
+struct d3 {
+	float _Complex fc;
+	char c;
+	double _Complex dc;
+	char d;
+	long double _Complex ldc;
+};
+
+union d4 {
+	char c;
+	long double ld;
+};
@@ -0,0 +1 @@
+struct s { int char c; };
@@ -0,0 +1 @@
+struct s { struct t t; };
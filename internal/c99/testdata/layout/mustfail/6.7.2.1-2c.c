@@ -0,0 +1 @@
+struct s { struct s s; };
@@ -0,0 +1 @@
+struct s { void v; };
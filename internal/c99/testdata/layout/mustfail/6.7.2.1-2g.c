@@ -0,0 +1 @@
+union u { int n; int a[]; };
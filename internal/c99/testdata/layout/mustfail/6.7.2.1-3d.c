@@ -0,0 +1 @@
+struct s { char a:9; };
@@ -0,0 +1 @@
+struct s { int *p:3; };
@@ -0,0 +1 @@
+struct s { int a; }; struct s { int b; };
@@ -0,0 +1 @@
+struct s { int a[1.5]; };
@@ -0,0 +1 @@
+struct s { int a[static 2]; };
@@ -0,0 +1,74 @@
+// #pragma pack caps member alignment, packed sets it to 1 and aligned raises
+// it.
+
+#pragma pack(1)
+struct p1 {
+	char c;
+	int a:20;
+	int b:20;
+};
+
+struct p2 {
+	char c;
+	int a __attribute__((aligned(8)));
+};
+
+struct __attribute__((aligned(16))) p3 {
+	char c;
+};
+
+struct p4 {
+	char c;
+	int :0;
+	char d;
+};
+#pragma pack()
+
+struct p5 {
+	char c;
+	int a:20;
+	int b:20;
+} __attribute__((packed));
+
+#pragma pack(push, 2)
+struct p6 {
+	char c;
+	int a:20;
+	int b:20;
+};
+
+#pragma pack(push)
+#pragma pack(4)
+struct p7 {
+	char c;
+	long long l;
+};
+#pragma pack(pop)
+
+struct p8 {
+	char c;
+	int a;
+};
+#pragma pack(pop)
+
+struct p9 {
+	char c;
+	int a:4 __attribute__((packed));
+	int b:30;
+};
+
+struct p10 {
+	char c;
+	int a __attribute__((packed));
+	short s __attribute__((__aligned__(4), unused));
+} __attribute__((__aligned__(8)));
+
+struct p11 {
+	char c;
+	struct p10 p;
+};
+
+struct p12 {
+	char c;
+	short s __attribute__((__aligned__));
+} __attribute__((__aligned__));
@@ -0,0 +1,17 @@
+// Line splices.
+int a\
+b = 1;
+#define X \
+	42
+char *s = "foo\
+bar";
+long c\
+\
+\
+d;
+/* multi \
+   line */ int e;
+f \
+g;
+int h\
+i;
@@ -0,0 +1,14 @@
+// Trigraph sequences.
+??=define X 1
+int a??(2??) = ??<0, 1??>;
+int b = 1 ??! 2 ??' 3;
+int c = ??-0;
+char *s = "??/"??/"";
+int d???=;
+int e ??/
+f;
+/* ??( and ??) are not reported in comments */
+// ??< but a line splice ??/
+is;
+// ??= x
+int g;
@@ -4,7 +4,16 @@
 
 package c99
 
+import (
+	"fmt"
+	"strings"
+)
+
 var (
+	_ Type = (*ArrayType)(nil)
+	_ Type = (*FunctionType)(nil)
+	_ Type = (*PointerType)(nil)
+	_ Type = (*StructType)(nil)
 	_ Type = (*undefinedType)(nil)
 
 	// Undefined represents an instance of undefined type. R/O
@@ -15,7 +24,104 @@ type undefinedType struct {
 	Type
 }
 
+// Kind implements Type.
+func (t *undefinedType) Kind() TypeKind { return 0 }
+
 // Type represents a C type.
 type Type interface {
 	Kind() TypeKind
 }
+
+// ArrayType represents an array type.
+type ArrayType struct {
+	Item Type
+	Size int64 // Number of items. Negative if unknown, like for a flexible array member.
+}
+
+// Kind implements Type.
+func (t *ArrayType) Kind() TypeKind { return Array }
+
+func (t *ArrayType) String() string {
+	if t.Size < 0 {
+		return fmt.Sprintf("%v[]", t.Item)
+	}
+
+	return fmt.Sprintf("%v[%d]", t.Item, t.Size)
+}
+
+// FunctionType represents a function type.
+type FunctionType struct {
+	Params   []Type // Nil if the function has no prototype.
+	Result   Type
+	Variadic bool
+}
+
+// Kind implements Type.
+func (t *FunctionType) Kind() TypeKind { return Function }
+
+func (t *FunctionType) String() string {
+	var a []string
+	for _, v := range t.Params {
+		a = append(a, fmt.Sprint(v))
+	}
+	switch {
+	case t.Variadic:
+		a = append(a, "...")
+	case t.Params != nil && len(a) == 0:
+		a = append(a, "void")
+	}
+	return fmt.Sprintf("%v(%s)", t.Result, strings.Join(a, ", "))
+}
+
+// PointerType represents a pointer type.
+type PointerType struct {
+	Item Type
+}
+
+// Kind implements Type.
+func (t *PointerType) Kind() TypeKind { return Ptr }
+
+func (t *PointerType) String() string { return fmt.Sprintf("%v*", t.Item) }
+
+// StructType represents a struct or union type. Its layout is computed by
+// Model.Layout.
+type StructType struct {
+	Fields     []Field
+	Tag        string // Empty for an untagged type.
+	Align      int    // Alignment set by __attribute__((aligned)), if not zero.
+	Pack       int    // Maximum member alignment set by #pragma pack, if not zero.
+	Incomplete bool   // The type is declared but not defined.
+	Packed     bool   // __attribute__((packed))
+	Union      bool
+}
+
+// Kind implements Type.
+func (t *StructType) Kind() TypeKind {
+	if t.Union {
+		return Union
+	}
+
+	return Struct
+}
+
+func (t *StructType) String() string {
+	s := "struct"
+	if t.Union {
+		s = "union"
+	}
+	if t.Tag == "" {
+		return s + " {...}"
+	}
+
+	return s + " " + t.Tag
+}
+
+// Field represents a member of a struct or union.
+type Field struct {
+	Name     string // Empty for an unnamed bit-field.
+	Type     Type
+	Align    int  // Alignment set by __attribute__((aligned)), if not zero.
+	BitField bool // The field is a bit-field, possibly of zero Bits.
+	Bits     int  // Width of a bit-field.
+	Packed   bool // __attribute__((packed))
+}
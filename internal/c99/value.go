@@ -11,6 +11,7 @@ import (
 	"math"
 
 	"github.com/cznic/ir"
+	"github.com/cznic/xc"
 )
 
 var (
@@ -65,6 +66,20 @@ var (
 		DoubleComplex:     true,
 		LongDoubleComplex: true,
 	}
+
+	isFloatingType = [maxTypeKind]bool{
+		Float:      true,
+		Double:     true,
+		LongDouble: true,
+	}
+
+	// [0]6.2.5-6: For each of the signed integer types, there is a
+	// corresponding (but different) unsigned integer type.
+	unsignedOf = [maxTypeKind]TypeKind{
+		Int:      UInt,
+		Long:     ULong,
+		LongLong: ULongLong,
+	}
 )
 
 // [0]6.3.1.8
@@ -78,9 +93,14 @@ var (
 // result, whose type domain is the type domain of the operands if they are the
 // same, and complex otherwise. This pattern is called the usual arithmetic
 // conversions:
-func usualArithmeticConversions(ctx *context, a, b *Value) (c, d *Value) {
+func usualArithmeticConversions(ctx *context, n Node, a, b *Value) (c, d *Value) {
+	if a.Type == Undefined || b.Type == Undefined {
+		return &Value{Type: Undefined}, &Value{Type: Undefined}
+	}
+
 	if !a.isArithmeticType() || !b.isArithmeticType() {
-		panic("TODO")
+		ctx.err(n, "invalid operands (%v and %v)", a.Type, b.Type)
+		return &Value{Type: Undefined}, &Value{Type: Undefined}
 	}
 
 	// First, if the corresponding real type of either operand is long
@@ -118,12 +138,8 @@ func usualArithmeticConversions(ctx *context, a, b *Value) (c, d *Value) {
 
 	// Otherwise, the integer promotions are performed on both operands.
 	// Then the following rules are applied to the promoted operands:
-	if !a.isIntegerType() || !b.isIntegerType() {
-		panic("TODO")
-	}
-
-	a = a.integerPromotion()
-	b = b.integerPromotion()
+	a = a.integerPromotion(ctx)
+	b = b.integerPromotion(ctx)
 
 	// If both operands have the same type, then no further conversion is
 	// needed.
@@ -143,175 +159,628 @@ func usualArithmeticConversions(ctx *context, a, b *Value) (c, d *Value) {
 		return a.convertTo(ctx, t), b.convertTo(ctx, t)
 	}
 
-	panic(fmt.Errorf("TODO %v %v", a, b))
+	// Otherwise, if the operand that has unsigned integer type has rank
+	// greater or equal to the rank of the type of the other operand, then
+	// the operand with signed integer type is converted to the type of the
+	// operand with unsigned integer type.
+	u, s := a.Type.Kind(), b.Type.Kind()
+	if a.isSigned() {
+		u, s = s, u
+	}
+	if intConvRank[u] >= intConvRank[s] {
+		return a.convertTo(ctx, u), b.convertTo(ctx, u)
+	}
+
+	// Otherwise, if the type of the operand with signed integer type can
+	// represent all of the values of the type of the operand with unsigned
+	// integer type, then the operand with unsigned integer type is
+	// converted to the type of the operand with signed integer type.
+	if ctx.model[s].Size > ctx.model[u].Size {
+		return a.convertTo(ctx, s), b.convertTo(ctx, s)
+	}
+
+	// Otherwise, both operands are converted to the unsigned integer type
+	// corresponding to the type of the operand with signed integer type.
+	t := unsignedOf[s]
+	return a.convertTo(ctx, t), b.convertTo(ctx, t)
 }
 
 // Value represents the type and optionally the value of an expression.
+//
+// An address constant, [0]6.6-9, has a non nil Addr. Its value is the address
+// of Addr plus the offset in bytes held by an *ir.Int64Value. The value of an
+// lvalue, which designates the object of type Type at such address, is not
+// known.
 type Value struct {
 	Type Type
 	ir.Value
+	Addr   Node // *Declarator of an object or function or the string literal *Expr.
+	lvalue bool
 }
 
 func (v *Value) isArithmeticType() bool { return isArithmeticType[v.Type.Kind()] }
+func (v *Value) isFloatingType() bool   { return isFloatingType[v.Type.Kind()] }
 func (v *Value) isIntegerType() bool    { return intConvRank[v.Type.Kind()] != 0 }
+func (v *Value) isPointerType() bool    { return v.Type.Kind() == Ptr }
 func (v *Value) isSigned() bool         { return isSigned[v.Type.Kind()] }
 
-func (v *Value) add(ctx *context, w *Value) (r *Value) {
-	v, w = usualArithmeticConversions(ctx, v, w)
-	if v.Value == nil || w.Value == nil {
+// [0]6.3.2.1
+//
+// rvalue returns the value of v. An lvalue that does not have array type is
+// converted to the value stored in the designated object, which is not
+// known. An expression that has type array of type or function type is
+// converted to an expression with type pointer to type or pointer to function
+// that points to the initial element of the array object or to the function.
+func (v *Value) rvalue() *Value {
+	if !v.lvalue {
+		return v
+	}
+
+	r := &Value{Addr: v.Addr}
+	switch x := v.Type.(type) {
+	case *ArrayType:
+		r.Type = &PointerType{x.Item}
+	case *FunctionType:
+		r.Type = &PointerType{x}
+	default:
 		return &Value{Type: v.Type}
 	}
 
 	switch x := v.Value.(type) {
 	case *ir.Int64Value:
-		return (&Value{v.Type, &ir.Int64Value{Value: x.Value + w.Value.(*ir.Int64Value).Value}}).normalize(ctx)
-	default:
-		panic(fmt.Errorf("TODO %T", x))
+		r.Value = x
+	case *ir.StringValue:
+		r.Value = &ir.Int64Value{Value: int64(x.Offset)}
 	}
+	return r
 }
 
-func (v *Value) convertTo(ctx *context, t Type) *Value {
-	if v.Type == t {
+// address returns the address of the lvalue v.
+func (v *Value) address() *Value {
+	r := &Value{Type: &PointerType{v.Type}, Addr: v.Addr}
+	switch x := v.Value.(type) {
+	case *ir.Int64Value:
+		r.Value = x
+	case *ir.StringValue:
+		r.Value = &ir.Int64Value{Value: int64(x.Offset)}
+	}
+	return r
+}
+
+// deref returns the lvalue designating the object the pointer v points to,
+// displaced by off bytes.
+func (v *Value) deref(t Type, off int64) *Value {
+	r := &Value{Type: t, Addr: v.Addr, lvalue: true}
+	if x, ok := v.Value.(*ir.Int64Value); ok {
+		r.Value = &ir.Int64Value{Value: x.Value + off}
+	}
+	return r
+}
+
+// selectField returns the member nm of the struct or union v. It is an lvalue
+// if v is.
+func (v *Value) selectField(ctx *context, n Node, nm xc.Token) *Value {
+	if v.Type == Undefined {
 		return v
 	}
 
-	if v.Value == nil {
+	t, ok := v.Type.(*StructType)
+	if !ok {
+		ctx.err(n, "request for member '%s' in something not a structure or union", nm.S())
+		return &Value{Type: Undefined}
+	}
+
+	l, err := ctx.model.Layout(t)
+	if err != nil {
+		ctx.err(n, "invalid use of incomplete type %v", t)
+		return &Value{Type: Undefined}
+	}
+
+	for i, f := range t.Fields {
+		if f.Name != string(nm.S()) {
+			continue
+		}
+
+		r := &Value{Type: f.Type, Addr: v.Addr, lvalue: v.lvalue}
+		if x, ok := v.Value.(*ir.Int64Value); ok && v.lvalue {
+			r.Value = &ir.Int64Value{Value: x.Value + l.Fields[i].Offset}
+		}
+		return r
+	}
+
+	ctx.err(n, "%v has no member named '%s'", t, nm.S())
+	return &Value{Type: Undefined}
+}
+
+// convertPtr converts v, a pointer or an integer, to t, a pointer or an
+// integer type, [0]6.3.2.3.
+func (v *Value) convertPtr(ctx *context, t Type) *Value {
+	r := &Value{Type: t, Addr: v.Addr}
+	x, ok := v.Value.(*ir.Int64Value)
+	switch k := t.Kind(); {
+	case !ok:
+		r.Addr = nil
+		return r
+	case k == Bool:
+		r.Addr = nil
+		r.Value = &ir.Int64Value{Value: bool2int(v.Addr != nil || x.Value != 0)}
+		return r
+	case v.Addr != nil && k != Ptr && ctx.model[k].Size < ctx.model[Ptr].Size:
+		// Like gcc, an address constant converted to an integer type
+		// at least as wide as a pointer is still an address constant.
 		return &Value{Type: t}
 	}
 
-	switch x := v.Type.Kind(); x {
-	case Int:
-		switch t.Kind() {
-		case Long:
-			return &Value{t, v.Value}
-		default:
-			panic(fmt.Errorf("%v -> %v", v, t))
+	r.Value = &ir.Int64Value{Value: x.Value}
+	if v.Addr != nil {
+		return r
+	}
+
+	return r.normalize(ctx)
+}
+
+// [0]6.5.6-8: When an expression that has integer type is added to or
+// subtracted from a pointer, the result has the type of the pointer operand.
+//
+// ptrAdd returns v + sign*w, where v is a pointer and w an integer.
+func (v *Value) ptrAdd(ctx *context, n Node, w *Value, sign int64) *Value {
+	if v.Type == Undefined || w.Type == Undefined {
+		return &Value{Type: Undefined}
+	}
+
+	var sz int64 = 1 // Like gcc for void and function pointers.
+	switch t := v.Type.(*PointerType).Item; t.Kind() {
+	case Void, Function:
+		// nop
+	default:
+		var err error
+		if sz, err = ctx.model.Sizeof(t); err != nil {
+			ctx.err(n, "arithmetic on pointer to an incomplete type")
+			return &Value{Type: Undefined}
 		}
+	}
+
+	r := &Value{Type: v.Type, Addr: v.Addr}
+	x, ok := v.Value.(*ir.Int64Value)
+	y, ok2 := w.Value.(*ir.Int64Value)
+	if ok && ok2 {
+		r.Value = &ir.Int64Value{Value: x.Value + sign*sz*y.Value}
+	}
+	return r
+}
+
+// binary returns v op w, where op is one of the binary operators + - * / % &
+// | ^ or '<' and '>' for the shift operators << and >>.
+func (v *Value) binary(ctx *context, n Node, op rune, w *Value) *Value {
+	switch op {
+	case '+':
+		switch {
+		case v.isPointerType() && w.isIntegerType():
+			return v.ptrAdd(ctx, n, w, 1)
+		case v.isIntegerType() && w.isPointerType():
+			return w.ptrAdd(ctx, n, v, 1)
+		}
+		return v.add(ctx, n, w)
+	case '-':
+		switch {
+		case v.isPointerType() && w.isIntegerType():
+			return v.ptrAdd(ctx, n, w, -1)
+		case v.isPointerType() && w.isPointerType():
+			return v.ptrDiff(ctx, n, w)
+		}
+		return v.sub(ctx, n, w)
+	case '*':
+		return v.mul(ctx, n, w)
+	case '/':
+		return v.div(ctx, n, w)
+	case '%':
+		return v.mod(ctx, n, w)
+	case '&':
+		return v.and(ctx, n, w)
+	case '|':
+		return v.or(ctx, n, w)
+	case '^':
+		return v.xor(ctx, n, w)
+	case '<':
+		return v.shift(ctx, n, w, true)
+	case '>':
+		return v.shift(ctx, n, w, false)
 	default:
-		panic(fmt.Errorf("%v -> %v", v, t))
+		panic("internal error")
 	}
 }
 
-func (v *Value) eq(ctx *context, w *Value) (r *Value) {
-	r = &Value{Type: Int}
+// binop applies the usual arithmetic conversions to v and w and computes the
+// result of an integer operation i or a floating point operation f. A nil
+// f means the operation requires integer operands.
+func (v *Value) binop(ctx *context, n Node, w *Value, i func(a, b int64, signed bool) int64, f func(a, b float64) float64) *Value {
+	v, w = usualArithmeticConversions(ctx, n, v, w)
+	if v.Type == Undefined {
+		return v
+	}
+
+	if f == nil && !v.isIntegerType() {
+		ctx.err(n, "invalid operands (%v and %v)", v.Type, w.Type)
+		return &Value{Type: Undefined}
+	}
+
+	r := &Value{Type: v.Type}
 	if v.Value == nil || w.Value == nil {
 		return r
 	}
 
-	v, w = usualArithmeticConversions(ctx, v, w)
 	switch x := v.Value.(type) {
 	case *ir.Int64Value:
-		var val int64
-		if x.Value == w.Value.(*ir.Int64Value).Value {
-			val = 1
-		}
-		r.Value = &ir.Int64Value{Value: val}
+		r.Value = &ir.Int64Value{Value: i(x.Value, w.Value.(*ir.Int64Value).Value, v.isSigned())}
+	case *ir.Float32Value:
+		r.Value = &ir.Float32Value{Value: float32(f(float64(x.Value), float64(w.Value.(*ir.Float32Value).Value)))}
+	case *ir.Float64Value:
+		r.Value = &ir.Float64Value{Value: f(x.Value, w.Value.(*ir.Float64Value).Value)}
 	default:
-		panic(fmt.Errorf("TODO %T", x))
+		panic(fmt.Errorf("internal error %T", x))
 	}
-	return r
+	return r.normalize(ctx)
 }
 
-func (v *Value) ge(ctx *context, w *Value) (r *Value) {
-	r = &Value{Type: Int}
-	r = &Value{Type: Int}
+// cmp applies the usual arithmetic conversions to v and w and compares them
+// using i or f. The result has type int.
+func (v *Value) cmp(ctx *context, n Node, w *Value, i func(a, b int64, signed bool) bool, f func(a, b float64) bool) *Value {
+	if v.isPointerType() || w.isPointerType() {
+		return v.ptrCmp(ctx, n, w, i)
+	}
+
+	v, w = usualArithmeticConversions(ctx, n, v, w)
+	if v.Type == Undefined {
+		return v
+	}
+
+	r := &Value{Type: Int}
 	if v.Value == nil || w.Value == nil {
 		return r
 	}
 
-	v, w = usualArithmeticConversions(ctx, v, w)
+	var b bool
 	switch x := v.Value.(type) {
 	case *ir.Int64Value:
-		var val int64
-		switch {
-		case v.isSigned():
-			if x.Value >= w.Value.(*ir.Int64Value).Value {
-				val = 1
-			}
-		default:
-			panic("TODO")
-		}
-		r.Value = &ir.Int64Value{Value: val}
+		b = i(x.Value, w.Value.(*ir.Int64Value).Value, v.isSigned())
+	case *ir.Float32Value:
+		b = f(float64(x.Value), float64(w.Value.(*ir.Float32Value).Value))
+	case *ir.Float64Value:
+		b = f(x.Value, w.Value.(*ir.Float64Value).Value)
 	default:
-		panic(fmt.Errorf("TODO %T", x))
+		panic(fmt.Errorf("internal error %T", x))
+	}
+	r.Value = &ir.Int64Value{Value: bool2int(b)}
+	return r
+}
+
+// [0]6.5.8-2, 6.5.9-2: Both operands are pointers, or one is a pointer and
+// the other is a null pointer constant.
+//
+// ptrCmp compares v and w, at least one of which is a pointer, as unsigned
+// integers using i. The result has type int and it is known only if both
+// operands are offsets from the same address constant or integers cast to
+// pointers.
+func (v *Value) ptrCmp(ctx *context, n Node, w *Value, i func(a, b int64, signed bool) bool) *Value {
+	if v.Type == Undefined || w.Type == Undefined {
+		return &Value{Type: Undefined}
+	}
+
+	if !v.isPointerType() && !v.isIntegerType() || !w.isPointerType() && !w.isIntegerType() {
+		ctx.err(n, "invalid operands (%v and %v)", v.Type, w.Type)
+		return &Value{Type: Undefined}
+	}
+
+	r := &Value{Type: Int}
+	x, ok := v.Value.(*ir.Int64Value)
+	y, ok2 := w.Value.(*ir.Int64Value)
+	if ok && ok2 && v.Addr == w.Addr {
+		r.Value = &ir.Int64Value{Value: bool2int(i(x.Value, y.Value, false))}
 	}
 	return r
 }
 
-func (v *Value) gt(ctx *context, w *Value) (r *Value) {
-	r = &Value{Type: Int}
-	r = &Value{Type: Int}
+func bool2int(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func (v *Value) add(ctx *context, n Node, w *Value) *Value {
+	return v.binop(ctx, n, w,
+		func(a, b int64, signed bool) int64 { return a + b },
+		func(a, b float64) float64 { return a + b },
+	)
+}
+
+func (v *Value) sub(ctx *context, n Node, w *Value) *Value {
+	return v.binop(ctx, n, w,
+		func(a, b int64, signed bool) int64 { return a - b },
+		func(a, b float64) float64 { return a - b },
+	)
+}
+
+func (v *Value) mul(ctx *context, n Node, w *Value) *Value {
+	return v.binop(ctx, n, w,
+		func(a, b int64, signed bool) int64 { return a * b },
+		func(a, b float64) float64 { return a * b },
+	)
+}
+
+func (v *Value) div(ctx *context, n Node, w *Value) *Value {
+	if v.isIntegerType() && w.isIntegerType() && w.isZero() {
+		ctx.err(n, "division by zero")
+		return &Value{Type: Undefined}
+	}
+
+	return v.binop(ctx, n, w,
+		func(a, b int64, signed bool) int64 {
+			if signed {
+				return a / b
+			}
+
+			return int64(uint64(a) / uint64(b))
+		},
+		func(a, b float64) float64 { return a / b },
+	)
+}
+
+func (v *Value) mod(ctx *context, n Node, w *Value) *Value {
+	if v.isIntegerType() && w.isIntegerType() && w.isZero() {
+		ctx.err(n, "division by zero")
+		return &Value{Type: Undefined}
+	}
+
+	return v.binop(ctx, n, w,
+		func(a, b int64, signed bool) int64 {
+			if signed {
+				return a % b
+			}
+
+			return int64(uint64(a) % uint64(b))
+		},
+		nil,
+	)
+}
+
+func (v *Value) and(ctx *context, n Node, w *Value) *Value {
+	return v.binop(ctx, n, w, func(a, b int64, signed bool) int64 { return a & b }, nil)
+}
+
+func (v *Value) or(ctx *context, n Node, w *Value) *Value {
+	return v.binop(ctx, n, w, func(a, b int64, signed bool) int64 { return a | b }, nil)
+}
+
+func (v *Value) xor(ctx *context, n Node, w *Value) *Value {
+	return v.binop(ctx, n, w, func(a, b int64, signed bool) int64 { return a ^ b }, nil)
+}
+
+// [0]6.5.7
+func (v *Value) shift(ctx *context, n Node, w *Value, left bool) *Value {
+	if v.Type == Undefined || w.Type == Undefined {
+		return &Value{Type: Undefined}
+	}
+
+	if !v.isIntegerType() || !w.isIntegerType() {
+		ctx.err(n, "invalid operands (%v and %v)", v.Type, w.Type)
+		return &Value{Type: Undefined}
+	}
+
+	// The integer promotions are performed on each of the operands. The
+	// type of the result is that of the promoted left operand.
+	v, w = v.integerPromotion(ctx), w.integerPromotion(ctx)
+	r := &Value{Type: v.Type}
 	if v.Value == nil || w.Value == nil {
 		return r
 	}
 
-	v, w = usualArithmeticConversions(ctx, v, w)
+	a, b := v.Value.(*ir.Int64Value).Value, w.Value.(*ir.Int64Value).Value
+	if w.isSigned() && b < 0 || uint64(b) >= uint64(8*ctx.model[v.Type.Kind()].Size) {
+		ctx.warnPos(n.Pos(), "shift count out of range")
+		return r
+	}
+
+	switch {
+	case left:
+		a <<= uint(b)
+	case v.isSigned():
+		a >>= uint(b)
+	default:
+		a = int64(uint64(a) >> uint(b))
+	}
+	r.Value = &ir.Int64Value{Value: a}
+	return r.normalize(ctx)
+}
+
+// [0]6.5.6-9: When two pointers are subtracted, both shall point to elements of
+// the same array object, or one past the last element of the array object;
+// the result is the difference of the subscripts of the two array elements.
+// The size of the result is implementation-defined, and its type (a signed
+// integer type) is ptrdiff_t defined in the <stddef.h> header.
+func (v *Value) ptrDiff(ctx *context, n Node, w *Value) *Value {
+	if v.Type == Undefined || w.Type == Undefined {
+		return &Value{Type: Undefined}
+	}
+
+	r := &Value{Type: Long}
+	x, ok := v.Value.(*ir.Int64Value)
+	y, ok2 := w.Value.(*ir.Int64Value)
+	if !ok || !ok2 || v.Addr != w.Addr {
+		return r
+	}
+
+	sz, err := ctx.model.Sizeof(v.Type.(*PointerType).Item)
+	if err != nil || sz == 0 {
+		sz = 1
+	}
+	r.Value = &ir.Int64Value{Value: (x.Value - y.Value) / sz}
+	return r
+}
+
+func (v *Value) eq(ctx *context, n Node, w *Value) *Value {
+	return v.cmp(ctx, n, w,
+		func(a, b int64, signed bool) bool { return a == b },
+		func(a, b float64) bool { return a == b },
+	)
+}
+
+func (v *Value) ne(ctx *context, n Node, w *Value) *Value {
+	return v.cmp(ctx, n, w,
+		func(a, b int64, signed bool) bool { return a != b },
+		func(a, b float64) bool { return a != b },
+	)
+}
+
+func (v *Value) lt(ctx *context, n Node, w *Value) *Value {
+	return v.cmp(ctx, n, w,
+		func(a, b int64, signed bool) bool {
+			if signed {
+				return a < b
+			}
+
+			return uint64(a) < uint64(b)
+		},
+		func(a, b float64) bool { return a < b },
+	)
+}
+
+func (v *Value) le(ctx *context, n Node, w *Value) *Value {
+	return v.cmp(ctx, n, w,
+		func(a, b int64, signed bool) bool {
+			if signed {
+				return a <= b
+			}
+
+			return uint64(a) <= uint64(b)
+		},
+		func(a, b float64) bool { return a <= b },
+	)
+}
+
+func (v *Value) gt(ctx *context, n Node, w *Value) *Value { return w.lt(ctx, n, v) }
+func (v *Value) ge(ctx *context, n Node, w *Value) *Value { return w.le(ctx, n, v) }
+
+// [0]6.5.3.3
+func (v *Value) unary(ctx *context, n Node, op rune) *Value {
+	if v.Type == Undefined {
+		return v
+	}
+
+	if !v.isArithmeticType() || op == '~' && !v.isIntegerType() {
+		ctx.err(n, "invalid operand (%v)", v.Type)
+		return &Value{Type: Undefined}
+	}
+
+	v = v.integerPromotion(ctx)
+	r := &Value{Type: v.Type}
 	switch x := v.Value.(type) {
+	case nil:
+		// nop
 	case *ir.Int64Value:
-		var val int64
-		switch {
-		case v.isSigned():
-			if x.Value > w.Value.(*ir.Int64Value).Value {
-				val = 1
-			}
-		default:
-			panic("TODO")
+		switch op {
+		case '+':
+			r.Value = x
+		case '-':
+			r.Value = &ir.Int64Value{Value: -x.Value}
+		case '~':
+			r.Value = &ir.Int64Value{Value: ^x.Value}
+		}
+	case *ir.Float32Value:
+		switch op {
+		case '+':
+			r.Value = x
+		case '-':
+			r.Value = &ir.Float32Value{Value: -x.Value}
+		}
+	case *ir.Float64Value:
+		switch op {
+		case '+':
+			r.Value = x
+		case '-':
+			r.Value = &ir.Float64Value{Value: -x.Value}
 		}
-		r.Value = &ir.Int64Value{Value: val}
 	default:
-		panic(fmt.Errorf("TODO %T", x))
+		panic(fmt.Errorf("internal error %T", x))
 	}
-	return r
+	return r.normalize(ctx)
 }
 
-func (v *Value) lt(ctx *context, w *Value) (r *Value) {
-	r = &Value{Type: Int}
-	r = &Value{Type: Int}
-	if v.Value == nil || w.Value == nil {
-		return r
+// [0]6.3.1
+func (v *Value) convertTo(ctx *context, t Type) *Value {
+	if v.Type == t {
+		return v
 	}
 
-	v, w = usualArithmeticConversions(ctx, v, w)
+	r := &Value{Type: t}
+	k := t.Kind()
+	var f float64
 	switch x := v.Value.(type) {
+	case nil:
+		return r
 	case *ir.Int64Value:
-		var val int64
 		switch {
-		case v.isSigned():
-			if x.Value < w.Value.(*ir.Int64Value).Value {
-				val = 1
-			}
-		default:
-			panic("TODO")
+		case k == Bool:
+			r.Value = &ir.Int64Value{Value: bool2int(x.Value != 0)}
+			return r
+		case intConvRank[k] != 0:
+			r.Value = &ir.Int64Value{Value: x.Value}
+			return r.normalize(ctx)
 		}
-		r.Value = &ir.Int64Value{Value: val}
+
+		f = float64(x.Value)
+		if !v.isSigned() {
+			f = float64(uint64(x.Value))
+		}
+	case *ir.Float32Value:
+		f = float64(x.Value)
+	case *ir.Float64Value:
+		f = x.Value
 	default:
-		panic(fmt.Errorf("TODO %T", x))
+		return r
+	}
+
+	switch {
+	case k == Bool:
+		r.Value = &ir.Int64Value{Value: bool2int(f != 0)}
+	case intConvRank[k] != 0:
+		var n int64
+		switch {
+		case !isSigned[k] && f >= math.MaxInt64:
+			n = int64(uint64(f))
+		default:
+			n = int64(f)
+		}
+		r.Value = &ir.Int64Value{Value: n}
+		return r.normalize(ctx)
+	case k == Float:
+		r.Value = &ir.Float32Value{Value: float32(f)}
+	case k == Double, k == LongDouble:
+		r.Value = &ir.Float64Value{Value: f}
 	}
 	return r
 }
 
+// normalize truncates an integer value to the size of its type and sign or
+// zero extends it back to 64 bits.
 func (v *Value) normalize(ctx *context) *Value {
-	switch x := v.Value.(type) {
-	case *ir.Int64Value:
-		val := x.Value
-		switch sz := ctx.model[v.Type.Kind()].Size; sz {
-		case 4:
-			switch {
-			case v.isSigned():
-				switch {
-				case val < 0:
-					panic("TODO")
-				default:
-					x.Value = val & math.MaxUint32
-				}
-			default:
-				panic("TODO")
-			}
+	x, ok := v.Value.(*ir.Int64Value)
+	if !ok {
+		return v
+	}
+
+	switch k := v.Type.Kind(); k {
+	case Bool:
+		x.Value = bool2int(x.Value != 0)
+	default:
+		n := uint(64 - 8*ctx.model[k].Size)
+		switch {
+		case v.isSigned():
+			x.Value = x.Value << n >> n
 		default:
-			panic(fmt.Errorf("TODO %v", sz))
+			x.Value = int64(uint64(x.Value) << n >> n)
 		}
-	default:
-		panic(fmt.Errorf("TODO %T", x))
 	}
 	return v
 }
@@ -322,29 +791,47 @@ func (v *Value) normalize(ctx *context) *Value {
 // converted to an int; otherwise, it is converted to an unsigned int. These
 // are called the integer promotions. All other types are unchanged by the
 // integer promotions.
-func (v *Value) integerPromotion() *Value {
-	switch v.Type.Kind() {
-	case Int, Long:
-		return v
-	default:
-		panic(v)
+func (v *Value) integerPromotion(ctx *context) *Value {
+	if v.isIntegerType() && intConvRank[v.Type.Kind()] < intConvRank[Int] {
+		return v.convertTo(ctx, Int)
 	}
+
+	return v
 }
 
+// isNonzero reports whether v is known to be nonzero. String literals and the
+// addresses of objects and functions convert to non null pointers.
 func (v *Value) isNonzero() bool {
+	if v.Addr != nil {
+		return v.Value != nil
+	}
+
 	switch x := v.Value.(type) {
 	case *ir.Int64Value:
 		return x.Value != 0
-	default:
-		panic(fmt.Errorf("TODO %T", x))
+	case *ir.Float32Value:
+		return x.Value != 0
+	case *ir.Float64Value:
+		return x.Value != 0
+	case *ir.StringValue:
+		return true
 	}
+	return false
 }
 
+// isZero reports whether v is known to be zero.
 func (v *Value) isZero() bool {
+	if v.Addr != nil {
+		return false
+	}
+
 	switch x := v.Value.(type) {
 	case *ir.Int64Value:
 		return x.Value == 0
-	default:
-		panic(fmt.Errorf("TODO %T", x))
+	case *ir.Float32Value:
+		return x.Value == 0
+	case *ir.Float64Value:
+		return x.Value == 0
 	}
+	return false
 }
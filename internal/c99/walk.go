@@ -0,0 +1,170 @@
+// Copyright 2017 The C99 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package c99
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/cznic/xc"
+)
+
+// A Visitor's Visit method is invoked for each node encountered by Walk. If
+// the result visitor w is not nil, Walk visits each of the children of node
+// with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(n Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: It starts by calling
+// v.Visit(n); n must not be nil. If the visitor w returned by v.Visit(n) is
+// not nil, Walk is invoked recursively with visitor w for each of the non-nil
+// children of n, in source order, followed by a call of w.Visit(nil).
+//
+// The elements of list nodes, like BlockItemList, are visited as nested
+// children: the item first, then the rest of the list.
+func Walk(v Visitor, n Node) {
+	if v = v.Visit(n); v == nil {
+		return
+	}
+
+	children(n, func(_ string, c Node) { Walk(v, c) })
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(n Node) Visitor {
+	if f(n) {
+		return f
+	}
+
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling f(n);
+// n must not be nil. If f returns true, Inspect invokes f recursively for each
+// of the non-nil children of n, followed by a call of f(nil).
+func Inspect(n Node, f func(Node) bool) { Walk(inspector(f), n) }
+
+// An ApplyFunc is invoked by Apply for each non-nil node before and/or after
+// the node's children, using a Cursor describing the current node and
+// providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal. See Apply
+// for details.
+type ApplyFunc func(*Cursor) bool
+
+// A Cursor describes a node encountered during Apply. Information about the
+// node and its parent is available from the Node, Parent and Name methods.
+type Cursor struct {
+	name   string
+	node   Node
+	parent Node
+}
+
+// Node returns the current Node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current Node or nil for the root passed to
+// Apply.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent Node field that contains the current
+// Node, like "Expr2" or "BlockItemList", or "" for the root passed to Apply.
+func (c *Cursor) Name() string { return c.name }
+
+// Replace replaces the current Node with n. When called from the pre
+// function of Apply, the children of n are traversed instead of those of the
+// replaced node. Passing nil clears the parent field, which is valid only
+// where the grammar makes the field optional, like ExprStmt.ExprListOpt.
+// Replace panics if n cannot be stored in the parent field.
+func (c *Cursor) Replace(n Node) {
+	if n != nil {
+		if v := reflect.ValueOf(n); v.Kind() == reflect.Ptr && v.IsNil() {
+			n = nil
+		}
+	}
+	if c.parent != nil {
+		f := reflect.ValueOf(c.parent).Elem().FieldByName(c.name)
+		switch {
+		case n == nil:
+			f.Set(reflect.Zero(f.Type()))
+		case reflect.TypeOf(n).AssignableTo(f.Type()):
+			f.Set(reflect.ValueOf(n))
+		default:
+			panic(fmt.Errorf("cannot replace %T.%s (%s) with %T", c.parent, c.name, f.Type(), n))
+		}
+	}
+	c.node = n
+}
+
+// Apply traverses a syntax tree recursively, starting with root, and calling
+// pre and post for each node:
+//
+//   - If pre is not nil, it is called for each node before the node's
+//     children are traversed (pre-order). If pre returns false, no children
+//     are traversed, and post is not called for that node.
+//
+//   - If post is not nil, and a prior call of pre didn't return false, post is
+//     called for each node after its children are traversed (post-order). If
+//     post returns false, traversal is terminated and Apply returns
+//     immediately.
+//
+// Only fields that refer to AST nodes are considered children. Tokens are
+// not. Children are traversed in source order.
+//
+// Apply returns the root node, which is different from the argument when
+// it was replaced in pre or post.
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	a := &applier{pre: pre, post: post, root: &Cursor{node: root}}
+	defer func() {
+		if e := recover(); e != nil && e != errAbort {
+			panic(e)
+		}
+
+		result = a.root.node
+	}()
+
+	a.apply(a.root)
+	return a.root.node
+}
+
+var errAbort = new(int) // singleton, to signal termination of Apply
+
+type applier struct {
+	pre  ApplyFunc
+	post ApplyFunc
+	root *Cursor
+}
+
+func (a *applier) apply(c *Cursor) {
+	if a.pre != nil && !a.pre(c) {
+		return
+	}
+
+	if n := c.node; n != nil {
+		children(n, func(name string, child Node) { a.apply(&Cursor{name: name, node: child, parent: n}) })
+	}
+	if a.post != nil && !a.post(c) {
+		panic(errAbort)
+	}
+}
+
+// children calls f for every non-nil node field of n in source order. The
+// name argument is the name of the field.
+func children(n Node, f func(name string, child Node)) {
+	components(n, func(name string, _ xc.Token, child Node) {
+		if child != nil {
+			f(name, child)
+		}
+	})
+}
+
+// Components calls f for every component of n in source order. For a token
+// child is nil, for a non-nil child node tok is the zero xc.Token.
+func Components(n Node, f func(tok xc.Token, child Node)) {
+	components(n, func(_ string, tok xc.Token, child Node) { f(tok, child) })
+}
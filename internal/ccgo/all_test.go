@@ -0,0 +1,166 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ccgo
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cznic/ir"
+	"github.com/cznic/sqlite2go/internal/c99"
+)
+
+func caller(s string, va ...interface{}) {
+	if s == "" {
+		s = strings.Repeat("%v ", len(va))
+	}
+	_, fn, fl, _ := runtime.Caller(2)
+	fmt.Fprintf(os.Stderr, "# caller: %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintf(os.Stderr, s, va...)
+	fmt.Fprintln(os.Stderr)
+	_, fn, fl, _ = runtime.Caller(1)
+	fmt.Fprintf(os.Stderr, "# \tcallee: %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintln(os.Stderr)
+	os.Stderr.Sync()
+}
+
+func dbg(s string, va ...interface{}) {
+	if s == "" {
+		s = strings.Repeat("%v ", len(va))
+	}
+	_, fn, fl, _ := runtime.Caller(1)
+	fmt.Fprintf(os.Stderr, "# dbg %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintf(os.Stderr, s, va...)
+	fmt.Fprintln(os.Stderr)
+	os.Stderr.Sync()
+}
+
+func TODO(...interface{}) string { //TODOOK
+	_, fn, fl, _ := runtime.Caller(1)
+	return fmt.Sprintf("# TODO: %s:%d:\n", path.Base(fn), fl) //TODOOK
+}
+
+func use(...interface{}) {}
+
+func init() {
+	use(caller, dbg, TODO) //TODOOK
+}
+
+// ============================================================================
+
+var (
+	oKeep = flag.Bool("keep", false, "keep the generated programs")
+	oRE   = flag.String("re", "", "")
+)
+
+// translate returns the IR objects of the C program in the file path.
+func translate(path string) ([]ir.Object, error) {
+	tu, err := c99.Translate(nil, nil, nil, c99.NewBuiltinSource(), c99.NewFileSource(path))
+	if err != nil {
+		return nil, err
+	}
+
+	return c99.IR(tu)
+}
+
+// run generates the Go program of the C program in the file path, executes
+// it and returns its combined output.
+func run(t *testing.T, dir, path string) ([]byte, error) {
+	objects, err := translate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var b, b2 bytes.Buffer
+	if err := Generate(&b, "main", objects); err != nil {
+		return nil, err
+	}
+
+	if err := Generate(&b2, "main", objects); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(b.Bytes(), b2.Bytes()) {
+		return nil, fmt.Errorf("output is not deterministic")
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(src, b.Bytes()) {
+		return nil, fmt.Errorf("output is not formatted")
+	}
+
+	fn := filepath.Join(dir, strings.TrimSuffix(filepath.Base(path), ".c")+".go")
+	if err := ioutil.WriteFile(fn, src, 0644); err != nil {
+		return nil, err
+	}
+
+	return exec.Command("go", "run", fn).CombinedOutput()
+}
+
+// TestGenerate translates the self checking programs in ../c99/testdata/ir and
+// testdata to Go and executes them. The main function of every program returns
+// 0 or the ordinal number of the first failed check.
+func TestGenerate(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip(err)
+	}
+
+	var re *regexp.Regexp
+	if s := *oRE; s != "" {
+		re = regexp.MustCompile(s)
+	}
+
+	var m []string
+	for _, v := range []string{"../c99/testdata/ir/*.c", "testdata/*.c"} {
+		a, err := filepath.Glob(filepath.FromSlash(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m = append(m, a...)
+	}
+
+	// The directory must be in this package to use package crt. Go
+	// tools ignore directories beginning with an underscore.
+	dir, err := ioutil.TempDir(".", "_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if *oKeep {
+			t.Logf("generated programs kept in %s", dir)
+			return
+		}
+
+		os.RemoveAll(dir)
+	}()
+
+	for _, path := range m {
+		if re != nil && !re.MatchString(path) {
+			continue
+		}
+
+		out, err := run(t, dir, path)
+		if err != nil {
+			t.Errorf("%s: %v\n%s", path, err, out)
+		}
+	}
+}
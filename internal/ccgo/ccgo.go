@@ -0,0 +1,546 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ccgo translates IR objects to Go source code. (Work In Progress)
+//
+// # Memory
+//
+// The generated code uses the memory model of package crt. A C pointer is an
+// uintptr. Objects with static storage duration are allocated in the
+// initialized data segment ds, the zeroed segment bss and the string literals
+// segment ts when the package is initialized. Objects with automatic storage
+// duration the address of which is taken live in the frame of their function,
+// allocated from the TLS stack, the others are Go local variables. Values of
+// struct, union and array types are Go byte arrays of the same size.
+//
+// # Functions
+//
+// Every C function is a Go function having a *crt.TLS as its first parameter,
+// followed by the C parameters. The value of a function returning a value is
+// the named Go result r. The control flow of a function body is expressed using
+// goto statements only, see the IR. All labels are in the outermost block of
+// the Go function and all Go variables are declared before the first one, so
+// any C goto, including one jumping into a block, translates to a valid Go
+// goto. A variadic function has an additional last parameter va, the va_list of
+// its variadic arguments, which callers store in 8 byte slots in their frame,
+// see package crt. Va is zero if there are no variadic arguments.
+//
+// # Names
+//
+// Names of the Go objects are derived from the C names, independently of the
+// position of their definition.
+//
+//	Xfoo		the object or function foo with external linkage
+//	xfoo		the object or function foo with internal linkage
+//	xbar_foo	the static local foo of function bar
+//	crt.Xfoo	foo, not defined by the objects
+//	_foo		the parameter or local variable foo
+//	_foo:		the label foo
+//
+// Names colliding with one already in use get a numeric suffix, for example
+// _i_1.
+package ccgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cznic/ir"
+	"github.com/cznic/xc"
+)
+
+const crtPath = "github.com/cznic/sqlite2go/internal/crt"
+
+var (
+	dict = xc.Dict
+
+	// The size of an uintptr equals the size of an int on all Go
+	// platforms.
+	ptrSize = int64(strconv.IntSize / 8)
+
+	// errRestart aborts the translation of a function to restart it with
+	// more information about its variables and labels.
+	errRestart = errors.New("restart")
+)
+
+// genError is a translation error.
+type genError struct{ error }
+
+// Generate writes to out the Go source code of the package pkg consisting of
+// objects, the linked translation units of a program or a library. If pkg is
+// "main" and objects define the function main with external linkage, the
+// package is a command executing it.
+func Generate(out io.Writer, pkg string, objects []ir.Object) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			x, ok := e.(genError)
+			if !ok {
+				panic(e)
+			}
+
+			err = x.error
+		}
+	}()
+
+	g := &gen{
+		imports: map[string]bool{},
+		objects: objects,
+		order:   byteOrder(),
+		pkg:     pkg,
+		strings: map[ir.StringID]int64{},
+		types:   map[ir.TypeID]*typ{},
+	}
+	b, err := g.gen()
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(b)
+	return err
+}
+
+func byteOrder() binary.ByteOrder {
+	switch runtime.GOARCH {
+	case "armbe", "arm64be", "mips", "mips64", "mips64p32", "ppc", "ppc64", "s390", "s390x", "sparc", "sparc64":
+		return binary.BigEndian
+	default:
+		return binary.LittleEndian
+	}
+}
+
+func roundup(n, m int64) int64 { return (n + m - 1) &^ (m - 1) }
+
+// unique returns nm, or nm with a numeric suffix if m already contains it, and
+// adds the result to m.
+func unique(m map[string]bool, nm string) string {
+	s := nm
+	for i := 1; m[s]; i++ {
+		s = fmt.Sprintf("%s_%d", nm, i)
+	}
+	m[s] = true
+	return s
+}
+
+// typ is the layout of an IR type.
+type typ struct {
+	align    int64
+	fields   []*typ // Struct, union or function parameters.
+	item     *typ   // Array item, pointer target or function result.
+	kind     byte   // One of "*[cfFisuU".
+	offs     []int64
+	size     int64
+	variadic bool
+}
+
+func (t *typ) isInteger() bool { return t.kind == 'i' || t.kind == 'u' || t.kind == '*' }
+
+// parseType parses the IR type at the start of s and returns the rest of s.
+func parseType(s string) (*typ, string) {
+	switch {
+	case strings.HasPrefix(s, "*"):
+		t := &typ{align: ptrSize, kind: '*', size: ptrSize}
+		t.item, s = parseType(s[1:])
+		return t, s
+	case strings.HasPrefix(s, "["):
+		i := strings.IndexByte(s, ']')
+		n, err := strconv.ParseInt(s[1:i], 10, 64)
+		if err != nil {
+			panic(err)
+		}
+
+		t := &typ{kind: '['}
+		t.item, s = parseType(s[i+1:])
+		t.align, t.size = t.item.align, n*t.item.size
+		return t, s
+	case strings.HasPrefix(s, "struct{"), strings.HasPrefix(s, "union{"):
+		t := &typ{align: 1, kind: 's'}
+		if s[0] == 'u' {
+			t.kind = 'U'
+		}
+		s = s[strings.IndexByte(s, '{')+1:]
+		for s[0] != '}' {
+			var f *typ
+			f, s = parseType(s)
+			s = strings.TrimPrefix(s, ",")
+			if f.align > t.align {
+				t.align = f.align
+			}
+			var off int64
+			switch {
+			case t.kind == 'U':
+				if f.size > t.size {
+					t.size = f.size
+				}
+			default:
+				off = roundup(t.size, f.align)
+				t.size = off + f.size
+			}
+			t.fields = append(t.fields, f)
+			t.offs = append(t.offs, off)
+		}
+		t.size = roundup(t.size, t.align)
+		return t, s[1:]
+	case strings.HasPrefix(s, "func("):
+		t := &typ{align: 1, kind: 'F'}
+		s = s[len("func("):]
+		for s[0] != ')' {
+			if strings.HasPrefix(s, "...") {
+				t.variadic = true
+				s = s[len("..."):]
+				continue
+			}
+
+			var p *typ
+			p, s = parseType(s)
+			s = strings.TrimPrefix(s, ",")
+			t.fields = append(t.fields, p)
+		}
+		s = s[1:]
+		if s != "" && !strings.ContainsRune(",)}", rune(s[0])) {
+			t.item, s = parseType(s)
+		}
+		return t, s
+	}
+
+	i := 0
+	for i < len(s) && s[i] >= 'a' && s[i] <= 'z' {
+		i++
+	}
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	nm := s[:i]
+	t := &typ{}
+	switch {
+	case strings.HasPrefix(nm, "uint"):
+		t.kind = 'u'
+	case strings.HasPrefix(nm, "int"):
+		t.kind = 'i'
+	case strings.HasPrefix(nm, "float"):
+		t.kind = 'f'
+	case strings.HasPrefix(nm, "complex"):
+		t.kind = 'c'
+	default:
+		panic(fmt.Errorf("invalid IR type %q", s))
+	}
+	bits, err := strconv.Atoi(strings.TrimLeft(nm, "abcdefghijklmnopqrstuvwxyz"))
+	if err != nil {
+		panic(err)
+	}
+
+	t.size = int64(bits) / 8
+	t.align = t.size
+	if t.kind == 'c' {
+		t.align /= 2
+	}
+	return t, s[i:]
+}
+
+// reloc is an address stored in the data segment.
+type reloc struct {
+	off    int64
+	target string
+}
+
+// gen translates a list of IR objects.
+type gen struct {
+	bss     int64
+	ds      []byte
+	imports map[string]bool
+	names   []string // Object: Go name.
+	objects []ir.Object
+	offs    []int64 // Data object: offset in its segment.
+	order   binary.ByteOrder
+	pkg     string
+	relocs  []reloc
+	strings map[ir.StringID]int64 // Offset in ts.
+	ts      []byte
+	types   map[ir.TypeID]*typ
+}
+
+func (g *gen) err(p token.Position, s string, args ...interface{}) {
+	s = fmt.Sprintf(s, args...)
+	if p.IsValid() {
+		s = fmt.Sprintf("%v: %s", p, s)
+	}
+	panic(genError{errors.New(s)})
+}
+
+func (g *gen) typ(id ir.TypeID) *typ {
+	if t := g.types[id]; t != nil {
+		return t
+	}
+
+	s := string(dict.S(int(id)))
+	t, rest := parseType(s)
+	if rest != "" {
+		g.err(token.Position{}, "invalid IR type %q", s)
+	}
+
+	g.types[id] = t
+	return t
+}
+
+// goType returns the Go type of values of t.
+func (g *gen) goType(t *typ) string {
+	switch t.kind {
+	case '*':
+		return "uintptr"
+	case 'i':
+		return fmt.Sprintf("int%d", 8*t.size)
+	case 'u':
+		return fmt.Sprintf("uint%d", 8*t.size)
+	case 'f':
+		return fmt.Sprintf("float%d", 8*t.size)
+	case 'c':
+		return fmt.Sprintf("complex%d", 8*t.size)
+	case 'F':
+		g.imports[crtPath] = true
+		a := []string{"*crt.TLS"}
+		for _, v := range t.fields {
+			a = append(a, g.goType(v))
+		}
+		if t.variadic {
+			a = append(a, "uintptr")
+		}
+		s := fmt.Sprintf("func(%s)", strings.Join(a, ", "))
+		if t.item != nil {
+			s += " " + g.goType(t.item)
+		}
+		return s
+	default:
+		return fmt.Sprintf("[%d]byte", t.size)
+	}
+}
+
+// addr returns the Go expression of the address off bytes after base.
+func addr(base string, off int64) string {
+	if off == 0 {
+		return base
+	}
+
+	return fmt.Sprintf("%s + %d", base, off)
+}
+
+// str returns the offset of the string s in ts.
+func (g *gen) str(s ir.StringID) int64 {
+	if off, ok := g.strings[s]; ok {
+		return off
+	}
+
+	off := int64(len(g.ts))
+	g.ts = append(append(g.ts, dict.S(int(s))...), 0)
+	g.strings[s] = off
+	return off
+}
+
+func (g *gen) gen() ([]byte, error) {
+	m := map[string]bool{}
+	main := -1
+	for i, v := range g.objects {
+		b := v.Base()
+		nm := strings.Replace(string(dict.S(int(b.NameID))), ".", "_", -1)
+		switch b.Linkage {
+		case ir.ExternalLinkage:
+			if _, ok := v.(*ir.FunctionDefinition); ok && nm == "main" {
+				main = i
+			}
+			nm = "X" + nm
+		default:
+			nm = "x" + nm
+		}
+		g.names = append(g.names, unique(m, nm))
+	}
+	g.data()
+	var funcs bytes.Buffer
+	for i, v := range g.objects {
+		if x, ok := v.(*ir.FunctionDefinition); ok {
+			newFn(g, i, x).translate(&funcs)
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by ccgo. DO NOT EDIT.\n\npackage %s\n", g.pkg)
+	if g.pkg != "main" {
+		main = -1
+	}
+	if main >= 0 {
+		g.imports[crtPath] = true
+	}
+	if g.bss != 0 || len(g.ds) != 0 || len(g.ts) != 0 {
+		g.imports[crtPath] = true
+	}
+	if len(g.relocs) != 0 {
+		g.imports["unsafe"] = true
+	}
+	var imports []string
+	for k := range g.imports {
+		if k != crtPath {
+			imports = append(imports, k)
+		}
+	}
+	sort.Strings(imports)
+	if g.imports[crtPath] {
+		imports = append(imports, "", crtPath)
+	}
+	b.WriteString("\nimport (\n")
+	for _, v := range imports {
+		if v != "" {
+			fmt.Fprintf(&b, "%q", v)
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString(")\n")
+	if main >= 0 {
+		switch t := g.typ(g.objects[main].Base().TypeID); {
+		case len(t.fields) == 0:
+			fmt.Fprintf(&b, "\nfunc main() {\ncrt.Main(func(tls *crt.TLS, _ int32, _ uintptr) int32 { return %s(tls) })\n}\n", g.names[main])
+		default:
+			fmt.Fprintf(&b, "\nfunc main() { crt.Main(%s) }\n", g.names[main])
+		}
+	}
+	if g.bss != 0 || len(g.ds) != 0 || len(g.ts) != 0 {
+		b.WriteString("\nvar (\n")
+		if g.bss != 0 {
+			fmt.Fprintf(&b, "bss = crt.BSS(%d)\n", g.bss)
+		}
+		if len(g.ds) != 0 {
+			fmt.Fprintf(&b, "ds = crt.DS(%q)\n", g.ds)
+		}
+		if len(g.ts) != 0 {
+			fmt.Fprintf(&b, "ts = crt.TS(%q)\n", g.ts)
+		}
+		b.WriteString(")\n")
+	}
+	var objects bytes.Buffer
+	for i, v := range g.objects {
+		if x, ok := v.(*ir.DataDefinition); ok {
+			seg := "ds"
+			if x.Value == nil {
+				seg = "bss"
+			}
+			fmt.Fprintf(&objects, "%s = %s\n", g.names[i], addr(seg, g.offs[i]))
+		}
+	}
+	if objects.Len() != 0 {
+		fmt.Fprintf(&b, "\nvar (\n%s)\n", objects.Bytes())
+	}
+	if len(g.relocs) != 0 {
+		b.WriteString("\nfunc init() {\n")
+		for _, v := range g.relocs {
+			fmt.Fprintf(&b, "*(*uintptr)(unsafe.Pointer(%s)) = %s\n", addr("ds", v.off), v.target)
+		}
+		b.WriteString("}\n")
+	}
+	b.Write(funcs.Bytes())
+	r, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%v\n%s", err, b.Bytes())
+	}
+
+	return r, nil
+}
+
+// data lays out the objects with static storage duration.
+func (g *gen) data() {
+	g.offs = make([]int64, len(g.objects))
+	for i, v := range g.objects {
+		x, ok := v.(*ir.DataDefinition)
+		if !ok {
+			continue
+		}
+
+		t := g.typ(x.TypeID)
+		if x.Value == nil {
+			g.bss = roundup(g.bss, t.align)
+			g.offs[i] = g.bss
+			g.bss += t.size
+			continue
+		}
+
+		off := roundup(int64(len(g.ds)), t.align)
+		g.ds = append(g.ds, make([]byte, off+t.size-int64(len(g.ds)))...)
+		g.offs[i] = off
+		g.value(x.Position, off, t, x.Value)
+	}
+}
+
+// value stores the initializer v of an object of type t at off in ds.
+func (g *gen) value(p token.Position, off int64, t *typ, v ir.Value) {
+	switch x := v.(type) {
+	case *ir.CompositeValue:
+		for _, v := range x.Values {
+			d := v.(*ir.DesignatedValue)
+			switch t.kind {
+			case '[':
+				g.value(p, off+int64(d.Index)*t.item.size, t.item, d.Value)
+			case 's', 'U':
+				g.value(p, off+t.offs[d.Index], t.fields[d.Index], d.Value)
+			default:
+				g.err(p, "invalid composite value")
+			}
+		}
+	case *ir.Int32Value:
+		g.put(off, t.size, uint64(x.Value))
+	case *ir.Int64Value:
+		g.put(off, t.size, uint64(x.Value))
+	case *ir.Float32Value:
+		g.putFloat(off, t.size, float64(x.Value))
+	case *ir.Float64Value:
+		g.putFloat(off, t.size, x.Value)
+	case *ir.Complex64Value:
+		g.putFloat(off, 4, float64(real(x.Value)))
+		g.putFloat(off+4, 4, float64(imag(x.Value)))
+	case *ir.Complex128Value:
+		g.putFloat(off, 8, real(x.Value))
+		g.putFloat(off+8, 8, imag(x.Value))
+	case *ir.AddressValue:
+		var s string
+		switch {
+		case x.Index < 0:
+			// Assumed to be a function.
+			g.imports[crtPath] = true
+			s = fmt.Sprintf("crt.FP(crt.X%s)", dict.S(int(x.NameID)))
+		default:
+			s = g.names[x.Index]
+			if _, ok := g.objects[x.Index].(*ir.FunctionDefinition); ok {
+				s = fmt.Sprintf("crt.FP(%s)", s)
+			}
+		}
+		g.relocs = append(g.relocs, reloc{off, addr(s, int64(x.Offset))})
+	case *ir.StringValue:
+		g.relocs = append(g.relocs, reloc{off, addr("ts", g.str(x.StringID)+int64(x.Offset))})
+	default:
+		g.err(p, "unexpected value %T", x)
+	}
+}
+
+// put stores the size low bytes of v at off in ds.
+func (g *gen) put(off, size int64, v uint64) {
+	b := make([]byte, 8)
+	g.order.PutUint64(b, v)
+	if g.order == binary.BigEndian {
+		b = b[8-size:]
+	}
+	copy(g.ds[off:off+size], b)
+}
+
+func (g *gen) putFloat(off, size int64, v float64) {
+	if size == 4 {
+		g.put(off, 4, uint64(math.Float32bits(float32(v))))
+		return
+	}
+
+	g.put(off, 8, math.Float64bits(v))
+}
@@ -0,0 +1,1433 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ccgo
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cznic/ir"
+)
+
+// Precedence of Go binary operators.
+var precedence = map[string]int{
+	"*": 5, "/": 5, "%": 5, "<<": 5, ">>": 5, "&": 5,
+	"+": 4, "-": 4, "|": 4, "^": 4,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+}
+
+// Negation of comparison operators.
+var negation = map[string]string{
+	"==": "!=", "!=": "==", "<": ">=", "<=": ">", ">": "<=", ">=": "<",
+}
+
+type exprKind int
+
+const (
+	value     exprKind = iota
+	boolean            // A Go bool, the IR value is int32.
+	call               // A value having side effects.
+	funcAddr           // s is the Go name of a function.
+	localAddr          // The address of l, a Go variable.
+	marker             // A placeholder pushed by AllocResult or Arguments.
+)
+
+// cval is a constant value: the bits of an integer or pointer, sign or zero
+// extended, or a floating point value.
+type cval struct {
+	f float64
+	i int64
+}
+
+// expr is the Go expression of an item on the IR evaluation stack.
+type expr struct {
+	a, b   *expr    // Operands of cmp.
+	c      *cval    // Constant value.
+	cmp    string   // A boolean comparing a and b.
+	kind   exprKind //
+	l      *local   // Of a localAddr.
+	load   *expr    // The address read by a memory load.
+	off    int64    // Added to the value of s.
+	prec   int      // Of the operator of s, 7 for primary expressions.
+	reads  []*local // Go variables s reads.
+	s      string   //
+	stable bool     // Statements cannot change the value.
+	t      *typ     // IR type.
+}
+
+// local is the parameter, local variable or the result of a function or a
+// Go temporary.
+type local struct {
+	gotype string // Of a temporary.
+	memory bool   // The object lives in the frame.
+	name   string
+	off    int64 // In the frame.
+	read   bool  // The Go variable is read.
+	ref    bool  // The Go variable is referenced.
+	typ    *typ
+}
+
+// arrival describes the evaluation stack at a label.
+type arrival struct {
+	ok     bool // stack is valid.
+	placed bool // The label was seen.
+	stack  []*expr
+}
+
+// slot is a stack item passed to a label in a Go variable.
+type slot struct {
+	label, depth int
+}
+
+// pending is a statement zeroing a variable, omitted if the next statement
+// assigns to the whole variable.
+type pending struct {
+	key, s string
+}
+
+// fn translates a function definition.
+type fn struct {
+	*gen
+	args      []*local
+	body      bytes.Buffer
+	dead      bool // The previous operation does not fall through.
+	f         *ir.FunctionDefinition
+	frame     int64
+	gotos     map[int]bool
+	index     int // Of f in objects.
+	labelNms  map[int]string
+	labels    map[int]*arrival
+	pc        int
+	prologue  bool // No label was placed yet.
+	result    *local
+	slotNames map[slot]*local
+	slots     map[slot]bool
+	stack     []*expr
+	t         *typ
+	targets   map[int]bool // Labels jumped to.
+	temps     []*local
+	vaBase    int64         // Frame offset of the variadic arguments of calls.
+	vaOffs    map[int]int64 // Call pc: offset from vaBase.
+	vaSize    int64
+	vars      map[int]*local
+	zero      *pending
+}
+
+func newFn(g *gen, index int, f *ir.FunctionDefinition) *fn {
+	return &fn{
+		f:        f,
+		gen:      g,
+		index:    index,
+		labelNms: map[int]string{},
+		slots:    map[slot]bool{},
+		t:        g.typ(f.TypeID),
+		targets:  map[int]bool{},
+		vaOffs:   map[int]int64{},
+		vars:     map[int]*local{},
+	}
+}
+
+func (f *fn) fail(s string, args ...interface{}) {
+	f.err(f.f.Body[f.pc].Pos(), s, args...)
+}
+
+// translate writes the translation of f to w.
+func (f *fn) translate(w *bytes.Buffer) {
+	names := map[string]bool{"bp": true, "r": true, "tls": true, "va": true}
+	for i, v := range f.f.Arguments {
+		nm := "_"
+		if v != 0 {
+			nm = unique(names, "_"+string(dict.S(int(v))))
+		}
+		f.args = append(f.args, &local{name: nm, typ: f.t.fields[i]})
+	}
+	if f.t.variadic {
+		f.args = append(f.args, &local{name: "va", typ: f.typ(idVAList)})
+	}
+	if f.t.item != nil {
+		f.result = &local{name: "r", typ: f.t.item}
+	}
+	for pc, v := range f.f.Body {
+		switch x := v.(type) {
+		case *ir.Call:
+			f.vaArgs(pc, x.Arguments, x.TypeID)
+		case *ir.CallFP:
+			f.vaArgs(pc, x.Arguments, x.TypeID)
+		case *ir.VariableDeclaration:
+			nm := fmt.Sprintf("v%d", x.Index)
+			if x.NameID != 0 {
+				nm = unique(names, "_"+string(dict.S(int(x.NameID))))
+			}
+			f.vars[x.Index] = &local{name: nm, typ: f.typ(x.TypeID)}
+		case *ir.Label:
+			if x.NameID != 0 {
+				f.labelNms[x.Number] = "_" + string(dict.S(int(x.NameID)))
+			}
+		case *ir.Jmp:
+			f.targets[x.Number] = true
+		case *ir.Jnz:
+			f.targets[x.Number] = true
+		case *ir.Jz:
+			f.targets[x.Number] = true
+		case *ir.Switch:
+			for _, v := range x.Cases {
+				f.targets[v.Number] = true
+			}
+			f.targets[x.Default.Number] = true
+		}
+	}
+	for i := 0; !f.pass(); i++ {
+		if i > 100 {
+			f.err(f.f.Position, "internal error: translation does not converge")
+		}
+	}
+	f.write(w)
+}
+
+// vaArgs reserves frame space for the variadic arguments of the call at pc
+// passing n arguments to a function of type id.
+func (f *fn) vaArgs(pc, n int, id ir.TypeID) {
+	if t := f.typ(id); t.variadic && n > len(t.fields) {
+		f.vaOffs[pc] = f.vaSize
+		f.vaSize += 8 * int64(n-len(t.fields))
+	}
+}
+
+func (f *fn) locals() []*local {
+	r := append([]*local(nil), f.args...)
+	if f.result != nil {
+		r = append(r, f.result)
+	}
+	var a []int
+	for k := range f.vars {
+		a = append(a, k)
+	}
+	sort.Ints(a)
+	for _, v := range a {
+		r = append(r, f.vars[v])
+	}
+	return r
+}
+
+// pass translates the body of f. It returns false if the translation must be
+// restarted.
+func (f *fn) pass() (ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			if e != errRestart {
+				panic(e)
+			}
+
+			ok = false
+		}
+	}()
+
+	f.body.Reset()
+	f.dead = false
+	f.frame = 0
+	f.gotos = map[int]bool{}
+	f.labels = map[int]*arrival{}
+	f.prologue = true
+	f.slotNames = map[slot]*local{}
+	f.stack = nil
+	f.temps = nil
+	f.zero = nil
+	for _, v := range f.locals() {
+		v.read, v.ref = false, false
+		if v.memory {
+			f.frame = roundup(f.frame, v.typ.align)
+			v.off = f.frame
+			f.frame += v.typ.size
+		}
+	}
+	f.vaBase = roundup(f.frame, 8)
+	f.frame = roundup(f.vaBase+f.vaSize, 16)
+	for f.pc = 0; f.pc < len(f.f.Body); f.pc++ {
+		op := f.f.Body[f.pc]
+		if _, ok := op.(*ir.Label); !ok && f.dead {
+			continue // Unreachable.
+		}
+
+		f.op(op)
+	}
+	if len(f.gotos) != len(f.targets) {
+		f.targets = f.gotos
+		return false
+	}
+
+	return true
+}
+
+func (f *fn) write(w *bytes.Buffer) {
+	f.imports[crtPath] = true
+	var params []string
+	for _, v := range f.args {
+		params = append(params, fmt.Sprintf("%s %s", v.name, f.goType(v.typ)))
+	}
+	fmt.Fprintf(w, "\nfunc %s(tls *crt.TLS", f.names[f.index])
+	for _, v := range params {
+		fmt.Fprintf(w, ", %s", v)
+	}
+	w.WriteString(")")
+	if f.result != nil {
+		fmt.Fprintf(w, " (r %s)", f.goType(f.result.typ))
+	}
+	w.WriteString(" {\n")
+	var vars, unused []*local
+	for _, v := range f.locals()[len(f.args):] {
+		if v != f.result && v.ref && !v.memory {
+			vars = append(vars, v)
+		}
+	}
+	vars = append(vars, f.temps...)
+	if len(vars) != 0 {
+		w.WriteString("var (\n")
+		for _, v := range vars {
+			t := v.gotype
+			if t == "" {
+				t = f.goType(v.typ)
+			}
+			fmt.Fprintf(w, "%s %s\n", v.name, t)
+			if !v.read {
+				unused = append(unused, v)
+			}
+		}
+		w.WriteString(")\n")
+	}
+	for _, v := range unused {
+		fmt.Fprintf(w, "_ = %s\n", v.name)
+	}
+	if f.frame != 0 {
+		fmt.Fprintf(w, "bp := tls.Alloc(%d)\n", f.frame)
+		for _, v := range f.args {
+			if v.memory {
+				fmt.Fprintf(w, "%s = %s\n", f.deref(f.addrOf(v, nil), v.typ), v.name)
+			}
+		}
+	}
+	w.Write(f.body.Bytes())
+	w.WriteString("}\n")
+}
+
+func (f *fn) push(e *expr) { f.stack = append(f.stack, e) }
+
+func (f *fn) pop() *expr {
+	n := len(f.stack) - 1
+	if n < 0 {
+		f.fail("internal error: evaluation stack underflow")
+	}
+
+	e := f.stack[n]
+	f.stack = f.stack[:n]
+	return e
+}
+
+// dropped reports whether the next operation discards the value of the
+// current one and skips it if so.
+func (f *fn) dropped() bool {
+	if f.pc+1 < len(f.f.Body) {
+		if _, ok := f.f.Body[f.pc+1].(*ir.Drop); ok {
+			f.pc++
+			return true
+		}
+	}
+	return false
+}
+
+// use marks the variables read by e.
+func (f *fn) use(e *expr) {
+	for _, v := range e.reads {
+		v.read = true
+	}
+}
+
+func reads(a ...*expr) []*local {
+	var r []*local
+	for _, v := range a {
+		r = append(r, v.reads...)
+	}
+	return r
+}
+
+// paren returns s, the operator of which has precedence p, as an operand of
+// an operator of precedence prec.
+func paren(s string, p, prec int) string {
+	if p < prec {
+		return "(" + s + ")"
+	}
+
+	return s
+}
+
+// str returns e as an operand of an operator of precedence prec.
+func (f *fn) str(e *expr, prec int) string {
+	s, p := e.s, e.prec
+	switch {
+	case e.off > 0:
+		s, p = fmt.Sprintf("%s + %d", paren(s, p, 4), e.off), 4
+	case e.off < 0:
+		s, p = fmt.Sprintf("%s - %d", paren(s, p, 4), -e.off), 4
+	}
+	return paren(s, p, prec)
+}
+
+// typed returns e as a typed operand of a primary expression.
+func (f *fn) typed(e *expr) string {
+	if e.c == nil {
+		return f.str(e, 7)
+	}
+
+	return fmt.Sprintf("%s(%s)", f.goType(e.t), e.s)
+}
+
+func (f *fn) emit(s string) {
+	f.body.WriteString(s)
+	f.body.WriteByte('\n')
+}
+
+// stmt emits the statement s reading the variables of a. If key is not empty,
+// s assigns to all of the variable or object key.
+func (f *fn) stmt(key, s string, a ...*expr) {
+	f.flush(key)
+	for _, v := range a {
+		f.use(v)
+	}
+	f.emit(s)
+}
+
+// flush emits the pending zeroing statement unless it zeroes key.
+func (f *fn) flush(key string) {
+	if z := f.zero; z != nil {
+		f.zero = nil
+		if z.key != key {
+			f.emit(z.s)
+		}
+	}
+}
+
+// temp returns a new Go variable of type t.
+func (f *fn) temp(t string) *local {
+	l := &local{gotype: t, name: fmt.Sprintf("s%d", len(f.temps)), ref: true}
+	f.temps = append(f.temps, l)
+	return l
+}
+
+// spill evaluates e into a temporary and returns the temporary.
+func (f *fn) spill(e *expr) *expr {
+	if e.kind == localAddr || e.kind == marker {
+		e = f.val(e)
+	}
+	t := "bool"
+	if e.kind != boolean {
+		e = f.val(e)
+		t = f.goType(e.t)
+	}
+	l := f.temp(t)
+	f.use(e)
+	f.emit(fmt.Sprintf("%s = %s", l.name, f.str(e, 0)))
+	r := &expr{kind: value, prec: 7, reads: []*local{l}, s: l.name, stable: true, t: e.t}
+	if e.kind == boolean {
+		r.kind = boolean
+	}
+	return r
+}
+
+func (e *expr) isStable() bool {
+	return e.stable || e.c != nil || e.kind == funcAddr || e.kind == localAddr || e.kind == marker
+}
+
+// stabilize spills the items on the evaluation stack the values of which the
+// next statement may change.
+func (f *fn) stabilize() {
+	for i, v := range f.stack {
+		if !v.isStable() {
+			f.stack[i] = f.spill(v)
+		}
+	}
+}
+
+// escape moves l to the frame and restarts the translation.
+func (f *fn) escape(l *local) {
+	if l.memory {
+		f.fail("internal error: %s escapes twice", l.name)
+	}
+
+	l.memory = true
+	panic(errRestart)
+}
+
+// val returns e as a value.
+func (f *fn) val(e *expr) *expr {
+	switch e.kind {
+	case value, call:
+		return e
+	case boolean:
+		if e.c != nil {
+			return f.intConst(e.t, e.c.i)
+		}
+
+		f.imports[crtPath] = true
+		return &expr{kind: value, prec: 7, reads: e.reads, s: fmt.Sprintf("crt.Bool32(%s)", f.str(e, 0)), stable: e.stable, t: e.t}
+	case funcAddr:
+		f.imports[crtPath] = true
+		return &expr{kind: value, prec: 7, s: fmt.Sprintf("crt.FP(%s)", e.s), stable: true, t: e.t}
+	case localAddr:
+		f.escape(e.l)
+	}
+	f.fail("internal error: unexpected stack item %v", e.kind)
+	panic("unreachable")
+}
+
+// addrOf returns the address of l of pointer type t.
+func (f *fn) addrOf(l *local, t *typ) *expr {
+	if l.memory {
+		return &expr{kind: value, off: l.off, prec: 7, s: "bp", stable: true, t: t}
+	}
+
+	l.ref = true
+	return &expr{kind: localAddr, l: l, prec: 7, s: l.name, t: t}
+}
+
+// deref returns the Go expression designating the object of type t at a.
+func (f *fn) deref(a *expr, t *typ) string {
+	f.imports["unsafe"] = true
+	p := f.str(a, 0)
+	if a.c != nil {
+		p = f.typed(a)
+	}
+	return fmt.Sprintf("*(*%s)(unsafe.Pointer(%s))", f.goType(t), p)
+}
+
+// lvalue returns the Go expression designating the object of type t at a and
+// its key, see stmt.
+func (f *fn) lvalue(a *expr, t *typ) (string, string) {
+	if a.kind == localAddr {
+		return a.l.name, a.l.name
+	}
+
+	return f.deref(a, t), fmt.Sprintf("%s/%s", f.str(a, 0), f.goType(t))
+}
+
+// load returns the value of type t at a.
+func (f *fn) load(a *expr, t *typ) *expr {
+	if a.kind == localAddr {
+		return &expr{kind: value, prec: 7, reads: []*local{a.l}, s: a.l.name, t: t}
+	}
+
+	a = f.val(a)
+	return &expr{kind: value, load: a, prec: 6, reads: a.reads, s: f.deref(a, t), t: t}
+}
+
+// ptr returns the pointer e as a value.
+func (f *fn) ptr(e *expr) *expr {
+	if e.kind == localAddr {
+		f.escape(e.l)
+	}
+
+	return f.val(e)
+}
+
+func zeroValue(t *typ) string {
+	switch t.kind {
+	case '[', 's', 'U':
+		return fmt.Sprintf("[%d]byte{}", t.size)
+	}
+	return "0"
+}
+
+// normalize returns the bits v of an integer of type t, sign or zero extended.
+func normalize(t *typ, v int64) int64 {
+	w := uint(64 - 8*t.size)
+	if t.kind == 'i' {
+		return v << w >> w
+	}
+
+	return int64(uint64(v) << w >> w)
+}
+
+func (f *fn) intConst(t *typ, v int64) *expr {
+	v = normalize(t, v)
+	e := &expr{c: &cval{i: v}, kind: value, prec: 7, stable: true, t: t}
+	switch {
+	case t.kind == 'i':
+		e.s = strconv.FormatInt(v, 10)
+		if v < 0 {
+			e.prec = 6
+		}
+	default:
+		e.s = strconv.FormatUint(uint64(v), 10)
+	}
+	return e
+}
+
+func (f *fn) floatConst(t *typ, v float64) *expr {
+	bits := 64
+	if t.size == 4 {
+		bits = 32
+		v = float64(float32(v))
+	}
+	var s string
+	switch {
+	case math.IsInf(v, 1):
+		s = "math.Inf(1)"
+	case math.IsInf(v, -1):
+		s = "math.Inf(-1)"
+	case math.IsNaN(v):
+		s = "math.NaN()"
+	case v == 0 && math.Signbit(v):
+		s = "math.Copysign(0, -1)"
+	}
+	if s != "" {
+		f.imports["math"] = true
+		if bits == 32 {
+			s = fmt.Sprintf("float32(%s)", s)
+		}
+		return &expr{kind: value, prec: 7, s: s, stable: true, t: t}
+	}
+
+	e := &expr{c: &cval{f: v}, kind: value, prec: 7, s: strconv.FormatFloat(v, 'g', -1, bits), stable: true, t: t}
+	if v < 0 {
+		e.prec = 6
+	}
+	return e
+}
+
+// constant returns the constant of type t having the value c.
+func (f *fn) constant(t *typ, c *cval) *expr {
+	if t.kind == 'f' {
+		return f.floatConst(t, c.f)
+	}
+
+	return f.intConst(t, c.i)
+}
+
+func (f *fn) boolConst(b bool) *expr {
+	e := &expr{c: &cval{}, kind: boolean, prec: 7, s: "false", stable: true, t: f.typ(idInt32)}
+	if b {
+		e.c.i, e.s = 1, "true"
+	}
+	return e
+}
+
+// fold returns the value of the constant binary operation a op b of type t.
+func fold(op string, t *typ, a, b *cval) (*cval, bool) {
+	switch {
+	case t.kind == 'f':
+		x, y := a.f, b.f
+		var r float64
+		switch op {
+		case "+":
+			r = x + y
+		case "-":
+			r = x - y
+		case "*":
+			r = x * y
+		case "/":
+			r = x / y
+		default:
+			return nil, false
+		}
+		return &cval{f: r}, true
+	case t.isInteger():
+		x, y := a.i, b.i
+		var r int64
+		switch op {
+		case "+":
+			r = x + y
+		case "-":
+			r = x - y
+		case "*":
+			r = x * y
+		case "/", "%":
+			switch {
+			case y == 0:
+				return nil, false
+			case t.kind == 'i' && op == "/":
+				r = x / y
+			case t.kind == 'i':
+				r = x % y
+			case op == "/":
+				r = int64(uint64(x) / uint64(y))
+			default:
+				r = int64(uint64(x) % uint64(y))
+			}
+		case "&":
+			r = x & y
+		case "|":
+			r = x | y
+		case "^":
+			r = x ^ y
+		case "<<":
+			r = x << uint(y)
+		case ">>":
+			switch {
+			case t.kind == 'i':
+				r = x >> uint(y)
+			default:
+				r = int64(uint64(x) >> uint(y))
+			}
+		default:
+			return nil, false
+		}
+		return &cval{i: normalize(t, r)}, true
+	}
+	return nil, false
+}
+
+// foldCmp returns the value of the constant comparison a op b of operands of
+// type t.
+func foldCmp(op string, t *typ, a, b *cval) (bool, bool) {
+	var lt, eq bool
+	switch {
+	case t.kind == 'f':
+		if math.IsNaN(a.f) || math.IsNaN(b.f) {
+			return false, false
+		}
+
+		lt, eq = a.f < b.f, a.f == b.f
+	case t.kind == 'i':
+		lt, eq = a.i < b.i, a.i == b.i
+	case t.isInteger():
+		lt, eq = uint64(a.i) < uint64(b.i), a.i == b.i
+	default:
+		return false, false
+	}
+	switch op {
+	case "==":
+		return eq, true
+	case "!=":
+		return !eq, true
+	case "<":
+		return lt, true
+	case "<=":
+		return lt || eq, true
+	case ">":
+		return !lt && !eq, true
+	default:
+		return !lt, true
+	}
+}
+
+// foldConv returns the constant c of type from converted to type to.
+func foldConv(c *cval, from, to *typ) (*cval, bool) {
+	switch {
+	case from.isInteger() && to.isInteger():
+		return &cval{i: normalize(to, c.i)}, true
+	case from.isInteger() && to.kind == 'f':
+		if from.kind == 'i' {
+			return &cval{f: float64(c.i)}, true
+		}
+
+		return &cval{f: float64(uint64(c.i))}, true
+	case from.kind == 'f' && to.isInteger():
+		if math.IsNaN(c.f) || math.IsInf(c.f, 0) {
+			return nil, false
+		}
+
+		if to.kind != 'i' && c.f >= 1<<63 {
+			return &cval{i: normalize(to, int64(uint64(c.f)))}, true
+		}
+
+		return &cval{i: normalize(to, int64(c.f))}, true
+	case from.kind == 'f' && to.kind == 'f':
+		return &cval{f: c.f}, true
+	}
+	return nil, false
+}
+
+var (
+	idInt32  = ir.TypeID(dict.SID("int32"))
+	idVAList = ir.TypeID(dict.SID("*int8"))
+)
+
+func (f *fn) binop(id ir.TypeID, op string) {
+	t := f.typ(id)
+	b := f.val(f.pop())
+	a := f.val(f.pop())
+	if a.c != nil && b.c != nil {
+		if c, ok := fold(op, t, a.c, b.c); ok {
+			f.push(f.constant(t, c))
+			return
+		}
+	}
+
+	p := precedence[op]
+	f.push(&expr{kind: value, prec: p, reads: reads(a, b), s: fmt.Sprintf("%s %s %s", f.str(a, p), op, f.str(b, p+1)), stable: a.stable && b.stable, t: t})
+}
+
+func (f *fn) shift(id ir.TypeID, op string) {
+	t := f.typ(id)
+	n := f.val(f.pop())
+	a := f.val(f.pop())
+	if a.c != nil && n.c != nil {
+		if c, ok := fold(op, t, a.c, n.c); ok {
+			f.push(f.constant(t, c))
+			return
+		}
+	}
+
+	s := f.str(a, 5)
+	if a.c != nil {
+		s = f.typed(a)
+	}
+	f.push(&expr{kind: value, prec: 5, reads: reads(a, n), s: fmt.Sprintf("%s %s %s", s, op, f.str(n, 6)), stable: a.stable && n.stable, t: t})
+}
+
+// compare returns the boolean a op b.
+func (f *fn) compare(op string, a, b *expr) *expr {
+	if op == "==" || op == "!=" {
+		switch {
+		case a.kind == boolean && b.c != nil && b.c.i == 0:
+			if op == "==" {
+				return f.not(a)
+			}
+
+			return a
+		case b.kind == boolean && a.c != nil && a.c.i == 0:
+			if op == "==" {
+				return f.not(b)
+			}
+
+			return b
+		}
+	}
+
+	a, b = f.val(a), f.val(b)
+	if a.c != nil && b.c != nil {
+		if v, ok := foldCmp(op, a.t, a.c, b.c); ok {
+			return f.boolConst(v)
+		}
+	}
+
+	return &expr{a: a, b: b, cmp: op, kind: boolean, prec: 3, reads: reads(a, b), s: fmt.Sprintf("%s %s %s", f.str(a, 4), op, f.str(b, 4)), stable: a.stable && b.stable, t: f.typ(idInt32)}
+}
+
+// not returns the negation of the boolean e.
+func (f *fn) not(e *expr) *expr {
+	switch {
+	case e.c != nil:
+		return f.boolConst(e.c.i == 0)
+	case e.cmp != "" && (e.a.t.kind != 'f' || e.cmp == "==" || e.cmp == "!="):
+		return f.compare(negation[e.cmp], e.a, e.b)
+	}
+	return &expr{kind: boolean, prec: 6, reads: e.reads, s: "!" + f.str(e, 7), stable: e.stable, t: e.t}
+}
+
+// bool returns e != 0 as a boolean.
+func (f *fn) bool(e *expr) *expr {
+	switch {
+	case e.kind == boolean:
+		return e
+	case e.kind == funcAddr:
+		return f.boolConst(true)
+	case e.c != nil:
+		return f.boolConst(e.c.i != 0 || e.c.f != 0)
+	}
+
+	e = f.val(e)
+	return f.compare("!=", e, f.intConst(f.typ(idInt32), 0))
+}
+
+func (f *fn) convert(e *expr, from, to *typ) *expr {
+	if e.kind == funcAddr && to.kind == '*' {
+		r := *e
+		r.t = to
+		return &r
+	}
+
+	e = f.ptr(e)
+	if e.c != nil {
+		if c, ok := foldConv(e.c, from, to); ok {
+			return f.constant(to, c)
+		}
+	}
+
+	r := *e
+	r.c, r.cmp, r.load, r.t = nil, "", nil, to
+	ft, tt := f.goType(from), f.goType(to)
+	switch {
+	case ft == tt:
+		r.load = e.load
+		return &r
+	case to.kind == 'c' && from.kind != 'c':
+		ct := "float64"
+		if to.size == 8 {
+			ct = "float32"
+		}
+		r.s = fmt.Sprintf("complex(%s(%s), 0)", ct, f.str(e, 0))
+	case from.kind == 'c' && to.kind != 'c':
+		r.s = fmt.Sprintf("%s(real(%s))", tt, f.str(e, 0))
+	default:
+		r.s = fmt.Sprintf("%s(%s)", tt, f.str(e, 0))
+	}
+	r.off, r.prec = 0, 7
+	return &r
+}
+
+// element returns the address of the item i of the array of items of size sz
+// at p, or -i if neg is set.
+func (f *fn) element(p, i *expr, sz int64, neg bool, t *typ) *expr {
+	p, i = f.ptr(p), f.val(i)
+	if i.c != nil {
+		d := i.c.i * sz
+		if neg {
+			d = -d
+		}
+		return f.offset(p, d, t)
+	}
+
+	s := fmt.Sprintf("uintptr(%s)", f.str(i, 0))
+	if sz != 1 {
+		s = fmt.Sprintf("%s*%d", s, sz)
+	}
+	op := "+"
+	if neg {
+		op = "-"
+	}
+	return &expr{kind: value, prec: 4, reads: reads(p, i), s: fmt.Sprintf("%s %s %s", f.str(p, 4), op, s), stable: p.stable && i.stable, t: t}
+}
+
+// offset returns the pointer p of type t plus d bytes.
+func (f *fn) offset(p *expr, d int64, t *typ) *expr {
+	if p.c != nil {
+		return f.intConst(t, p.c.i+d)
+	}
+
+	r := *p
+	r.load, r.off, r.t = nil, p.off+d, t
+	return &r
+}
+
+// callOp translates the call of fp, or of the function pointer on the stack
+// if fp is nil, of type id with n arguments.
+func (f *fn) callOp(fp *expr, n int, id ir.TypeID) {
+	t := f.typ(id)
+	args := append([]*expr(nil), f.stack[len(f.stack)-n:]...)
+	f.stack = f.stack[:len(f.stack)-n]
+	if fp == nil {
+		fp = f.pop()
+	}
+	f.pop() // Arguments
+	if t.item != nil {
+		f.pop() // AllocResult
+	}
+	if t.variadic && len(args) > len(t.fields) {
+		// The variadic arguments are stored in 8 byte slots in the
+		// frame, the address of the first one is the last argument.
+		f.stabilize()
+		va := &expr{kind: value, off: f.vaBase + f.vaOffs[f.pc], prec: 7, s: "bp", stable: true, t: f.typ(idVAList)}
+		for i, v := range args[len(t.fields):] {
+			v = f.val(v)
+			p := *va
+			p.off += 8 * int64(i)
+			f.stmt("", fmt.Sprintf("%s = %s", f.deref(&p, v.t), f.str(v, 0)), v)
+		}
+		args = append(args[:len(t.fields):len(t.fields)], va)
+	}
+	a := []string{"tls"}
+	var r []*expr
+	for _, v := range args {
+		v = f.val(v)
+		r = append(r, v)
+		a = append(a, f.str(v, 0))
+	}
+	if t.variadic && len(args) == len(t.fields) {
+		a = append(a, "0")
+	}
+	var s string
+	switch fp.kind {
+	case funcAddr:
+		s = fp.s
+	default:
+		fp = f.val(fp)
+		r = append(r, fp)
+		f.imports["unsafe"] = true
+		switch {
+		case fp.load != nil:
+			s = fmt.Sprintf("(*(*%s)(unsafe.Pointer(%s)))", f.goType(t), f.str(fp.load, 0))
+		default:
+			s = fmt.Sprintf("(*(*%s)(unsafe.Pointer(&struct{ f uintptr }{%s})))", f.goType(t), f.str(fp, 0))
+		}
+	}
+	e := &expr{kind: call, prec: 7, reads: reads(r...), s: fmt.Sprintf("%s(%s)", s, strings.Join(a, ", ")), t: t.item}
+	if t.item == nil {
+		f.stabilize()
+		f.stmt("", e.s, e)
+		return
+	}
+
+	f.push(e)
+}
+
+// label returns the Go name of the label n.
+func (f *fn) label(n int) string {
+	if s := f.labelNms[n]; s != "" {
+		return s
+	}
+
+	return fmt.Sprintf("l%d", n)
+}
+
+func sameItem(a, b *expr) bool {
+	return a.kind == b.kind && a.s == b.s && a.off == b.off && a.l == b.l
+}
+
+// arrive records the evaluation stack at a jump to the label n and returns
+// the statements passing the stack items to it.
+func (f *fn) arrive(n int) []string {
+	f.stabilize()
+	lb := f.labels[n]
+	if lb == nil {
+		lb = &arrival{}
+		f.labels[n] = lb
+	}
+	switch {
+	case lb.placed:
+		if len(f.stack) != 0 || len(lb.stack) != 0 {
+			f.fail("backward jump with a non-empty evaluation stack is not supported")
+		}
+	case !lb.ok:
+		lb.ok = true
+		lb.stack = append([]*expr(nil), f.stack...)
+	default:
+		if len(f.stack) != len(lb.stack) {
+			f.fail("internal error: evaluation stack mismatch at label %d", n)
+		}
+
+		for i, v := range f.stack {
+			if k := (slot{n, i}); !f.slots[k] && !sameItem(v, lb.stack[i]) {
+				f.slots[k] = true
+				panic(errRestart)
+			}
+		}
+	}
+	var r []string
+	for i, v := range f.stack {
+		if k := (slot{n, i}); f.slots[k] {
+			v = f.val(v)
+			f.use(v)
+			r = append(r, fmt.Sprintf("%s = %s", f.slot(k, v).name, f.str(v, 0)))
+		}
+	}
+	return r
+}
+
+func (f *fn) slot(k slot, e *expr) *local {
+	l := f.slotNames[k]
+	if l == nil {
+		l = &local{gotype: f.goType(e.t), name: fmt.Sprintf("l%d_%d", k.label, k.depth), ref: true}
+		f.slotNames[k] = l
+		f.temps = append(f.temps, l)
+	}
+	return l
+}
+
+// jump translates a jump to the label n, taken if cond is true or if cond is
+// nil.
+func (f *fn) jump(n int, cond *expr) {
+	f.flush("")
+	f.stabilize()
+	a := append(f.arrive(n), fmt.Sprintf("goto %s", f.label(n)))
+	f.gotos[n] = true
+	if cond == nil {
+		for _, v := range a {
+			f.emit(v)
+		}
+		f.dead = true
+		return
+	}
+
+	f.use(cond)
+	f.emit(fmt.Sprintf("if %s {\n%s\n}", f.str(cond, 0), strings.Join(a, "\n")))
+}
+
+// branch translates a conditional jump to the label n taken if e is nonzero,
+// or zero if nz is not set.
+func (f *fn) branch(n int, e *expr, nz bool) {
+	c := f.bool(e)
+	if !nz {
+		c = f.not(c)
+	}
+	if c.c != nil {
+		if c.c.i != 0 {
+			f.jump(n, nil)
+		}
+		return
+	}
+
+	f.jump(n, c)
+}
+
+// place translates the label n.
+func (f *fn) place(n int) {
+	if !f.targets[n] {
+		f.dead = false
+		return
+	}
+
+	f.flush("")
+	if !f.dead {
+		for _, v := range f.arrive(n) {
+			f.emit(v)
+		}
+	}
+	lb := f.labels[n]
+	if lb == nil {
+		lb = &arrival{}
+		f.labels[n] = lb
+	}
+	if !lb.ok {
+		lb.ok = true
+		lb.stack = nil
+	}
+	lb.placed = true
+	f.stack = f.stack[:0]
+	for i, v := range lb.stack {
+		if k := (slot{n, i}); f.slots[k] {
+			l := f.slotNames[k]
+			v = &expr{kind: value, prec: 7, reads: []*local{l}, s: l.name, stable: true, t: f.val(v).t}
+		}
+		f.push(v)
+	}
+	f.emit(f.label(n) + ":")
+	f.dead = false
+	f.prologue = false
+}
+
+func (f *fn) switchOp(x *ir.Switch) {
+	t := f.typ(x.TypeID)
+	v := f.val(f.pop())
+	f.flush("")
+	if !v.isStable() {
+		v = f.spill(v)
+	}
+	f.stabilize()
+	var b bytes.Buffer
+	jump := func(n int) {
+		for _, v := range f.arrive(n) {
+			fmt.Fprintf(&b, "%s\n", v)
+		}
+		fmt.Fprintf(&b, "goto %s\n", f.label(n))
+		f.gotos[n] = true
+	}
+	f.use(v)
+	fmt.Fprintf(&b, "switch %s {\n", f.str(v, 0))
+	for _, c := range x.Cases {
+		var n int64
+		switch y := c.Value.(type) {
+		case *ir.Int32Value:
+			n = int64(y.Value)
+		case *ir.Int64Value:
+			n = y.Value
+		default:
+			f.fail("unexpected case value %T", y)
+		}
+		fmt.Fprintf(&b, "case %s:\n", f.intConst(t, n).s)
+		jump(c.Number)
+	}
+	b.WriteString("default:\n")
+	jump(x.Default.Number)
+	b.WriteString("}")
+	f.emit(b.String())
+	f.dead = true
+}
+
+func (f *fn) store(t *typ) {
+	v := f.val(f.pop())
+	a := f.pop()
+	if a.kind != localAddr {
+		a = f.ptr(a)
+	}
+	drop := f.dropped()
+	f.stabilize()
+	if !drop && v.c == nil {
+		v = f.spill(v)
+	}
+	lhs, key := f.lvalue(a, t)
+	f.stmt(key, fmt.Sprintf("%s = %s", lhs, f.str(v, 0)), a, v)
+	if !drop {
+		f.push(v)
+	}
+}
+
+func (f *fn) incDec(t *typ, delta int, post bool) {
+	a := f.pop()
+	if a.kind != localAddr {
+		a = f.ptr(a)
+	}
+	drop := f.dropped()
+	f.stabilize()
+	if !drop && !a.isStable() {
+		a = f.spill(a)
+	}
+	var old *expr
+	if post && !drop {
+		old = f.spill(f.load(a, t))
+	}
+	lhs, _ := f.lvalue(a, t)
+	var s string
+	switch {
+	case delta == 1:
+		s = lhs + "++"
+	case delta == -1:
+		s = lhs + "--"
+	case delta > 0:
+		s = fmt.Sprintf("%s += %d", lhs, delta)
+	default:
+		s = fmt.Sprintf("%s -= %d", lhs, -delta)
+	}
+	f.stmt("", s, a)
+	switch {
+	case drop:
+		// nop
+	case post:
+		f.push(old)
+	default:
+		f.push(f.load(a, t))
+	}
+}
+
+func (f *fn) ret() {
+	f.flush("")
+	s := "return"
+	if r := f.result; r != nil {
+		if r.memory {
+			f.emit(fmt.Sprintf("r = %s", f.deref(f.addrOf(r, nil), r.typ)))
+		}
+		s = "return r"
+	}
+	if f.frame != 0 {
+		f.emit(fmt.Sprintf("tls.Free(%d)", f.frame))
+	}
+	f.emit(s)
+	f.dead = true
+}
+
+func (f *fn) op(op ir.Operation) {
+	switch x := op.(type) {
+	case *ir.AllocResult:
+		f.push(&expr{kind: marker, s: "result"})
+	case *ir.Add:
+		f.binop(x.TypeID, "+")
+	case *ir.And:
+		f.binop(x.TypeID, "&")
+	case *ir.Argument:
+		f.push(f.addrOf(f.args[x.Index], f.typ(x.TypeID)))
+	case *ir.Arguments:
+		f.push(&expr{kind: marker, s: "arguments"})
+	case *ir.BeginScope, *ir.EndScope:
+		// nop
+	case *ir.Bool:
+		f.push(f.bool(f.pop()))
+	case *ir.Call:
+		f.callOp(&expr{kind: funcAddr, s: f.names[x.Index]}, x.Arguments, x.TypeID)
+	case *ir.CallFP:
+		f.callOp(nil, x.Arguments, x.TypeID)
+	case *ir.Const:
+		switch y := x.Value.(type) {
+		case *ir.Float32Value:
+			f.push(f.floatConst(f.typ(x.TypeID), float64(y.Value)))
+		case *ir.Float64Value:
+			f.push(f.floatConst(f.typ(x.TypeID), y.Value))
+		default:
+			f.fail("unexpected constant %T", y)
+		}
+	case *ir.Const32:
+		f.push(f.intConst(f.typ(x.TypeID), int64(x.Value)))
+	case *ir.Const64:
+		f.push(f.intConst(f.typ(x.TypeID), x.Value))
+	case *ir.Convert:
+		f.push(f.convert(f.pop(), f.typ(x.TypeID), f.typ(x.Result)))
+	case *ir.Cpl:
+		e := f.val(f.pop())
+		if e.c != nil {
+			f.push(f.intConst(e.t, ^e.c.i))
+			break
+		}
+
+		f.push(&expr{kind: value, prec: 6, reads: e.reads, s: "^" + f.str(e, 6), stable: e.stable, t: e.t})
+	case *ir.Div:
+		f.binop(x.TypeID, "/")
+	case *ir.Drop:
+		if e := f.pop(); e.kind == call {
+			f.stabilize()
+			f.stmt("", e.s, e)
+		}
+	case *ir.Dup:
+		e := f.pop()
+		if !e.isStable() {
+			e = f.spill(e)
+		}
+		f.push(e)
+		f.push(e)
+	case *ir.Element:
+		t := f.typ(x.TypeID)
+		i := f.pop()
+		f.push(f.element(f.pop(), i, t.item.size, x.Neg, t))
+	case *ir.Eq:
+		b := f.pop()
+		f.push(f.compare("==", f.pop(), b))
+	case *ir.Field:
+		st := f.typ(x.TypeID).item
+		p := f.ptr(f.pop())
+		f.push(f.offset(p, st.offs[x.Index], &typ{align: ptrSize, item: st.fields[x.Index], kind: '*', size: ptrSize}))
+	case *ir.Geq:
+		b := f.pop()
+		f.push(f.compare(">=", f.pop(), b))
+	case *ir.Global:
+		f.global(x)
+	case *ir.Gt:
+		b := f.pop()
+		f.push(f.compare(">", f.pop(), b))
+	case *ir.Jmp:
+		f.jump(x.Number, nil)
+	case *ir.Jnz:
+		f.branch(x.Number, f.pop(), true)
+	case *ir.Jz:
+		f.branch(x.Number, f.pop(), false)
+	case *ir.Label:
+		f.place(x.Number)
+	case *ir.Leq:
+		b := f.pop()
+		f.push(f.compare("<=", f.pop(), b))
+	case *ir.Load:
+		f.push(f.load(f.pop(), f.typ(x.TypeID).item))
+	case *ir.Lsh:
+		f.shift(x.TypeID, "<<")
+	case *ir.Lt:
+		b := f.pop()
+		f.push(f.compare("<", f.pop(), b))
+	case *ir.Mul:
+		f.binop(x.TypeID, "*")
+	case *ir.Neg:
+		e := f.val(f.pop())
+		if e.c != nil {
+			switch {
+			case e.t.kind == 'f':
+				f.push(f.floatConst(e.t, -e.c.f))
+			default:
+				f.push(f.intConst(e.t, -e.c.i))
+			}
+			break
+		}
+
+		s := f.str(e, 6)
+		if strings.HasPrefix(s, "-") {
+			s = "(" + s + ")"
+		}
+		f.push(&expr{kind: value, prec: 6, reads: e.reads, s: "-" + s, stable: e.stable, t: e.t})
+	case *ir.Neq:
+		b := f.pop()
+		f.push(f.compare("!=", f.pop(), b))
+	case *ir.Nil:
+		f.push(f.intConst(f.typ(x.TypeID), 0))
+	case *ir.Or:
+		f.binop(x.TypeID, "|")
+	case *ir.Panic:
+		f.flush("")
+		f.emit(`panic("unreachable")`)
+		f.dead = true
+	case *ir.PostIncrement:
+		if x.Bits != 0 {
+			f.fail("unsupported bit-field increment")
+		}
+
+		f.incDec(f.typ(x.TypeID), x.Delta, true)
+	case *ir.PreIncrement:
+		if x.Bits != 0 {
+			f.fail("unsupported bit-field increment")
+		}
+
+		f.incDec(f.typ(x.TypeID), x.Delta, false)
+	case *ir.PtrDiff:
+		pt := f.typ(x.PtrType)
+		t := f.typ(x.TypeID)
+		b := f.ptr(f.pop())
+		a := f.ptr(f.pop())
+		sz := pt.item.size
+		if a.c != nil && b.c != nil && sz != 0 {
+			f.push(f.intConst(t, (a.c.i-b.c.i)/sz))
+			break
+		}
+
+		e := &expr{kind: value, prec: 7, reads: reads(a, b), s: fmt.Sprintf("%s(%s - %s)", f.goType(t), f.str(a, 4), f.str(b, 5)), stable: a.stable && b.stable, t: t}
+		if sz > 1 {
+			e.s, e.prec = fmt.Sprintf("%s / %d", e.s, sz), 5
+		}
+		f.push(e)
+	case *ir.Rem:
+		f.binop(x.TypeID, "%")
+	case *ir.Result:
+		f.push(f.addrOf(f.result, f.typ(x.TypeID)))
+	case *ir.Return:
+		f.ret()
+	case *ir.Rsh:
+		f.shift(x.TypeID, ">>")
+	case *ir.Store:
+		if x.Bits != 0 {
+			f.fail("unsupported bit-field store")
+		}
+
+		f.store(f.typ(x.TypeID))
+	case *ir.StringConst:
+		f.push(&expr{kind: value, off: f.gen.str(x.Value), prec: 7, s: "ts", stable: true, t: f.typ(x.TypeID)})
+	case *ir.Sub:
+		f.binop(x.TypeID, "-")
+	case *ir.Switch:
+		f.switchOp(x)
+	case *ir.Variable:
+		f.push(f.addrOf(f.vars[x.Index], f.typ(x.TypeID)))
+	case *ir.VariableDeclaration:
+		f.declaration(x)
+	case *ir.Xor:
+		f.binop(x.TypeID, "^")
+	default:
+		f.fail("unsupported operation %T", x)
+	}
+}
+
+func (f *fn) global(x *ir.Global) {
+	t := f.typ(x.TypeID)
+	if x.Index >= 0 {
+		nm := f.names[x.Index]
+		if _, ok := f.objects[x.Index].(*ir.FunctionDefinition); ok {
+			f.push(&expr{kind: funcAddr, prec: 7, s: nm, stable: true, t: t})
+			return
+		}
+
+		f.push(&expr{kind: value, prec: 7, s: nm, stable: true, t: t})
+		return
+	}
+
+	f.imports[crtPath] = true
+	nm := fmt.Sprintf("crt.X%s", dict.S(int(x.NameID)))
+	if t.item.kind == 'F' {
+		f.push(&expr{kind: funcAddr, prec: 7, s: nm, stable: true, t: t})
+		return
+	}
+
+	f.push(&expr{kind: value, prec: 7, s: nm, stable: true, t: t})
+}
+
+func (f *fn) declaration(x *ir.VariableDeclaration) {
+	if x.Value != nil {
+		f.fail("unsupported variable initializer")
+	}
+
+	l := f.vars[x.Index]
+	f.flush("")
+	switch {
+	case l.memory:
+		lhs, key := f.lvalue(f.addrOf(l, nil), l.typ)
+		f.zero = &pending{key, fmt.Sprintf("%s = %s", lhs, zeroValue(l.typ))}
+	case !f.prologue:
+		l.ref = true
+		f.zero = &pending{l.name, fmt.Sprintf("%s = %s", l.name, zeroValue(l.typ))}
+	}
+}
@@ -0,0 +1,135 @@
+// The C library as seen by translated programs: allocation, strings,
+// callbacks, time, formatted output and the system interface.
+
+#define CHECK(x) if (++check, !(x)) return check
+
+int check;
+
+typedef unsigned long size_t;
+typedef long time_t;
+
+struct timeval {
+	long tv_sec;
+	long tv_usec;
+};
+
+struct tm {
+	int tm_sec, tm_min, tm_hour, tm_mday, tm_mon, tm_year, tm_wday, tm_yday, tm_isdst;
+	long tm_gmtoff;
+	const char *tm_zone;
+};
+
+void *malloc(size_t);
+void *calloc(size_t, size_t);
+void *realloc(void *, size_t);
+void free(void *);
+size_t malloc_usable_size(void *);
+int memcmp(const void *, const void *, size_t);
+void *memcpy(void *, const void *, size_t);
+void *memmove(void *, const void *, size_t);
+int strcmp(const char *, const char *);
+int strncmp(const char *, const char *, size_t);
+size_t strlen(const char *);
+char *strrchr(const char *, int);
+void qsort(void *, size_t, size_t, int (*)(const void *, const void *));
+int gettimeofday(struct timeval *, void *);
+struct tm *localtime_r(const time_t *, struct tm *);
+time_t time(time_t *);
+int usleep(unsigned);
+int getpid(void);
+int *__errno_location(void);
+int open(const char *, int, ...);
+long write(int, const void *, size_t);
+long pread(int, void *, size_t, long);
+int close(int);
+int unlink(const char *);
+void *dlopen(const char *, int);
+int snprintf(char *, size_t, const char *, ...);
+int sprintf(char *, const char *, ...);
+int vsnprintf(char *, size_t, const char *, __builtin_va_list);
+
+#define errno (*__errno_location())
+
+// format is snprintf into a buffer of 32 bytes.
+static int format(char *buf, const char *fmt, ...) {
+	__builtin_va_list ap;
+	int n;
+	__builtin_va_start(ap, fmt);
+	n = vsnprintf(buf, 32, fmt, ap);
+	__builtin_va_end(ap);
+	return n;
+}
+
+static int cmp(const void *a, const void *b) {
+	return *(const int *)a - *(const int *)b;
+}
+
+int main() {
+	int i, *p, a[] = {4, -2, 9, 0, 7, 7, -5};
+	char *s;
+	struct timeval tv;
+	struct tm tm;
+	time_t t;
+	int fd;
+	char buf[8];
+
+	p = malloc(10 * sizeof(int));
+	CHECK(p != 0);
+	CHECK(malloc_usable_size(p) >= 10 * sizeof(int));
+	for (i = 0; i < 10; i++)
+		p[i] = i * i;
+	p = realloc(p, 1000 * sizeof(int));
+	CHECK(malloc_usable_size(p) >= 1000 * sizeof(int));
+	for (i = 0; i < 10; i++)
+		CHECK(p[i] == i * i);
+	free(p);
+	p = calloc(4, sizeof(int));
+	CHECK(p[0] == 0 && p[3] == 0);
+	free(p);
+
+	s = malloc(16);
+	memcpy(s, "abcdef", 7);
+	memmove(s + 1, s, 6);
+	CHECK(strcmp(s, "aabcdef") == 0);
+	CHECK(strncmp(s, "aaX", 2) == 0);
+	CHECK(strncmp(s, "aaz", 3) < 0);
+	CHECK(memcmp(s, "aab", 3) == 0);
+	CHECK(strlen(s) == 7);
+	CHECK(strrchr(s, 'a') == s + 1);
+	free(s);
+
+	qsort(a, sizeof a / sizeof a[0], sizeof a[0], cmp);
+	for (i = 1; i < sizeof a / sizeof a[0]; i++)
+		CHECK(a[i - 1] <= a[i]);
+
+	CHECK(gettimeofday(&tv, 0) == 0);
+	CHECK(tv.tv_sec > 1500000000 && tv.tv_usec >= 0 && tv.tv_usec < 1000000);
+	t = 86400 * 365;
+	CHECK(localtime_r(&t, &tm) == &tm);
+	CHECK(tm.tm_year == 70 || tm.tm_year == 71);
+	CHECK(time(&t) == t);
+	CHECK(usleep(1000) == 0);
+	CHECK(getpid() > 0);
+
+	CHECK(open("/nonexistent/file", 0) == -1);
+	CHECK(errno == 2); // ENOENT
+	fd = open("_libc.tmp", 0102, 0644); // O_RDWR|O_CREAT
+	CHECK(fd >= 0);
+	CHECK(write(fd, "hello", 5) == 5);
+	CHECK(pread(fd, buf, sizeof buf, 1) == 4);
+	CHECK(memcmp(buf, "ello", 4) == 0);
+	CHECK(close(fd) == 0);
+	CHECK(unlink("_libc.tmp") == 0);
+
+	CHECK(dlopen("libc.so.6", 1) == 0);
+
+	CHECK(snprintf(buf, sizeof buf, "%d|%s", -42, "abcdef") == 10);
+	CHECK(strcmp(buf, "-42|abc") == 0);
+	s = malloc(64);
+	CHECK(sprintf(s, "%5.2f|%-3c|%#lx|%hhu", 3.14159, 'x', 255L, 257) == 16);
+	CHECK(strcmp(s, " 3.14|x  |0xff|1") == 0);
+	CHECK(format(s, "%s=%lld%%%c", "x", -1LL << 40, 'y') == 18);
+	CHECK(strcmp(s, "x=-1099511627776%y") == 0);
+	free(s);
+	return 0;
+}
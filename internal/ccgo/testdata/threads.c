@@ -0,0 +1,133 @@
+// Threads as seen by translated programs: the pthread functions SQLite uses
+// with SQLITE_THREADSAFE=1, condition variables and thread-specific data.
+
+#define CHECK(x) if (++check, !(x)) return check
+
+int check;
+
+typedef unsigned long pthread_t;
+typedef unsigned pthread_key_t;
+
+typedef union {
+	char size[40];
+	long align;
+} pthread_mutex_t;
+
+typedef union {
+	char size[4];
+	int align;
+} pthread_mutexattr_t;
+
+typedef union {
+	char size[48];
+	long long align;
+} pthread_cond_t;
+
+typedef union {
+	char size[56];
+	long align;
+} pthread_attr_t;
+
+#define PTHREAD_MUTEX_INITIALIZER {{0}}
+#define PTHREAD_MUTEX_RECURSIVE 1
+
+int pthread_create(pthread_t *, const pthread_attr_t *, void *(*)(void *), void *);
+int pthread_join(pthread_t, void **);
+pthread_t pthread_self(void);
+int pthread_equal(pthread_t, pthread_t);
+int pthread_mutexattr_init(pthread_mutexattr_t *);
+int pthread_mutexattr_settype(pthread_mutexattr_t *, int);
+int pthread_mutexattr_destroy(pthread_mutexattr_t *);
+int pthread_mutex_init(pthread_mutex_t *, const pthread_mutexattr_t *);
+int pthread_mutex_destroy(pthread_mutex_t *);
+int pthread_mutex_lock(pthread_mutex_t *);
+int pthread_mutex_trylock(pthread_mutex_t *);
+int pthread_mutex_unlock(pthread_mutex_t *);
+int pthread_cond_init(pthread_cond_t *, const void *);
+int pthread_cond_destroy(pthread_cond_t *);
+int pthread_cond_wait(pthread_cond_t *, pthread_mutex_t *);
+int pthread_cond_broadcast(pthread_cond_t *);
+int pthread_key_create(pthread_key_t *, void (*)(void *));
+void *pthread_getspecific(pthread_key_t);
+int pthread_setspecific(pthread_key_t, const void *);
+
+// A mutex like the sqlite3_mutex of mutex_unix.c.
+struct sqlite3_mutex {
+	pthread_mutex_t mutex;
+	int id;
+};
+
+struct sqlite3_mutex staticMutex = {PTHREAD_MUTEX_INITIALIZER, 2};
+struct sqlite3_mutex recursiveMutex;
+
+pthread_mutex_t gate = PTHREAD_MUTEX_INITIALIZER;
+pthread_cond_t gateOpen;
+int opened;
+
+pthread_key_t key;
+int destroyed;
+
+long counter;
+
+void destroy(void *p) {
+	pthread_mutex_lock(&staticMutex.mutex);
+	destroyed += (long)p;
+	pthread_mutex_unlock(&staticMutex.mutex);
+}
+
+void *worker(void *arg) {
+	int i;
+
+	pthread_mutex_lock(&gate);
+	while (!opened)
+		pthread_cond_wait(&gateOpen, &gate);
+	pthread_mutex_unlock(&gate);
+
+	pthread_setspecific(key, arg);
+	for (i = 0; i < 1000; i++) {
+		pthread_mutex_lock(&recursiveMutex.mutex);
+		pthread_mutex_lock(&recursiveMutex.mutex);
+		counter++;
+		pthread_mutex_unlock(&recursiveMutex.mutex);
+		pthread_mutex_unlock(&recursiveMutex.mutex);
+	}
+	return pthread_getspecific(key);
+}
+
+int main() {
+	pthread_mutexattr_t attr;
+	pthread_t threads[4];
+	void *r;
+	long i, sum = 0;
+
+	pthread_mutexattr_init(&attr);
+	pthread_mutexattr_settype(&attr, PTHREAD_MUTEX_RECURSIVE);
+	CHECK(pthread_mutex_init(&recursiveMutex.mutex, &attr) == 0);
+	pthread_mutexattr_destroy(&attr);
+	CHECK(pthread_cond_init(&gateOpen, 0) == 0);
+	CHECK(pthread_key_create(&key, destroy) == 0);
+
+	for (i = 0; i < 4; i++)
+		CHECK(pthread_create(&threads[i], 0, worker, (void *)(i + 1)) == 0);
+
+	pthread_mutex_lock(&gate);
+	opened = 1;
+	pthread_cond_broadcast(&gateOpen);
+	pthread_mutex_unlock(&gate);
+
+	for (i = 0; i < 4; i++) {
+		CHECK(!pthread_equal(threads[i], pthread_self()));
+		CHECK(pthread_join(threads[i], &r) == 0);
+		sum += (long)r;
+	}
+	CHECK(sum == 10);
+	CHECK(destroyed == 10);
+	CHECK(counter == 4000);
+	CHECK(pthread_getspecific(key) == 0);
+	CHECK(pthread_equal(pthread_self(), pthread_self()));
+
+	CHECK(pthread_mutex_trylock(&staticMutex.mutex) == 0);
+	CHECK(pthread_mutex_unlock(&staticMutex.mutex) == 0);
+	CHECK(pthread_mutex_destroy(&recursiveMutex.mutex) == 0);
+	CHECK(pthread_cond_destroy(&gateOpen) == 0);
+}
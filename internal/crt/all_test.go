@@ -0,0 +1,757 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func caller(s string, va ...interface{}) {
+	if s == "" {
+		s = strings.Repeat("%v ", len(va))
+	}
+	_, fn, fl, _ := runtime.Caller(2)
+	fmt.Fprintf(os.Stderr, "# caller: %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintf(os.Stderr, s, va...)
+	fmt.Fprintln(os.Stderr)
+	_, fn, fl, _ = runtime.Caller(1)
+	fmt.Fprintf(os.Stderr, "# \tcallee: %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintln(os.Stderr)
+	os.Stderr.Sync()
+}
+
+func dbg(s string, va ...interface{}) {
+	if s == "" {
+		s = strings.Repeat("%v ", len(va))
+	}
+	_, fn, fl, _ := runtime.Caller(1)
+	fmt.Fprintf(os.Stderr, "# dbg %s:%d: ", path.Base(fn), fl)
+	fmt.Fprintf(os.Stderr, s, va...)
+	fmt.Fprintln(os.Stderr)
+	os.Stderr.Sync()
+}
+
+func TODO(...interface{}) string { //TODOOK
+	_, fn, fl, _ := runtime.Caller(1)
+	return fmt.Sprintf("# TODO: %s:%d:\n", path.Base(fn), fl) //TODOOK
+}
+
+func use(...interface{}) {}
+
+func init() {
+	use(caller, dbg, TODO) //TODOOK
+}
+
+// ============================================================================
+
+func TestMalloc(t *testing.T) {
+	tls := NewTLS()
+	for _, n := range []uint64{0, 1, 15, 16, 17, 100, 4096} {
+		p := Xmalloc(tls, n)
+		if p == 0 || p%16 != 0 {
+			t.Fatalf("malloc(%v): %#x", n, p)
+		}
+
+		u := Xmalloc_usable_size(tls, p)
+		if u < n {
+			t.Fatalf("malloc_usable_size(malloc(%v)): %v", n, u)
+		}
+
+		b := mem(p, int(u))
+		for i := range b {
+			b[i] = byte(i)
+		}
+		q := Xrealloc(tls, p, 2*u+1)
+		if Xmalloc_usable_size(tls, q) < 2*u+1 {
+			t.Fatal(Xmalloc_usable_size(tls, q))
+		}
+
+		for i, v := range mem(q, int(u)) {
+			if v != byte(i) {
+				t.Fatalf("realloc lost data at %v", i)
+			}
+		}
+		Xfree(tls, q)
+	}
+
+	if g, e := Xmalloc_usable_size(tls, 0), uint64(0); g != e {
+		t.Fatal(g, e)
+	}
+
+	Xfree(tls, 0)
+	if p := Xcalloc(tls, 1<<33, 1<<33); p != 0 {
+		t.Fatalf("%#x", p)
+	}
+
+	if g, e := *(*int32)(pointer(X__errno_location(tls))), int32(syscall.ENOMEM); g != e {
+		t.Fatal(g, e)
+	}
+
+	p := Xcalloc(tls, 10, 10)
+	for i, v := range mem(p, 100) {
+		if v != 0 {
+			t.Fatal(i, v)
+		}
+	}
+	Xfree(tls, p)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("double free not detected")
+			}
+		}()
+
+		Xfree(tls, p)
+	}()
+}
+
+func sign(n int32) int32 {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestString(t *testing.T) {
+	tls := NewTLS()
+	for _, v := range []struct{ a, b string }{
+		{"", ""},
+		{"", "a"},
+		{"a", "a"},
+		{"ab", "a"},
+		{"abc", "abd"},
+		{"\xff", "\x01"},
+	} {
+		a, b := CString(v.a), CString(v.b)
+		if g, e := sign(Xstrcmp(tls, a, b)), int32(strings.Compare(v.a, v.b)); g != e {
+			t.Errorf("strcmp(%q, %q): %v, expected %v", v.a, v.b, g, e)
+		}
+
+		if g, e := sign(Xstrncmp(tls, a, b, 1)), int32(strings.Compare(prefix(v.a, 1), prefix(v.b, 1))); g != e {
+			t.Errorf("strncmp(%q, %q, 1): %v, expected %v", v.a, v.b, g, e)
+		}
+
+		if g, e := Xstrlen(tls, a), uint64(len(v.a)); g != e {
+			t.Errorf("strlen(%q): %v, expected %v", v.a, g, e)
+		}
+	}
+
+	s := CString("hello, world")
+	if g, e := Xstrchr(tls, s, 'o')-s, uintptr(4); g != e {
+		t.Error(g, e)
+	}
+
+	if g, e := Xstrrchr(tls, s, 'o')-s, uintptr(8); g != e {
+		t.Error(g, e)
+	}
+
+	if g := Xstrchr(tls, s, 'x'); g != 0 {
+		t.Error(g)
+	}
+
+	if g, e := Xstrchr(tls, s, 0)-s, uintptr(12); g != e {
+		t.Error(g, e)
+	}
+
+	if g, e := Xstrcspn(tls, s, CString(" ,")), uint64(5); g != e {
+		t.Error(g, e)
+	}
+
+	if g, e := Xstrspn(tls, s, CString("leh")), uint64(4); g != e {
+		t.Error(g, e)
+	}
+
+	if g, e := Xstrstr(tls, s, CString("wor"))-s, uintptr(7); g != e {
+		t.Error(g, e)
+	}
+
+	if g, e := sign(Xmemcmp(tls, s, CString("help"), 4)), int32(-1); g != e {
+		t.Error(g, e)
+	}
+
+	if g, e := Xmemchr(tls, s, ',', 12)-s, uintptr(5); g != e {
+		t.Error(g, e)
+	}
+
+	d := Xmalloc(tls, 32)
+	Xstrncpy(tls, d, s, 32)
+	if g, e := string(mem(d, 32)), "hello, world"+strings.Repeat("\x00", 20); g != e {
+		t.Errorf("%q %q", g, e)
+	}
+
+	Xmemmove(tls, d+1, d, 5)
+	if g, e := GoString(d), "hhello world"; g != e {
+		t.Errorf("%q %q", g, e)
+	}
+
+	Xstrcpy(tls, d, CString("foo"))
+	Xstrcat(tls, d, CString("bar"))
+	if g, e := GoString(Xstrdup(tls, d)), "foobar"; g != e {
+		t.Errorf("%q %q", g, e)
+	}
+}
+
+func prefix(s string, n int) string {
+	if n < len(s) {
+		return s[:n]
+	}
+
+	return s
+}
+
+func TestQsort(t *testing.T) {
+	tls := NewTLS()
+	a := []int32{5, -1, 3, 3, 0, 42, -7, 1}
+	p := Xmalloc(tls, uint64(4*len(a)))
+	for i, v := range a {
+		*(*int32)(pointer(p + uintptr(4*i))) = v
+	}
+	cmp := func(tls *TLS, a, b uintptr) int32 {
+		return *(*int32)(pointer(a)) - *(*int32)(pointer(b))
+	}
+	Xqsort(tls, p, uint64(len(a)), 4, FP(cmp))
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	for i, v := range a {
+		if g := *(*int32)(pointer(p + uintptr(4*i))); g != v {
+			t.Fatal(i, g, v)
+		}
+	}
+}
+
+func TestLocaltime(t *testing.T) {
+	tls := NewTLS()
+	p := Xmalloc(tls, 8)
+	if g := Xtime(tls, p); g != *(*int64)(pointer(p)) {
+		t.Fatal(g)
+	}
+
+	for _, v := range []int64{0, 951782400, 1500000000} {
+		*(*int64)(pointer(p)) = v
+		r := (*tm)(pointer(Xlocaltime(tls, p)))
+		e := time.Unix(v, 0)
+		zone, off := e.Zone()
+		if r.year+1900 != int32(e.Year()) || time.Month(r.mon+1) != e.Month() || r.mday != int32(e.Day()) ||
+			r.hour != int32(e.Hour()) || r.min != int32(e.Minute()) || r.sec != int32(e.Second()) ||
+			time.Weekday(r.wday) != e.Weekday() || r.yday+1 != int32(e.YearDay()) ||
+			r.gmtoff != int64(off) || GoString(r.zone) != zone {
+			t.Errorf("%v: %+v, expected %v", v, r, e)
+		}
+	}
+
+	if g, e := unsafe.Sizeof(tm{}), uintptr(56); g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestUsleep(t *testing.T) {
+	tls := NewTLS()
+	tv := Xmalloc(tls, 16)
+	Xgettimeofday(tls, tv, 0)
+	t0 := time.Now()
+	if g := Xusleep(tls, 20000); g != 0 {
+		t.Fatal(g)
+	}
+
+	if d := time.Since(t0); d < 20*time.Millisecond {
+		t.Fatal(d)
+	}
+
+	r := *(*timeval)(pointer(tv))
+	if d := t0.Sub(time.Unix(r.sec, r.usec*1000)); d < 0 || d > time.Second || r.usec >= 1e6 {
+		t.Fatal(d, r)
+	}
+}
+
+func TestDlopen(t *testing.T) {
+	tls := NewTLS()
+	if g := Xdlopen(tls, CString("libc.so.6"), 1); g != 0 {
+		t.Fatal(g)
+	}
+
+	if g := GoString(Xdlerror(tls)); g == "" {
+		t.Fatal(g)
+	}
+}
+
+// TestPrintf compares the output of snprintf with the glibc output recorded
+// in testdata/printf/glibc.txt. See testdata/printf/generate.go.
+func TestPrintf(t *testing.T) {
+	fn := filepath.Join("testdata", "printf", "glibc.txt")
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tls := NewTLS()
+	buf := Xmalloc(tls, 4096)
+	n := 0
+	for i, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pos := fmt.Sprintf("%s:%d", fn, i+1)
+		f := strings.Split(line, "\t")
+		format, err := strconv.Unquote(f[0])
+		if err != nil {
+			t.Fatalf("%s: %v", pos, err)
+		}
+
+		ret, err := strconv.Atoi(f[1])
+		if err != nil {
+			t.Fatalf("%s: %v", pos, err)
+		}
+
+		out, err := strconv.Unquote(f[2])
+		if err != nil {
+			t.Fatalf("%s: %v", pos, err)
+		}
+
+		var args []interface{}
+		for _, v := range f[3:] {
+			a, err := printfArg(v)
+			if err != nil {
+				t.Fatalf("%s: %v", pos, err)
+			}
+
+			args = append(args, a)
+		}
+		g := Xsnprintf(tls, buf, 4096, CString(format), vaList(args...))
+		if int(g) != ret || ret >= 0 && GoString(buf) != out {
+			t.Errorf("%s: snprintf(%q, %v): %v %q, expected %v %q", pos, format, f[3:], g, GoString(buf), ret, out)
+		}
+		n++
+	}
+	t.Logf("%v tests", n)
+}
+
+// printfArg returns the argument of a conversion in the printf conformance
+// table.
+func printfArg(s string) (interface{}, error) {
+	kind, v := s[0], s[2:]
+	switch kind {
+	case 'i':
+		n, err := strconv.ParseInt(v, 10, 32)
+		return int32(n), err
+	case 'u':
+		n, err := strconv.ParseUint(v, 10, 32)
+		return uint32(n), err
+	case 'l':
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err
+	case 'L':
+		n, err := strconv.ParseUint(v, 10, 64)
+		return n, err
+	case 'f', 'D':
+		switch v {
+		case "inf":
+			return math.Inf(1), nil
+		case "-inf":
+			return math.Inf(-1), nil
+		case "nan":
+			return math.NaN(), nil
+		case "-nan":
+			return math.Copysign(math.NaN(), -1), nil
+		}
+
+		return strconv.ParseFloat(v, 64)
+	case 's':
+		v, err := strconv.Unquote(v)
+		return CString(v), err
+	case 'w':
+		v, err := strconv.Unquote(v)
+		var a []int32
+		for _, c := range v {
+			a = append(a, c)
+		}
+		a = append(a, 0)
+		p := alloc(4 * len(a))
+		for i, c := range a {
+			*(*int32)(pointer(p + uintptr(4*i))) = c
+		}
+		return p, err
+	case 'p':
+		n, err := strconv.ParseUint(v, 0, 64)
+		return uintptr(n), err
+	}
+	return nil, fmt.Errorf("invalid argument %q", s)
+}
+
+// vaList returns a va_list of args, which must have promoted types.
+func vaList(args ...interface{}) uintptr {
+	if len(args) == 0 {
+		return 0
+	}
+
+	ap := alloc(8 * len(args))
+	for i, v := range args {
+		p := pointer(ap + uintptr(8*i))
+		switch x := v.(type) {
+		case int32:
+			*(*int32)(p) = x
+		case uint32:
+			*(*uint32)(p) = x
+		case int64:
+			*(*int64)(p) = x
+		case uint64:
+			*(*uint64)(p) = x
+		case float64:
+			*(*float64)(p) = x
+		case uintptr:
+			*(*uintptr)(p) = x
+		default:
+			panic(fmt.Errorf("unexpected variadic argument type %T", x))
+		}
+	}
+	return ap
+}
+
+func TestVA(t *testing.T) {
+	args := []interface{}{int32(-1), uint32(math.MaxUint32), int64(math.MinInt64), uint64(math.MaxUint64), -0.5, uintptr(42), int32(7)}
+	ap := vaList(args...)
+	var g []interface{}
+	g = append(g, VAInt32(&ap), VAUint32(&ap), VAInt64(&ap), VAUint64(&ap), VAFloat64(&ap), VAUintptr(&ap), VAInt32(&ap))
+	if fmt.Sprint(g) != fmt.Sprint(args) {
+		t.Fatalf("got %v exp %v", g, args)
+	}
+}
+
+func TestSnprintf(t *testing.T) {
+	tls := NewTLS()
+	buf := Xmalloc(tls, 16)
+	Xmemset(tls, buf, 'x', 16)
+	if g, e := Xsnprintf(tls, buf, 5, CString("%d|%s"), vaList(int32(123456), CString("abc"))), int32(10); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := string(mem(buf, 6)), "1234\x00x"; g != e {
+		t.Fatalf("%q %q", g, e)
+	}
+
+	if g, e := Xsnprintf(tls, buf, 0, CString("abc"), 0), int32(3); g != e || at(buf) != '1' {
+		t.Fatal(g, e)
+	}
+
+	n := Xmalloc(tls, 8)
+	if g, e := Xsprintf(tls, buf, CString("ab%ncd%lnef"), vaList(n, n+4)), int32(6); g != e || GoString(buf) != "abcdef" {
+		t.Fatal(g, e, GoString(buf))
+	}
+
+	if g, e := *(*int32)(pointer(n)), int32(2); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := *(*int32)(pointer(n + 4)), int32(4); g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestPthreadMutex(t *testing.T) {
+	tls, tls2 := NewTLS(), NewTLS()
+	attr := Xmalloc(tls, 4)
+	m := Xmalloc(tls, mutexSize)
+	Xpthread_mutexattr_init(tls, attr)
+	if g, e := Xpthread_mutexattr_settype(tls, attr, 42), int32(syscall.EINVAL); g != e {
+		t.Fatal(g, e)
+	}
+
+	Xpthread_mutexattr_settype(tls, attr, mutexRecursive)
+	Xpthread_mutex_init(tls, m, attr)
+	Xpthread_mutexattr_destroy(tls, attr)
+	for i := 0; i < 2; i++ {
+		if g := Xpthread_mutex_lock(tls, m); g != 0 {
+			t.Fatal(g)
+		}
+	}
+	if g, e := Xpthread_mutex_trylock(tls2, m), int32(syscall.EBUSY); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := Xpthread_mutex_unlock(tls2, m), int32(syscall.EPERM); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := Xpthread_mutex_destroy(tls, m), int32(syscall.EBUSY); g != e {
+		t.Fatal(g, e)
+	}
+
+	Xpthread_mutex_unlock(tls, m)
+	if g, e := Xpthread_mutex_trylock(tls2, m), int32(syscall.EBUSY); g != e {
+		t.Fatal(g, e)
+	}
+
+	Xpthread_mutex_unlock(tls, m)
+	if g := Xpthread_mutex_trylock(tls2, m); g != 0 {
+		t.Fatal(g)
+	}
+
+	Xpthread_mutex_unlock(tls2, m)
+	if g := Xpthread_mutex_destroy(tls, m); g != 0 {
+		t.Fatal(g)
+	}
+
+	Xpthread_mutexattr_settype(tls, attr, mutexErrorCheck)
+	Xpthread_mutex_init(tls, m, attr)
+	Xpthread_mutex_lock(tls, m)
+	if g, e := Xpthread_mutex_lock(tls, m), int32(syscall.EDEADLK); g != e {
+		t.Fatal(g, e)
+	}
+
+	Xpthread_mutex_unlock(tls, m)
+	if g, e := Xpthread_mutex_unlock(tls, m), int32(syscall.EPERM); g != e {
+		t.Fatal(g, e)
+	}
+
+	// A zeroed mutex is a statically initialized normal one.
+	m = BSS(mutexSize)
+	n := BSS(4)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			tls := NewTLS()
+			for i := 0; i < 1000; i++ {
+				Xpthread_mutex_lock(tls, m)
+				*(*int32)(pointer(n))++
+				Xpthread_mutex_unlock(tls, m)
+			}
+		}()
+	}
+	wg.Wait()
+	if g, e := *(*int32)(pointer(n)), int32(8000); g != e {
+		t.Fatal(g, e)
+	}
+
+	// Freeing a mutex drops its state.
+	m = Xmalloc(tls, mutexSize)
+	Xpthread_mutex_init(tls, m, attr)
+	Xpthread_mutex_lock(tls, m)
+	Xpthread_mutex_unlock(tls, m)
+	Xfree(tls, m)
+	objectsMu.Lock()
+	_, ok := mutexes[m]
+	n2 := len(objects)
+	objectsMu.Unlock()
+	if ok || n2 != len(mutexes)+len(conds) {
+		t.Fatal("state of a freed mutex")
+	}
+
+	// A normal mutex reusing the memory of a recursive one is normal.
+	Xpthread_mutexattr_settype(tls, attr, mutexRecursive)
+	m = tls.Alloc(mutexSize)
+	Xpthread_mutex_init(tls, m, attr)
+	Xpthread_mutex_lock(tls, m)
+	Xpthread_mutex_unlock(tls, m)
+	tls.Free(mutexSize)
+	if g, e := tls.Alloc(mutexSize), m; g != e {
+		t.Fatal(g, e)
+	}
+
+	copy(mem(m, mutexSize), make([]byte, mutexSize))
+	Xpthread_mutex_lock(tls, m)
+	if g, e := Xpthread_mutex_trylock(tls, m), int32(syscall.EBUSY); g != e {
+		t.Fatal(g, e)
+	}
+
+	Xpthread_mutex_unlock(tls, m)
+	tls.Free(mutexSize)
+}
+
+func TestTLSStack(t *testing.T) {
+	tls := NewTLS()
+	tls.Alloc(stackSize)
+	m := tls.Alloc(mutexSize)
+	if g, e := len(tls.stack), 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	// Releasing a segment drops the state of its mutexes.
+	Xpthread_mutex_lock(tls, m)
+	Xpthread_mutex_unlock(tls, m)
+	tls.Free(mutexSize)
+	objectsMu.Lock()
+	_, ok := mutexes[m]
+	objectsMu.Unlock()
+	if ok || len(tls.stack) != 1 {
+		t.Fatal("segment not released")
+	}
+
+	tls.setErrno(syscall.ENOENT)
+	if g, e := *(*int32)(pointer(X__errno_location(tls))), int32(syscall.ENOENT); g != e {
+		t.Fatal(g, e)
+	}
+
+	tls.exit()
+	if g := len(tls.stack); g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestPthreadCond(t *testing.T) {
+	tls := NewTLS()
+	m, c := BSS(mutexSize), BSS(condSize)
+	Xpthread_cond_init(tls, c, 0)
+	var queue []int
+	done := make(chan int)
+	for i := 0; i < 4; i++ {
+		go func() {
+			tls := NewTLS()
+			sum := 0
+			Xpthread_mutex_lock(tls, m)
+			for {
+				for len(queue) == 0 {
+					Xpthread_cond_wait(tls, c, m)
+				}
+				v := queue[0]
+				queue = queue[1:]
+				if v < 0 {
+					break
+				}
+
+				sum += v
+			}
+			Xpthread_mutex_unlock(tls, m)
+			done <- sum
+		}()
+	}
+	for i := 1; i <= 100; i++ {
+		Xpthread_mutex_lock(tls, m)
+		queue = append(queue, i)
+		Xpthread_cond_signal(tls, c)
+		Xpthread_mutex_unlock(tls, m)
+	}
+	Xpthread_mutex_lock(tls, m)
+	queue = append(queue, -1, -1, -1, -1)
+	Xpthread_cond_broadcast(tls, c)
+	Xpthread_mutex_unlock(tls, m)
+	sum := 0
+	for i := 0; i < 4; i++ {
+		sum += <-done
+	}
+	if g, e := sum, 5050; g != e {
+		t.Fatal(g, e)
+	}
+
+	ts := Xmalloc(tls, 16)
+	deadline := time.Now().Add(10 * time.Millisecond)
+	*(*[2]int64)(pointer(ts)) = [2]int64{deadline.Unix(), int64(deadline.Nanosecond())}
+	Xpthread_mutex_lock(tls, m)
+	if g, e := Xpthread_cond_timedwait(tls, c, m, ts), int32(syscall.ETIMEDOUT); g != e {
+		t.Fatal(g, e)
+	}
+
+	if time.Now().Before(deadline) {
+		t.Fatal("early timeout")
+	}
+
+	if g, e := Xpthread_mutex_trylock(NewTLS(), m), int32(syscall.EBUSY); g != e {
+		t.Fatal(g, e)
+	}
+
+	Xpthread_mutex_unlock(tls, m)
+	if g := Xpthread_cond_destroy(tls, c); g != 0 {
+		t.Fatal(g)
+	}
+}
+
+var (
+	testFreed   []uintptr
+	testFreedMu sync.Mutex
+	testKey     uint32
+)
+
+func testDestroy(tls *TLS, p uintptr) {
+	testFreedMu.Lock()
+	testFreed = append(testFreed, p)
+	testFreedMu.Unlock()
+}
+
+func testStart(tls *TLS, arg uintptr) uintptr {
+	if Xpthread_getspecific(tls, testKey) != 0 {
+		return 0
+	}
+
+	Xpthread_setspecific(tls, testKey, arg)
+	if Xpthread_getspecific(tls, testKey) != arg {
+		return 0
+	}
+
+	return uintptr(Xpthread_self(tls))
+}
+
+func TestPthread(t *testing.T) {
+	testFreed = nil
+	tls := NewTLS()
+	key := Xmalloc(tls, 4)
+	Xpthread_key_create(tls, key, FP(testDestroy))
+	k := *(*uint32)(pointer(key))
+	testKey = k
+	var threads []uint64
+	for i := 1; i <= 4; i++ {
+		th := Xmalloc(tls, 8)
+		if g := Xpthread_create(tls, th, 0, FP(testStart), uintptr(i)); g != 0 {
+			t.Fatal(g)
+		}
+
+		threads = append(threads, *(*uint64)(pointer(th)))
+	}
+	r := Xmalloc(tls, 8)
+	for _, v := range threads {
+		if Xpthread_equal(tls, v, Xpthread_self(tls)) != 0 {
+			t.Fatal(v)
+		}
+
+		if g := Xpthread_join(tls, v, r); g != 0 {
+			t.Fatal(g)
+		}
+
+		if g, e := *(*uint64)(pointer(r)), v; g != e {
+			t.Fatal(g, e)
+		}
+	}
+	if g, e := Xpthread_join(tls, threads[0], 0), int32(syscall.ESRCH); g != e {
+		t.Fatal(g, e)
+	}
+
+	sort.Slice(testFreed, func(i, j int) bool { return testFreed[i] < testFreed[j] })
+	if g, e := fmt.Sprint(testFreed), "[1 2 3 4]"; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g := Xpthread_getspecific(tls, k); g != 0 {
+		t.Fatal(g)
+	}
+
+	if g := Xpthread_key_delete(tls, k); g != 0 {
+		t.Fatal(g)
+	}
+
+	if g, e := Xpthread_setspecific(tls, k, 1), int32(syscall.EINVAL); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := Xpthread_equal(tls, Xpthread_self(tls), Xpthread_self(tls)), int32(1); g != e {
+		t.Fatal(g, e)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package crt is the C runtime of the Go code generated by ccgo. (Work In
+// Progress)
+//
+// # Memory
+//
+// C objects live in memory allocated by this package, which the Go garbage
+// collector neither moves nor frees. A C pointer is an uintptr holding the
+// address of such memory. Dereferencing it is a conversion to a Go pointer
+// using package unsafe.
+//
+// # Calling convention
+//
+// Every C function is a Go function having a *TLS as its first parameter,
+// followed by the C parameters. C library functions are exported by this
+// package with the X prefix, for example Xstrlen. The C types map to Go types
+// of the LP64 data model: int is int32, long and long long are int64, size_t
+// is uint64 and pointers are uintptr.
+//
+// # Variadic functions
+//
+// A variadic C function has an additional last uintptr parameter, the va_list
+// of its variadic arguments, which is zero if there are none. Functions
+// taking a va_list, like vsnprintf, and the variadic functions of this package
+// read the arguments using the VA functions, see VAInt32.
+//
+// # Errors
+//
+// Functions failing in C by setting errno set the errno of the TLS passed to
+// them, see X__errno_location.
+//
+// # Threads
+//
+// A C thread is a goroutine with its own TLS, which holds the thread
+// identity, errno, stack and thread-specific data. Mutexes and condition
+// variables are implemented using package sync, see Xpthread_mutex_lock. The
+// C code translated to a package may be used by multiple goroutines
+// concurrently as long as each uses its own TLS, see NewTLS.
+package crt
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	// Memory referenced only by uintptrs, kept alive.
+	segments   [][]byte
+	segmentsMu sync.Mutex
+)
+
+// alloc returns the address of n zeroed bytes aligned to 16 bytes, never
+// freed.
+func alloc(n int) uintptr {
+	if n == 0 {
+		n = 1
+	}
+	b := make([]byte, n+15)
+	segmentsMu.Lock()
+	segments = append(segments, b)
+	segmentsMu.Unlock()
+	p := uintptr(unsafe.Pointer(&b[0]))
+	return (p + 15) &^ 15
+}
+
+// pointer returns the C pointer p as an unsafe.Pointer.
+func pointer(p uintptr) unsafe.Pointer { return *(*unsafe.Pointer)(unsafe.Pointer(&p)) }
+
+// mem returns the n bytes at p.
+func mem(p uintptr, n int) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	return (*[1 << 30]byte)(pointer(p))[:n:n]
+}
+
+// BSS returns the address of n zero bytes of static storage duration.
+func BSS(n int) uintptr { return alloc(n) }
+
+// DS returns the address of a copy of the initialized data s of static
+// storage duration.
+func DS(s string) uintptr {
+	p := alloc(len(s))
+	copy(mem(p, len(s)), s)
+	return p
+}
+
+// TS returns the address of a copy of the string literals s, the text
+// segment.
+func TS(s string) uintptr { return DS(s) }
+
+// FP returns the C function pointer of the Go function f. The pointer does
+// not keep f reachable, nor does it follow a closure moved with its stack, so
+// f should be a top-level function.
+func FP(f interface{}) uintptr {
+	// A func value is a pointer to its closure, the data word of the
+	// interface.
+	return (*[2]uintptr)(unsafe.Pointer(&f))[1]
+}
+
+// Bool32 returns 1 if b is true and 0 otherwise.
+func Bool32(b bool) int32 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+const stackSize = 1 << 20
+
+// TLS is the state of a C thread. A TLS must be used by one goroutine at a
+// time. Its memory, the errno and the stack segments, is released with it.
+type TLS struct {
+	errno  int32              // Addressed by __errno_location.
+	id     uintptr            // pthread_t
+	stack  []stack            // The current stack is the last one.
+	values map[uint32]uintptr // pthread_key_t: value.
+}
+
+// A stack is a segment of the automatic storage of a TLS.
+type stack struct {
+	mem             []byte // Keeps the segment alive.
+	base, sp, limit uintptr
+}
+
+// threadID is the pthread_t of the last created TLS.
+var threadID uintptr
+
+// NewTLS returns a newly created TLS.
+func NewTLS() *TLS {
+	return &TLS{id: atomic.AddUintptr(&threadID, 1), values: map[uint32]uintptr{}}
+}
+
+// setErrno sets the errno of t to the error number of err, if any.
+func (t *TLS) setErrno(err error) {
+	if t == nil {
+		return
+	}
+
+	n := syscall.EIO
+	errors.As(err, &n)
+	t.errno = int32(n)
+}
+
+// int *__errno_location(void);
+func X__errno_location(tls *TLS) uintptr { return uintptr(unsafe.Pointer(&tls.errno)) }
+
+// Alloc returns the address of n bytes of automatic storage duration aligned
+// to 16 bytes. Alloc and Free calls must be balanced.
+func (t *TLS) Alloc(n int) uintptr {
+	n = (n + 15) &^ 15
+	if len(t.stack) != 0 {
+		s := &t.stack[len(t.stack)-1]
+		if s.sp+uintptr(n) <= s.limit {
+			r := s.sp
+			s.sp += uintptr(n)
+			return r
+		}
+	}
+
+	sz := stackSize
+	if n > sz {
+		sz = n
+	}
+	b := make([]byte, sz+15)
+	p := (uintptr(unsafe.Pointer(&b[0])) + 15) &^ 15
+	t.stack = append(t.stack, stack{b, p, p + uintptr(n), p + uintptr(sz)})
+	return p
+}
+
+// Free releases the last n bytes allocated by Alloc. An emptied segment other
+// than the first one is released as well.
+func (t *TLS) Free(n int) {
+	n = (n + 15) &^ 15
+	s := &t.stack[len(t.stack)-1]
+	s.sp -= uintptr(n)
+	if s.sp == s.base && len(t.stack) > 1 {
+		t.pop()
+	}
+}
+
+// pop releases the current stack segment.
+func (t *TLS) pop() {
+	s := &t.stack[len(t.stack)-1]
+	forget(s.base, s.limit-s.base)
+	*s = stack{}
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// Main executes the C main function and exits the process with the value it
+// returns.
+func Main(main func(tls *TLS, argc int32, argv uintptr) int32) {
+	tls := NewTLS()
+	argv := alloc((len(os.Args) + 1) * int(unsafe.Sizeof(uintptr(0))))
+	for i, v := range os.Args {
+		*(*uintptr)(pointer(argv + uintptr(i)*unsafe.Sizeof(uintptr(0)))) = CString(v)
+	}
+	os.Exit(int(main(tls, int32(len(os.Args)), argv)))
+}
+
+// GoString returns the C string at p as a Go string.
+func GoString(p uintptr) string {
+	if p == 0 {
+		return ""
+	}
+
+	return string(mem(p, int(Xstrlen(nil, p))))
+}
+
+// CString returns the address of a copy of s as a C string of static storage
+// duration.
+func CString(s string) uintptr { return DS(s + "\x00") }
+
+// cstrings caches C strings returned by functions like strerror, keyed by
+// their Go value.
+var (
+	cstrings   = map[string]uintptr{}
+	cstringsMu sync.Mutex
+)
+
+// cstring returns the address of a C string s, allocated once.
+func cstring(s string) uintptr {
+	cstringsMu.Lock()
+	defer cstringsMu.Unlock()
+
+	p, ok := cstrings[s]
+	if !ok {
+		p = CString(s)
+		cstrings[s] = p
+	}
+	return p
+}
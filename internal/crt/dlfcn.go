@@ -0,0 +1,22 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+// Dynamic loading is not supported. The functions below fail like they do for
+// a missing library.
+
+var errDynamic = cstring("dynamic loading not supported")
+
+// int dlclose(void *handle);
+func Xdlclose(tls *TLS, handle uintptr) int32 { return 0 }
+
+// char *dlerror(void);
+func Xdlerror(tls *TLS) uintptr { return errDynamic }
+
+// void *dlopen(const char *filename, int flags);
+func Xdlopen(tls *TLS, filename uintptr, flags int32) uintptr { return 0 }
+
+// void *dlsym(void *handle, const char *symbol);
+func Xdlsym(tls *TLS, handle, symbol uintptr) uintptr { return 0 }
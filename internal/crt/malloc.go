@@ -0,0 +1,124 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// The heap. Blocks are Go byte slices, kept alive by the heap map until
+// freed. The Go garbage collector does not move them.
+var (
+	heap   = map[uintptr][]byte{}
+	heapMu sync.Mutex
+)
+
+// malloc returns the address of a new block of at least n zeroed bytes
+// aligned to 16 bytes or zero if n is too big.
+func malloc(n uint64) uintptr {
+	if n > 1<<40 {
+		return 0
+	}
+
+	n = (n + 15) &^ 15
+	if n == 0 {
+		n = 16
+	}
+	b := make([]byte, n+15)
+	p := (uintptr(unsafe.Pointer(&b[0])) + 15) &^ 15
+	off := p - uintptr(unsafe.Pointer(&b[0]))
+	heapMu.Lock()
+	heap[p] = b[off : off+uintptr(n)]
+	heapMu.Unlock()
+	return p
+}
+
+// block returns the heap block at p. It panics if p is not the address of an
+// allocated block.
+func block(p uintptr) []byte {
+	heapMu.Lock()
+	b, ok := heap[p]
+	heapMu.Unlock()
+	if !ok {
+		panic("invalid heap pointer")
+	}
+
+	return b
+}
+
+// void *malloc(size_t size);
+func Xmalloc(tls *TLS, size uint64) uintptr {
+	p := malloc(size)
+	if p == 0 {
+		tls.setErrno(syscall.ENOMEM)
+	}
+	return p
+}
+
+// void *calloc(size_t nmemb, size_t size);
+func Xcalloc(tls *TLS, nmemb, size uint64) uintptr {
+	n := nmemb * size
+	if size != 0 && n/size != nmemb {
+		tls.setErrno(syscall.ENOMEM)
+		return 0
+	}
+
+	return Xmalloc(tls, n)
+}
+
+// void *realloc(void *ptr, size_t size);
+func Xrealloc(tls *TLS, ptr uintptr, size uint64) uintptr {
+	if ptr == 0 {
+		return Xmalloc(tls, size)
+	}
+
+	if size == 0 {
+		Xfree(tls, ptr)
+		return 0
+	}
+
+	b := block(ptr)
+	if size <= uint64(len(b)) {
+		return ptr
+	}
+
+	p := Xmalloc(tls, size)
+	if p == 0 {
+		return 0
+	}
+
+	copy(mem(p, len(b)), b)
+	Xfree(tls, ptr)
+	return p
+}
+
+// void free(void *ptr);
+func Xfree(tls *TLS, ptr uintptr) {
+	if ptr == 0 {
+		return
+	}
+
+	heapMu.Lock()
+	b, ok := heap[ptr]
+	if !ok {
+		heapMu.Unlock()
+		panic("free of an invalid pointer")
+	}
+
+	delete(heap, ptr)
+	heapMu.Unlock()
+	forget(ptr, uintptr(len(b)))
+}
+
+// size_t malloc_usable_size(void *ptr);
+func Xmalloc_usable_size(tls *TLS, ptr uintptr) uint64 {
+	if ptr == 0 {
+		return 0
+	}
+
+	return uint64(len(block(ptr)))
+}
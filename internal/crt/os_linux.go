@@ -0,0 +1,272 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+import (
+	"os"
+	"syscall"
+)
+
+// fail sets the errno of tls to err and returns -1.
+func fail(tls *TLS, err error) int32 {
+	tls.setErrno(err)
+	return -1
+}
+
+// int access(const char *pathname, int mode);
+func Xaccess(tls *TLS, pathname uintptr, mode int32) int32 {
+	if err := syscall.Access(GoString(pathname), uint32(mode)); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// int close(int fd);
+func Xclose(tls *TLS, fd int32) int32 {
+	if err := syscall.Close(int(fd)); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// int fchmod(int fd, mode_t mode);
+func Xfchmod(tls *TLS, fd int32, mode uint32) int32 {
+	if err := syscall.Fchmod(int(fd), mode); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// int fchown(int fd, uid_t owner, gid_t group);
+func Xfchown(tls *TLS, fd int32, owner, group uint32) int32 {
+	if err := syscall.Fchown(int(fd), int(int32(owner)), int(int32(group))); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// int fcntl(int fd, int cmd, ... /* arg */ );
+func Xfcntl(tls *TLS, fd, cmd int32, va uintptr) int32 {
+	var arg uintptr
+	if va != 0 {
+		switch cmd {
+		case syscall.F_GETLK, syscall.F_SETLK, syscall.F_SETLKW, syscall.F_GETOWN_EX, syscall.F_SETOWN_EX:
+			arg = VAUintptr(&va)
+		default:
+			arg = uintptr(VAInt32(&va))
+		}
+	}
+	r, _, e := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), uintptr(cmd), arg)
+	if e != 0 {
+		return fail(tls, e)
+	}
+
+	return int32(r)
+}
+
+// int fdatasync(int fd);
+func Xfdatasync(tls *TLS, fd int32) int32 {
+	if err := syscall.Fdatasync(int(fd)); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// int fstat(int fd, struct stat *statbuf);
+func Xfstat(tls *TLS, fd int32, statbuf uintptr) int32 {
+	if err := syscall.Fstat(int(fd), (*syscall.Stat_t)(pointer(statbuf))); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// int fsync(int fd);
+func Xfsync(tls *TLS, fd int32) int32 {
+	if err := syscall.Fsync(int(fd)); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// int ftruncate(int fd, off_t length);
+func Xftruncate(tls *TLS, fd int32, length int64) int32 {
+	if err := syscall.Ftruncate(int(fd), length); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// char *getcwd(char *buf, size_t size);
+func Xgetcwd(tls *TLS, buf uintptr, size uint64) uintptr {
+	s, err := os.Getwd()
+	if err != nil {
+		fail(tls, err)
+		return 0
+	}
+
+	if uint64(len(s)) >= size {
+		fail(tls, syscall.ERANGE)
+		return 0
+	}
+
+	copy(mem(buf, int(size)), s+"\x00")
+	return buf
+}
+
+// uid_t geteuid(void);
+func Xgeteuid(tls *TLS) uint32 { return uint32(os.Geteuid()) }
+
+// int getpagesize(void);
+func Xgetpagesize(tls *TLS) int32 { return int32(os.Getpagesize()) }
+
+// pid_t getpid(void);
+func Xgetpid(tls *TLS) int32 { return int32(os.Getpid()) }
+
+// off_t lseek(int fd, off_t offset, int whence);
+func Xlseek(tls *TLS, fd int32, offset int64, whence int32) int64 {
+	n, err := syscall.Seek(int(fd), offset, int(whence))
+	if err != nil {
+		return int64(fail(tls, err))
+	}
+
+	return n
+}
+
+// int lstat(const char *pathname, struct stat *statbuf);
+func Xlstat(tls *TLS, pathname, statbuf uintptr) int32 {
+	if err := syscall.Lstat(GoString(pathname), (*syscall.Stat_t)(pointer(statbuf))); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// int mkdir(const char *pathname, mode_t mode);
+func Xmkdir(tls *TLS, pathname uintptr, mode uint32) int32 {
+	if err := syscall.Mkdir(GoString(pathname), mode); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// void *mmap(void *addr, size_t length, int prot, int flags, int fd, off_t offset);
+func Xmmap(tls *TLS, addr uintptr, length uint64, prot, flags, fd int32, offset int64) uintptr {
+	r, _, e := syscall.Syscall6(syscall.SYS_MMAP, addr, uintptr(length), uintptr(prot), uintptr(flags), uintptr(fd), uintptr(offset))
+	if e != 0 {
+		tls.setErrno(e)
+		return ^uintptr(0) // MAP_FAILED
+	}
+
+	return r
+}
+
+// int munmap(void *addr, size_t length);
+func Xmunmap(tls *TLS, addr uintptr, length uint64) int32 {
+	if _, _, e := syscall.Syscall(syscall.SYS_MUNMAP, addr, uintptr(length), 0); e != 0 {
+		return fail(tls, e)
+	}
+
+	return 0
+}
+
+// int open(const char *pathname, int flags, ... /* mode_t mode */);
+func Xopen(tls *TLS, pathname uintptr, flags int32, va uintptr) int32 {
+	var mode uint32
+	if va != 0 {
+		mode = VAUint32(&va)
+	}
+	fd, err := syscall.Open(GoString(pathname), int(flags), mode)
+	if err != nil {
+		return fail(tls, err)
+	}
+
+	return int32(fd)
+}
+
+// ssize_t pread(int fd, void *buf, size_t count, off_t offset);
+func Xpread(tls *TLS, fd int32, buf uintptr, count uint64, offset int64) int64 {
+	n, err := syscall.Pread(int(fd), mem(buf, int(count)), offset)
+	if err != nil {
+		return int64(fail(tls, err))
+	}
+
+	return int64(n)
+}
+
+// ssize_t pwrite(int fd, const void *buf, size_t count, off_t offset);
+func Xpwrite(tls *TLS, fd int32, buf uintptr, count uint64, offset int64) int64 {
+	n, err := syscall.Pwrite(int(fd), mem(buf, int(count)), offset)
+	if err != nil {
+		return int64(fail(tls, err))
+	}
+
+	return int64(n)
+}
+
+// ssize_t read(int fd, void *buf, size_t count);
+func Xread(tls *TLS, fd int32, buf uintptr, count uint64) int64 {
+	n, err := syscall.Read(int(fd), mem(buf, int(count)))
+	if err != nil {
+		return int64(fail(tls, err))
+	}
+
+	return int64(n)
+}
+
+// ssize_t readlink(const char *pathname, char *buf, size_t bufsiz);
+func Xreadlink(tls *TLS, pathname, buf uintptr, bufsiz uint64) int64 {
+	n, err := syscall.Readlink(GoString(pathname), mem(buf, int(bufsiz)))
+	if err != nil {
+		return int64(fail(tls, err))
+	}
+
+	return int64(n)
+}
+
+// int rmdir(const char *pathname);
+func Xrmdir(tls *TLS, pathname uintptr) int32 {
+	if err := syscall.Rmdir(GoString(pathname)); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// int stat(const char *pathname, struct stat *statbuf);
+func Xstat(tls *TLS, pathname, statbuf uintptr) int32 {
+	if err := syscall.Stat(GoString(pathname), (*syscall.Stat_t)(pointer(statbuf))); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// int unlink(const char *pathname);
+func Xunlink(tls *TLS, pathname uintptr) int32 {
+	if err := syscall.Unlink(GoString(pathname)); err != nil {
+		return fail(tls, err)
+	}
+
+	return 0
+}
+
+// ssize_t write(int fd, const void *buf, size_t count);
+func Xwrite(tls *TLS, fd int32, buf uintptr, count uint64) int64 {
+	n, err := syscall.Write(int(fd), mem(buf, int(count)))
+	if err != nil {
+		return int64(fail(tls, err))
+	}
+
+	return int64(n)
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func TestFile(t *testing.T) {
+	tls := NewTLS()
+	dir, err := ioutil.TempDir("", "crt-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	nm := CString(filepath.Join(dir, "f"))
+	if g := Xopen(tls, nm, syscall.O_RDWR, 0); g != -1 {
+		t.Fatal(g)
+	}
+
+	if g, e := *(*int32)(pointer(X__errno_location(tls))), int32(syscall.ENOENT); g != e {
+		t.Fatal(g, e)
+	}
+
+	fd := Xopen(tls, nm, syscall.O_RDWR|syscall.O_CREAT, vaList(uint32(0644)))
+	if fd < 0 {
+		t.Fatal(fd)
+	}
+
+	s := CString("0123456789")
+	if g := Xwrite(tls, fd, s, 10); g != 10 {
+		t.Fatal(g)
+	}
+
+	if g := Xfsync(tls, fd); g != 0 {
+		t.Fatal(g)
+	}
+
+	if g := Xftruncate(tls, fd, 8); g != 0 {
+		t.Fatal(g)
+	}
+
+	var st syscall.Stat_t
+	if g := Xfstat(tls, fd, uintptr(unsafe.Pointer(&st))); g != 0 || st.Size != 8 {
+		t.Fatal(g, st.Size)
+	}
+
+	if g := Xstat(tls, nm, uintptr(unsafe.Pointer(&st))); g != 0 || st.Size != 8 {
+		t.Fatal(g, st.Size)
+	}
+
+	buf := Xmalloc(tls, 16)
+	if g := Xpread(tls, fd, buf, 16, 3); g != 5 || string(mem(buf, 5)) != "34567" {
+		t.Fatal(g, string(mem(buf, 5)))
+	}
+
+	if g := Xlseek(tls, fd, 6, 0); g != 6 {
+		t.Fatal(g)
+	}
+
+	if g := Xread(tls, fd, buf, 16); g != 2 || string(mem(buf, 2)) != "67" {
+		t.Fatal(g)
+	}
+
+	if g := Xfcntl(tls, fd, syscall.F_GETFD, 0); g < 0 {
+		t.Fatal(g)
+	}
+
+	if g := Xclose(tls, fd); g != 0 {
+		t.Fatal(g)
+	}
+
+	if g := Xaccess(tls, nm, 0); g != 0 {
+		t.Fatal(g)
+	}
+
+	if g := Xunlink(tls, nm); g != 0 {
+		t.Fatal(g)
+	}
+
+	if g := Xaccess(tls, nm, 0); g != -1 {
+		t.Fatal(g)
+	}
+
+	if g := Xgetcwd(tls, buf, 1); g != 0 {
+		t.Fatal(g)
+	}
+
+	if g, e := Xgetpid(tls), int32(os.Getpid()); g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestMmap(t *testing.T) {
+	tls := NewTLS()
+	n := uint64(Xgetpagesize(tls))
+	p := Xmmap(tls, 0, n, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON, -1, 0)
+	if p == ^uintptr(0) {
+		t.Fatal(p)
+	}
+
+	Xmemset(tls, p, 42, n)
+	if g := mem(p, int(n))[n-1]; g != 42 {
+		t.Fatal(g)
+	}
+
+	if g := Xmunmap(tls, p, n); g != 0 {
+		t.Fatal(g)
+	}
+}
@@ -0,0 +1,473 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// spec is a printf conversion specification.
+type spec struct {
+	hash, minus, plus, space, zero bool
+	length                         string
+	prec                           int // Negative if omitted.
+	verb                           byte
+	width                          int
+}
+
+// pad appends to b the prefix and body of a conversion, padded to the field
+// width. Zeros are inserted between prefix and body if the zero flag is set.
+func (s *spec) pad(b []byte, prefix, body string) []byte {
+	n := s.width - len(prefix) - len(body)
+	switch {
+	case n <= 0:
+		b = append(b, prefix...)
+		b = append(b, body...)
+	case s.minus:
+		b = append(b, prefix...)
+		b = append(b, body...)
+		b = append(b, strings.Repeat(" ", n)...)
+	case s.zero:
+		b = append(b, prefix...)
+		b = append(b, strings.Repeat("0", n)...)
+		b = append(b, body...)
+	default:
+		b = append(b, strings.Repeat(" ", n)...)
+		b = append(b, prefix...)
+		b = append(b, body...)
+	}
+	return b
+}
+
+// sign returns the sign prefix of a signed conversion.
+func (s *spec) sign(neg bool) string {
+	switch {
+	case neg:
+		return "-"
+	case s.plus:
+		return "+"
+	case s.space:
+		return " "
+	}
+	return ""
+}
+
+// printf returns the output of the printf format string at format, reading
+// the arguments from ap. It returns false if a wide character cannot be
+// converted.
+func printf(format uintptr, ap *uintptr) (b []byte, ok bool) {
+	for {
+		c := at(format)
+		format++
+		switch c {
+		case 0:
+			return b, true
+		case '%':
+			// ok
+		default:
+			b = append(b, c)
+			continue
+		}
+
+		start := format - 1
+		s := spec{prec: -1}
+	flags:
+		for {
+			switch at(format) {
+			case '-':
+				s.minus = true
+			case '+':
+				s.plus = true
+			case ' ':
+				s.space = true
+			case '#':
+				s.hash = true
+			case '0':
+				s.zero = true
+			case '\'':
+				// Thousands grouping, none in the C locale.
+			default:
+				break flags
+			}
+			format++
+		}
+		if at(format) == '*' {
+			format++
+			if s.width = int(VAInt32(ap)); s.width < 0 {
+				s.minus = true
+				s.width = -s.width
+			}
+		} else {
+			for c := at(format); c >= '0' && c <= '9'; c = at(format) {
+				s.width = 10*s.width + int(c-'0')
+				format++
+			}
+		}
+		if at(format) == '.' {
+			format++
+			s.prec = 0
+			if at(format) == '*' {
+				format++
+				if s.prec = int(VAInt32(ap)); s.prec < 0 {
+					s.prec = -1
+				}
+			} else {
+				for c := at(format); c >= '0' && c <= '9'; c = at(format) {
+					s.prec = 10*s.prec + int(c-'0')
+					format++
+				}
+			}
+		}
+		switch c := at(format); c {
+		case 'h', 'l':
+			s.length = string(c)
+			if format++; at(format) == c {
+				s.length += string(c)
+				format++
+			}
+		case 'q', 'L', 'j', 'z', 'Z', 't':
+			s.length = string(c)
+			format++
+		}
+		s.verb = at(format)
+		if s.verb != 0 {
+			format++
+		}
+		if s.minus {
+			s.zero = false
+		}
+		if s.plus {
+			s.space = false
+		}
+		switch s.verb {
+		case 'd', 'i':
+			var n int64
+			switch s.length {
+			case "hh":
+				n = int64(int8(VAInt32(ap)))
+			case "h":
+				n = int64(int16(VAInt32(ap)))
+			case "":
+				n = int64(VAInt32(ap))
+			default:
+				n = VAInt64(ap)
+			}
+			u := uint64(n)
+			if n < 0 {
+				u = -u
+			}
+			b = s.integer(b, s.sign(n < 0), u)
+		case 'o', 'u', 'x', 'X':
+			var u uint64
+			switch s.length {
+			case "hh":
+				u = uint64(uint8(VAUint32(ap)))
+			case "h":
+				u = uint64(uint16(VAUint32(ap)))
+			case "":
+				u = uint64(VAUint32(ap))
+			default:
+				u = VAUint64(ap)
+			}
+			prefix := ""
+			if s.hash && u != 0 && (s.verb == 'x' || s.verb == 'X') {
+				prefix = "0" + string(s.verb)
+			}
+			b = s.integer(b, prefix, u)
+		case 'p':
+			p := VAUintptr(ap)
+			if p == 0 {
+				s.zero = false
+				b = s.pad(b, "", "(nil)")
+				break
+			}
+
+			s.verb = 'x'
+			b = s.integer(b, s.sign(false)+"0x", uint64(p))
+		case 'e', 'E', 'f', 'F', 'g', 'G', 'a', 'A':
+			b = s.float(b, VAFloat64(ap))
+		case 'c':
+			w := VAInt32(ap)
+			c := byte(w)
+			if s.length == "l" {
+				if c, ok = narrow(w); !ok {
+					return nil, false
+				}
+			}
+			s.zero = false
+			b = s.pad(b, "", string([]byte{c}))
+		case 's':
+			p := VAUintptr(ap)
+			var t []byte
+			switch {
+			case p == 0:
+				if s.prec < 0 || s.prec >= 6 {
+					t = []byte("(null)")
+				}
+			case s.length == "l":
+				for ; s.prec < 0 || len(t) < s.prec; p += 4 {
+					w := *(*int32)(pointer(p))
+					if w == 0 {
+						break
+					}
+
+					c, ok := narrow(w)
+					if !ok {
+						return nil, false
+					}
+
+					t = append(t, c)
+				}
+			default:
+				for ; s.prec < 0 || len(t) < s.prec; p++ {
+					c := at(p)
+					if c == 0 {
+						break
+					}
+
+					t = append(t, c)
+				}
+			}
+			s.zero = false
+			b = s.pad(b, "", string(t))
+		case 'n':
+			p := VAUintptr(ap)
+			switch s.length {
+			case "hh":
+				*(*int8)(pointer(p)) = int8(len(b))
+			case "h":
+				*(*int16)(pointer(p)) = int16(len(b))
+			case "":
+				*(*int32)(pointer(p)) = int32(len(b))
+			default:
+				*(*int64)(pointer(p)) = int64(len(b))
+			}
+		case '%':
+			b = append(b, '%')
+		default:
+			// Not a conversion, written as is.
+			for ; start < format; start++ {
+				b = append(b, at(start))
+			}
+		}
+	}
+}
+
+// narrow returns the wide character w converted to a multibyte character of
+// the C locale.
+func narrow(w int32) (byte, bool) {
+	if w < 0 || w >= 0x80 {
+		return 0, false
+	}
+
+	return byte(w), true
+}
+
+// integer appends the digits of u in the base of the conversion, preceded by
+// prefix.
+func (s *spec) integer(b []byte, prefix string, u uint64) []byte {
+	base := 10
+	switch s.verb {
+	case 'o':
+		base = 8
+	case 'x', 'X':
+		base = 16
+	}
+	digits := strconv.FormatUint(u, base)
+	if s.verb == 'X' {
+		digits = strings.ToUpper(digits)
+	}
+	if s.prec >= 0 {
+		s.zero = false
+		if s.prec == 0 && u == 0 {
+			digits = ""
+		}
+		if n := s.prec - len(digits); n > 0 {
+			digits = strings.Repeat("0", n) + digits
+		}
+	}
+	if s.hash && s.verb == 'o' && (digits == "" || digits[0] != '0') {
+		digits = "0" + digits
+	}
+	return s.pad(b, prefix, digits)
+}
+
+// float appends v formatted by the conversions a, e, f and g.
+func (s *spec) float(b []byte, v float64) []byte {
+	prefix := s.sign(math.Signbit(v))
+	upper := s.verb >= 'A' && s.verb <= 'Z'
+	v = math.Abs(v)
+	var body string
+	switch {
+	case math.IsInf(v, 0):
+		body = "inf"
+		s.zero = false
+	case math.IsNaN(v):
+		body = "nan"
+		s.zero = false
+	default:
+		prec := s.prec
+		switch s.verb {
+		case 'a', 'A':
+			prefix += "0x"
+			body = s.hex(v)
+		case 'e', 'E':
+			if prec < 0 {
+				prec = 6
+			}
+			body = s.point(strconv.FormatFloat(v, 'e', prec, 64))
+		case 'f', 'F':
+			if prec < 0 {
+				prec = 6
+			}
+			body = s.point(strconv.FormatFloat(v, 'f', prec, 64))
+		case 'g', 'G':
+			switch {
+			case prec < 0:
+				prec = 6
+			case prec == 0:
+				prec = 1
+			}
+			e := strconv.FormatFloat(v, 'e', prec-1, 64)
+			x, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:])
+			if prec > x && x >= -4 {
+				body = strconv.FormatFloat(v, 'f', prec-1-x, 64)
+			} else {
+				body = e
+			}
+			if !s.hash {
+				body = trimZeros(body)
+			}
+			body = s.point(body)
+		}
+	}
+	if upper {
+		prefix = strings.ToUpper(prefix)
+		body = strings.ToUpper(body)
+	}
+	return s.pad(b, prefix, body)
+}
+
+// point returns the floating point number s with a decimal point if the hash
+// flag is set.
+func (s *spec) point(t string) string {
+	if !s.hash || strings.IndexByte(t, '.') >= 0 {
+		return t
+	}
+
+	if i := strings.IndexAny(t, "ep"); i >= 0 {
+		return t[:i] + "." + t[i:]
+	}
+
+	return t + "."
+}
+
+// trimZeros removes trailing zeros of the fraction of s and the decimal point
+// if no fraction remains.
+func trimZeros(s string) string {
+	if strings.IndexByte(s, '.') < 0 {
+		return s
+	}
+
+	exp := ""
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		s, exp = s[:i], s[i:]
+	}
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	return s + exp
+}
+
+// hex returns the finite, non negative v formatted like glibc does for the
+// conversion a, without the 0x prefix.
+func (s *spec) hex(v float64) string {
+	bits := math.Float64bits(v)
+	mant := bits & (1<<52 - 1)
+	exp := int(bits>>52) - 1023
+	lead := uint64(1)
+	switch {
+	case v == 0:
+		lead, exp = 0, 0
+	case exp == -1023: // Subnormal.
+		lead, exp = 0, -1022
+	}
+	digits := ""
+	switch {
+	case s.prec < 0:
+		digits = strings.TrimRight(strconv.FormatUint(mant|1<<52, 16)[1:], "0")
+	case s.prec < 13:
+		// Round the mantissa to prec digits, ties to even.
+		shift := uint(4 * (13 - s.prec))
+		m := lead<<52 | mant
+		half := uint64(1) << (shift - 1)
+		rem := m & (1<<shift - 1)
+		m >>= shift
+		if rem > half || rem == half && m&1 != 0 {
+			m++
+		}
+		lead = m >> uint(4*s.prec)
+		if s.prec != 0 {
+			digits = strconv.FormatUint(m|1<<uint(4*s.prec+4), 16)[2:]
+		}
+	default:
+		digits = strconv.FormatUint(mant|1<<52, 16)[1:] + strings.Repeat("0", s.prec-13)
+	}
+	t := strconv.FormatUint(lead, 16)
+	if digits != "" || s.hash {
+		t += "." + digits
+	}
+	sign := "+"
+	if exp < 0 {
+		sign = "-"
+		exp = -exp
+	}
+	return t + "p" + sign + strconv.Itoa(exp)
+}
+
+// output returns the result of printf as returned by the C printf functions,
+// setting errno on failure.
+func output(tls *TLS, b []byte, ok bool) int32 {
+	if !ok {
+		tls.setErrno(syscall.EILSEQ)
+		return -1
+	}
+
+	return int32(len(b))
+}
+
+// int sprintf(char *str, const char *format, ...);
+func Xsprintf(tls *TLS, str, format, va uintptr) int32 {
+	return Xvsprintf(tls, str, format, va)
+}
+
+// int snprintf(char *str, size_t size, const char *format, ...);
+func Xsnprintf(tls *TLS, str uintptr, size uint64, format, va uintptr) int32 {
+	return Xvsnprintf(tls, str, size, format, va)
+}
+
+// int vsprintf(char *str, const char *format, va_list ap);
+func Xvsprintf(tls *TLS, str, format, ap uintptr) int32 {
+	b, ok := printf(format, &ap)
+	if ok {
+		copy(mem(str, len(b)+1), append(b, 0))
+	}
+	return output(tls, b, ok)
+}
+
+// int vsnprintf(char *str, size_t size, const char *format, va_list ap);
+func Xvsnprintf(tls *TLS, str uintptr, size uint64, format, ap uintptr) int32 {
+	b, ok := printf(format, &ap)
+	if ok && size != 0 {
+		n := len(b)
+		if uint64(n) >= size {
+			n = int(size - 1)
+		}
+		copy(mem(str, n+1), append(b[:n:n], 0))
+	}
+	return output(tls, b, ok)
+}
@@ -0,0 +1,513 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The pthread objects of LP64 glibc. A pthread_t is the id of a TLS.
+const (
+	condSize  = 48 // sizeof(pthread_cond_t)
+	mutexKind = 16 // offsetof(pthread_mutex_t, __data.__kind)
+	mutexSize = 40 // sizeof(pthread_mutex_t)
+
+	// Values of __kind and of a pthread_mutexattr_t. A zeroed
+	// pthread_mutex_t, like PTHREAD_MUTEX_INITIALIZER, is a normal one.
+	mutexNormal     = 0 // PTHREAD_MUTEX_NORMAL, PTHREAD_MUTEX_DEFAULT
+	mutexRecursive  = 1 // PTHREAD_MUTEX_RECURSIVE
+	mutexErrorCheck = 2 // PTHREAD_MUTEX_ERRORCHECK
+
+	destructorIterations = 4 // PTHREAD_DESTRUCTOR_ITERATIONS
+)
+
+// A mutex is the Go state of a pthread_mutex_t.
+type mutex struct {
+	sync.Mutex
+	count int     // Recursive locks, guarded by Mutex.
+	kind  int32   // Accessed atomically, changed only by the holder of Mutex.
+	owner uintptr // pthread_t, accessed atomically.
+}
+
+// mutexes and conds hold the state of the pthread_mutex_t and pthread_cond_t
+// objects in use, keyed by their address. The state is created on first use,
+// so a statically initialized object needs no initialization. Objects lists
+// their addresses sorted, so forget finds the objects of the memory being
+// released without scanning the maps.
+var (
+	conds     = map[uintptr]*cond{}
+	mutexes   = map[uintptr]*mutex{}
+	objects   []uintptr
+	objectsMu sync.Mutex
+)
+
+// search returns the index of the first of objects not below p.
+func search(p uintptr) int {
+	return sort.Search(len(objects), func(i int) bool { return objects[i] >= p })
+}
+
+// addObject records an object at p. objectsMu must be locked.
+func addObject(p uintptr) {
+	i := search(p)
+	if i < len(objects) && objects[i] == p {
+		return
+	}
+
+	objects = append(objects, 0)
+	copy(objects[i+1:], objects[i:])
+	objects[i] = p
+}
+
+// removeObject drops the state of the objects at p. objectsMu must be locked.
+func removeObject(p uintptr) {
+	delete(mutexes, p)
+	delete(conds, p)
+	if i := search(p); i < len(objects) && objects[i] == p {
+		objects = append(objects[:i], objects[i+1:]...)
+	}
+}
+
+// mutexAt returns the state of the pthread_mutex_t at p. The kind of an
+// unlocked mutex is read again, because its memory may have been reused, for
+// example by a stack frame, by a mutex of another kind. The kind is updated
+// only if mutexAt gets the lock of the mutex, so it does not change under an
+// owner.
+func mutexAt(p uintptr) *mutex {
+	objectsMu.Lock()
+	defer objectsMu.Unlock()
+
+	kind := *(*int32)(pointer(p + mutexKind))
+	m := mutexes[p]
+	switch {
+	case m == nil:
+		m = &mutex{kind: kind}
+		mutexes[p] = m
+		addObject(p)
+	case atomic.LoadInt32(&m.kind) != kind && m.TryLock():
+		atomic.StoreInt32(&m.kind, kind)
+		m.Unlock()
+	}
+	return m
+}
+
+// forget drops the state of the mutexes and condition variables in the n
+// bytes at p, which are being released.
+func forget(p, n uintptr) {
+	if n < mutexSize {
+		return
+	}
+
+	objectsMu.Lock()
+	i, j := search(p), search(p+n)
+	for _, k := range objects[i:j] {
+		delete(mutexes, k)
+		delete(conds, k)
+	}
+	objects = append(objects[:i], objects[j:]...)
+	objectsMu.Unlock()
+}
+
+// lock locks m on behalf of the thread id. If try is set, lock fails instead
+// of blocking.
+func (m *mutex) lock(id uintptr, try bool) int32 {
+	if kind := atomic.LoadInt32(&m.kind); kind != mutexNormal && atomic.LoadUintptr(&m.owner) == id {
+		switch {
+		case kind == mutexRecursive:
+			m.count++
+			return 0
+		case try:
+			return int32(syscall.EBUSY)
+		default:
+			return int32(syscall.EDEADLK)
+		}
+	}
+
+	switch {
+	case try:
+		if !m.TryLock() {
+			return int32(syscall.EBUSY)
+		}
+	default:
+		m.Lock()
+	}
+	atomic.StoreUintptr(&m.owner, id)
+	m.count = 1
+	return 0
+}
+
+// unlock unlocks m on behalf of the thread id.
+func (m *mutex) unlock(id uintptr) int32 {
+	if atomic.LoadInt32(&m.kind) != mutexNormal && atomic.LoadUintptr(&m.owner) != id {
+		return int32(syscall.EPERM)
+	}
+
+	if m.count--; m.count == 0 {
+		atomic.StoreUintptr(&m.owner, 0)
+		m.Unlock()
+	}
+	return 0
+}
+
+// int pthread_mutexattr_destroy(pthread_mutexattr_t *attr);
+func Xpthread_mutexattr_destroy(tls *TLS, attr uintptr) int32 { return 0 }
+
+// int pthread_mutexattr_init(pthread_mutexattr_t *attr);
+func Xpthread_mutexattr_init(tls *TLS, attr uintptr) int32 {
+	*(*int32)(pointer(attr)) = mutexNormal
+	return 0
+}
+
+// int pthread_mutexattr_settype(pthread_mutexattr_t *attr, int type);
+func Xpthread_mutexattr_settype(tls *TLS, attr uintptr, typ int32) int32 {
+	switch typ {
+	case mutexNormal, mutexRecursive, mutexErrorCheck:
+		*(*int32)(pointer(attr)) = typ
+		return 0
+	}
+
+	return int32(syscall.EINVAL)
+}
+
+// int pthread_mutex_destroy(pthread_mutex_t *mutex);
+func Xpthread_mutex_destroy(tls *TLS, mutex uintptr) int32 {
+	objectsMu.Lock()
+	defer objectsMu.Unlock()
+
+	if m := mutexes[mutex]; m != nil && atomic.LoadUintptr(&m.owner) != 0 {
+		return int32(syscall.EBUSY)
+	}
+
+	removeObject(mutex)
+	return 0
+}
+
+// int pthread_mutex_init(pthread_mutex_t *mutex, const pthread_mutexattr_t *attr);
+func Xpthread_mutex_init(tls *TLS, mutex, attr uintptr) int32 {
+	kind := int32(mutexNormal)
+	if attr != 0 {
+		kind = *(*int32)(pointer(attr))
+	}
+	copy(mem(mutex, mutexSize), make([]byte, mutexSize))
+	*(*int32)(pointer(mutex + mutexKind)) = kind
+	objectsMu.Lock()
+	removeObject(mutex)
+	objectsMu.Unlock()
+	return 0
+}
+
+// int pthread_mutex_lock(pthread_mutex_t *mutex);
+//
+// A normal mutex is a sync.Mutex, locking it twice by the same thread
+// deadlocks. A recursive mutex counts the locks of its owner, an error
+// checking one reports them.
+func Xpthread_mutex_lock(tls *TLS, mutex uintptr) int32 {
+	return mutexAt(mutex).lock(tls.id, false)
+}
+
+// int pthread_mutex_trylock(pthread_mutex_t *mutex);
+func Xpthread_mutex_trylock(tls *TLS, mutex uintptr) int32 {
+	return mutexAt(mutex).lock(tls.id, true)
+}
+
+// int pthread_mutex_unlock(pthread_mutex_t *mutex);
+func Xpthread_mutex_unlock(tls *TLS, mutex uintptr) int32 {
+	return mutexAt(mutex).unlock(tls.id)
+}
+
+// A cond is the Go state of a pthread_cond_t.
+type cond struct {
+	sync.Mutex
+	waiters []chan struct{} // Closed when signaled.
+}
+
+// condAt returns the state of the pthread_cond_t at p.
+func condAt(p uintptr) *cond {
+	objectsMu.Lock()
+	defer objectsMu.Unlock()
+
+	c := conds[p]
+	if c == nil {
+		c = &cond{}
+		conds[p] = c
+		addObject(p)
+	}
+	return c
+}
+
+// signal wakes up the first waiter of c or all of them.
+func (c *cond) signal(all bool) {
+	c.Lock()
+	n := len(c.waiters)
+	if !all && n > 1 {
+		n = 1
+	}
+	for _, v := range c.waiters[:n] {
+		close(v)
+	}
+	c.waiters = append([]chan struct{}(nil), c.waiters[n:]...)
+	c.Unlock()
+}
+
+// wait unlocks m, waits for c to be signaled or until deadline, if not zero,
+// and locks m again on behalf of the thread id.
+func (c *cond) wait(id uintptr, m *mutex, deadline time.Time) int32 {
+	ch := make(chan struct{})
+	c.Lock()
+	c.waiters = append(c.waiters, ch)
+	c.Unlock()
+	count := m.count
+	m.count = 1
+	if r := m.unlock(id); r != 0 {
+		m.count = count
+		c.remove(ch)
+		return r
+	}
+
+	var r int32
+	switch {
+	case deadline.IsZero():
+		<-ch
+	default:
+		t := time.NewTimer(time.Until(deadline))
+		select {
+		case <-ch:
+		case <-t.C:
+			if c.remove(ch) {
+				r = int32(syscall.ETIMEDOUT)
+			}
+		}
+		t.Stop()
+	}
+	m.lock(id, false)
+	m.count = count
+	return r
+}
+
+// remove removes the waiter ch from c and reports whether it was not signaled.
+func (c *cond) remove(ch chan struct{}) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	for i, v := range c.waiters {
+		if v == ch {
+			c.waiters = append(c.waiters[:i:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// int pthread_cond_broadcast(pthread_cond_t *cond);
+func Xpthread_cond_broadcast(tls *TLS, cond uintptr) int32 {
+	condAt(cond).signal(true)
+	return 0
+}
+
+// int pthread_cond_destroy(pthread_cond_t *cond);
+func Xpthread_cond_destroy(tls *TLS, cond uintptr) int32 {
+	objectsMu.Lock()
+	defer objectsMu.Unlock()
+
+	if c := conds[cond]; c != nil {
+		c.Lock()
+		n := len(c.waiters)
+		c.Unlock()
+		if n != 0 {
+			return int32(syscall.EBUSY)
+		}
+	}
+
+	removeObject(cond)
+	return 0
+}
+
+// int pthread_cond_init(pthread_cond_t *cond, const pthread_condattr_t *attr);
+func Xpthread_cond_init(tls *TLS, cond, attr uintptr) int32 {
+	copy(mem(cond, condSize), make([]byte, condSize))
+	objectsMu.Lock()
+	removeObject(cond)
+	objectsMu.Unlock()
+	return 0
+}
+
+// int pthread_cond_signal(pthread_cond_t *cond);
+func Xpthread_cond_signal(tls *TLS, cond uintptr) int32 {
+	condAt(cond).signal(false)
+	return 0
+}
+
+// int pthread_cond_timedwait(pthread_cond_t *cond, pthread_mutex_t *mutex, const struct timespec *abstime);
+func Xpthread_cond_timedwait(tls *TLS, cond, mutex, abstime uintptr) int32 {
+	ts := (*[2]int64)(pointer(abstime)) // struct timespec of LP64.
+	if ts[1] < 0 || ts[1] >= 1e9 {
+		return int32(syscall.EINVAL)
+	}
+
+	return condAt(cond).wait(tls.id, mutexAt(mutex), time.Unix(ts[0], ts[1]))
+}
+
+// int pthread_cond_wait(pthread_cond_t *cond, pthread_mutex_t *mutex);
+func Xpthread_cond_wait(tls *TLS, cond, mutex uintptr) int32 {
+	return condAt(cond).wait(tls.id, mutexAt(mutex), time.Time{})
+}
+
+// keys holds the destructors of the pthread_key_t objects in use. The values
+// are stored in the TLS of a thread.
+var (
+	keys    = map[uint32]uintptr{}
+	keysMu  sync.Mutex
+	lastKey uint32
+)
+
+// destructor returns the destructor of key and whether key is in use.
+func destructor(key uint32) (uintptr, bool) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	d, ok := keys[key]
+	return d, ok
+}
+
+// int pthread_key_create(pthread_key_t *key, void (*destructor)(void*));
+func Xpthread_key_create(tls *TLS, key, destructor uintptr) int32 {
+	keysMu.Lock()
+	lastKey++
+	k := lastKey
+	keys[k] = destructor
+	keysMu.Unlock()
+	*(*uint32)(pointer(key)) = k
+	return 0
+}
+
+// int pthread_key_delete(pthread_key_t key);
+func Xpthread_key_delete(tls *TLS, key uint32) int32 {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	if _, ok := keys[key]; !ok {
+		return int32(syscall.EINVAL)
+	}
+
+	delete(keys, key)
+	return 0
+}
+
+// void *pthread_getspecific(pthread_key_t key);
+func Xpthread_getspecific(tls *TLS, key uint32) uintptr { return tls.values[key] }
+
+// int pthread_setspecific(pthread_key_t key, const void *value);
+func Xpthread_setspecific(tls *TLS, key uint32, value uintptr) int32 {
+	if _, ok := destructor(key); !ok {
+		return int32(syscall.EINVAL)
+	}
+
+	switch {
+	case value == 0:
+		delete(tls.values, key)
+	default:
+		tls.values[key] = value
+	}
+	return 0
+}
+
+// exit calls the destructors of the thread-specific data of t, in key order,
+// and releases the stack of t.
+func (t *TLS) exit() {
+
+	for i := 0; i < destructorIterations && len(t.values) != 0; i++ {
+		var a []uint32
+		for k := range t.values {
+			a = append(a, k)
+		}
+		sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+		for _, k := range a {
+			v := t.values[k]
+			delete(t.values, k)
+			if d, _ := destructor(k); d != 0 {
+				(*(*func(*TLS, uintptr))(unsafe.Pointer(&d)))(t, v)
+			}
+		}
+	}
+	for len(t.stack) != 0 {
+		t.pop()
+	}
+}
+
+// A pthread is a goroutine created by pthread_create.
+type pthread struct {
+	done   chan struct{} // Closed when the start routine returns.
+	result uintptr
+}
+
+// pthreads holds the joinable threads, keyed by their pthread_t.
+var (
+	pthreads   = map[uintptr]*pthread{}
+	pthreadsMu sync.Mutex
+)
+
+// int pthread_create(pthread_t *thread, const pthread_attr_t *attr, void *(*start_routine) (void *), void *arg);
+//
+// The thread is a new goroutine with a new TLS. The attributes are ignored.
+func Xpthread_create(tls *TLS, thread, attr, startRoutine, arg uintptr) int32 {
+	t := NewTLS()
+	p := &pthread{done: make(chan struct{})}
+	pthreadsMu.Lock()
+	pthreads[t.id] = p
+	pthreadsMu.Unlock()
+	*(*uint64)(pointer(thread)) = uint64(t.id)
+	f := *(*func(*TLS, uintptr) uintptr)(unsafe.Pointer(&startRoutine))
+	go func() {
+		defer close(p.done)
+
+		p.result = f(t, arg)
+		t.exit()
+	}()
+	return 0
+}
+
+// int pthread_detach(pthread_t thread);
+func Xpthread_detach(tls *TLS, thread uint64) int32 {
+	pthreadsMu.Lock()
+	defer pthreadsMu.Unlock()
+
+	if _, ok := pthreads[uintptr(thread)]; !ok {
+		return int32(syscall.ESRCH)
+	}
+
+	delete(pthreads, uintptr(thread))
+	return 0
+}
+
+// int pthread_equal(pthread_t t1, pthread_t t2);
+func Xpthread_equal(tls *TLS, t1, t2 uint64) int32 { return Bool32(t1 == t2) }
+
+// int pthread_join(pthread_t thread, void **retval);
+func Xpthread_join(tls *TLS, thread uint64, retval uintptr) int32 {
+	if uintptr(thread) == tls.id {
+		return int32(syscall.EDEADLK)
+	}
+
+	pthreadsMu.Lock()
+	p := pthreads[uintptr(thread)]
+	delete(pthreads, uintptr(thread))
+	pthreadsMu.Unlock()
+	if p == nil {
+		return int32(syscall.ESRCH)
+	}
+
+	<-p.done
+	if retval != 0 {
+		*(*uintptr)(pointer(retval)) = p.result
+	}
+	return 0
+}
+
+// pthread_t pthread_self(void);
+func Xpthread_self(tls *TLS) uint64 { return uint64(tls.id) }
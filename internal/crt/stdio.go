@@ -0,0 +1,125 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+import (
+	"os"
+	"sync"
+)
+
+// A FILE is an opaque C object. Its Go state is in files, keyed by its
+// address.
+var (
+	files   = map[uintptr]*os.File{}
+	filesMu sync.Mutex
+)
+
+var (
+	// FILE *stdin, *stdout, *stderr;
+	Xstdin  = stream(os.Stdin)
+	Xstdout = stream(os.Stdout)
+	Xstderr = stream(os.Stderr)
+)
+
+// stream returns the address of a FILE * variable pointing to a new FILE
+// writing to f.
+func stream(f *os.File) uintptr {
+	p := alloc(8)
+	filesMu.Lock()
+	files[p] = f
+	filesMu.Unlock()
+	v := alloc(8)
+	*(*uintptr)(pointer(v)) = p
+	return v
+}
+
+// write writes b to the FILE at stream and returns the number of bytes
+// written.
+func write(tls *TLS, stream uintptr, b []byte) int {
+	filesMu.Lock()
+	f := files[stream]
+	filesMu.Unlock()
+	if f == nil {
+		panic("invalid FILE")
+	}
+
+	n, err := f.Write(b)
+	if err != nil {
+		tls.setErrno(err)
+	}
+	return n
+}
+
+// int fflush(FILE *stream);
+func Xfflush(tls *TLS, stream uintptr) int32 { return 0 }
+
+// int fprintf(FILE *stream, const char *format, ...);
+func Xfprintf(tls *TLS, stream, format, va uintptr) int32 {
+	return Xvfprintf(tls, stream, format, va)
+}
+
+// int fputc(int c, FILE *stream);
+func Xfputc(tls *TLS, c int32, stream uintptr) int32 {
+	if write(tls, stream, []byte{byte(c)}) != 1 {
+		return -1 // EOF
+	}
+
+	return int32(byte(c))
+}
+
+// int fputs(const char *s, FILE *stream);
+func Xfputs(tls *TLS, s, stream uintptr) int32 {
+	n := int(Xstrlen(tls, s))
+	if write(tls, stream, mem(s, n)) != n {
+		return -1 // EOF
+	}
+
+	return 0
+}
+
+// size_t fwrite(const void *ptr, size_t size, size_t nmemb, FILE *stream);
+func Xfwrite(tls *TLS, ptr uintptr, size, nmemb uint64, stream uintptr) uint64 {
+	if size == 0 {
+		return 0
+	}
+
+	return uint64(write(tls, stream, mem(ptr, int(size*nmemb)))) / size
+}
+
+// int printf(const char *format, ...);
+func Xprintf(tls *TLS, format, va uintptr) int32 {
+	return Xvprintf(tls, format, va)
+}
+
+// int putc(int c, FILE *stream);
+func Xputc(tls *TLS, c int32, stream uintptr) int32 { return Xfputc(tls, c, stream) }
+
+// int putchar(int c);
+func Xputchar(tls *TLS, c int32) int32 { return Xfputc(tls, c, *(*uintptr)(pointer(Xstdout))) }
+
+// int puts(const char *s);
+func Xputs(tls *TLS, s uintptr) int32 {
+	stdout := *(*uintptr)(pointer(Xstdout))
+	if Xfputs(tls, s, stdout) < 0 {
+		return -1 // EOF
+	}
+
+	return Xfputc(tls, '\n', stdout)
+}
+
+// int vfprintf(FILE *stream, const char *format, va_list ap);
+func Xvfprintf(tls *TLS, stream, format, ap uintptr) int32 {
+	b, ok := printf(format, &ap)
+	if ok && write(tls, stream, b) != len(b) {
+		return -1
+	}
+
+	return output(tls, b, ok)
+}
+
+// int vprintf(const char *format, va_list ap);
+func Xvprintf(tls *TLS, format, ap uintptr) int32 {
+	return Xvfprintf(tls, *(*uintptr)(pointer(Xstdout)), format, ap)
+}
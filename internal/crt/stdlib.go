@@ -0,0 +1,90 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// void abort(void);
+func Xabort(tls *TLS) { panic("abort") }
+
+// int abs(int j);
+func Xabs(tls *TLS, j int32) int32 {
+	if j < 0 {
+		return -j
+	}
+
+	return j
+}
+
+// int atoi(const char *nptr);
+func Xatoi(tls *TLS, nptr uintptr) int32 { return int32(Xatol(tls, nptr)) }
+
+// long atol(const char *nptr);
+func Xatol(tls *TLS, nptr uintptr) int64 {
+	s := strings.TrimLeft(GoString(nptr), " \t\n\v\f\r")
+	i := 0
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.ParseInt(s[:i], 10, 64)
+	return n
+}
+
+// void exit(int status);
+func Xexit(tls *TLS, status int32) { os.Exit(int(status)) }
+
+// char *getenv(const char *name);
+func Xgetenv(tls *TLS, name uintptr) uintptr {
+	s, ok := os.LookupEnv(GoString(name))
+	if !ok {
+		return 0
+	}
+
+	return cstring(s)
+}
+
+type sorter struct {
+	base uintptr
+	cmp  func(*TLS, uintptr, uintptr) int32
+	n    int
+	size uintptr
+	tls  *TLS
+	tmp  []byte
+}
+
+func (s *sorter) Len() int { return s.n }
+
+func (s *sorter) Less(i, j int) bool {
+	return s.cmp(s.tls, s.base+uintptr(i)*s.size, s.base+uintptr(j)*s.size) < 0
+}
+
+func (s *sorter) Swap(i, j int) {
+	a, b := mem(s.base+uintptr(i)*s.size, int(s.size)), mem(s.base+uintptr(j)*s.size, int(s.size))
+	copy(s.tmp, a)
+	copy(a, b)
+	copy(b, s.tmp)
+}
+
+// void qsort(void *base, size_t nmemb, size_t size, int (*compar)(const void *, const void *));
+func Xqsort(tls *TLS, base uintptr, nmemb, size uint64, compar uintptr) {
+	s := &sorter{
+		base: base,
+		cmp:  *(*func(*TLS, uintptr, uintptr) int32)(unsafe.Pointer(&compar)),
+		n:    int(nmemb),
+		size: uintptr(size),
+		tls:  tls,
+		tmp:  make([]byte, size),
+	}
+	sort.Stable(s)
+}
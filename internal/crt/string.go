@@ -0,0 +1,192 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// at returns the byte at p.
+func at(p uintptr) byte { return *(*byte)(pointer(p)) }
+
+// void *memchr(const void *s, int c, size_t n);
+func Xmemchr(tls *TLS, s uintptr, c int32, n uint64) uintptr {
+	if i := bytes.IndexByte(mem(s, int(n)), byte(c)); i >= 0 {
+		return s + uintptr(i)
+	}
+
+	return 0
+}
+
+// int memcmp(const void *s1, const void *s2, size_t n);
+func Xmemcmp(tls *TLS, s1, s2 uintptr, n uint64) int32 {
+	a, b := mem(s1, int(n)), mem(s2, int(n))
+	for i, v := range a {
+		if w := b[i]; v != w {
+			return int32(v) - int32(w)
+		}
+	}
+	return 0
+}
+
+// void *memcpy(void *dest, const void *src, size_t n);
+func Xmemcpy(tls *TLS, dest, src uintptr, n uint64) uintptr {
+	copy(mem(dest, int(n)), mem(src, int(n)))
+	return dest
+}
+
+// void *memmove(void *dest, const void *src, size_t n);
+func Xmemmove(tls *TLS, dest, src uintptr, n uint64) uintptr {
+	copy(mem(dest, int(n)), mem(src, int(n)))
+	return dest
+}
+
+// void *memset(void *s, int c, size_t n);
+func Xmemset(tls *TLS, s uintptr, c int32, n uint64) uintptr {
+	b := mem(s, int(n))
+	for i := range b {
+		b[i] = byte(c)
+	}
+	return s
+}
+
+// char *strcat(char *dest, const char *src);
+func Xstrcat(tls *TLS, dest, src uintptr) uintptr {
+	Xstrcpy(tls, dest+uintptr(Xstrlen(tls, dest)), src)
+	return dest
+}
+
+// char *strchr(const char *s, int c);
+func Xstrchr(tls *TLS, s uintptr, c int32) uintptr {
+	for ; ; s++ {
+		switch at(s) {
+		case byte(c):
+			return s
+		case 0:
+			return 0
+		}
+	}
+}
+
+// int strcmp(const char *s1, const char *s2);
+func Xstrcmp(tls *TLS, s1, s2 uintptr) int32 {
+	for {
+		a, b := at(s1), at(s2)
+		if a != b || a == 0 {
+			return int32(a) - int32(b)
+		}
+
+		s1++
+		s2++
+	}
+}
+
+// char *strcpy(char *dest, const char *src);
+func Xstrcpy(tls *TLS, dest, src uintptr) uintptr {
+	n := Xstrlen(tls, src) + 1
+	copy(mem(dest, int(n)), mem(src, int(n)))
+	return dest
+}
+
+// size_t strcspn(const char *s, const char *reject);
+func Xstrcspn(tls *TLS, s, reject uintptr) uint64 {
+	r := mem(reject, int(Xstrlen(tls, reject)))
+	var n uint64
+	for ; ; n++ {
+		if c := at(s + uintptr(n)); c == 0 || bytes.IndexByte(r, c) >= 0 {
+			return n
+		}
+	}
+}
+
+// char *strdup(const char *s);
+func Xstrdup(tls *TLS, s uintptr) uintptr {
+	n := Xstrlen(tls, s) + 1
+	p := Xmalloc(tls, n)
+	if p != 0 {
+		copy(mem(p, int(n)), mem(s, int(n)))
+	}
+	return p
+}
+
+// char *strerror(int errnum);
+func Xstrerror(tls *TLS, errnum int32) uintptr {
+	return cstring(syscall.Errno(errnum).Error())
+}
+
+// size_t strlen(const char *s);
+func Xstrlen(tls *TLS, s uintptr) uint64 {
+	var n uint64
+	for ; at(s) != 0; s++ {
+		n++
+	}
+	return n
+}
+
+// int strncmp(const char *s1, const char *s2, size_t n);
+func Xstrncmp(tls *TLS, s1, s2 uintptr, n uint64) int32 {
+	for ; n != 0; n-- {
+		a, b := at(s1), at(s2)
+		if a != b || a == 0 {
+			return int32(a) - int32(b)
+		}
+
+		s1++
+		s2++
+	}
+	return 0
+}
+
+// char *strncpy(char *dest, const char *src, size_t n);
+func Xstrncpy(tls *TLS, dest, src uintptr, n uint64) uintptr {
+	d := mem(dest, int(n))
+	i := 0
+	for ; i < len(d); i++ {
+		if d[i] = at(src + uintptr(i)); d[i] == 0 {
+			break
+		}
+	}
+	for ; i < len(d); i++ {
+		d[i] = 0
+	}
+	return dest
+}
+
+// char *strrchr(const char *s, int c);
+func Xstrrchr(tls *TLS, s uintptr, c int32) uintptr {
+	var r uintptr
+	for ; ; s++ {
+		switch at(s) {
+		case byte(c):
+			if r = s; c == 0 {
+				return r
+			}
+		case 0:
+			return r
+		}
+	}
+}
+
+// size_t strspn(const char *s, const char *accept);
+func Xstrspn(tls *TLS, s, accept uintptr) uint64 {
+	a := mem(accept, int(Xstrlen(tls, accept)))
+	var n uint64
+	for ; ; n++ {
+		if c := at(s + uintptr(n)); c == 0 || bytes.IndexByte(a, c) < 0 {
+			return n
+		}
+	}
+}
+
+// char *strstr(const char *haystack, const char *needle);
+func Xstrstr(tls *TLS, haystack, needle uintptr) uintptr {
+	h := mem(haystack, int(Xstrlen(tls, haystack)))
+	if i := bytes.Index(h, mem(needle, int(Xstrlen(tls, needle)))); i >= 0 {
+		return haystack + uintptr(i)
+	}
+
+	return 0
+}
@@ -0,0 +1,330 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build ignore
+// +build ignore
+
+// Generate writes to stdout the printf conformance table used by TestPrintf.
+// Every line holds, separated by tabs, a Go quoted format string, the value
+// snprintf returns for it, the Go quoted output and the arguments. An argument
+// is a kind and a value separated by a colon:
+//
+//	i	int
+//	u	unsigned
+//	l	long
+//	L	unsigned long
+//	f	double, as Go formats it using 'x', or inf, -inf, nan and -nan
+//	D	long double, like f
+//	s	char *, a Go quoted string
+//	w	wchar_t *, a Go quoted string
+//	p	void *, in hexadecimal
+//
+// Usage, from internal/crt:
+//
+//	go run testdata/printf/generate.go [-cc compiler] > testdata/printf/glibc.txt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var oCC = flag.String("cc", "gcc", "C compiler")
+
+type arg struct {
+	kind byte
+	v    interface{}
+}
+
+// c returns a as a C expression.
+func (a arg) c() string {
+	switch a.kind {
+	case 'i':
+		return fmt.Sprintf("(int)%dLL", a.v)
+	case 'u':
+		return fmt.Sprintf("%du", a.v)
+	case 'l':
+		if fmt.Sprint(a.v) == fmt.Sprint(int64(math.MinInt64)) {
+			return "(long)(-9223372036854775807L - 1)"
+		}
+
+		return fmt.Sprintf("%dL", a.v)
+	case 'L':
+		return fmt.Sprintf("%dUL", a.v)
+	case 'D':
+		return "(long double)" + arg{'f', a.v}.c()
+	case 'f':
+		v := a.v.(float64)
+		switch {
+		case math.IsInf(v, 1):
+			return "__builtin_inf()"
+		case math.IsInf(v, -1):
+			return "-__builtin_inf()"
+		case math.IsNaN(v) && math.Signbit(v):
+			return "-__builtin_nan(\"\")"
+		case math.IsNaN(v):
+			return "__builtin_nan(\"\")"
+		}
+
+		return strconv.FormatFloat(v, 'x', -1, 64)
+	case 's':
+		return cString(a.v.(string))
+	case 'w':
+		return wString(a.v.(string))
+	case 'p':
+		return fmt.Sprintf("(void *)%#xUL", a.v)
+	}
+	panic(a.kind)
+}
+
+// String returns a as it appears in the table.
+func (a arg) String() string {
+	switch a.kind {
+	case 'f', 'D':
+		v := a.v.(float64)
+		s := strconv.FormatFloat(v, 'x', -1, 64)
+		switch {
+		case math.IsInf(v, 1):
+			s = "inf"
+		case math.IsInf(v, -1):
+			s = "-inf"
+		case math.IsNaN(v) && math.Signbit(v):
+			s = "-nan"
+		case math.IsNaN(v):
+			s = "nan"
+		}
+		return fmt.Sprintf("%c:%s", a.kind, s)
+	case 's', 'w':
+		return fmt.Sprintf("%c:%q", a.kind, a.v)
+	case 'p':
+		return fmt.Sprintf("p:%#x", a.v)
+	}
+	return fmt.Sprintf("%c:%d", a.kind, a.v)
+}
+
+// cString returns s as a C string literal.
+func cString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			fmt.Fprintf(&b, "\\%c", c)
+		case c < ' ' || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%x\"\"", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// wString returns s as a C wide string literal.
+func wString(s string) string {
+	var b strings.Builder
+	b.WriteString("L\"")
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			fmt.Fprintf(&b, "\\%c", c)
+		case c < ' ' || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%x\"L\"", c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+type test struct {
+	format string
+	args   []arg
+}
+
+var tests []test
+
+func add(format string, args ...arg) { tests = append(tests, test{format, args}) }
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+
+	integers()
+	floats()
+	others()
+
+	dir, err := ioutil.TempDir("", "printf-")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	var b strings.Builder
+	b.WriteString("#include <stdio.h>\n#include <wchar.h>\n\nstatic char buf[4096];\n\nstatic void dump(int n) {\n\tint i;\n\n\tprintf(\"%d\\t\", n);\n\tfor (i = 0; i < n && i < sizeof buf; i++)\n\t\tprintf(\"%02x\", (unsigned char)buf[i]);\n\tprintf(\"\\n\");\n}\n\nint main() {\n")
+	for _, v := range tests {
+		a := []string{"buf", "sizeof buf", cString(v.format)}
+		for _, w := range v.args {
+			a = append(a, w.c())
+		}
+		fmt.Fprintf(&b, "\tdump(snprintf(%s));\n", strings.Join(a, ", "))
+	}
+	b.WriteString("}\n")
+	out := strings.Split(strings.TrimSpace(run(dir, b.String())), "\n")
+	if len(out) != len(tests) {
+		log.Fatalf("got %d results for %d tests", len(out), len(tests))
+	}
+
+	version, err := exec.Command(*oCC, "--version").Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("# Generated by generate.go using %s on %s/%s. DO NOT EDIT.\n", strings.SplitN(string(version), "\n", 2)[0], runtime.GOOS, runtime.GOARCH)
+	for i, v := range tests {
+		f := strings.Split(out[i], "\t")
+		var s []byte
+		for j := 0; j+1 < len(f[1]); j += 2 {
+			n, err := strconv.ParseUint(f[1][j:j+2], 16, 8)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			s = append(s, byte(n))
+		}
+		a := []string{strconv.Quote(v.format), f[0], strconv.Quote(string(s))}
+		for _, w := range v.args {
+			a = append(a, w.String())
+		}
+		fmt.Println(strings.Join(a, "\t"))
+	}
+}
+
+// run compiles and executes the C program src.
+func run(dir, src string) string {
+	fn := filepath.Join(dir, "main.c")
+	if err := ioutil.WriteFile(fn, []byte(src), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	bin := filepath.Join(dir, "main")
+	if out, err := exec.Command(*oCC, "-w", "-o", bin, fn).CombinedOutput(); err != nil {
+		log.Fatalf("%s\n%v", out, err)
+	}
+
+	out, err := exec.Command(bin).Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return string(out)
+}
+
+func integers() {
+	flags := []string{"", "-", "+", " ", "#", "0", "-0", "+0", " 0", "#0", "+ ", "-#"}
+	widths := []string{"", "8"}
+	precs := []string{"", ".0", ".3"}
+	signed := []int64{0, 1, -1, 42, -42, 255, 65535, math.MaxInt32, math.MinInt32, math.MaxInt64, math.MinInt64}
+	for _, c := range "diuoxX" {
+		for _, fl := range flags {
+			for _, w := range widths {
+				for _, p := range precs {
+					for _, v := range []int64{0, -42} {
+						add(fmt.Sprintf("|%%%s%s%s%c|", fl, w, p, c), arg{'i', v})
+					}
+				}
+			}
+		}
+		for _, lm := range []string{"hh", "h", "", "l", "ll", "j", "z", "t"} {
+			for _, v := range signed {
+				a := arg{'l', v}
+				if lm == "hh" || lm == "h" || lm == "" {
+					a = arg{'i', int64(int32(v))}
+				}
+				add(fmt.Sprintf("%%%s%c", lm, c), a)
+				if lm == "hh" || lm == "l" {
+					add(fmt.Sprintf("%%#+12.5%s%c", lm, c), a)
+				}
+			}
+		}
+	}
+	add("%lu %lx", arg{'L', uint64(math.MaxUint64)}, arg{'L', uint64(math.MaxUint64)})
+	add("%u %x %o", arg{'u', uint64(math.MaxUint32)}, arg{'u', uint64(math.MaxUint32)}, arg{'u', uint64(math.MaxUint32)})
+}
+
+func floats() {
+	values := []float64{
+		0, math.Copysign(0, -1), 1, -1, 0.5, 1.5, 2.5, 0.1, 1.0 / 3,
+		9.9999999, 99.95, 123456.789, 0.000123456, 1e15, 1e17, 1e-300,
+		1e300, math.MaxFloat64, math.SmallestNonzeroFloat64,
+		2.2250738585072014e-308, 0x1.fffffffffffffp0, 0x1.08p0, 0x1.18p0,
+		math.Inf(1), math.Inf(-1), math.NaN(), math.Copysign(math.NaN(), -1),
+	}
+	flagged := []float64{0, -1, 1.5, 0.1, 123456.789, 1e-300, math.Inf(-1), math.NaN()}
+	for _, c := range "feEgGaA" {
+		for _, v := range values {
+			for _, p := range []string{"", ".0", ".1", ".3", ".17"} {
+				add(fmt.Sprintf("%%%s%c", p, c), arg{'f', v})
+			}
+		}
+		for _, v := range flagged {
+			for _, fl := range []string{"-", "+", " ", "#", "0", "+0"} {
+				for _, p := range []string{"", ".2"} {
+					add(fmt.Sprintf("|%%%s12%s%c|", fl, p, c), arg{'f', v})
+				}
+			}
+		}
+	}
+	add("%F %F %F", arg{'f', 1.5}, arg{'f', math.Inf(1)}, arg{'f', math.NaN()})
+	// Not %La, glibc formats the x87 extended precision as 0x8p-3.
+	add("%Lf %Le %Lg", arg{'D', 1.5}, arg{'D', -0.1}, arg{'D', 1e100})
+	add("%.300f", arg{'f', 1e-300})
+	add("%.40e|%.40g|%.40a", arg{'f', 0.1}, arg{'f', 0.1}, arg{'f', 0.1})
+}
+
+func others() {
+	for _, fl := range []string{"", "-", "0", "#", "+", " "} {
+		for _, w := range []string{"", "3", "10"} {
+			for _, p := range []string{"", ".0", ".2", ".10"} {
+				add(fmt.Sprintf("|%%%s%s%ss|", fl, w, p), arg{'s', "hello"})
+				add(fmt.Sprintf("|%%%s%s%sls|", fl, w, p), arg{'w', "wide"})
+			}
+			add(fmt.Sprintf("|%%%s%sc|", fl, w), arg{'i', 'x'})
+			add(fmt.Sprintf("|%%%s%slc|", fl, w), arg{'i', 'y'})
+			for _, v := range []uint64{0, 0x1234, 0xdeadbeefcafe} {
+				add(fmt.Sprintf("|%%%s%sp|", fl, w), arg{'p', v})
+			}
+		}
+	}
+	add("%s", arg{'s', ""})
+	add("%s|%5s|%-5s|", arg{'s', "a\tb"}, arg{'s', "\xff"}, arg{'s', "xy"})
+	add("%c%c%c", arg{'i', 0x41}, arg{'i', 0x142}, arg{'i', -1})
+	add("%ls", arg{'w', "caf\u00e9"})
+	add("%lc", arg{'i', 0xe9})
+	add("%%|%5%|%-5%|")
+	add("no conversions")
+	add("")
+	add("%*d|%-*d|%*d", arg{'i', 6}, arg{'i', 42}, arg{'i', 6}, arg{'i', 42}, arg{'i', -6}, arg{'i', 42})
+	add("%.*d|%.*d|%*.*f", arg{'i', 5}, arg{'i', 42}, arg{'i', -5}, arg{'i', 42}, arg{'i', 10}, arg{'i', 3}, arg{'f', 3.14159})
+	add("%.*s|%.*f", arg{'i', 3}, arg{'s', "abcdef"}, arg{'i', -1}, arg{'f', 1.5})
+	add("%d %s %5.2f|%-4c|%x", arg{'i', -7}, arg{'s', "mixed"}, arg{'f', 2.675}, arg{'i', 'z'}, arg{'i', 255})
+	add("%hhd %hhu %hd %hu", arg{'i', 300}, arg{'i', -1}, arg{'i', 70000}, arg{'i', -1})
+	add("%5.3d|%-8.5x|%08.3u", arg{'i', 7}, arg{'i', 0xab}, arg{'i', 9})
+	add("%#.0o|%#.0x|%#o|%#x", arg{'i', 0}, arg{'i', 0}, arg{'i', 0}, arg{'i', 0})
+	add("%.0d|%5.0d|%+.0d|% .0d", arg{'i', 0}, arg{'i', 0}, arg{'i', 0}, arg{'i', 0})
+	add("%qd %Ld %Zd", arg{'l', -1}, arg{'l', -2}, arg{'l', -3})
+	add("%'d", arg{'i', 1234567})
+	add("%y|%5k|%")
+}
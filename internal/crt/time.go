@@ -0,0 +1,86 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+import (
+	"time"
+	"unsafe"
+)
+
+// struct tm of LP64.
+type tm struct {
+	sec, min, hour, mday, mon, year, wday, yday, isdst int32
+	gmtoff                                             int64
+	zone                                               uintptr
+}
+
+// struct timeval of LP64.
+type timeval struct {
+	sec, usec int64
+}
+
+// localtime holds the result of localtime.
+var localtime = alloc(int(unsafe.Sizeof(tm{})))
+
+// setTm stores t at the struct tm at p.
+func setTm(p uintptr, t time.Time) {
+	zone, off := t.Zone()
+	isdst := int32(0)
+	if t.IsDST() {
+		isdst = 1
+	}
+	*(*tm)(pointer(p)) = tm{
+		sec:    int32(t.Second()),
+		min:    int32(t.Minute()),
+		hour:   int32(t.Hour()),
+		mday:   int32(t.Day()),
+		mon:    int32(t.Month() - 1),
+		year:   int32(t.Year() - 1900),
+		wday:   int32(t.Weekday()),
+		yday:   int32(t.YearDay() - 1),
+		isdst:  isdst,
+		gmtoff: int64(off),
+		zone:   cstring(zone),
+	}
+}
+
+// int gettimeofday(struct timeval *tv, struct timezone *tz);
+func Xgettimeofday(tls *TLS, tv, tz uintptr) int32 {
+	if tv != 0 {
+		n := time.Now().UnixNano()
+		*(*timeval)(pointer(tv)) = timeval{n / 1e9, n % 1e9 / 1e3}
+	}
+	return 0
+}
+
+// struct tm *localtime(const time_t *timep);
+func Xlocaltime(tls *TLS, timep uintptr) uintptr { return Xlocaltime_r(tls, timep, localtime) }
+
+// struct tm *localtime_r(const time_t *timep, struct tm *result);
+func Xlocaltime_r(tls *TLS, timep, result uintptr) uintptr {
+	setTm(result, time.Unix(*(*int64)(pointer(timep)), 0))
+	return result
+}
+
+// unsigned int sleep(unsigned int seconds);
+func Xsleep(tls *TLS, seconds uint32) uint32 {
+	time.Sleep(time.Duration(seconds) * time.Second)
+	return 0
+}
+
+// time_t time(time_t *tloc);
+func Xtime(tls *TLS, tloc uintptr) int64 {
+	t := time.Now().Unix()
+	if tloc != 0 {
+		*(*int64)(pointer(tloc)) = t
+	}
+	return t
+}
+
+// int usleep(useconds_t usec);
+func Xusleep(tls *TLS, usec uint32) int32 {
+	time.Sleep(time.Duration(usec) * time.Microsecond)
+	return 0
+}
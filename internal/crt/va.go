@@ -0,0 +1,37 @@
+// Copyright 2017 The SQLite2Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crt
+
+// A va_list is the address of the variadic arguments of a call, each stored
+// in an 8 byte slot after the default argument promotions. The argument is at
+// the start of its slot, having the Go type of its promoted C type: int32,
+// uint32, int64, uint64, float64 or uintptr. The VA functions read the next
+// argument and advance ap.
+
+// va returns the address of the next variadic argument and advances ap.
+func va(ap *uintptr) uintptr {
+	p := *ap
+	*ap += 8
+	return p
+}
+
+// VAInt32 returns the next variadic argument of type int.
+func VAInt32(ap *uintptr) int32 { return *(*int32)(pointer(va(ap))) }
+
+// VAUint32 returns the next variadic argument of type unsigned.
+func VAUint32(ap *uintptr) uint32 { return *(*uint32)(pointer(va(ap))) }
+
+// VAInt64 returns the next variadic argument of type long or long long.
+func VAInt64(ap *uintptr) int64 { return *(*int64)(pointer(va(ap))) }
+
+// VAUint64 returns the next variadic argument of type unsigned long or
+// unsigned long long.
+func VAUint64(ap *uintptr) uint64 { return *(*uint64)(pointer(va(ap))) }
+
+// VAFloat64 returns the next variadic argument of type double.
+func VAFloat64(ap *uintptr) float64 { return *(*float64)(pointer(va(ap))) }
+
+// VAUintptr returns the next variadic argument of a pointer type.
+func VAUintptr(ap *uintptr) uintptr { return *(*uintptr)(pointer(va(ap))) }